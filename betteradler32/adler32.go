@@ -0,0 +1,136 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package betteradler32 implements the Adler-32 checksum as defined in RFC
+// 1950, with a digest whose state can be saved and restored, and a rolling
+// variant over a fixed window for rsync-style block matching.
+package betteradler32
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("betteradler32: invalid state")
+
+const (
+	// mod is the largest prime that is less than 65536.
+	mod = 65521
+	// nmax is the largest n such that
+	// 255 * n * (n+1) / 2 + (n+1) * (mod-1) <= 2^32-1.
+	// It is mentioned in RFC 1950 (search for "5552").
+	nmax = 5552
+)
+
+// The size of an Adler-32 checksum in bytes.
+const Size = 4
+
+// The state format is
+//
+//	"ba32" || version || uint32 big-endian checksum
+const (
+	stateMagic   = "ba32"
+	stateVersion = 1
+	stateSize    = len(stateMagic) + 1 + 4
+)
+
+// Digest represents the partial evaluation of a checksum. The low 16 bits
+// are s1, the high 16 bits are s2.
+type Digest struct {
+	d uint32
+}
+
+// New returns a new hash.Hash32 computing the Adler-32 checksum.
+func New() *Digest {
+	return &Digest{d: 1}
+}
+
+// NewFromState returns a new hash.Hash32 computing the Adler-32 checksum
+// from existing state.
+func NewFromState(state []byte) *Digest {
+	d := New()
+	d.SetState(state)
+	return d
+}
+
+func (d *Digest) Reset() { d.d = 1 }
+
+func (d *Digest) Size() int { return Size }
+
+func (d *Digest) BlockSize() int { return 4 }
+
+func (d *Digest) Write(p []byte) (int, error) {
+	d.d = update(d.d, p)
+	return len(p), nil
+}
+
+func (d *Digest) Sum32() uint32 { return d.d }
+
+func (d *Digest) Sum(in []byte) []byte {
+	return binary.BigEndian.AppendUint32(in, d.d)
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *Digest) GetState() []byte {
+	b := make([]byte, 0, stateSize)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	return binary.BigEndian.AppendUint32(b, d.d)
+}
+
+// SetState restores the digest from state returned by GetState. It returns
+// ErrInvalidState and leaves the digest unchanged if state is not valid.
+func (d *Digest) SetState(state []byte) error {
+	if len(state) != stateSize || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	s := binary.BigEndian.Uint32(state[len(stateMagic)+1:])
+	if s&0xffff >= mod || s>>16 >= mod {
+		return ErrInvalidState
+	}
+	d.d = s
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *Digest) Clone() *Digest {
+	c := *d
+	return &c
+}
+
+// Add p to the running checksum d.
+func update(d uint32, p []byte) uint32 {
+	s1, s2 := d&0xffff, d>>16
+	for len(p) > 0 {
+		var q []byte
+		if len(p) > nmax {
+			p, q = p[:nmax], p[nmax:]
+		}
+		for len(p) >= 4 {
+			s1 += uint32(p[0])
+			s2 += s1
+			s1 += uint32(p[1])
+			s2 += s1
+			s1 += uint32(p[2])
+			s2 += s1
+			s1 += uint32(p[3])
+			s2 += s1
+			p = p[4:]
+		}
+		for _, x := range p {
+			s1 += uint32(x)
+			s2 += s1
+		}
+		s1 %= mod
+		s2 %= mod
+		p = q
+	}
+	return s2<<16 | s1
+}
+
+// Checksum returns the Adler-32 checksum of data.
+func Checksum(data []byte) uint32 { return update(1, data) }
@@ -0,0 +1,63 @@
+package betteradler32
+
+import (
+	"hash"
+	"hash/adler32"
+	"testing"
+)
+
+var _ hash.Hash32 = (*Digest)(nil)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>5)
+	}
+	return data
+}
+
+func TestDigest(t *testing.T) {
+	data := testData(20000)
+	data[100] = 0xff
+
+	for _, split := range []int{0, 1, 5552, 5553, 10000, 20000} {
+		want := adler32.Checksum(data)
+
+		d := New()
+		d.Write(data[:split])
+
+		r := NewFromState(d.GetState())
+		r.Write(data[split:])
+		if r.Sum32() != want {
+			t.Fatalf("%d: Sum32 = %08x want %08x", split, r.Sum32(), want)
+		}
+
+		c := d.Clone()
+		c.Write(data[split:])
+		if c.Sum32() != want || Checksum(data) != want {
+			t.Fatalf("%d: Clone or Checksum mismatch", split)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := New()
+	d.Write([]byte("keep"))
+	want := d.Sum32()
+	state := d.GetState()
+
+	bad := map[string][]byte{
+		"empty":     nil,
+		"truncated": state[:len(state)-1],
+		"version":   append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+		"range":     append(append([]byte(nil), state[:stateSize-2]...), 0xff, 0xff),
+	}
+	for name, bad := range bad {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if d.Sum32() != want {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
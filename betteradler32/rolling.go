@@ -0,0 +1,155 @@
+package betteradler32
+
+import (
+	"encoding/binary"
+)
+
+// The rolling state format is
+//
+//	"bar1" || version || uint32 window || uint64 count || uint32 checksum || window bytes, oldest first
+//
+// with integers in big-endian, where the window holds the last
+// min(count, window) bytes.
+const (
+	rollingMagic   = "bar1"
+	rollingVersion = 1
+	rollingHeader  = len(rollingMagic) + 1 + 4 + 8 + 4
+)
+
+// RollingHash is the Adler-32 checksum of the last Window bytes written to
+// it, updated in constant time per byte as the window slides.
+type RollingHash struct {
+	window int
+	buf    []byte
+	pos    int
+	count  uint64
+	s1, s2 uint32
+}
+
+// NewRollingHash returns a RollingHash over a window of window bytes. It
+// panics if window is not positive.
+func NewRollingHash(window int) *RollingHash {
+	if window <= 0 {
+		panic("betteradler32.NewRollingHash: window must be positive")
+	}
+
+	return &RollingHash{
+		window: window,
+		buf:    make([]byte, window),
+		s1:     1,
+	}
+}
+
+// Window returns the size of the window.
+func (r *RollingHash) Window() int { return r.window }
+
+// Count returns the total number of bytes written or rolled in.
+func (r *RollingHash) Count() uint64 { return r.count }
+
+// Full reports whether a whole window has been written.
+func (r *RollingHash) Full() bool { return r.count >= uint64(r.window) }
+
+// Write adds the bytes of p one after another, sliding the window once it
+// is full. It never returns an error.
+func (r *RollingHash) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if r.Full() {
+			r.Roll(r.buf[r.pos], c)
+			continue
+		}
+		r.s1 = (r.s1 + uint32(c)) % mod
+		r.s2 = (r.s2 + r.s1) % mod
+		r.buf[r.pos] = c
+		r.pos = (r.pos + 1) % r.window
+		r.count++
+	}
+	return len(p), nil
+}
+
+// Roll slides a full window by one byte: out leaves the window and in
+// enters it. out must be the oldest byte of the window, as returned by
+// Oldest, or the checksum no longer matches the window. Roll panics if the
+// window is not full.
+func (r *RollingHash) Roll(out, in byte) {
+	if !r.Full() {
+		panic("betteradler32.Roll: window is not full")
+	}
+
+	n := uint32(r.window % mod)
+	r.s1 = (r.s1 + mod - uint32(out) + uint32(in)) % mod
+	r.s2 = (r.s2 + mod - n*uint32(out)%mod + r.s1 + mod - 1) % mod
+	r.buf[r.pos] = in
+	r.pos = (r.pos + 1) % r.window
+	r.count++
+}
+
+// Oldest returns the byte that the next Roll removes from a full window.
+func (r *RollingHash) Oldest() byte { return r.buf[r.pos] }
+
+// Sum32 returns the Adler-32 checksum of the window, or of all bytes written
+// while the window is not yet full.
+func (r *RollingHash) Sum32() uint32 { return r.s2<<16 | r.s1 }
+
+// Reset empties the window.
+func (r *RollingHash) Reset() {
+	r.pos = 0
+	r.count = 0
+	r.s1, r.s2 = 1, 0
+}
+
+// GetState returns the state of r, including the window bytes, so that a
+// scan can be resumed with SetState without rereading them.
+func (r *RollingHash) GetState() []byte {
+	n := r.window
+	if !r.Full() {
+		n = int(r.count)
+	}
+
+	b := make([]byte, 0, rollingHeader+n)
+	b = append(b, rollingMagic...)
+	b = append(b, rollingVersion)
+	b = binary.BigEndian.AppendUint32(b, uint32(r.window))
+	b = binary.BigEndian.AppendUint64(b, r.count)
+	b = binary.BigEndian.AppendUint32(b, r.Sum32())
+	if r.Full() {
+		b = append(b, r.buf[r.pos:]...)
+		b = append(b, r.buf[:r.pos]...)
+	} else {
+		b = append(b, r.buf[:n]...)
+	}
+	return b
+}
+
+// SetState restores r, including its window size, from state returned by
+// GetState. It returns ErrInvalidState and leaves r unchanged if state is
+// not valid.
+func (r *RollingHash) SetState(state []byte) error {
+	if len(state) < rollingHeader || string(state[:len(rollingMagic)]) != rollingMagic || state[len(rollingMagic)] != rollingVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(rollingMagic)+1:]
+	window := binary.BigEndian.Uint32(p)
+	count := binary.BigEndian.Uint64(p[4:])
+	sum := binary.BigEndian.Uint32(p[12:])
+	p = p[16:]
+
+	n := uint64(window)
+	if count < n {
+		n = count
+	}
+	if window == 0 || window > 1<<30 || uint64(len(p)) != n || sum&0xffff >= mod || sum>>16 >= mod {
+		return ErrInvalidState
+	}
+
+	buf := make([]byte, window)
+	copy(buf, p)
+
+	r.window = int(window)
+	r.buf = buf
+	r.pos = int(n % uint64(window))
+	r.count = count
+	r.s1, r.s2 = sum&0xffff, sum>>16
+
+	return nil
+}
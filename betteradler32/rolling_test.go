@@ -0,0 +1,86 @@
+package betteradler32
+
+import (
+	"testing"
+)
+
+func TestRollingHash(t *testing.T) {
+	data := testData(3000)
+	for i := range data[:500] {
+		data[i] = 0xff
+	}
+
+	const window = 700
+
+	r := NewRollingHash(window)
+	for i := range data {
+		r.Write(data[i : i+1])
+
+		start := i + 1 - window
+		if start < 0 {
+			start = 0
+		}
+		if want := Checksum(data[start : i+1]); r.Sum32() != want {
+			t.Fatalf("after %d bytes: Sum32 = %08x want %08x", i+1, r.Sum32(), want)
+		}
+	}
+
+	// Explicit rsync-style rolling.
+	r2 := NewRollingHash(window)
+	r2.Write(data[:window])
+	for i := window; i < len(data); i++ {
+		if r2.Oldest() != data[i-window] {
+			t.Fatalf("Oldest at %d = %x want %x", i, r2.Oldest(), data[i-window])
+		}
+		r2.Roll(data[i-window], data[i])
+	}
+	if r2.Sum32() != r.Sum32() || r2.Count() != uint64(len(data)) {
+		t.Fatal("Roll and Write disagree")
+	}
+}
+
+func TestRollingHashState(t *testing.T) {
+	data := testData(2000)
+	const window = 300
+
+	want := NewRollingHash(window)
+	want.Write(data)
+
+	for _, split := range []int{0, 1, window - 1, window, window + 1, 1000, 2000} {
+		r := NewRollingHash(window)
+		r.Write(data[:split])
+
+		resumed := NewRollingHash(1)
+		if err := resumed.SetState(r.GetState()); err != nil {
+			t.Fatalf("%d: %v", split, err)
+		}
+		if resumed.Window() != window {
+			t.Fatalf("%d: window = %d", split, resumed.Window())
+		}
+		resumed.Write(data[split:])
+
+		if resumed.Sum32() != want.Sum32() {
+			t.Fatalf("%d: resumed Sum32 = %08x want %08x", split, resumed.Sum32(), want.Sum32())
+		}
+	}
+
+	state := want.GetState()
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": state[:len(state)-1],
+		"trailing":  append(append([]byte(nil), state...), 0),
+	} {
+		if err := want.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestRollNotFull(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Roll on a window that is not full did not panic")
+		}
+	}()
+	NewRollingHash(4).Roll(0, 1)
+}
@@ -0,0 +1,296 @@
+// Package betterblake2b implements the BLAKE2b hash algorithm as defined in
+// RFC 7693, with a digest whose state can be saved and restored.
+package betterblake2b
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+var (
+	// ErrInvalidState is returned by SetState when the state is not valid.
+	ErrInvalidState = errors.New("betterblake2b: invalid state")
+
+	// ErrInvalidSize is returned by New for unsupported digest sizes.
+	ErrInvalidSize = errors.New("betterblake2b: invalid digest size")
+
+	// ErrKeyTooLong is returned by New for keys longer than 64 bytes.
+	ErrKeyTooLong = errors.New("betterblake2b: key longer than 64 bytes")
+)
+
+const (
+	// Size is the size of a BLAKE2b-512 checksum in bytes.
+	Size = 64
+
+	// Size256 is the size of a BLAKE2b-256 checksum in bytes.
+	Size256 = 32
+
+	// BlockSize is the block size of BLAKE2b in bytes.
+	BlockSize = 128
+
+	// MaxKeySize is the maximum key size in bytes.
+	MaxKeySize = 64
+)
+
+var iv = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+var sigma = [10][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+}
+
+// The state format is
+//
+//	"bb2b" || version || digest size || 8 uint64 words || uint64 counter high || uint64 counter low || buffered bytes
+//
+// with integers in big-endian. Up to a whole block stays buffered, since the
+// last block is compressed differently. For a keyed digest the buffered
+// bytes can contain the key, so such states are as sensitive as the key.
+const (
+	stateMagic   = "bb2b"
+	stateVersion = 1
+	stateHeader  = len(stateMagic) + 1 + 1 + 8*8 + 16
+)
+
+// BetterDigest represents the partial evaluation of a checksum.
+type BetterDigest struct {
+	h    [8]uint64
+	t    [2]uint64
+	x    [BlockSize]byte
+	nx   int
+	size int
+	key  [MaxKeySize]byte
+	klen int
+}
+
+// New returns a new hash.Hash computing the BLAKE2b checksum of size bytes,
+// between 1 and 64, keyed with key if it is not empty.
+func New(size int, key []byte) (*BetterDigest, error) {
+	if size < 1 || size > Size {
+		return nil, ErrInvalidSize
+	}
+	if len(key) > MaxKeySize {
+		return nil, ErrKeyTooLong
+	}
+
+	d := &BetterDigest{size: size, klen: len(key)}
+	copy(d.key[:], key)
+	d.Reset()
+
+	return d, nil
+}
+
+// New512 returns a new hash.Hash computing the BLAKE2b-512 checksum.
+func New512() *BetterDigest {
+	d, _ := New(Size, nil)
+	return d
+}
+
+// New256 returns a new hash.Hash computing the BLAKE2b-256 checksum.
+func New256() *BetterDigest {
+	d, _ := New(Size256, nil)
+	return d
+}
+
+// NewFromState returns a new hash.Hash computing the BLAKE2b checksum from
+// existing state, with the digest size recorded in it.
+func NewFromState(state []byte) *BetterDigest {
+	d := New512()
+	d.SetState(state)
+	return d
+}
+
+func (d *BetterDigest) Reset() {
+	d.h = iv
+	d.h[0] ^= 0x01010000 ^ uint64(d.klen)<<8 ^ uint64(d.size)
+	d.t = [2]uint64{}
+	d.x = [BlockSize]byte{}
+	d.nx = 0
+	if d.klen > 0 {
+		copy(d.x[:], d.key[:d.klen])
+		d.nx = BlockSize
+	}
+}
+
+func (d *BetterDigest) Size() int { return d.size }
+
+func (d *BetterDigest) BlockSize() int { return BlockSize }
+
+func (d *BetterDigest) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+
+	if d.nx > 0 {
+		// Keep the last block buffered until more data arrives.
+		if d.nx == BlockSize && len(p) > 0 {
+			d.compress(d.x[:], false)
+			d.nx = 0
+		}
+		n := copy(d.x[d.nx:], p)
+		d.nx += n
+		p = p[n:]
+		if len(p) > 0 {
+			d.compress(d.x[:], false)
+			d.nx = 0
+		}
+	}
+
+	for len(p) > BlockSize {
+		d.compress(p[:BlockSize], false)
+		p = p[BlockSize:]
+	}
+
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+
+	return
+}
+
+func (d *BetterDigest) compress(block []byte, last bool) {
+	n := uint64(BlockSize)
+	if last {
+		n = uint64(d.nx)
+	}
+	var c uint64
+	d.t[0], c = bits.Add64(d.t[0], n, 0)
+	d.t[1] += c
+
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+
+	var v [16]uint64
+	copy(v[:8], d.h[:])
+	copy(v[8:], iv[:])
+	v[12] ^= d.t[0]
+	v[13] ^= d.t[1]
+	if last {
+		v[14] = ^v[14]
+	}
+
+	for r := 0; r < 12; r++ {
+		s := &sigma[r%10]
+		g(&v, 0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(&v, 1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(&v, 2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(&v, 3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(&v, 0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(&v, 1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(&v, 2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(&v, 3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+
+	for i := range d.h {
+		d.h[i] ^= v[i] ^ v[i+8]
+	}
+}
+
+func g(v *[16]uint64, a, b, c, d int, x, y uint64) {
+	v[a] += v[b] + x
+	v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+	v[c] += v[d]
+	v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+	v[a] += v[b] + y
+	v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+	v[c] += v[d]
+	v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+}
+
+func (d0 *BetterDigest) Sum(in []byte) []byte {
+	// Make a copy of d0 so that caller can keep writing and summing.
+	d := *d0
+	hash := d.checkSum()
+	return append(in, hash[:d.size]...)
+}
+
+func (d *BetterDigest) checkSum() [Size]byte {
+	for i := d.nx; i < BlockSize; i++ {
+		d.x[i] = 0
+	}
+	d.compress(d.x[:], true)
+
+	var digest [Size]byte
+	for i, h := range d.h {
+		binary.LittleEndian.PutUint64(digest[i*8:], h)
+	}
+
+	return digest
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *BetterDigest) GetState() []byte {
+	b := make([]byte, 0, stateHeader+d.nx)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion, byte(d.size))
+	for _, h := range d.h {
+		b = binary.BigEndian.AppendUint64(b, h)
+	}
+	b = binary.BigEndian.AppendUint64(b, d.t[1])
+	b = binary.BigEndian.AppendUint64(b, d.t[0])
+	b = append(b, d.x[:d.nx]...)
+	return b
+}
+
+// SetState restores the digest, including its size, from state returned by
+// GetState. It returns ErrInvalidState and leaves the digest unchanged if
+// state is not valid. The key is not part of the state, so Reset after
+// SetState gives an unkeyed digest unless d was created with the same key.
+func (d *BetterDigest) SetState(state []byte) error {
+	if len(state) < stateHeader || len(state) > stateHeader+BlockSize || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	size := int(p[0])
+	if size < 1 || size > Size {
+		return ErrInvalidState
+	}
+	p = p[1:]
+
+	for i := range d.h {
+		d.h[i] = binary.BigEndian.Uint64(p[i*8:])
+	}
+	d.t[1] = binary.BigEndian.Uint64(p[64:])
+	d.t[0] = binary.BigEndian.Uint64(p[72:])
+	d.x = [BlockSize]byte{}
+	d.nx = copy(d.x[:], p[80:])
+	d.size = size
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *BetterDigest) Clone() *BetterDigest {
+	c := *d
+	return &c
+}
+
+// Sum512 returns the BLAKE2b-512 checksum of the data.
+func Sum512(data []byte) [Size]byte {
+	d := New512()
+	d.Write(data)
+	return d.checkSum()
+}
+
+// Sum256 returns the BLAKE2b-256 checksum of the data.
+func Sum256(data []byte) [Size256]byte {
+	d := New256()
+	d.Write(data)
+	sum := d.checkSum()
+	var out [Size256]byte
+	copy(out[:], sum[:])
+	return out
+}
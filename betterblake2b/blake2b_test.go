@@ -0,0 +1,168 @@
+package betterblake2b
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*BetterDigest)(nil)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+var testKey = []byte("a secret key")
+
+var golden = []struct {
+	n      int
+	size   int
+	keyed  bool
+	digest string
+}{
+	{0, 64, false, "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+	{1, 64, false, "2fa3f686df876995167e7c2e5d74c4c7b6e48f8068fe0e44208344d480f7904c36963e44115fe3eb2a3ac8694c28bcb4f5a0f3276f2e79487d8219057a506e4b"},
+	{127, 64, false, "08b38d2c2a521e8a819cdca2d43b52df46768623ff2a89e8cbf5a0095e9873d8714e9f0f94bda6c0f43731a465769f5b4a978bc0efa8e0ccf8a37d901d3265b5"},
+	{128, 64, false, "0be555525cf1e0b9b74d2a743dd1ee3164b1de36feaa6084a1d054af06a5091346d6a2be5068fd5c612e0f8cbcefaacac2f5b309226bfc28817916fbc3ef0b23"},
+	{129, 64, false, "31f95aa8eb1487ce670bc3c0c60ef98b83b7d7d88ff6b7d719fdc8838f301785591eed59d633b5f47b73aa828cf2dcdc775fc92c0de005ae9b7922b0f3251885"},
+	{1000, 64, false, "dffd33ca75a71d06aaae06e87a53b2b4aba635bcaab2622e6314c9d137dfc8cb2812c7d6591b2026a5d7e4c4871bd174a913e74bd4f666a2a5768318c828be50"},
+	{0, 32, false, "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+	{256, 32, false, "3d0cb2693dfbac42af5a6cc960953fea8714aa39c4bcd054ef61d6b5e98ade4a"},
+	{1000, 32, false, "38981cec8fd0971914a759c4fac0538dbb29495eec4aea07f277e1f5f8562d27"},
+	{0, 20, true, "ebbbe3823fad1a41c601af087f8324be4e3278f0"},
+	{1, 20, true, "7e2a32a1487a5a7c08aa2440d437eeecfead19a1"},
+	{128, 20, true, "aa267c7c9d592b1c328c981958ebb91fb20e0497"},
+	{129, 20, true, "cd2910f4cd9709ee59db0d1cce8b59e9da20bbc1"},
+	{1000, 20, true, "fafec37947448d7da155b0441f2870dddb821d98"},
+}
+
+func newGolden(t *testing.T, size int, keyed bool) *BetterDigest {
+	var key []byte
+	if keyed {
+		key = testKey
+	}
+	d, err := New(size, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestGolden(t *testing.T) {
+	for _, g := range golden {
+		data := testData(g.n)
+
+		d := newGolden(t, g.size, g.keyed)
+		d.Write(data)
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.digest {
+			t.Fatalf("%d bytes, size %d, keyed %v: %s want %s", g.n, g.size, g.keyed, got, g.digest)
+		}
+
+		d.Reset()
+		for i := range data {
+			d.Write(data[i : i+1])
+		}
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.digest {
+			t.Fatalf("byte-wise %d bytes, size %d, keyed %v: %s want %s", g.n, g.size, g.keyed, got, g.digest)
+		}
+	}
+
+	if got := Sum512(testData(1000)); hex.EncodeToString(got[:]) != golden[5].digest {
+		t.Fatalf("Sum512 = %x", got)
+	}
+	if got := Sum256(testData(1000)); hex.EncodeToString(got[:]) != golden[8].digest {
+		t.Fatalf("Sum256 = %x", got)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, size := range []int{0, -1, 65} {
+		if _, err := New(size, nil); err != ErrInvalidSize {
+			t.Fatalf("New(%d): err = %v", size, err)
+		}
+	}
+	if _, err := New(Size, make([]byte, MaxKeySize+1)); err != ErrKeyTooLong {
+		t.Fatalf("long key: err = %v", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(1000)
+
+	for _, keyed := range []bool{false, true} {
+		d := newGolden(t, 20, keyed)
+		d.Write(data)
+		want := d.Sum(nil)
+
+		for _, split := range []int{0, 1, 127, 128, 129, 256, 999, 1000} {
+			d := newGolden(t, 20, keyed)
+			d.Write(data[:split])
+
+			r := NewFromState(d.GetState())
+			if r.Size() != 20 {
+				t.Fatalf("restored Size = %d", r.Size())
+			}
+			r.Write(data[split:])
+			if got := r.Sum(nil); !bytes.Equal(got, want) {
+				t.Fatalf("keyed %v, %d: resumed Sum = %x want %x", keyed, split, got, want)
+			}
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := New512()
+	d.Write(testData(200))
+	state := d.GetState()
+	want := d.Sum(nil)
+
+	bad := map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:stateHeader-1],
+		"wrong magic":     append([]byte("xxxx"), state[4:]...),
+		"unknown version": append(append([]byte(stateMagic), 2), state[5:]...),
+		"zero size":       append(append([]byte(stateMagic), stateVersion, 0), state[6:]...),
+		"too long":        append(append([]byte(nil), state[:stateHeader]...), make([]byte, BlockSize+1)...),
+	}
+	for name, state := range bad {
+		if err := d.SetState(state); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if got := d.Sum(nil); !bytes.Equal(got, want) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
+
+func TestClone(t *testing.T) {
+	data := testData(1000)
+
+	d := New512()
+	d.Write(data[:300])
+	c := d.Clone()
+	d.Write(data[300:])
+	c.Write(data[300:500])
+
+	if want := Sum512(data); !bytes.Equal(d.Sum(nil), want[:]) {
+		t.Fatal("original diverged after Clone")
+	}
+	if want := Sum512(data[:500]); !bytes.Equal(c.Sum(nil), want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+}
+
+func BenchmarkHash8K(b *testing.B) {
+	data := testData(8192)
+	d := New512()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		d.Reset()
+		d.Write(data)
+		d.Sum(nil)
+	}
+}
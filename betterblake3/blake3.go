@@ -0,0 +1,336 @@
+// Package betterblake3 implements the BLAKE3 hash function, in its hash,
+// keyed hash and key derivation modes, with a digest whose state can be
+// saved and restored.
+package betterblake3
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+var (
+	// ErrInvalidState is returned by SetState when the state is not valid.
+	ErrInvalidState = errors.New("betterblake3: invalid state")
+
+	// ErrInvalidKeySize is returned by NewKeyed for keys that are not 32
+	// bytes long.
+	ErrInvalidKeySize = errors.New("betterblake3: key must be 32 bytes")
+)
+
+const (
+	// Size is the size of a BLAKE3 checksum in bytes.
+	Size = 32
+
+	// BlockSize is the block size of BLAKE3 in bytes.
+	BlockSize = 64
+
+	// KeySize is the size of a BLAKE3 key in bytes.
+	KeySize = 32
+
+	// ChunkSize is the size of the chunks that form the leaves of the
+	// BLAKE3 hash tree.
+	ChunkSize = 1024
+)
+
+const (
+	flagChunkStart        = 1 << 0
+	flagChunkEnd          = 1 << 1
+	flagParent            = 1 << 2
+	flagRoot              = 1 << 3
+	flagKeyedHash         = 1 << 4
+	flagDeriveKeyContext  = 1 << 5
+	flagDeriveKeyMaterial = 1 << 6
+
+	// maxStack is the depth of the chaining value stack, enough for 2^54
+	// chunks, the 2^64 bytes the chunk counter can address.
+	maxStack = 54
+)
+
+var iv = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+	0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+// BetterDigest represents the partial evaluation of a checksum.
+//
+// Besides the chunk being hashed, the digest keeps a stack with the chaining
+// values of the completed subtrees to its left, one per set bit of the number
+// of completed chunks. GetState saves both, so hashing can resume anywhere
+// in the input.
+type BetterDigest struct {
+	key   [8]uint32
+	flags uint32
+
+	// The current chunk.
+	cv         [8]uint32
+	counter    uint64
+	block      [BlockSize]byte
+	blockLen   int
+	compressed int
+
+	stack    [maxStack][8]uint32
+	stackLen int
+}
+
+// New returns a new hash.Hash computing the BLAKE3 checksum.
+func New() *BetterDigest {
+	return newDigest(iv, 0)
+}
+
+// NewKeyed returns a new hash.Hash computing the BLAKE3 keyed hash, a MAC,
+// with the 32-byte key.
+func NewKeyed(key []byte) (*BetterDigest, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKeySize
+	}
+
+	return newDigest(keyWords(key), flagKeyedHash), nil
+}
+
+// NewDeriveKey returns a new hash.Hash that derives a key from the key
+// material written to it, for the given context. The context should be a
+// hardcoded, globally unique and application-specific string.
+func NewDeriveKey(context string) *BetterDigest {
+	c := newDigest(iv, flagDeriveKeyContext)
+	c.Write([]byte(context))
+
+	var contextKey [KeySize]byte
+	c.rootOutput().bytes(contextKey[:])
+
+	return newDigest(keyWords(contextKey[:]), flagDeriveKeyMaterial)
+}
+
+// NewFromState returns a new hash.Hash computing the BLAKE3 checksum from
+// existing state, in the mode recorded in it.
+func NewFromState(state []byte) *BetterDigest {
+	d := New()
+	d.SetState(state)
+	return d
+}
+
+func newDigest(key [8]uint32, flags uint32) *BetterDigest {
+	d := &BetterDigest{key: key, flags: flags}
+	d.Reset()
+	return d
+}
+
+func keyWords(key []byte) (w [8]uint32) {
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+	return
+}
+
+// Reset resets the digest to its initial state, keeping its mode and key.
+func (d *BetterDigest) Reset() {
+	d.cv = d.key
+	d.counter = 0
+	d.block = [BlockSize]byte{}
+	d.blockLen = 0
+	d.compressed = 0
+	d.stackLen = 0
+}
+
+func (d *BetterDigest) Size() int { return Size }
+
+func (d *BetterDigest) BlockSize() int { return BlockSize }
+
+func (d *BetterDigest) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+
+	for len(p) > 0 {
+		if d.chunkLen() == ChunkSize {
+			d.pushChunk(d.chunkOutput().chainingValue())
+		}
+
+		// Compress the buffered block only once more input arrives, since
+		// the last block of a chunk is compressed with different flags.
+		if d.blockLen == BlockSize {
+			d.cv = truncate(compress(&d.cv, &d.block, d.counter, BlockSize, d.flags|d.startFlag()))
+			d.compressed++
+			d.blockLen = 0
+		}
+
+		n := copy(d.block[d.blockLen:], p)
+		d.blockLen += n
+		p = p[n:]
+	}
+
+	return
+}
+
+func (d *BetterDigest) chunkLen() int {
+	return d.compressed*BlockSize + d.blockLen
+}
+
+func (d *BetterDigest) startFlag() uint32 {
+	if d.compressed == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+// pushChunk adds the chaining value of the completed chunk to the stack,
+// merging it with the subtrees to its left that it completes, and starts the
+// next chunk.
+func (d *BetterDigest) pushChunk(cv [8]uint32) {
+	total := d.counter + 1
+	for total&1 == 0 {
+		d.stackLen--
+		cv = parentOutput(&d.stack[d.stackLen], &cv, &d.key, d.flags).chainingValue()
+		total >>= 1
+	}
+	d.stack[d.stackLen] = cv
+	d.stackLen++
+
+	d.cv = d.key
+	d.counter++
+	d.block = [BlockSize]byte{}
+	d.blockLen = 0
+	d.compressed = 0
+}
+
+func (d *BetterDigest) chunkOutput() output {
+	o := output{
+		cv:       d.cv,
+		counter:  d.counter,
+		blockLen: uint32(d.blockLen),
+		flags:    d.flags | d.startFlag() | flagChunkEnd,
+	}
+	copy(o.block[:], d.block[:d.blockLen])
+	return o
+}
+
+func (d *BetterDigest) rootOutput() output {
+	o := d.chunkOutput()
+	for i := d.stackLen - 1; i >= 0; i-- {
+		cv := o.chainingValue()
+		o = parentOutput(&d.stack[i], &cv, &d.key, d.flags)
+	}
+	return o
+}
+
+func (d *BetterDigest) Sum(in []byte) []byte {
+	var hash [Size]byte
+	d.rootOutput().bytes(hash[:])
+	return append(in, hash[:]...)
+}
+
+// SumXOF fills out with the extended output of the digest. The first Size
+// bytes are those returned by Sum, and any length can be requested.
+func (d *BetterDigest) SumXOF(out []byte) {
+	d.rootOutput().bytes(out)
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *BetterDigest) Clone() *BetterDigest {
+	c := *d
+	return &c
+}
+
+// output is a node of the hash tree that has not been compressed yet, so it
+// can give either a chaining value or, for the root, the output bytes.
+type output struct {
+	cv       [8]uint32
+	block    [BlockSize]byte
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func parentOutput(left, right, key *[8]uint32, flags uint32) output {
+	o := output{cv: *key, blockLen: BlockSize, flags: flags | flagParent}
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(o.block[i*4:], left[i])
+		binary.LittleEndian.PutUint32(o.block[32+i*4:], right[i])
+	}
+	return o
+}
+
+func (o output) chainingValue() [8]uint32 {
+	return truncate(compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags))
+}
+
+func (o output) bytes(out []byte) {
+	for t := uint64(0); len(out) > 0; t++ {
+		w := compress(&o.cv, &o.block, t, o.blockLen, o.flags|flagRoot)
+		var b [2 * Size]byte
+		for i, v := range w {
+			binary.LittleEndian.PutUint32(b[i*4:], v)
+		}
+		out = out[copy(out, b[:]):]
+	}
+}
+
+func truncate(w [16]uint32) (cv [8]uint32) {
+	copy(cv[:], w[:8])
+	return
+}
+
+func compress(cv *[8]uint32, block *[BlockSize]byte, counter uint64, blockLen, flags uint32) [16]uint32 {
+	var m [16]uint32
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint32(block[i*4:])
+	}
+
+	v := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+
+	for r := 0; r < 7; r++ {
+		g(&v, 0, 4, 8, 12, m[0], m[1])
+		g(&v, 1, 5, 9, 13, m[2], m[3])
+		g(&v, 2, 6, 10, 14, m[4], m[5])
+		g(&v, 3, 7, 11, 15, m[6], m[7])
+		g(&v, 0, 5, 10, 15, m[8], m[9])
+		g(&v, 1, 6, 11, 12, m[10], m[11])
+		g(&v, 2, 7, 8, 13, m[12], m[13])
+		g(&v, 3, 4, 9, 14, m[14], m[15])
+
+		var p [16]uint32
+		for i, j := range msgPermutation {
+			p[i] = m[j]
+		}
+		m = p
+	}
+
+	for i := 0; i < 8; i++ {
+		v[i] ^= v[i+8]
+		v[i+8] ^= cv[i]
+	}
+
+	return v
+}
+
+func g(v *[16]uint32, a, b, c, d int, x, y uint32) {
+	v[a] += v[b] + x
+	v[d] = bits.RotateLeft32(v[d]^v[a], -16)
+	v[c] += v[d]
+	v[b] = bits.RotateLeft32(v[b]^v[c], -12)
+	v[a] += v[b] + y
+	v[d] = bits.RotateLeft32(v[d]^v[a], -8)
+	v[c] += v[d]
+	v[b] = bits.RotateLeft32(v[b]^v[c], -7)
+}
+
+// Sum256 returns the BLAKE3 checksum of the data.
+func Sum256(data []byte) [Size]byte {
+	var sum [Size]byte
+	d := New()
+	d.Write(data)
+	d.rootOutput().bytes(sum[:])
+	return sum
+}
+
+// DeriveKey fills out with key material derived from material for the given
+// context, as NewDeriveKey followed by SumXOF.
+func DeriveKey(context string, material []byte, out []byte) {
+	d := NewDeriveKey(context)
+	d.Write(material)
+	d.SumXOF(out)
+}
@@ -0,0 +1,127 @@
+package betterblake3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*BetterDigest)(nil)
+
+// testInput is the input of the official BLAKE3 test vectors.
+func testInput(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+const (
+	testKey     = "whats the Elvish word for friend"
+	testContext = "BLAKE3 2019-12-27 16:29:52 test vectors context"
+)
+
+var golden = []struct {
+	n      int
+	digest string
+}{
+	{0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+	{1, "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+	{1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+	{1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+	{102400, "bc3e3d41a1146b069abffad3c0d44860cf664390afce4d9661f7902e7943e085"},
+}
+
+func TestGolden(t *testing.T) {
+	for _, g := range golden {
+		data := testInput(g.n)
+
+		if got := Sum256(data); hex.EncodeToString(got[:]) != g.digest {
+			t.Fatalf("Sum256(%d bytes) = %x want %s", g.n, got, g.digest)
+		}
+
+		d := New()
+		for i := 0; i < len(data); i += 7 {
+			d.Write(data[i:min(i+7, len(data))])
+		}
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.digest {
+			t.Fatalf("piecewise %d bytes: %s want %s", g.n, got, g.digest)
+		}
+	}
+
+	if got := Sum256([]byte("abc")); hex.EncodeToString(got[:]) != "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85" {
+		t.Fatalf("abc: %x", got)
+	}
+}
+
+func TestModes(t *testing.T) {
+	k, err := NewKeyed([]byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(k.Sum(nil)); got != "92b2b75604ed3c761f9d6f62392c8a9227ad0ea3f09573e783f1498a4ed60d26" {
+		t.Fatalf("keyed: %s", got)
+	}
+
+	d := NewDeriveKey(testContext)
+	if got := hex.EncodeToString(d.Sum(nil)); got != "2cc39783c223154fea8dfb7c1b1660f2ac2dcbd1c1de8277b0b0dd39b7e50d7d" {
+		t.Fatalf("derive key: %s", got)
+	}
+
+	out := make([]byte, 100)
+	DeriveKey(testContext, nil, out)
+	if !bytes.Equal(out[:Size], d.Sum(nil)) {
+		t.Fatal("DeriveKey prefix differs from Sum")
+	}
+
+	if _, err := NewKeyed(make([]byte, KeySize-1)); err != ErrInvalidKeySize {
+		t.Fatalf("short key: err = %v", err)
+	}
+}
+
+func TestSumXOF(t *testing.T) {
+	d := New()
+	d.Write(testInput(1025))
+
+	long := make([]byte, 200)
+	d.SumXOF(long)
+	if !bytes.Equal(long[:Size], d.Sum(nil)) {
+		t.Fatal("extended output prefix differs from Sum")
+	}
+
+	short := make([]byte, 70)
+	d.SumXOF(short)
+	if !bytes.Equal(short, long[:70]) {
+		t.Fatal("extended output depends on its length")
+	}
+}
+
+func TestClone(t *testing.T) {
+	data := testInput(5000)
+
+	d := New()
+	d.Write(data[:3000])
+	c := d.Clone()
+	d.Write(data[3000:])
+	c.Write(data[3000:4000])
+
+	if want := Sum256(data); !bytes.Equal(d.Sum(nil), want[:]) {
+		t.Fatal("original diverged after Clone")
+	}
+	if want := Sum256(data[:4000]); !bytes.Equal(c.Sum(nil), want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+}
+
+func BenchmarkHash8K(b *testing.B) {
+	data := testInput(8192)
+	d := New()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		d.Reset()
+		d.Write(data)
+		d.Sum(nil)
+	}
+}
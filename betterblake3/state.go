@@ -0,0 +1,112 @@
+package betterblake3
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The state format is
+//
+//	"bb3s" || version || flags || key || chunk counter || chunk chaining value ||
+//	compressed block count || stack depth || stack || buffered block bytes
+//
+// with the counter as a big-endian uint64, words as big-endian uint32 and the
+// count and depth as single bytes. The key words are part of the state, as
+// every new chunk and parent node needs them, so the state of a keyed digest
+// is as sensitive as its key.
+const (
+	stateMagic   = "bb3s"
+	stateVersion = 1
+	stateHeader  = len(stateMagic) + 1 + 1 + 8*4 + 8 + 8*4 + 1 + 1
+)
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *BetterDigest) GetState() []byte {
+	b := make([]byte, 0, stateHeader+d.stackLen*32+d.blockLen)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion, byte(d.flags))
+	b = appendWords(b, &d.key)
+	b = binary.BigEndian.AppendUint64(b, d.counter)
+	b = appendWords(b, &d.cv)
+	b = append(b, byte(d.compressed), byte(d.stackLen))
+	for i := 0; i < d.stackLen; i++ {
+		b = appendWords(b, &d.stack[i])
+	}
+	b = append(b, d.block[:d.blockLen]...)
+	return b
+}
+
+// SetState restores the digest, including its mode and key, from state
+// returned by GetState. It returns ErrInvalidState and leaves the digest
+// unchanged if state is not valid.
+func (d *BetterDigest) SetState(state []byte) error {
+	if len(state) < stateHeader || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+
+	flags := uint32(p[0])
+	switch flags {
+	case 0, flagKeyedHash, flagDeriveKeyMaterial:
+	default:
+		return ErrInvalidState
+	}
+	p = p[1:]
+
+	key := consumeWords(&p)
+	counter := binary.BigEndian.Uint64(p)
+	p = p[8:]
+	cv := consumeWords(&p)
+	compressed, stackLen := int(p[0]), int(p[1])
+	p = p[2:]
+
+	// The stack holds one chaining value per set bit of the number of
+	// completed chunks, of which there are at most 1<<maxStack.
+	if stackLen > maxStack {
+		return ErrInvalidState
+	}
+	if compressed >= ChunkSize/BlockSize || stackLen != bits.OnesCount64(counter) || len(p) < stackLen*32 {
+		return ErrInvalidState
+	}
+
+	var stack [maxStack][8]uint32
+	for i := 0; i < stackLen; i++ {
+		stack[i] = consumeWords(&p)
+	}
+
+	// A block is only compressed once more input follows it, so a chunk with
+	// compressed blocks always has buffered bytes, and one without any starts
+	// from the key.
+	blockLen := len(p)
+	if blockLen > BlockSize || (compressed > 0 && blockLen == 0) || (compressed == 0 && cv != key) {
+		return ErrInvalidState
+	}
+
+	d.key = key
+	d.flags = flags
+	d.cv = cv
+	d.counter = counter
+	d.block = [BlockSize]byte{}
+	d.blockLen = copy(d.block[:], p)
+	d.compressed = compressed
+	d.stack = stack
+	d.stackLen = stackLen
+
+	return nil
+}
+
+func appendWords(b []byte, w *[8]uint32) []byte {
+	for _, v := range w {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func consumeWords(p *[]byte) (w [8]uint32) {
+	for i := range w {
+		w[i] = binary.BigEndian.Uint32((*p)[i*4:])
+	}
+	*p = (*p)[32:]
+	return
+}
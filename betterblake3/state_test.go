@@ -0,0 +1,68 @@
+package betterblake3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	data := testInput(9 * ChunkSize)
+
+	keyed, _ := NewKeyed([]byte(testKey))
+	for _, d := range []*BetterDigest{New(), keyed, NewDeriveKey(testContext)} {
+		d.Write(data)
+		want := d.Sum(nil)
+
+		for _, split := range []int{0, 1, 64, 65, 1023, 1024, 1025, 2048, 3 * ChunkSize, 7*ChunkSize + 1, len(data)} {
+			d.Reset()
+			d.Write(data[:split])
+
+			r := NewFromState(d.GetState())
+			r.Write(data[split:])
+			if got := r.Sum(nil); !bytes.Equal(got, want) {
+				t.Fatalf("flags %d, %d: resumed Sum = %x want %x", d.flags, split, got, want)
+			}
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := New()
+	d.Write(testInput(3*ChunkSize + 100))
+	state := d.GetState()
+	want := d.Sum(nil)
+
+	with := func(i int, b byte) []byte {
+		s := append([]byte(nil), state...)
+		s[i] = b
+		return s
+	}
+	counter := stateHeader - 2 - 32 - 1
+
+	// A counter with more set bits than the stack has room for.
+	deep := append([]byte(nil), state[:stateHeader]...)
+	binary.BigEndian.PutUint64(deep[counter-7:], 1<<(maxStack+1)-1)
+	deep[stateHeader-1] = maxStack + 1
+	deep = append(deep, make([]byte, (maxStack+1)*32)...)
+
+	bad := map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:stateHeader-1],
+		"wrong magic":     with(0, 'x'),
+		"unknown version": with(len(stateMagic), 2),
+		"unknown flags":   with(len(stateMagic)+1, flagDeriveKeyContext),
+		"chunk counter":   with(counter, 4),
+		"block count":     with(stateHeader-2, ChunkSize/BlockSize),
+		"stack too deep":  deep,
+		"too long":        append(append([]byte(nil), state...), make([]byte, BlockSize)...),
+	}
+	for name, state := range bad {
+		if err := d.SetState(state); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if got := d.Sum(nil); !bytes.Equal(got, want) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
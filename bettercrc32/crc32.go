@@ -0,0 +1,117 @@
+// Package bettercrc32 implements the 32-bit cyclic redundancy check with a
+// digest whose state can be saved and restored. Checksums are computed by
+// hash/crc32, including its hardware acceleration.
+package bettercrc32
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("bettercrc32: invalid state")
+
+// The size of a CRC-32 checksum in bytes.
+const Size = 4
+
+// Predefined polynomials, as in hash/crc32.
+const (
+	IEEE       = crc32.IEEE
+	Castagnoli = crc32.Castagnoli
+	Koopman    = crc32.Koopman
+)
+
+// The state format is
+//
+//	"bc32" || version || uint32 polynomial || uint32 checksum
+//
+// with integers in big-endian.
+const (
+	stateMagic   = "bc32"
+	stateVersion = 1
+	stateSize    = len(stateMagic) + 1 + 4 + 4
+)
+
+// Digest represents the partial evaluation of a checksum.
+type Digest struct {
+	poly uint32
+	tab  *crc32.Table
+	crc  uint32
+}
+
+// New returns a new hash.Hash32 computing the CRC-32 checksum with the
+// polynomial poly in reversed notation, such as IEEE or Castagnoli.
+func New(poly uint32) *Digest {
+	return &Digest{poly: poly, tab: crc32.MakeTable(poly)}
+}
+
+// NewIEEE returns a new hash.Hash32 computing the CRC-32 checksum with the
+// IEEE polynomial.
+func NewIEEE() *Digest { return New(IEEE) }
+
+// NewCastagnoli returns a new hash.Hash32 computing the CRC-32C checksum, as
+// used by Google Cloud Storage.
+func NewCastagnoli() *Digest { return New(Castagnoli) }
+
+// NewFromState returns a new hash.Hash32 computing the CRC-32 checksum from
+// existing state, with the polynomial recorded in it.
+func NewFromState(state []byte) *Digest {
+	d := NewIEEE()
+	d.SetState(state)
+	return d
+}
+
+func (d *Digest) Reset() { d.crc = 0 }
+
+func (d *Digest) Size() int { return Size }
+
+func (d *Digest) BlockSize() int { return 1 }
+
+func (d *Digest) Write(p []byte) (int, error) {
+	d.crc = crc32.Update(d.crc, d.tab, p)
+	return len(p), nil
+}
+
+func (d *Digest) Sum32() uint32 { return d.crc }
+
+func (d *Digest) Sum(in []byte) []byte {
+	return binary.BigEndian.AppendUint32(in, d.crc)
+}
+
+// Polynomial returns the polynomial of the digest.
+func (d *Digest) Polynomial() uint32 { return d.poly }
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *Digest) GetState() []byte {
+	b := make([]byte, 0, stateSize)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = binary.BigEndian.AppendUint32(b, d.poly)
+	b = binary.BigEndian.AppendUint32(b, d.crc)
+	return b
+}
+
+// SetState restores the digest, including its polynomial, from state
+// returned by GetState. It returns ErrInvalidState and leaves the digest
+// unchanged if state is not valid.
+func (d *Digest) SetState(state []byte) error {
+	if len(state) != stateSize || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	if poly := binary.BigEndian.Uint32(p); poly != d.poly {
+		d.poly = poly
+		d.tab = crc32.MakeTable(poly)
+	}
+	d.crc = binary.BigEndian.Uint32(p[4:])
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *Digest) Clone() *Digest {
+	c := *d
+	return &c
+}
@@ -0,0 +1,69 @@
+package bettercrc32
+
+import (
+	"bytes"
+	"hash"
+	"hash/crc32"
+	"testing"
+)
+
+var _ hash.Hash32 = (*Digest)(nil)
+
+func TestDigest(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	for _, poly := range []uint32{IEEE, Castagnoli, Koopman} {
+		want := crc32.Checksum(data, crc32.MakeTable(poly))
+
+		for _, split := range []int{0, 1, 500, 1000} {
+			d := New(poly)
+			d.Write(data[:split])
+
+			r := NewFromState(d.GetState())
+			if r.Polynomial() != poly {
+				t.Fatalf("%08x: restored polynomial %08x", poly, r.Polynomial())
+			}
+			r.Write(data[split:])
+			if r.Sum32() != want {
+				t.Fatalf("%08x/%d: Sum32 = %08x want %08x", poly, split, r.Sum32(), want)
+			}
+
+			c := d.Clone()
+			c.Write(data[split:])
+			std := crc32.New(crc32.MakeTable(poly))
+			std.Write(data)
+			if !bytes.Equal(c.Sum(nil), std.Sum(nil)) {
+				t.Fatalf("%08x/%d: Sum = %x want %x", poly, split, c.Sum(nil), std.Sum(nil))
+			}
+		}
+	}
+
+	if NewCastagnoli().Polynomial() != Castagnoli || NewIEEE().Polynomial() != IEEE {
+		t.Fatal("constructor polynomial mismatch")
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := NewCastagnoli()
+	d.Write([]byte("keep"))
+	want := d.Sum32()
+	state := d.GetState()
+
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": state[:len(state)-1],
+		"magic":     append([]byte("bc64"), state[4:]...),
+		"version":   append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+	} {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	if d.Sum32() != want || d.Polynomial() != Castagnoli {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
@@ -0,0 +1,116 @@
+// Package bettercrc64 implements the 64-bit cyclic redundancy check with a
+// digest whose state can be saved and restored. Checksums are computed by
+// hash/crc64.
+package bettercrc64
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("bettercrc64: invalid state")
+
+// The size of a CRC-64 checksum in bytes.
+const Size = 8
+
+// Predefined polynomials, as in hash/crc64.
+const (
+	ISO  = crc64.ISO
+	ECMA = crc64.ECMA
+)
+
+// The state format is
+//
+//	"bc64" || version || uint64 polynomial || uint64 checksum
+//
+// with integers in big-endian.
+const (
+	stateMagic   = "bc64"
+	stateVersion = 1
+	stateSize    = len(stateMagic) + 1 + 8 + 8
+)
+
+// Digest represents the partial evaluation of a checksum.
+type Digest struct {
+	poly uint64
+	tab  *crc64.Table
+	crc  uint64
+}
+
+// New returns a new hash.Hash64 computing the CRC-64 checksum with the
+// polynomial poly in reversed notation, such as ISO or ECMA.
+func New(poly uint64) *Digest {
+	return &Digest{poly: poly, tab: crc64.MakeTable(poly)}
+}
+
+// NewISO returns a new hash.Hash64 computing the CRC-64 checksum with the ISO
+// polynomial.
+func NewISO() *Digest { return New(ISO) }
+
+// NewECMA returns a new hash.Hash64 computing the CRC-64 checksum with the
+// ECMA polynomial.
+func NewECMA() *Digest { return New(ECMA) }
+
+// NewFromState returns a new hash.Hash64 computing the CRC-64 checksum from
+// existing state, with the polynomial recorded in it.
+func NewFromState(state []byte) *Digest {
+	d := NewISO()
+	d.SetState(state)
+	return d
+}
+
+func (d *Digest) Reset() { d.crc = 0 }
+
+func (d *Digest) Size() int { return Size }
+
+func (d *Digest) BlockSize() int { return 1 }
+
+func (d *Digest) Write(p []byte) (int, error) {
+	d.crc = crc64.Update(d.crc, d.tab, p)
+	return len(p), nil
+}
+
+func (d *Digest) Sum64() uint64 { return d.crc }
+
+func (d *Digest) Sum(in []byte) []byte {
+	return binary.BigEndian.AppendUint64(in, d.crc)
+}
+
+// Polynomial returns the polynomial of the digest.
+func (d *Digest) Polynomial() uint64 { return d.poly }
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *Digest) GetState() []byte {
+	b := make([]byte, 0, stateSize)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = binary.BigEndian.AppendUint64(b, d.poly)
+	b = binary.BigEndian.AppendUint64(b, d.crc)
+	return b
+}
+
+// SetState restores the digest, including its polynomial, from state
+// returned by GetState. It returns ErrInvalidState and leaves the digest
+// unchanged if state is not valid.
+func (d *Digest) SetState(state []byte) error {
+	if len(state) != stateSize || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	if poly := binary.BigEndian.Uint64(p); poly != d.poly {
+		d.poly = poly
+		d.tab = crc64.MakeTable(poly)
+	}
+	d.crc = binary.BigEndian.Uint64(p[8:])
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *Digest) Clone() *Digest {
+	c := *d
+	return &c
+}
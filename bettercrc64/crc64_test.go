@@ -0,0 +1,69 @@
+package bettercrc64
+
+import (
+	"bytes"
+	"hash"
+	"hash/crc64"
+	"testing"
+)
+
+var _ hash.Hash64 = (*Digest)(nil)
+
+func TestDigest(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	for _, poly := range []uint64{ISO, ECMA} {
+		want := crc64.Checksum(data, crc64.MakeTable(poly))
+
+		for _, split := range []int{0, 1, 500, 1000} {
+			d := New(poly)
+			d.Write(data[:split])
+
+			r := NewFromState(d.GetState())
+			if r.Polynomial() != poly {
+				t.Fatalf("%016x: restored polynomial %016x", poly, r.Polynomial())
+			}
+			r.Write(data[split:])
+			if r.Sum64() != want {
+				t.Fatalf("%016x/%d: Sum64 = %016x want %016x", poly, split, r.Sum64(), want)
+			}
+
+			c := d.Clone()
+			c.Write(data[split:])
+			std := crc64.New(crc64.MakeTable(poly))
+			std.Write(data)
+			if !bytes.Equal(c.Sum(nil), std.Sum(nil)) {
+				t.Fatalf("%016x/%d: Sum = %x want %x", poly, split, c.Sum(nil), std.Sum(nil))
+			}
+		}
+	}
+
+	if NewECMA().Polynomial() != ECMA || NewISO().Polynomial() != ISO {
+		t.Fatal("constructor polynomial mismatch")
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := NewECMA()
+	d.Write([]byte("keep"))
+	want := d.Sum64()
+	state := d.GetState()
+
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": state[:len(state)-1],
+		"magic":     append([]byte("bc32"), state[4:]...),
+		"version":   append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+	} {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	if d.Sum64() != want || d.Polynomial() != ECMA {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
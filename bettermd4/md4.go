@@ -0,0 +1,188 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bettermd4 implements the MD4 hash algorithm as defined in RFC
+// 1320, with a digest whose state can be saved and restored.
+//
+// MD4 is cryptographically broken: collisions can be found by hand. It is
+// here only for protocols that still require it, such as the block and file
+// checksums of rsync, and must not be used for anything else.
+package bettermd4
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/internal/hashstate"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("bettermd4: invalid state")
+
+// The size of an MD4 checksum in bytes.
+const Size = 16
+
+// The blocksize of MD4 in bytes.
+const BlockSize = 64
+
+const (
+	chunk = 64
+	init0 = 0x67452301
+	init1 = 0xEFCDAB89
+	init2 = 0x98BADCFE
+	init3 = 0x10325476
+)
+
+// The state format is the hashstate format with the magic "bmd4" and the
+// words and length in little-endian.
+const (
+	stateMagic      = "bmd4"
+	stateHeaderSize = len(stateMagic) + 1 + 4*4 + 8
+)
+
+var stateFormat = hashstate.Format{
+	Magic:     stateMagic,
+	Version:   1,
+	Order:     binary.LittleEndian,
+	WordSize:  4,
+	Words:     4,
+	BlockSize: chunk,
+}
+
+// BetterDigest represents the partial evaluation of a checksum.
+type BetterDigest struct {
+	s   [4]uint32
+	x   [chunk]byte
+	nx  int
+	len uint64
+}
+
+func (d *BetterDigest) Reset() {
+	d.s[0] = init0
+	d.s[1] = init1
+	d.s[2] = init2
+	d.s[3] = init3
+	d.nx = 0
+	d.len = 0
+}
+
+// New returns a new hash.Hash computing the MD4 checksum.
+func New() *BetterDigest {
+	d := new(BetterDigest)
+	d.Reset()
+	return d
+}
+
+// NewFromState returns a new hash.Hash computing the MD4 checksum from
+// existing state.
+func NewFromState(state []byte) *BetterDigest {
+	d := new(BetterDigest)
+	d.Reset()
+	d.SetState(state)
+	return d
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *BetterDigest) GetState() []byte {
+	var words [4]uint64
+	for i, s := range d.s {
+		words[i] = uint64(s)
+	}
+
+	return stateFormat.Append(make([]byte, 0, stateHeaderSize+d.nx), words[:], d.len, d.x[:d.nx])
+}
+
+// SetState restores the digest from state returned by GetState. It returns
+// ErrInvalidState and leaves the digest unchanged if state is not valid.
+func (d *BetterDigest) SetState(state []byte) error {
+	var words [4]uint64
+
+	length, pending, err := stateFormat.Decode(state, words[:])
+	if err != nil {
+		return ErrInvalidState
+	}
+
+	for i, w := range words {
+		d.s[i] = uint32(w)
+	}
+	d.len = length
+	d.nx = copy(d.x[:], pending)
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *BetterDigest) Clone() *BetterDigest {
+	c := *d
+	return &c
+}
+
+func (d *BetterDigest) Size() int { return Size }
+
+func (d *BetterDigest) BlockSize() int { return BlockSize }
+
+func (d *BetterDigest) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	d.len += uint64(nn)
+	if d.nx > 0 {
+		n := copy(d.x[d.nx:], p)
+		d.nx += n
+		if d.nx == chunk {
+			block(d, d.x[:])
+			d.nx = 0
+		}
+		p = p[n:]
+	}
+	if len(p) >= chunk {
+		n := len(p) &^ (chunk - 1)
+		block(d, p[:n])
+		p = p[n:]
+	}
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+	return
+}
+
+func (d0 *BetterDigest) Sum(in []byte) []byte {
+	// Make a copy of d0 so that caller can keep writing and summing.
+	d := *d0
+	hash := d.checkSum()
+	return append(in, hash[:]...)
+}
+
+func (d *BetterDigest) checkSum() [Size]byte {
+	len := d.len
+	// Padding.  Add a 1 bit and 0 bits until 56 bytes mod 64.
+	var tmp [64]byte
+	tmp[0] = 0x80
+	if len%64 < 56 {
+		d.Write(tmp[0 : 56-len%64])
+	} else {
+		d.Write(tmp[0 : 64+56-len%64])
+	}
+
+	// Length in bits.
+	len <<= 3
+	binary.LittleEndian.PutUint64(tmp[:], len)
+	d.Write(tmp[0:8])
+
+	if d.nx != 0 {
+		panic("d.nx != 0")
+	}
+
+	var digest [Size]byte
+	for i, s := range d.s {
+		binary.LittleEndian.PutUint32(digest[i*4:], s)
+	}
+
+	return digest
+}
+
+// Sum returns the MD4 checksum of the data.
+func Sum(data []byte) [Size]byte {
+	var d BetterDigest
+	d.Reset()
+	d.Write(data)
+	return d.checkSum()
+}
@@ -0,0 +1,120 @@
+package bettermd4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*BetterDigest)(nil)
+
+// The test suite of RFC 1320, appendix A.5.
+var golden = []struct {
+	out string
+	in  string
+}{
+	{"31d6cfe0d16ae931b73c59d7e0c089c0", ""},
+	{"bde52cb31de33e46245e05fbdbd6fb24", "a"},
+	{"a448017aaf21d8525fc10ae87aa6729d", "abc"},
+	{"d9130a8164549fe818874806e1c7014b", "message digest"},
+	{"d79e1c308aa5bbcdeea8ed63df412da9", "abcdefghijklmnopqrstuvwxyz"},
+	{"043f8582f241db351ce627e153e7f0e4", "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"},
+	{"e33b4ddc9c38f2199c3e7b164fcc0536", "12345678901234567890123456789012345678901234567890123456789012345678901234567890"},
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+func TestGolden(t *testing.T) {
+	for _, g := range golden {
+		if got := Sum([]byte(g.in)); hex.EncodeToString(got[:]) != g.out {
+			t.Fatalf("Sum(%q) = %x want %s", g.in, got, g.out)
+		}
+
+		d := New()
+		for i := 0; i < len(g.in); i++ {
+			d.Write([]byte{g.in[i]})
+		}
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.out {
+			t.Fatalf("byte-wise Sum(%q) = %s want %s", g.in, got, g.out)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(1000)
+	want := Sum(data)
+
+	for _, split := range []int{0, 1, 63, 64, 100, 999, 1000} {
+		d := New()
+		d.Write(data[:split])
+		state := d.GetState()
+
+		if len(state) != stateHeaderSize+split%chunk {
+			t.Fatalf("%d: state is %d bytes", split, len(state))
+		}
+
+		r := NewFromState(state)
+		r.Write(data[split:])
+		if got := r.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Fatalf("%d: resumed Sum = %x want %x", split, got, want)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := New()
+	d.Write(testData(100))
+	state := d.GetState()
+	want := d.Sum(nil)
+
+	for name, bad := range map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:len(state)-1],
+		"trailing bytes":  append(append([]byte(nil), state...), 0),
+		"unknown version": append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+		"wrong magic":     append([]byte("bmd5"), state[len(stateMagic):]...),
+	} {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	if !bytes.Equal(d.Sum(nil), want) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
+
+func TestClone(t *testing.T) {
+	data := testData(1000)
+
+	d := New()
+	d.Write(data[:300])
+	c := d.Clone()
+	d.Write(data[300:])
+	c.Write(data[300:500])
+
+	if want := Sum(data); !bytes.Equal(d.Sum(nil), want[:]) {
+		t.Fatal("original diverged after Clone")
+	}
+	if want := Sum(data[:500]); !bytes.Equal(c.Sum(nil), want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+}
+
+func BenchmarkHash8K(b *testing.B) {
+	data := testData(8192)
+	d := New()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		d.Reset()
+		d.Write(data)
+		d.Sum(nil)
+	}
+}
@@ -0,0 +1,110 @@
+package bettermd5
+
+import (
+	"errors"
+)
+
+var (
+	// ErrBlockOverlap is returned by OrderedBlockAssembler.Add for data that
+	// overlaps data already added.
+	ErrBlockOverlap = errors.New("bettermd5: block overlaps data already added")
+
+	// ErrBlockBeyondEnd is returned by OrderedBlockAssembler.Add for data past
+	// the total length.
+	ErrBlockBeyondEnd = errors.New("bettermd5: block beyond total length")
+
+	// ErrGaps is returned by OrderedBlockAssembler.Sum when not all data up to
+	// the total length has arrived contiguously.
+	ErrGaps = errors.New("bettermd5: data has gaps")
+)
+
+// OrderedBlockAssembler computes the MD5 checksum of data that arrives as
+// blocks in any order, such as ranges fetched in parallel. Blocks are
+// buffered until they extend the contiguous prefix, which is hashed as soon
+// as it grows, so only out-of-order blocks are held in memory.
+type OrderedBlockAssembler struct {
+	d       *BetterDigest
+	total   int64
+	next    int64
+	pending map[int64][]byte
+}
+
+// NewOrderedBlockAssembler returns an OrderedBlockAssembler for data of total
+// bytes.
+func NewOrderedBlockAssembler(total int64) *OrderedBlockAssembler {
+	return &OrderedBlockAssembler{
+		d:       New(),
+		total:   total,
+		pending: make(map[int64][]byte),
+	}
+}
+
+// Add adds block found at offset. The block is copied if it has to be
+// buffered. It returns ErrBlockOverlap if the block overlaps the hashed
+// prefix or a buffered block, which leaves the assembler unchanged.
+func (a *OrderedBlockAssembler) Add(offset int64, block []byte) error {
+	if offset < a.next {
+		return ErrBlockOverlap
+	}
+	if int64(len(block)) > a.total-offset {
+		return ErrBlockBeyondEnd
+	}
+	if len(block) == 0 {
+		return nil
+	}
+	if a.overlapsPending(offset, offset+int64(len(block))) {
+		return ErrBlockOverlap
+	}
+
+	if offset > a.next {
+		a.pending[offset] = append([]byte(nil), block...)
+		return nil
+	}
+
+	a.d.Write(block)
+	a.next += int64(len(block))
+
+	for {
+		b, ok := a.pending[a.next]
+		if !ok {
+			break
+		}
+		delete(a.pending, a.next)
+		a.d.Write(b)
+		a.next += int64(len(b))
+	}
+
+	return nil
+}
+
+// overlapsPending reports whether [start, end) overlaps a buffered block.
+func (a *OrderedBlockAssembler) overlapsPending(start, end int64) bool {
+	for off, b := range a.pending {
+		if start < off+int64(len(b)) && off < end {
+			return true
+		}
+	}
+	return false
+}
+
+// Contiguous returns the length of the contiguous prefix hashed so far.
+func (a *OrderedBlockAssembler) Contiguous() int64 {
+	return a.next
+}
+
+// Buffered returns the number of blocks waiting for the data before them.
+func (a *OrderedBlockAssembler) Buffered() int {
+	return len(a.pending)
+}
+
+// Sum returns the MD5 checksum of the data. It returns ErrGaps unless all
+// data up to the total length has been added without gaps or overlaps.
+func (a *OrderedBlockAssembler) Sum() (sum [Size]byte, err error) {
+	if a.next != a.total || len(a.pending) > 0 {
+		return sum, ErrGaps
+	}
+
+	a.d.Sum(sum[:0])
+
+	return sum, nil
+}
@@ -0,0 +1,87 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"math/rand"
+	"testing"
+)
+
+func TestOrderedBlockAssembler(t *testing.T) {
+	data := make([]byte, 64*100+10)
+	for i := range data {
+		data[i] = byte(i * 37)
+	}
+
+	var offsets []int64
+	for off := 0; off < len(data); off += 64 * 3 {
+		offsets = append(offsets, int64(off))
+	}
+	rng := rand.New(rand.NewSource(1))
+	rng.Shuffle(len(offsets), func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
+
+	a := NewOrderedBlockAssembler(int64(len(data)))
+	for i, off := range offsets {
+		end := off + 64*3
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		if i == len(offsets)/2 {
+			if _, err := a.Sum(); err != ErrGaps {
+				t.Fatalf("Sum with gaps: err = %v", err)
+			}
+		}
+		if err := a.Add(off, data[off:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum, err := a.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != md5.Sum(data) {
+		t.Fatalf("Sum = %x want %x", sum, md5.Sum(data))
+	}
+	if a.Buffered() != 0 || a.Contiguous() != int64(len(data)) {
+		t.Fatalf("Buffered = %d, Contiguous = %d", a.Buffered(), a.Contiguous())
+	}
+
+	a = NewOrderedBlockAssembler(256)
+	a.Add(0, data[:64])
+	a.Add(128, data[128:192])
+	if err := a.Add(0, data[:64]); err != ErrBlockOverlap {
+		t.Fatalf("Add before contiguous prefix: err = %v", err)
+	}
+	if err := a.Add(128, data[128:192]); err != ErrBlockOverlap {
+		t.Fatalf("duplicate Add: err = %v", err)
+	}
+	if err := a.Add(192, data[192:320]); err != ErrBlockBeyondEnd {
+		t.Fatalf("Add past end: err = %v", err)
+	}
+
+	// Blocks overlapping a buffered block at another offset are rejected,
+	// whether they are buffered themselves or extend the prefix.
+	for name, r := range map[string][2]int64{
+		"into buffered block":   {100, 140},
+		"buffered block inside": {96, 200},
+		"from inside":           {150, 200},
+		"extending the prefix":  {64, 130},
+	} {
+		if err := a.Add(r[0], data[r[0]:r[1]]); err != ErrBlockOverlap {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if a.Buffered() != 1 || a.Contiguous() != 64 {
+		t.Fatalf("rejected blocks changed the assembler: Buffered = %d, Contiguous = %d", a.Buffered(), a.Contiguous())
+	}
+
+	// Adjacent blocks still fit.
+	for _, r := range [][2]int64{{192, 256}, {64, 128}} {
+		if err := a.Add(r[0], data[r[0]:r[1]]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sum, err := a.Sum(); err != nil || sum != md5.Sum(data[:256]) {
+		t.Fatalf("Sum = %x, %v", sum, err)
+	}
+}
@@ -0,0 +1,127 @@
+package bettermd5
+
+import (
+	"runtime"
+	"sync"
+)
+
+// HashAll returns the MD5 checksums of inputs, in order. All of them are
+// hashed with one pooled digest, so hashing many small inputs only allocates
+// the result.
+func HashAll(inputs [][]byte) [][Size]byte {
+	sums := make([][Size]byte, len(inputs))
+	hashInto(sums, inputs)
+	return sums
+}
+
+// HashAllParallel is like HashAll but splits inputs between workers
+// goroutines, each with its own digest. A workers value that is not positive
+// means runtime.GOMAXPROCS(0).
+func HashAllParallel(inputs [][]byte, workers int) [][Size]byte {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+
+	sums := make([][Size]byte, len(inputs))
+	if workers <= 1 {
+		hashInto(sums, inputs)
+		return sums
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo, hi := w*len(inputs)/workers, (w+1)*len(inputs)/workers
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hashInto(sums[lo:hi], inputs[lo:hi])
+		}()
+	}
+	wg.Wait()
+
+	return sums
+}
+
+func hashInto(sums [][Size]byte, inputs [][]byte) {
+	d := getDigest()
+	defer putDigest(d)
+
+	for i, data := range inputs {
+		d.Reset()
+		d.Write(data)
+		sums[i] = d.checkSum()
+	}
+}
+
+// HashPipeline hashes every input received from in on workers goroutines
+// and sends the checksums on the returned channel in the order the inputs
+// were received. The channel is closed after in is closed and the last
+// checksum is sent. At most two inputs per worker are in flight, and the
+// caller must keep receiving until the channel is closed or the workers
+// stay blocked. A workers value that is not positive means
+// runtime.GOMAXPROCS(0).
+//
+// Results go through a fixed ring of slots allocated up front, so hashing
+// an input allocates nothing once the pipeline is running.
+func HashPipeline(in <-chan []byte, workers int) <-chan [Size]byte {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	type job struct {
+		data []byte
+		slot int
+	}
+
+	slots := 2 * workers
+	sums := make([][Size]byte, slots)
+	done := make([]chan struct{}, slots)
+	free := make(chan int, slots)
+	for i := range done {
+		done[i] = make(chan struct{}, 1)
+		free <- i
+	}
+
+	jobs := make(chan job)
+	order := make(chan int, slots)
+	out := make(chan [Size]byte)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			d := getDigest()
+			defer putDigest(d)
+
+			for j := range jobs {
+				d.Reset()
+				d.Write(j.data)
+				sums[j.slot] = d.checkSum()
+				done[j.slot] <- struct{}{}
+			}
+		}()
+	}
+
+	go func() {
+		for data := range in {
+			slot := <-free
+			order <- slot
+			jobs <- job{data: data, slot: slot}
+		}
+		close(jobs)
+		close(order)
+	}()
+
+	go func() {
+		for slot := range order {
+			<-done[slot]
+			sum := sums[slot]
+			free <- slot
+			out <- sum
+		}
+		close(out)
+	}()
+
+	return out
+}
@@ -0,0 +1,99 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"testing"
+)
+
+func batchInputs(n int) [][]byte {
+	inputs := make([][]byte, n)
+	for i := range inputs {
+		inputs[i] = make([]byte, i%200)
+		for j := range inputs[i] {
+			inputs[i][j] = byte(i + j*7)
+		}
+	}
+	return inputs
+}
+
+func TestHashAll(t *testing.T) {
+	inputs := batchInputs(1000)
+
+	for name, sums := range map[string][][Size]byte{
+		"HashAll":             HashAll(inputs),
+		"HashAllParallel(0)":  HashAllParallel(inputs, 0),
+		"HashAllParallel(1)":  HashAllParallel(inputs, 1),
+		"HashAllParallel(7)":  HashAllParallel(inputs, 7),
+		"HashAllParallel(5k)": HashAllParallel(inputs, 5000),
+	} {
+		if len(sums) != len(inputs) {
+			t.Fatalf("%s: %d sums", name, len(sums))
+		}
+		for i, sum := range sums {
+			if sum != md5.Sum(inputs[i]) {
+				t.Fatalf("%s: sum %d = %x want %x", name, i, sum, md5.Sum(inputs[i]))
+			}
+		}
+	}
+
+	if sums := HashAllParallel(nil, 4); len(sums) != 0 {
+		t.Fatalf("no inputs: %d sums", len(sums))
+	}
+}
+
+func TestHashPipeline(t *testing.T) {
+	inputs := batchInputs(1000)
+
+	for _, workers := range []int{0, 1, 4} {
+		in := make(chan []byte)
+		go func() {
+			for _, data := range inputs {
+				in <- data
+			}
+			close(in)
+		}()
+
+		i := 0
+		for sum := range HashPipeline(in, workers) {
+			if sum != md5.Sum(inputs[i]) {
+				t.Fatalf("workers %d: sum %d = %x want %x", workers, i, sum, md5.Sum(inputs[i]))
+			}
+			i++
+		}
+		if i != len(inputs) {
+			t.Fatalf("workers %d: %d sums", workers, i)
+		}
+	}
+}
+
+func BenchmarkHashAll(b *testing.B) {
+	inputs := batchInputs(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		HashAll(inputs)
+	}
+}
+
+func BenchmarkHashAllParallel(b *testing.B) {
+	inputs := batchInputs(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		HashAllParallel(inputs, 0)
+	}
+}
+
+func BenchmarkHashPipeline(b *testing.B) {
+	inputs := batchInputs(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in := make(chan []byte)
+		go func() {
+			for _, data := range inputs {
+				in <- data
+			}
+			close(in)
+		}()
+		for range HashPipeline(in, 4) {
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package bettermd5
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrCheckpointerClosed is returned by writes to a closed checkpointer.
+var ErrCheckpointerClosed = errors.New("bettermd5: checkpointer closed")
+
+// checkpointBuffer is the number of checkpoints buffered in the channel
+// returned by NewChannelCheckpointer.
+const checkpointBuffer = 8
+
+// Checkpoint is the state of a digest after Offset bytes.
+type Checkpoint struct {
+	Offset uint64
+	State  []byte
+}
+
+type channelCheckpointer struct {
+	d      *BetterDigest
+	every  uint64
+	ch     chan Checkpoint
+	sent   bool
+	last   uint64
+	closed bool
+}
+
+// NewChannelCheckpointer returns a writer that hashes into d and sends a
+// checkpoint on the returned channel each time the total length of d crosses
+// a multiple of every, and a final one when the writer is closed, after
+// which the channel is closed. Writes never block on the channel: once
+// checkpointBuffer checkpoints are waiting, the oldest is dropped, so the
+// receiver always gets the most recent ones. It panics if every is zero.
+func NewChannelCheckpointer(d *BetterDigest, every uint64) (io.WriteCloser, <-chan Checkpoint) {
+	if every == 0 {
+		panic("bettermd5.NewChannelCheckpointer: every must be positive")
+	}
+
+	c := &channelCheckpointer{
+		d:     d,
+		every: every,
+		ch:    make(chan Checkpoint, checkpointBuffer),
+	}
+
+	return c, c.ch
+}
+
+func (c *channelCheckpointer) Write(p []byte) (nn int, err error) {
+	if c.closed {
+		return 0, ErrCheckpointerClosed
+	}
+
+	nn = len(p)
+	for len(p) > 0 {
+		n := c.every - c.d.len%c.every
+		if uint64(len(p)) < n {
+			c.d.Write(p)
+			break
+		}
+		c.d.Write(p[:n])
+		p = p[n:]
+		c.send()
+	}
+	return
+}
+
+// Close sends the final checkpoint, unless the last one sent is already at
+// the final offset, and closes the channel.
+func (c *channelCheckpointer) Close() error {
+	if c.closed {
+		return ErrCheckpointerClosed
+	}
+	c.closed = true
+
+	if !c.sent || c.last != c.d.len {
+		c.send()
+	}
+	close(c.ch)
+
+	return nil
+}
+
+func (c *channelCheckpointer) send() {
+	cp := Checkpoint{
+		Offset: c.d.len,
+		State:  c.d.GetState(),
+	}
+	c.sent = true
+	c.last = cp.Offset
+
+	for {
+		select {
+		case c.ch <- cp:
+			return
+		default:
+		}
+
+		// Full, drop the oldest. The receiver may have emptied the channel in
+		// the meantime, so don't wait here.
+		select {
+		case <-c.ch:
+		default:
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+)
+
+func TestChannelCheckpointer(t *testing.T) {
+	data := bytes.Repeat([]byte("checkpoint"), 100)
+
+	w, ch := NewChannelCheckpointer(New(), 128)
+	w.Write(data[:300])
+	w.Write(data[300:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != ErrCheckpointerClosed {
+		t.Fatalf("Write after Close: err = %v", err)
+	}
+
+	var offsets []uint64
+	for cp := range ch {
+		offsets = append(offsets, cp.Offset)
+
+		d := NewFromState(cp.State)
+		d.Write(data[cp.Offset:])
+		if want := md5.Sum(data); !bytes.Equal(d.Sum(nil), want[:]) {
+			t.Fatalf("checkpoint at %d: checksum mismatch", cp.Offset)
+		}
+	}
+
+	want := []uint64{128, 256, 384, 512, 640, 768, 896, 1000}
+	if len(offsets) != len(want) {
+		t.Fatalf("offsets = %v want %v", offsets, want)
+	}
+	for i := range want {
+		if offsets[i] != want[i] {
+			t.Fatalf("offsets = %v want %v", offsets, want)
+		}
+	}
+}
+
+func TestChannelCheckpointerDropOldest(t *testing.T) {
+	w, ch := NewChannelCheckpointer(New(), 1)
+	w.Write(make([]byte, 100))
+	w.Close()
+
+	var offsets []uint64
+	for cp := range ch {
+		offsets = append(offsets, cp.Offset)
+	}
+
+	if len(offsets) != checkpointBuffer {
+		t.Fatalf("got %d checkpoints want %d", len(offsets), checkpointBuffer)
+	}
+	for i, off := range offsets {
+		if want := uint64(100 - checkpointBuffer + 1 + i); off != want {
+			t.Fatalf("offsets = %v", offsets)
+		}
+	}
+}
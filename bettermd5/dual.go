@@ -0,0 +1,123 @@
+package bettermd5
+
+import (
+	"crypto/sha1"
+	"encoding"
+	"encoding/binary"
+	"hash"
+)
+
+// The size of a crypto/sha1 state: magic, five words, the block buffer and
+// the length.
+const sha1StateSize = 4 + 5*4 + sha1.BlockSize + 8
+
+// DualMD5SHA1 computes the MD5 and SHA-1 checksums of the same stream in one
+// pass. Both digests are captured by a single resumable state.
+type DualMD5SHA1 struct {
+	md5  *BetterDigest
+	sha1 hash.Hash
+}
+
+// NewDualMD5SHA1 returns a new DualMD5SHA1.
+func NewDualMD5SHA1() *DualMD5SHA1 {
+	return &DualMD5SHA1{
+		md5:  New(),
+		sha1: sha1.New(),
+	}
+}
+
+// NewDualMD5SHA1FromState returns a new DualMD5SHA1 from existing state.
+func NewDualMD5SHA1FromState(state []byte) *DualMD5SHA1 {
+	d := NewDualMD5SHA1()
+	d.SetState(state)
+	return d
+}
+
+func (d *DualMD5SHA1) Write(p []byte) (int, error) {
+	d.md5.Write(p)
+	d.sha1.Write(p)
+	return len(p), nil
+}
+
+func (d *DualMD5SHA1) Reset() {
+	d.md5.Reset()
+	d.sha1.Reset()
+}
+
+// MD5 returns the MD5 checksum of the data written so far.
+func (d *DualMD5SHA1) MD5() (sum [Size]byte) {
+	d.md5.Sum(sum[:0])
+	return
+}
+
+// SHA1 returns the SHA-1 checksum of the data written so far.
+func (d *DualMD5SHA1) SHA1() (sum [sha1.Size]byte) {
+	d.sha1.Sum(sum[:0])
+	return
+}
+
+// The state format is
+//
+//	"bdm1" || version || uvarint length of the MD5 state || MD5 state || SHA-1 state
+//
+// with the MD5 state as returned by GetState and the SHA-1 state in the
+// crypto/sha1 format.
+const (
+	dualMagic   = "bdm1"
+	dualVersion = 1
+)
+
+// GetState returns the state of both digests, to be restored by SetState.
+func (d *DualMD5SHA1) GetState() []byte {
+	md5State := d.md5.GetState()
+
+	b := make([]byte, 0, len(dualMagic)+1+binary.MaxVarintLen64+len(md5State)+sha1StateSize)
+	b = append(b, dualMagic...)
+	b = append(b, dualVersion)
+	b = binary.AppendUvarint(b, uint64(len(md5State)))
+	b = append(b, md5State...)
+
+	b, err := d.sha1.(encoding.BinaryAppender).AppendBinary(b)
+	if err != nil {
+		panic("bettermd5: SHA-1 state: " + err.Error())
+	}
+
+	return b
+}
+
+// SetState restores both digests from state returned by GetState. It
+// returns ErrInvalidState and leaves the digests unchanged if state is not
+// valid.
+func (d *DualMD5SHA1) SetState(state []byte) error {
+	if len(state) < len(dualMagic)+1 || string(state[:len(dualMagic)]) != dualMagic || state[len(dualMagic)] != dualVersion {
+		return ErrInvalidState
+	}
+	p := state[len(dualMagic)+1:]
+
+	n, l := binary.Uvarint(p)
+	if l <= 0 || n > uint64(len(p)-l) {
+		return ErrInvalidState
+	}
+	p = p[l:]
+	md5State, sha1State := p[:n], p[n:]
+
+	m := New()
+	if err := m.SetState(md5State); err != nil {
+		return ErrInvalidState
+	}
+
+	h := sha1.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(sha1State); err != nil {
+		return ErrInvalidState
+	}
+
+	// Both digests must have hashed the same stream.
+	if len(sha1State) != sha1StateSize || binary.BigEndian.Uint64(sha1State[len(sha1State)-8:]) != m.len {
+		return ErrInvalidState
+	}
+
+	d.md5 = m
+	d.sha1 = h
+
+	return nil
+}
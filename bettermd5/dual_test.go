@@ -0,0 +1,56 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"io"
+	"testing"
+)
+
+func TestDualMD5SHA1(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+
+	for _, split := range []int{0, 1, 64, 500, len(data)} {
+		d := NewDualMD5SHA1()
+		d.Write(data[:split])
+
+		d = NewDualMD5SHA1FromState(d.GetState())
+		d.Write(data[split:])
+
+		if s := d.MD5(); s != md5.Sum(data) {
+			t.Fatalf("split %d: MD5 = %x want %x", split, s, md5.Sum(data))
+		}
+		if s := d.SHA1(); s != sha1.Sum(data) {
+			t.Fatalf("split %d: SHA1 = %x want %x", split, s, sha1.Sum(data))
+		}
+	}
+
+}
+
+func TestDualMD5SHA1SetStateInvalid(t *testing.T) {
+	d := NewDualMD5SHA1()
+	io.WriteString(d, "abc")
+	state := d.GetState()
+
+	other := NewDualMD5SHA1()
+	other.md5.Write([]byte("x"))
+
+	for name, bad := range map[string][]byte{
+		"garbage":         []byte("garbage"),
+		"truncated":       state[:len(state)-1],
+		"trailing bytes":  append(append([]byte(nil), state...), 0),
+		"unknown version": append(append([]byte(dualMagic), 2), state[len(dualMagic)+1:]...),
+		"long md5 state":  append(append([]byte(dualMagic), dualVersion, 0xff), state[len(dualMagic)+2:]...),
+		"lengths differ":  other.GetState(),
+	} {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v want %v", name, err, ErrInvalidState)
+		}
+	}
+	if s := d.MD5(); s != md5.Sum([]byte("abc")) {
+		t.Fatal("failed SetState modified the digest")
+	}
+}
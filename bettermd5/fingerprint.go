@@ -0,0 +1,59 @@
+package bettermd5
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// FingerprintFile returns an MD5 fingerprint of the file at path for cache
+// invalidation. The digest absorbs
+//
+//	content || uint64 big-endian size
+//
+// and, if includeMTime is set, also
+//
+//	|| int64 big-endian modification time in Unix nanoseconds
+//
+// where size is the number of content bytes read. The result is stable
+// across runs as long as the content, and with includeMTime the modification
+// time, do not change. Because the size and modification time are hashed
+// after the content, a fingerprint is unlikely to equal the plain MD5 of the
+// content or the fingerprint of a different file, for input that is not
+// chosen by an attacker. MD5 collisions are easy to produce, so the
+// fingerprint must not be used where an attacker controls the files.
+func FingerprintFile(path string, includeMTime bool) (sum [Size]byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	d := getDigest()
+	defer putDigest(d)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	n, err := readFrom(d, f, *buf)
+	if err != nil {
+		return
+	}
+
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(n))
+	d.Write(l[:])
+
+	if includeMTime {
+		binary.BigEndian.PutUint64(l[:], uint64(info.ModTime().UnixNano()))
+		d.Write(l[:])
+	}
+
+	sum = d.checkSum()
+
+	return
+}
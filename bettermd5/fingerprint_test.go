@@ -0,0 +1,60 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFingerprintFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	content := []byte("fingerprinted content")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Unix(1500000000, 123456789)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	var frame []byte
+	frame = append(frame, content...)
+	frame = binary.BigEndian.AppendUint64(frame, uint64(len(content)))
+
+	sum, err := FingerprintFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := md5.Sum(frame); sum != want {
+		t.Fatalf("FingerprintFile without mtime = %x want %x", sum, want)
+	}
+
+	frame = binary.BigEndian.AppendUint64(frame, uint64(mtime.UnixNano()))
+
+	sum, err = FingerprintFile(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := md5.Sum(frame); sum != want {
+		t.Fatalf("FingerprintFile with mtime = %x want %x", sum, want)
+	}
+
+	touched := mtime.Add(time.Second)
+	if err := os.Chtimes(path, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := FingerprintFile(path, true); again == sum {
+		t.Fatal("touching the file did not change the fingerprint")
+	}
+	if again, _ := FingerprintFile(path, false); again != md5.Sum(frame[:len(frame)-8]) {
+		t.Fatal("touching the file changed the content-only fingerprint")
+	}
+
+	if _, err := FingerprintFile(filepath.Join(t.TempDir(), "missing"), false); !os.IsNotExist(err) {
+		t.Fatalf("missing file: err = %v", err)
+	}
+}
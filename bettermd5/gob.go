@@ -0,0 +1,320 @@
+package bettermd5
+
+import (
+	"encoding"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"sort"
+)
+
+// ErrRecursiveMapType is returned by SumGob for recursive types that contain
+// maps, which cannot be canonicalized.
+var ErrRecursiveMapType = errors.New("bettermd5: recursive type containing maps")
+
+// ErrUnorderedMapKey is returned by SumGob for maps whose keys contain
+// channels or unsafe pointers, which have no order that is the same in
+// every run.
+var ErrUnorderedMapKey = errors.New("bettermd5: map key type cannot be ordered")
+
+// SumGob returns the MD5 checksum of the gob encoding of v, made
+// deterministic so that equal values always produce the same checksum.
+//
+// Gob writes map entries in iteration order, which is random. Before
+// encoding, every map reachable from v is replaced by a slice of key/value
+// structs sorted by key. Values that contain no maps are encoded unchanged,
+// so for them the checksum equals the MD5 of their plain gob encoding. Maps
+// held in interface values and types with their own GobEncoder or
+// BinaryMarshaler are encoded as is.
+func SumGob(v interface{}) (sum [Size]byte, err error) {
+	rv := reflect.ValueOf(v)
+
+	if rv.IsValid() {
+		c := &canonicalizer{
+			types:  make(map[reflect.Type]reflect.Type),
+			active: make(map[reflect.Type]bool),
+		}
+
+		ct, err := c.canonicalType(rv.Type())
+		if err != nil {
+			return sum, err
+		}
+
+		if ct != rv.Type() {
+			v = canonicalValue(rv, ct).Interface()
+		}
+	}
+
+	d := getDigest()
+	defer putDigest(d)
+
+	if err = gob.NewEncoder(d).Encode(v); err != nil {
+		return
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+var (
+	gobEncoderType      = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+)
+
+type canonicalizer struct {
+	types  map[reflect.Type]reflect.Type
+	active map[reflect.Type]bool
+}
+
+// canonicalType returns t with every map replaced by a sorted slice of
+// key/value structs, or t itself if it contains no maps.
+func (c *canonicalizer) canonicalType(t reflect.Type) (reflect.Type, error) {
+	if ct, ok := c.types[t]; ok {
+		return ct, nil
+	}
+
+	if !hasMaps(t, make(map[reflect.Type]bool)) {
+		c.types[t] = t
+		return t, nil
+	}
+
+	if c.active[t] {
+		return nil, ErrRecursiveMapType
+	}
+	c.active[t] = true
+	defer delete(c.active, t)
+
+	var ct reflect.Type
+
+	switch t.Kind() {
+	case reflect.Map:
+		if !orderedKeyType(t.Key(), make(map[reflect.Type]bool)) {
+			return nil, ErrUnorderedMapKey
+		}
+		kt, err := c.canonicalType(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		vt, err := c.canonicalType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		ct = reflect.SliceOf(reflect.StructOf([]reflect.StructField{
+			{Name: "K", Type: kt},
+			{Name: "V", Type: vt},
+		}))
+
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		et, err := c.canonicalType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		switch t.Kind() {
+		case reflect.Ptr:
+			ct = reflect.PtrTo(et)
+		case reflect.Slice:
+			ct = reflect.SliceOf(et)
+		default:
+			ct = reflect.ArrayOf(t.Len(), et)
+		}
+
+	case reflect.Struct:
+		var fields []reflect.StructField
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !gobField(f) {
+				continue
+			}
+			ft, err := c.canonicalType(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: ft})
+		}
+		ct = reflect.StructOf(fields)
+	}
+
+	c.types[t] = ct
+
+	return ct, nil
+}
+
+// hasMaps reports whether t contains maps that gob would encode itself.
+func hasMaps(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] || hasGobMethods(t) {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return hasMaps(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); gobField(f) && hasMaps(f.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// orderedKeyType reports whether compareValues orders keys of type t the
+// same way in every run, which it cannot do for channels and unsafe
+// pointers.
+func orderedKeyType(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Chan, reflect.UnsafePointer:
+		return false
+	case reflect.Ptr, reflect.Array:
+		return orderedKeyType(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !orderedKeyType(t.Field(i).Type, seen) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasGobMethods reports whether t encodes itself.
+func hasGobMethods(t reflect.Type) bool {
+	return t.Implements(gobEncoderType) || reflect.PtrTo(t).Implements(gobEncoderType) ||
+		t.Implements(binaryMarshalerType) || reflect.PtrTo(t).Implements(binaryMarshalerType)
+}
+
+// gobField reports whether gob encodes the struct field f.
+func gobField(f reflect.StructField) bool {
+	k := f.Type.Kind()
+	return f.PkgPath == "" && k != reflect.Chan && k != reflect.Func
+}
+
+// canonicalValue converts v to the canonical type ct.
+func canonicalValue(v reflect.Value, ct reflect.Type) reflect.Value {
+	if v.Type() == ct {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(ct)
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return compareValues(keys[i], keys[j]) < 0
+		})
+		et := ct.Elem()
+		out := reflect.MakeSlice(ct, len(keys), len(keys))
+		for i, k := range keys {
+			e := out.Index(i)
+			e.Field(0).Set(canonicalValue(k, et.Field(0).Type))
+			e.Field(1).Set(canonicalValue(v.MapIndex(k), et.Field(1).Type))
+		}
+		return out
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(ct)
+		}
+		out := reflect.New(ct.Elem())
+		out.Elem().Set(canonicalValue(v.Elem(), ct.Elem()))
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(ct)
+		}
+		out := reflect.MakeSlice(ct, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(canonicalValue(v.Index(i), ct.Elem()))
+		}
+		return out
+
+	case reflect.Array:
+		out := reflect.New(ct).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(canonicalValue(v.Index(i), ct.Elem()))
+		}
+		return out
+
+	case reflect.Struct:
+		out := reflect.New(ct).Elem()
+		for i := 0; i < ct.NumField(); i++ {
+			f := ct.Field(i)
+			out.Field(i).Set(canonicalValue(v.FieldByName(f.Name), f.Type))
+		}
+		return out
+	}
+
+	return v
+}
+
+// compareValues orders map keys of the same type. Pointers are ordered by
+// the values they point to, nil first, so that the order does not depend on
+// addresses.
+func compareValues(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.Complex64, reflect.Complex128:
+		if c := compareOrdered(real(a.Complex()) < real(b.Complex()), real(a.Complex()) > real(b.Complex())); c != 0 {
+			return c
+		}
+		return compareOrdered(imag(a.Complex()) < imag(b.Complex()), imag(a.Complex()) > imag(b.Complex()))
+	case reflect.String:
+		return compareOrdered(a.String() < b.String(), a.String() > b.String())
+	case reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return compareOrdered(a.IsNil() && !b.IsNil(), !a.IsNil() && b.IsNil())
+		}
+		return compareValues(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if c := compareValues(a.Field(i), b.Field(i)); c != 0 {
+				return c
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if c := compareValues(a.Index(i), b.Index(i)); c != 0 {
+				return c
+			}
+		}
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return compareOrdered(a.IsNil() && !b.IsNil(), !a.IsNil() && b.IsNil())
+		}
+		at, bt := a.Elem().Type().String(), b.Elem().Type().String()
+		if at != bt {
+			return compareOrdered(at < bt, at > bt)
+		}
+		return compareValues(a.Elem(), b.Elem())
+	}
+	return 0
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/gob"
+	"fmt"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+type gobInner struct {
+	Tags map[string]int
+	Name string
+}
+
+type gobOuter struct {
+	ID     int
+	Inner  *gobInner
+	ByID   map[int]gobInner
+	List   []map[string]bool
+	hidden map[string]int
+}
+
+func TestSumGobDeterministic(t *testing.T) {
+	build := func(order []int) gobOuter {
+		v := gobOuter{
+			ID:     7,
+			Inner:  &gobInner{Tags: make(map[string]int), Name: "inner"},
+			ByID:   make(map[int]gobInner),
+			List:   []map[string]bool{make(map[string]bool)},
+			hidden: make(map[string]int),
+		}
+		for _, i := range order {
+			k := fmt.Sprintf("key%d", i)
+			v.Inner.Tags[k] = i
+			v.ByID[i] = gobInner{Tags: map[string]int{k: i, "x": 1}, Name: k}
+			v.List[0][k] = i%2 == 0
+			v.hidden[k] = i
+		}
+		return v
+	}
+
+	var order []int
+	for i := 0; i < 50; i++ {
+		order = append(order, i)
+	}
+	want, err := SumGob(build(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 0; run < 10; run++ {
+		reversed := make([]int, len(order))
+		for i := range order {
+			reversed[i] = order[len(order)-1-i]
+		}
+		sum, err := SumGob(build(reversed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum != want {
+			t.Fatalf("run %d: %x want %x", run, sum, want)
+		}
+	}
+
+	v := build(order)
+	v.ByID[3] = gobInner{Name: "changed"}
+	if sum, _ := SumGob(v); sum == want {
+		t.Fatal("SumGob: different values produced the same checksum")
+	}
+}
+
+func TestSumGobWithoutMaps(t *testing.T) {
+	type plain struct {
+		A int
+		B []string
+		T time.Time
+	}
+	v := plain{A: 1, B: []string{"x", "y"}, T: time.Unix(1e9, 0).UTC()}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := SumGob(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != md5.Sum(buf.Bytes()) {
+		t.Fatalf("SumGob = %x want %x", sum, md5.Sum(buf.Bytes()))
+	}
+}
+
+type gobNode struct {
+	Attrs    map[string]string
+	Children []*gobNode
+}
+
+func TestSumGobRecursive(t *testing.T) {
+	if _, err := SumGob(gobNode{}); err != ErrRecursiveMapType {
+		t.Fatalf("SumGob: err = %v want %v", err, ErrRecursiveMapType)
+	}
+}
+
+func TestSumGobPointerKeys(t *testing.T) {
+	build := func(order []int) map[*int]string {
+		m := make(map[*int]string)
+		for _, i := range order {
+			k := i
+			m[&k] = fmt.Sprint(i)
+		}
+		m[nil] = "nil"
+		return m
+	}
+
+	want, err := SumGob(build([]int{1, 2, 3, 4, 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 10; run++ {
+		if sum, _ := SumGob(build([]int{5, 3, 1, 4, 2})); sum != want {
+			t.Fatalf("run %d: %x want %x", run, sum, want)
+		}
+	}
+}
+
+func TestSumGobUnorderedKeys(t *testing.T) {
+	type chanKey struct {
+		C chan int
+	}
+
+	for name, v := range map[string]interface{}{
+		"chan":           map[chan int]int{},
+		"unsafe pointer": map[unsafe.Pointer]int{},
+		"struct field":   map[chanKey]int{},
+		"nested":         struct{ M map[[2]chan int]int }{},
+	} {
+		if _, err := SumGob(v); err != ErrUnorderedMapKey {
+			t.Fatalf("%s: err = %v want %v", name, err, ErrUnorderedMapKey)
+		}
+	}
+}
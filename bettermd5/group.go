@@ -0,0 +1,171 @@
+package bettermd5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrDuplicateID is returned by Group.Add for an id that was already added.
+var ErrDuplicateID = errors.New("bettermd5: duplicate stream id")
+
+// GroupError is returned by Group.Wait when some streams failed.
+type GroupError struct {
+	Errors map[string]error
+}
+
+func (e *GroupError) Error() string {
+	ids := make([]string, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%s: %v", id, e.Errors[id])
+	}
+
+	return fmt.Sprintf("bettermd5: %d streams failed: %s", len(ids), strings.Join(parts, "; "))
+}
+
+type groupJob struct {
+	id string
+	r  io.Reader
+}
+
+// Group hashes many independent streams on a fixed number of workers.
+type Group struct {
+	ctx  context.Context
+	jobs chan groupJob
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	seen    map[string]bool
+	results map[string][Size]byte
+	errs    map[string]error
+}
+
+// NewGroup returns a Group hashing streams on the given number of workers.
+// Once ctx is done, streams that have not started are not read and streams
+// being hashed stop at their next read, all failing with ctx.Err().
+func NewGroup(ctx context.Context, workers int) *Group {
+	if workers < 1 {
+		workers = 1
+	}
+
+	g := &Group{
+		ctx:     ctx,
+		jobs:    make(chan groupJob),
+		seen:    make(map[string]bool),
+		results: make(map[string][Size]byte),
+		errs:    make(map[string]error),
+	}
+
+	g.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go g.work()
+	}
+
+	return g
+}
+
+// Add queues r to be hashed under id. It blocks until a worker is free, so
+// at most the number of workers streams are open at a time. Add must not be
+// called after Wait.
+//
+// If id was already added, Add returns ErrDuplicateID without reading r.
+// The duplicate is not part of the group: the result or error of the stream
+// first added under id is what Wait reports.
+func (g *Group) Add(id string, r io.Reader) error {
+	g.mu.Lock()
+	dup := g.seen[id]
+	g.seen[id] = true
+	g.mu.Unlock()
+
+	if dup {
+		return ErrDuplicateID
+	}
+
+	select {
+	case g.jobs <- groupJob{id, r}:
+	case <-g.ctx.Done():
+		g.fail(id, g.ctx.Err())
+	}
+
+	return nil
+}
+
+// Wait waits for all added streams and returns the checksums of those that
+// were hashed. If any stream failed, the error is a *GroupError.
+func (g *Group) Wait() (map[string][Size]byte, error) {
+	close(g.jobs)
+	g.wg.Wait()
+
+	if len(g.errs) > 0 {
+		return g.results, &GroupError{Errors: g.errs}
+	}
+
+	return g.results, nil
+}
+
+func (g *Group) work() {
+	defer g.wg.Done()
+
+	for job := range g.jobs {
+		sum, err := g.hash(job.r)
+		if err != nil {
+			g.fail(job.id, err)
+			continue
+		}
+
+		g.mu.Lock()
+		g.results[job.id] = sum
+		g.mu.Unlock()
+	}
+}
+
+func (g *Group) hash(r io.Reader) (sum [Size]byte, err error) {
+	if err = g.ctx.Err(); err != nil {
+		return
+	}
+
+	d := getDigest()
+	defer putDigest(d)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err = readFrom(d, contextReader{g.ctx, r}, *buf); err != nil {
+		return
+	}
+
+	return d.checkSum(), nil
+}
+
+func (g *Group) fail(id string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Keep the first error for an id.
+	if _, ok := g.errs[id]; !ok {
+		g.errs[id] = err
+	}
+}
+
+// contextReader fails reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
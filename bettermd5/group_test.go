@@ -0,0 +1,86 @@
+package bettermd5
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestGroup(t *testing.T) {
+	g := NewGroup(context.Background(), 4)
+
+	want := make(map[string][Size]byte)
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("stream-%d", i)
+		data := bytes.Repeat([]byte{byte(i)}, i*1000)
+		want[id] = md5.Sum(data)
+		g.Add(id, bytes.NewReader(data))
+	}
+
+	errRead := errors.New("read failed")
+	g.Add("broken", iotest.ErrReader(errRead))
+
+	// A duplicate is rejected and leaves the stream first added under its
+	// id alone; it must not even be read.
+	if err := g.Add("stream-1", iotest.ErrReader(errRead)); err != ErrDuplicateID {
+		t.Fatalf("duplicate Add: err = %v", err)
+	}
+	if err := g.Add("broken", bytes.NewReader(nil)); err != ErrDuplicateID {
+		t.Fatalf("duplicate Add of a failing stream: err = %v", err)
+	}
+
+	results, err := g.Wait()
+	var gerr *GroupError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("Wait: err = %v", err)
+	}
+	if len(gerr.Errors) != 1 || gerr.Errors["broken"] != errRead {
+		t.Fatalf("Wait errors = %v", gerr.Errors)
+	}
+	if _, ok := results["broken"]; ok || len(results) != len(want) {
+		t.Fatalf("Wait returned %d results", len(results))
+	}
+
+	for id, sum := range want {
+		if results[id] != sum {
+			t.Fatalf("%s: %x want %x", id, results[id], sum)
+		}
+	}
+}
+
+type blockingReader struct {
+	ctx context.Context
+}
+
+func (r blockingReader) Read(p []byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, io.EOF
+}
+
+func TestGroupCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	g := NewGroup(ctx, 1)
+	g.Add("blocked", io.MultiReader(bytes.NewReader([]byte("x")), blockingReader{ctx}, bytes.NewReader([]byte("y"))))
+	cancel()
+	g.Add("late", bytes.NewReader([]byte("never read")))
+
+	results, err := g.Wait()
+	var gerr *GroupError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("Wait: err = %v", err)
+	}
+	for _, id := range []string{"blocked", "late"} {
+		if gerr.Errors[id] != context.Canceled {
+			t.Fatalf("%s: err = %v", id, gerr.Errors[id])
+		}
+	}
+	if len(results) != 0 {
+		t.Fatalf("results = %v", results)
+	}
+}
@@ -0,0 +1,111 @@
+package bettermd5
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// SumJSONCanonical returns the MD5 checksum of the canonical JSON encoding of
+// v, which does not depend on struct field order, map order or formatting.
+//
+// v is first marshaled with encoding/json and the result is rewritten in the
+// canonical form:
+//
+//   - no whitespace between tokens;
+//   - object members sorted by key, comparing the UTF-8 bytes of the keys;
+//   - strings escaped as encoding/json does, except that <, > and & are
+//     written literally;
+//   - numbers written exactly as encoding/json produced them.
+func SumJSONCanonical(v interface{}) (sum [Size]byte, err error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var generic interface{}
+	if err = dec.Decode(&generic); err != nil {
+		return
+	}
+
+	d := getDigest()
+	defer putDigest(d)
+
+	if err = writeCanonicalJSON(d, generic); err != nil {
+		return
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+func writeCanonicalJSON(w io.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		io.WriteString(w, "null")
+	case bool:
+		if v {
+			io.WriteString(w, "true")
+		} else {
+			io.WriteString(w, "false")
+		}
+	case json.Number:
+		io.WriteString(w, v.String())
+	case string:
+		return writeCanonicalJSONString(w, v)
+	case []interface{}:
+		io.WriteString(w, "[")
+		for i, e := range v {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			if err := writeCanonicalJSON(w, e); err != nil {
+				return err
+			}
+		}
+		io.WriteString(w, "]")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		io.WriteString(w, "{")
+		for i, k := range keys {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			if err := writeCanonicalJSONString(w, k); err != nil {
+				return err
+			}
+			io.WriteString(w, ":")
+			if err := writeCanonicalJSON(w, v[k]); err != nil {
+				return err
+			}
+		}
+		io.WriteString(w, "}")
+	}
+	return nil
+}
+
+func writeCanonicalJSONString(w io.Writer, s string) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+
+	// Drop the newline added by Encode.
+	_, err := w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+
+	return err
+}
@@ -0,0 +1,53 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"testing"
+)
+
+func TestSumJSONCanonical(t *testing.T) {
+	type inner struct {
+		Z int     `json:"z"`
+		A float64 `json:"a"`
+	}
+	type doc struct {
+		Name  string            `json:"name"`
+		Tags  map[string]string `json:"tags"`
+		Inner inner             `json:"inner"`
+		List  []interface{}     `json:"list"`
+		Empty *int              `json:"empty"`
+	}
+
+	v := doc{
+		Name:  "a <b> & c \"quoted\" é",
+		Tags:  map[string]string{"y": "1", "x": "2"},
+		Inner: inner{Z: 1, A: 2.5},
+		List:  []interface{}{true, false, 3, "s"},
+	}
+
+	canonical := `{"empty":null,"inner":{"a":2.5,"z":1},"list":[true,false,3,"s"],"name":"a <b> & c \"quoted\" é","tags":{"x":"2","y":"1"}}`
+
+	sum, err := SumJSONCanonical(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != md5.Sum([]byte(canonical)) {
+		t.Fatalf("SumJSONCanonical = %x want %x", sum, md5.Sum([]byte(canonical)))
+	}
+
+	// The same document with different key order and field order.
+	reordered := map[string]interface{}{
+		"tags":  map[string]string{"x": "2", "y": "1"},
+		"name":  "a <b> & c \"quoted\" é",
+		"list":  []interface{}{true, false, 3, "s"},
+		"inner": map[string]interface{}{"z": 1, "a": 2.5},
+		"empty": nil,
+	}
+	if s, _ := SumJSONCanonical(reordered); s != sum {
+		t.Fatalf("reordered = %x want %x", s, sum)
+	}
+
+	if _, err := SumJSONCanonical(make(chan int)); err == nil {
+		t.Fatal("SumJSONCanonical(chan): expected error")
+	}
+}
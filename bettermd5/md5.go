@@ -8,8 +8,7 @@
 package bettermd5
 
 import (
-	"bytes"
-	"encoding/gob"
+	"unsafe"
 )
 
 // The size of an MD5 checksum in bytes.
@@ -26,19 +25,24 @@ const (
 	init3 = 0x10325476
 )
 
-type betterDigestState struct {
-	S   [4]uint32
-	X   [chunk]byte
-	Nx  int
-	Len uint64
-}
-
 // BetterDigest represents the partial evaluation of a checksum.
+//
+// The total length is tracked in bytes as a uint64. MD5 commits to the length
+// in bits modulo 2^64, so inputs longer than 2^61 bytes are hashed with a
+// wrapped length, matching crypto/md5.
+//
+// A BetterDigest is not safe for concurrent use. GetState, Snapshot and Sum
+// read the same fields Write updates, so calling them from another goroutine
+// during a Write is a data race and can return a state mixing two positions,
+// which restores without error but resumes to a wrong checksum. Use a
+// SyncDigest when a digest is shared between goroutines.
 type BetterDigest struct {
 	s   [4]uint32
 	x   [chunk]byte
 	nx  int
 	len uint64
+
+	observer func(n uint64)
 }
 
 func (d *BetterDigest) Reset() {
@@ -50,6 +54,31 @@ func (d *BetterDigest) Reset() {
 	d.len = 0
 }
 
+// SetExtensionState sets the digest to the state right after a message
+// whose checksum is digest and whose padded length is totalLen, so that
+// writing more data continues that message past its padding. Only totalLen
+// needs to change to try different original lengths. totalLen must be a
+// multiple of the block size, otherwise SetExtensionState panics.
+func (d *BetterDigest) SetExtensionState(digest [Size]byte, totalLen uint64) {
+	if totalLen%chunk != 0 {
+		panic("bettermd5.SetExtensionState: length is not a multiple of the block size")
+	}
+	for i := range d.s {
+		d.s[i] = uint32(digest[i*4]) | uint32(digest[i*4+1])<<8 | uint32(digest[i*4+2])<<16 | uint32(digest[i*4+3])<<24
+	}
+	d.nx = 0
+	d.len = totalLen
+}
+
+// ResetSecure resets the digest like Reset and also zeroes the block buffer,
+// so bytes of a previously hashed secret do not linger in memory. Reset leaves
+// the buffer untouched, which is harmless for correctness and slightly faster;
+// use ResetSecure when the hashed data is sensitive.
+func (d *BetterDigest) ResetSecure() {
+	d.x = [chunk]byte{}
+	d.Reset()
+}
+
 // New returns a new hash.Hash computing the MD5 checksum.
 func New() *BetterDigest {
 	d := new(BetterDigest)
@@ -65,29 +94,79 @@ func NewFromState(state []byte) *BetterDigest {
 	return d
 }
 
+// NewSalted returns a new hash.Hash computing the MD5 checksum of salt
+// followed by everything written to it. The salt is absorbed before any
+// caller data, so the result always equals Sum(salt || data), and it is part
+// of the digest state, so a salted digest resumes correctly from GetState.
+func NewSalted(salt []byte) *BetterDigest {
+	d := New()
+	d.Write(salt)
+	return d
+}
+
 func (d *BetterDigest) GetState() []byte {
-	var state bytes.Buffer
+	state, _ := d.Snapshot().MarshalBinary()
 
-	enc := gob.NewEncoder(&state)
+	return state
+}
 
-	enc.Encode(betterDigestState{
-		S:   d.s,
-		X:   d.x,
-		Nx:  d.nx,
-		Len: d.len,
-	})
+func (d *BetterDigest) SetState(state []byte) error {
+	var s State
+
+	if err := s.UnmarshalBinary(state); err != nil {
+		return err
+	}
 
-	return state.Bytes()
+	return d.Restore(s)
 }
 
-func (d *BetterDigest) SetState(state []byte) error {
-	dec := gob.NewDecoder(bytes.NewBuffer(state))
+// MarshalBinary implements encoding.BinaryMarshaler. It uses the same format
+// as crypto/md5, so the state can be restored by either package. GetState
+// returns a more compact form of the same state.
+func (d *BetterDigest) MarshalBinary() ([]byte, error) {
+	return d.AppendBinary(make([]byte, 0, stdlibStateSize))
+}
+
+// AppendBinary implements encoding.BinaryAppender like MarshalBinary.
+func (d *BetterDigest) AppendBinary(b []byte) ([]byte, error) {
+	return appendStdlibState(b, d.Snapshot()), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It accepts state
+// marshaled by crypto/md5 as well as every format accepted by SetState.
+func (d *BetterDigest) UnmarshalBinary(b []byte) error {
+	return d.SetState(b)
+}
 
-	var s betterDigestState
+// StateEquals reports whether state describes the same digest state as d.
+// Only the meaningful parts of the state are compared (the chaining words,
+// the buffered bytes, and the total length), so two blobs with different
+// framing or stale bytes past the buffered prefix still compare equal.
+// Invalid state always compares unequal.
+func (d *BetterDigest) StateEquals(state []byte) bool {
+	var s State
 
-	err := dec.Decode(&s)
+	if err := s.UnmarshalBinary(state); err != nil {
+		return false
+	}
+
+	return d.Snapshot().Equal(s)
+}
+
+// Snapshot returns the current state of the digest.
+func (d *BetterDigest) Snapshot() State {
+	return State{
+		S:   d.s,
+		X:   d.x,
+		Nx:  d.nx,
+		Len: d.len,
+	}
+}
 
-	if err != nil {
+// Restore sets the digest to state s. It returns ErrInvalidState if s is
+// not a state a digest can be in.
+func (d *BetterDigest) Restore(s State) error {
+	if err := s.validate(); err != nil {
 		return err
 	}
 
@@ -99,31 +178,87 @@ func (d *BetterDigest) SetState(state []byte) error {
 	return nil
 }
 
+// Clone returns a copy of d that can be written to and summed independently,
+// so a common prefix only needs to be hashed once. The block observer is not
+// copied.
+func (d *BetterDigest) Clone() *BetterDigest {
+	c := *d
+	c.observer = nil
+	return &c
+}
+
+// Position returns the total number of bytes written and whether their
+// length in bits no longer fits in 64 bits. MD5 hashes the bit length modulo
+// 2^64, so once bitOverflow is set the checksum is still the standard one but
+// no longer commits to the full length.
+func (d *BetterDigest) Position() (totalBytes uint64, bitOverflow bool) {
+	return d.len, d.len >= 1<<61
+}
+
+// BlockCount returns the number of 64-byte blocks compressed so far, not
+// counting the partial block still buffered.
+func (d *BetterDigest) BlockCount() uint64 {
+	return (d.len - uint64(d.nx)) / chunk
+}
+
+// SetBlockObserver sets fn to be called each time the digest compresses
+// input, with the number of blocks compressed by that call. A nil fn removes
+// the observer. The observer is not part of the digest state, is kept across
+// Reset and does not see the padding blocks compressed by Sum.
+func (d *BetterDigest) SetBlockObserver(fn func(n uint64)) {
+	d.observer = fn
+}
+
+func (d *BetterDigest) block(p []byte) {
+	block(d, p)
+	if d.observer != nil {
+		d.observer(uint64(len(p) / chunk))
+	}
+}
+
 func (d *BetterDigest) Size() int { return Size }
 
 func (d *BetterDigest) BlockSize() int { return BlockSize }
 
-func (d *BetterDigest) Write(p []byte) (nn int, err error) {
+func (d *BetterDigest) Write(p []byte) (int, error) {
+	return writeFast(d, p, (*BetterDigest).write)
+}
+
+// writeFast is the body of Write. Small writes that do not complete a block
+// only need to be buffered and skip the alias check and block handling of
+// write. write is passed in rather than called directly because the inliner
+// charges a call through a parameter much less than a regular call, which
+// keeps Write inlinable. The indirect call is only made once a block is
+// complete, where it is small next to compressing the block.
+func writeFast(d *BetterDigest, p []byte, write func(*BetterDigest, []byte) (int, error)) (int, error) {
+	if d.nx+len(p) >= chunk {
+		return write(d, p)
+	}
+	d.len += uint64(len(p))
+	d.nx += copy(d.x[d.nx:], p)
+	return len(p), nil
+}
+
+func (d *BetterDigest) write(p []byte) (nn int, err error) {
 	nn = len(p)
 	d.len += uint64(nn)
+	if anyOverlap(p, d.x[:]) {
+		// p aliases the block buffer, which is overwritten below before all
+		// of p has been consumed.
+		p = append([]byte(nil), p...)
+	}
 	if d.nx > 0 {
-		n := len(p)
-		if n > chunk-d.nx {
-			n = chunk - d.nx
-		}
-		for i := 0; i < n; i++ {
-			d.x[d.nx+i] = p[i]
-		}
+		n := copy(d.x[d.nx:], p)
 		d.nx += n
 		if d.nx == chunk {
-			block(d, d.x[0:chunk])
+			d.block(d.x[0:chunk])
 			d.nx = 0
 		}
 		p = p[n:]
 	}
 	if len(p) >= chunk {
 		n := len(p) &^ (chunk - 1)
-		block(d, p[:n])
+		d.block(p[:n])
 		p = p[n:]
 	}
 	if len(p) > 0 {
@@ -132,13 +267,75 @@ func (d *BetterDigest) Write(p []byte) (nn int, err error) {
 	return
 }
 
+// WriteByte writes a single byte to the digest. It is cheaper than Write for
+// byte-at-a-time input and makes BetterDigest an io.ByteWriter.
+func (d *BetterDigest) WriteByte(c byte) error {
+	d.len++
+	d.x[d.nx] = c
+	d.nx++
+	if d.nx == chunk {
+		d.block(d.x[0:chunk])
+		d.nx = 0
+	}
+	return nil
+}
+
+// WriteAll writes each chunk to the digest in order, as if their
+// concatenation had been written in one call, and returns the total number of
+// bytes written. Empty and nil chunks are skipped.
+func (d *BetterDigest) WriteAll(chunks ...[]byte) (n int64, err error) {
+	for _, chunk := range chunks {
+		if len(chunk) == 0 {
+			continue
+		}
+		nn, _ := d.Write(chunk)
+		n += int64(nn)
+	}
+	return
+}
+
+// anyOverlap reports whether x and y share any memory.
+func anyOverlap(x, y []byte) bool {
+	return len(x) > 0 && len(y) > 0 &&
+		uintptr(unsafe.Pointer(&x[0])) <= uintptr(unsafe.Pointer(&y[len(y)-1])) &&
+		uintptr(unsafe.Pointer(&y[0])) <= uintptr(unsafe.Pointer(&x[len(x)-1]))
+}
+
 func (d0 *BetterDigest) Sum(in []byte) []byte {
 	// Make a copy of d0 so that caller can keep writing and summing.
 	d := *d0
+	d.observer = nil
 	hash := d.checkSum()
 	return append(in, hash[:]...)
 }
 
+// SumFixed returns the current checksum like Sum, as an array and without
+// allocating.
+func (d0 *BetterDigest) SumFixed() [Size]byte {
+	d := *d0
+	d.observer = nil
+	return d.checkSum()
+}
+
+// SumReset appends the current checksum to in and resets the digest. Unlike
+// Sum it finalizes the digest in place instead of on a copy, so the running
+// state is not preserved, which makes it slightly cheaper in loops that hash
+// one record after another.
+func (d *BetterDigest) SumReset(in []byte) []byte {
+	observer := d.observer
+	d.observer = nil
+	hash := d.checkSum()
+	d.observer = observer
+	d.Reset()
+	return append(in, hash[:]...)
+}
+
+// SumAndLen appends the current checksum to in like Sum and also returns the
+// number of bytes written so far, not counting padding.
+func (d *BetterDigest) SumAndLen(in []byte) (sum []byte, n uint64) {
+	return d.Sum(in), d.len
+}
+
 func (d *BetterDigest) checkSum() [Size]byte {
 	// Padding.  Add a 1 bit and 0 bits until 56 bytes mod 64.
 	len := d.len
@@ -150,13 +347,21 @@ func (d *BetterDigest) checkSum() [Size]byte {
 		d.Write(tmp[0 : 64+56-len%64])
 	}
 
-	// Length in bits.
+	// Length in bits. RFC 1321 appends the bit length modulo 2^64, so for
+	// inputs of 2^61 bytes or more the shift intentionally wraps, exactly as
+	// it does in crypto/md5.
 	len <<= 3
 	for i := uint(0); i < 8; i++ {
 		tmp[i] = byte(len >> (8 * i))
 	}
 	d.Write(tmp[0:8])
 
+	return d.output()
+}
+
+// output returns the checksum of a digest whose input, padding included, is
+// a whole number of blocks.
+func (d *BetterDigest) output() [Size]byte {
 	if d.nx != 0 {
 		panic("d.nx != 0")
 	}
@@ -179,3 +384,21 @@ func Sum(data []byte) [Size]byte {
 	d.Write(data)
 	return d.checkSum()
 }
+
+// SumCustomPad returns the checksum of data finalized with the padding
+// returned by pad instead of the RFC 1321 padding. pad is called with the
+// length of data in bytes. This is meant for matching devices that implement
+// a non-standard MD5 and gives no standard checksum; use Sum otherwise.
+//
+// data followed by the padding must be a whole number of 64-byte blocks,
+// otherwise SumCustomPad panics.
+func SumCustomPad(data []byte, pad func(len uint64) []byte) [Size]byte {
+	var d BetterDigest
+	d.Reset()
+	d.Write(data)
+	d.Write(pad(d.len))
+	if d.nx != 0 {
+		panic("bettermd5.SumCustomPad: padded length is not a multiple of the block size")
+	}
+	return d.output()
+}
@@ -5,9 +5,15 @@
 package bettermd5
 
 import (
+	"bytes"
+	"crypto/md5"
 	"crypto/rand"
+	"encoding"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"os/exec"
+	"regexp"
 	"testing"
 	"unsafe"
 )
@@ -82,6 +88,141 @@ func TestGolden(t *testing.T) {
 	}
 }
 
+func TestSumDoesNotMutate(t *testing.T) {
+	chunks := []string{"", "a", "bc", "The quick brown fox jumps over the lazy dog.", "", "0123456789012345678901234567890123456789012345678901234567890123", "tail"}
+
+	c := New()
+	var written []byte
+	for _, chunk := range chunks {
+		io.WriteString(c, chunk)
+		written = append(written, chunk...)
+
+		want := md5.Sum(written)
+		for i := 0; i < 3; i++ {
+			if s := c.Sum(nil); !bytes.Equal(s, want[:]) {
+				t.Fatalf("Sum #%d after %d bytes = %x want %x", i, len(written), s, want)
+			}
+		}
+	}
+
+	want := md5.Sum(written)
+	if s := c.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("final Sum = %x want %x", s, want)
+	}
+}
+
+func TestWriteAll(t *testing.T) {
+	chunks := [][]byte{nil, []byte("frag"), {}, []byte("mented payload "), nil, bytes.Repeat([]byte("x"), 100)}
+
+	var joined []byte
+	for _, chunk := range chunks {
+		joined = append(joined, chunk...)
+	}
+
+	c := New()
+	io.WriteString(c, "head:")
+	n, err := c.WriteAll(chunks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(joined)) {
+		t.Fatalf("WriteAll: n = %d want %d", n, len(joined))
+	}
+	n, _ = c.WriteAll()
+	if n != 0 {
+		t.Fatalf("WriteAll(): n = %d", n)
+	}
+
+	want := md5.Sum(append([]byte("head:"), joined...))
+	if s := c.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("WriteAll: %x want %x", s, want)
+	}
+}
+
+func TestResetSecure(t *testing.T) {
+	c := New()
+	io.WriteString(c, "secret key material")
+	c.ResetSecure()
+
+	if c.x != [chunk]byte{} {
+		t.Fatal("ResetSecure: block buffer not cleared")
+	}
+
+	io.WriteString(c, "abc")
+	if s := fmt.Sprintf("%x", c.Sum(nil)); s != "900150983cd24fb0d6963f7d28e17f72" {
+		t.Fatalf("ResetSecure: md5(abc) = %s", s)
+	}
+}
+
+func TestWriteAliasingBuffer(t *testing.T) {
+	data := make([]byte, 200)
+	for i := range data {
+		data[i] = byte(i*31 + 7)
+	}
+
+	for nx := 1; nx < chunk; nx += 3 {
+		for _, r := range [][2]int{{0, 10}, {0, nx}, {0, chunk}, {5, 40}, {nx - 1, chunk}, {chunk - 1, chunk}} {
+			lo, hi := r[0], r[1]
+			if lo >= hi {
+				continue
+			}
+
+			c := New()
+			c.Write(data[:chunk])
+			c.Write(data[chunk : chunk+nx])
+			// The buffer holds data[chunk:chunk+nx] in its first nx bytes and
+			// leftovers of data[:chunk] after that.
+			view := append([]byte{}, c.x[lo:hi]...)
+			c.Write(c.x[lo:hi])
+
+			want := md5.Sum(append(append([]byte{}, data[:chunk+nx]...), view...))
+			if s := c.Sum(nil); !bytes.Equal(s, want[:]) {
+				t.Fatalf("nx=%d write x[%d:%d]: %x want %x", nx, lo, hi, s, want)
+			}
+		}
+	}
+}
+
+func TestWriteInlinable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the package")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	out, err := exec.Command(gobin, "build", "-gcflags=-m", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	if !regexp.MustCompile(`(?m): can inline \(\*BetterDigest\)\.Write$`).Match(out) {
+		t.Fatalf("(*BetterDigest).Write is not inlinable:\n%s", out)
+	}
+}
+
+func TestWriteByte(t *testing.T) {
+	data := make([]byte, 3*chunk+5)
+	for i := range data {
+		data[i] = byte(i * 3)
+	}
+
+	var _ io.ByteWriter = New()
+
+	for split := 0; split <= len(data); split += 7 {
+		c := New()
+		c.Write(data[:split])
+		for _, b := range data[split:] {
+			c.WriteByte(b)
+		}
+
+		want := md5.Sum(data)
+		if s := c.Sum(nil); !bytes.Equal(s, want[:]) {
+			t.Fatalf("WriteByte after %d bytes: %x want %x", split, s, want)
+		}
+	}
+}
+
 func TestLarge(t *testing.T) {
 	const N = 10000
 	ok := "2bb571599a4180e1d542f76904adc3df" // md5sum of "0123456789" * 1000
@@ -106,6 +247,340 @@ func TestLarge(t *testing.T) {
 	}
 }
 
+func TestStateEquals(t *testing.T) {
+	data := []byte("The quick brown fox jumps over the lazy dog. 0123456789 0123456789")
+
+	for _, n := range []int{0, 1, 10, 63, 64, 65, len(data)} {
+		c := New()
+		c.Write(data[:n])
+		restored := NewFromState(c.GetState())
+
+		fresh := New()
+		fresh.Write(data[:n])
+
+		if !restored.StateEquals(fresh.GetState()) {
+			t.Fatalf("StateEquals(%d): restored state does not match fresh state", n)
+		}
+
+		other := New()
+		other.Write(data[:n])
+		other.Write([]byte("x"))
+
+		if restored.StateEquals(other.GetState()) {
+			t.Fatalf("StateEquals(%d): restored state matches a longer prefix", n)
+		}
+	}
+
+	// Bytes past the buffered prefix are not part of the state.
+	stale := New()
+	stale.Write(data[:40])
+	stale.Reset()
+	stale.Write(data[:3])
+
+	fresh := New()
+	fresh.Write(data[:3])
+
+	if !stale.StateEquals(fresh.GetState()) {
+		t.Fatal("StateEquals: stale buffer bytes affected comparison")
+	}
+
+	if fresh.StateEquals([]byte("garbage")) {
+		t.Fatal("StateEquals: invalid state compared equal")
+	}
+}
+
+func TestNewSalted(t *testing.T) {
+	salt := []byte("tenant-42")
+	data := []byte("identical content across tenants")
+
+	want := Sum(append(append([]byte{}, salt...), data...))
+
+	c := NewSalted(salt)
+	c.Write(data)
+	if s := c.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("NewSalted: %x want %x", s, want)
+	}
+
+	c = NewSalted(salt)
+	c.Write(data[:5])
+	c = NewFromState(c.GetState())
+	c.Write(data[5:])
+	if s := c.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("NewSalted resumed: %x want %x", s, want)
+	}
+
+	other := NewSalted([]byte("tenant-43"))
+	other.Write(data)
+	if s := other.Sum(nil); bytes.Equal(s, want[:]) {
+		t.Fatal("NewSalted: different salts produced the same checksum")
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	c := New()
+	io.WriteString(c, "abc")
+	state := c.GetState()
+
+	for _, bad := range [][]byte{nil, []byte("garbage"), state[:len(state)/2]} {
+		if err := New().SetState(bad); err != ErrInvalidState {
+			t.Fatalf("SetState(%q): err = %v want %v", bad, err, ErrInvalidState)
+		}
+	}
+}
+
+func TestBitLengthWrap(t *testing.T) {
+	tail := make([]byte, 3*chunk+11)
+	for i := range tail {
+		tail[i] = byte(i)
+	}
+
+	for _, start := range []uint64{1<<61 - 200, 1<<61 - 1, 1 << 61, 1<<64 - 100} {
+		st := State{
+			S:   [4]uint32{0x01234567, 0x89abcdef, 0xfedcba98, 0x76543210},
+			Nx:  int(start % chunk),
+			Len: start,
+		}
+		for i := 0; i < st.Nx; i++ {
+			st.X[i] = byte(0xa0 + i)
+		}
+
+		state, err := st.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := New()
+		if err := c.SetState(state); err != nil {
+			t.Fatal(err)
+		}
+		c.Write(tail)
+
+		// crypto/md5 can be put in the same state through its marshaled form.
+		std := md5.New()
+		marshaled := []byte("md5\x01")
+		for _, w := range st.S {
+			marshaled = binary.BigEndian.AppendUint32(marshaled, w)
+		}
+		marshaled = append(marshaled, st.X[:]...)
+		marshaled = binary.BigEndian.AppendUint64(marshaled, st.Len)
+		if err := std.(encoding.BinaryUnmarshaler).UnmarshalBinary(marshaled); err != nil {
+			t.Fatal(err)
+		}
+		std.Write(tail)
+
+		if s, want := c.Sum(nil), std.Sum(nil); !bytes.Equal(s, want) {
+			t.Fatalf("start %d: %x want %x", start, s, want)
+		}
+	}
+}
+
+func TestBlockObserver(t *testing.T) {
+	c := New()
+
+	var calls, blocks uint64
+	c.SetBlockObserver(func(n uint64) {
+		calls++
+		blocks += n
+	})
+
+	c.Write(make([]byte, 10))
+	c.Write(make([]byte, 60))
+	c.Write(make([]byte, 5*chunk))
+	for i := 0; i < chunk; i++ {
+		c.WriteByte(0)
+	}
+	c.Sum(nil)
+
+	// The first two writes complete one block, the third completes another
+	// and compresses four whole ones, and the byte writes complete one more.
+	if calls != 4 || blocks != 7 {
+		t.Fatalf("observer: %d calls, %d blocks", calls, blocks)
+	}
+	if c.BlockCount() != blocks {
+		t.Fatalf("BlockCount = %d want %d", c.BlockCount(), blocks)
+	}
+
+	c.SetBlockObserver(nil)
+	c.Write(make([]byte, chunk))
+	if calls != 4 || c.BlockCount() != 8 {
+		t.Fatalf("removed observer: %d calls, BlockCount = %d", calls, c.BlockCount())
+	}
+}
+
+func TestPosition(t *testing.T) {
+	c := New()
+	c.Write(make([]byte, 100))
+	if n, overflow := c.Position(); n != 100 || overflow {
+		t.Fatalf("Position = %d, %v", n, overflow)
+	}
+
+	for _, tc := range []struct {
+		len      uint64
+		overflow bool
+	}{
+		{1<<61 - 1, false},
+		{1 << 61, true},
+		{1<<64 - 1, true},
+	} {
+		if err := c.Restore(State{Nx: int(tc.len % chunk), Len: tc.len}); err != nil {
+			t.Fatal(err)
+		}
+		if n, overflow := c.Position(); n != tc.len || overflow != tc.overflow {
+			t.Fatalf("Position at %d = %d, %v", tc.len, n, overflow)
+		}
+	}
+}
+
+func TestSumAndLen(t *testing.T) {
+	c := New()
+	io.WriteString(c, "These pretzels are making me thirsty.")
+
+	sum, n := c.SumAndLen([]byte("prefix"))
+	if want := c.Sum([]byte("prefix")); !bytes.Equal(sum, want) {
+		t.Fatalf("SumAndLen = %x want %x", sum, want)
+	}
+	if n != 37 {
+		t.Fatalf("SumAndLen: n = %d want 37", n)
+	}
+}
+
+func TestSumReset(t *testing.T) {
+	c := New()
+	for i := 0; i < len(golden); i++ {
+		g := golden[i]
+		io.WriteString(c, g.in)
+		if s := fmt.Sprintf("%x", c.SumReset(nil)); s != g.out {
+			t.Fatalf("SumReset: md5(%s) = %s want %s", g.in, s, g.out)
+		}
+		if n, _ := c.Position(); n != 0 {
+			t.Fatalf("SumReset did not reset, len = %d", n)
+		}
+	}
+}
+
+func TestSumFixed(t *testing.T) {
+	c := New()
+	for i := 0; i < len(golden); i++ {
+		g := golden[i]
+		c.Reset()
+		io.WriteString(c, g.in)
+		if s := fmt.Sprintf("%x", c.SumFixed()); s != g.out {
+			t.Fatalf("SumFixed: md5(%s) = %s want %s", g.in, s, g.out)
+		}
+		if s := fmt.Sprintf("%x", c.Sum(nil)); s != g.out {
+			t.Fatalf("SumFixed changed the digest: md5(%s) = %s want %s", g.in, s, g.out)
+		}
+	}
+
+	c.Write([]byte("some data"))
+	if n := testing.AllocsPerRun(100, func() { c.SumFixed() }); n != 0 {
+		t.Fatalf("SumFixed allocates %v times", n)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c := New()
+	io.WriteString(c, "common prefix, longer than one block so that the clone also copies the chaining words ")
+	observed := 0
+	c.SetBlockObserver(func(n uint64) { observed++ })
+
+	a, b := c, c.Clone()
+	io.WriteString(a, "suffix a")
+	io.WriteString(b, "suffix b")
+
+	if want := md5.Sum([]byte("common prefix, longer than one block so that the clone also copies the chaining words suffix a")); !bytes.Equal(a.Sum(nil), want[:]) {
+		t.Fatal("original diverged after Clone")
+	}
+	if want := md5.Sum([]byte("common prefix, longer than one block so that the clone also copies the chaining words suffix b")); !bytes.Equal(b.Sum(nil), want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+
+	observed = 0
+	b.Write(make([]byte, 128))
+	if observed != 0 {
+		t.Fatal("clone kept the block observer")
+	}
+}
+
+func TestSumCustomPad(t *testing.T) {
+	standard := func(l uint64) []byte {
+		pad := make([]byte, 1, 72)
+		pad[0] = 0x80
+		for (l+uint64(len(pad)))%64 != 56 {
+			pad = append(pad, 0)
+		}
+		return binary.LittleEndian.AppendUint64(pad, l<<3)
+	}
+	for i := 0; i < len(golden); i++ {
+		g := golden[i]
+		if s := fmt.Sprintf("%x", SumCustomPad([]byte(g.in), standard)); s != g.out {
+			t.Fatalf("SumCustomPad(standard): md5(%s) = %s want %s", g.in, s, g.out)
+		}
+	}
+
+	// Padding without the length suffix differs from the standard checksum.
+	noLength := func(l uint64) []byte {
+		pad := make([]byte, 64-l%64)
+		pad[0] = 0x80
+		return pad
+	}
+	if SumCustomPad([]byte("abc"), noLength) == Sum([]byte("abc")) {
+		t.Fatal("SumCustomPad(noLength) equals the standard checksum")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("SumCustomPad with unaligned padding did not panic")
+		}
+	}()
+	SumCustomPad([]byte("abc"), func(uint64) []byte { return []byte{0x80} })
+}
+
+func TestSetExtensionState(t *testing.T) {
+	secret := []byte("unknown secret")
+	message := []byte("user=alice")
+	suffix := []byte("&admin=true")
+
+	original := Sum(append(append([]byte{}, secret...), message...))
+
+	padding := func(l int) []byte {
+		pad := []byte{0x80}
+		for (l+len(pad))%64 != 56 {
+			pad = append(pad, 0)
+		}
+		return binary.LittleEndian.AppendUint64(pad, uint64(l)<<3)
+	}
+
+	found := false
+	for secretLen := 1; secretLen <= 64; secretLen++ {
+		l := secretLen + len(message)
+		pad := padding(l)
+
+		c := New()
+		c.SetExtensionState(original, uint64(l+len(pad)))
+		c.Write(suffix)
+
+		forged := append(append(append(append([]byte{}, secret...), message...), pad...), suffix...)
+		want := md5.Sum(forged)
+		if bytes.Equal(c.Sum(nil), want[:]) {
+			if secretLen != len(secret) {
+				t.Fatalf("extension matched for secret length %d", secretLen)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("no candidate length produced the extended checksum")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("SetExtensionState with unaligned length did not panic")
+		}
+	}()
+	New().SetExtensionState(original, 65)
+}
+
 // Tests that blockGeneric (pure Go) and block (in assembly for amd64, 386, arm) match.
 func TestBlockGeneric(t *testing.T) {
 	gen, asm := New(), New()
@@ -113,7 +588,7 @@ func TestBlockGeneric(t *testing.T) {
 	rand.Read(buf)
 	blockGeneric(gen, buf)
 	block(asm, buf)
-	if *gen != *asm {
+	if gen.s != asm.s || gen.x != asm.x || gen.nx != asm.nx || gen.len != asm.len {
 		t.Error("block and blockGeneric resulted in different states")
 	}
 }
@@ -161,3 +636,16 @@ func BenchmarkHash1KUnaligned(b *testing.B) {
 func BenchmarkHash8KUnaligned(b *testing.B) {
 	benchmarkSize(b, 8192, true)
 }
+
+func BenchmarkManySmallWrites(b *testing.B) {
+	const total = 1 << 20
+	b.SetBytes(total)
+	p := buf[:1]
+	for i := 0; i < b.N; i++ {
+		bench.Reset()
+		for j := 0; j < total; j++ {
+			bench.Write(p)
+		}
+		bench.Sum(sum[:0])
+	}
+}
@@ -0,0 +1,70 @@
+package bettermd5
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// ErrFault is returned by SumMmapSafe when reading the data faults.
+var ErrFault = errors.New("bettermd5: memory fault while hashing")
+
+const mmapChunkSize = 1 << 20
+
+// SumMmapSafe returns the MD5 checksum of data, which is typically a
+// memory-mapped file. If the mapping becomes invalid while hashing, for
+// example because another process truncated the file, reading it raises
+// SIGBUS or SIGSEGV. SumMmapSafe turns such faults into an error wrapping
+// ErrFault that reports the offset of the failing chunk, instead of crashing
+// the program.
+//
+// Data is hashed in chunks of 1 MiB with faults made recoverable for the
+// calling goroutine only while hashing. Faults are still a sign that the
+// checksum cannot be trusted; callers should re-map and start over.
+func SumMmapSafe(data []byte) (sum [Size]byte, err error) {
+	d := getDigest()
+	defer putDigest(d)
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	for off := 0; off < len(data); off += mmapChunkSize {
+		end := off + mmapChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		p := data[off:end]
+		if err = recoverFault(func() { d.Write(p) }); err != nil {
+			return sum, fmt.Errorf("%w at offset %d: %v", ErrFault, off, err)
+		}
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+// faultError is implemented by the runtime errors of the panics raised for
+// memory faults when debug.SetPanicOnFault is set.
+type faultError interface {
+	runtime.Error
+	Addr() uintptr
+}
+
+// recoverFault calls fn and returns the error of a memory fault it raises.
+// Any other panic, such as a bug in the block function, is propagated.
+func recoverFault(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(faultError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	fn()
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSumMmapSafe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+
+	data := make([]byte, 3*mmapChunkSize+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m, err := syscall.Mmap(int(f.Fd()), 0, len(data), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Munmap(m)
+
+	sum, err := SumMmapSafe(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != md5.Sum(data) {
+		t.Fatalf("SumMmapSafe = %x want %x", sum, md5.Sum(data))
+	}
+
+	if err := f.Truncate(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SumMmapSafe(m); !errors.Is(err, ErrFault) {
+		t.Fatalf("SumMmapSafe after truncate: err = %v", err)
+	}
+}
+
+func TestRecoverFaultPropagatesOtherPanics(t *testing.T) {
+	for name, fn := range map[string]func(){
+		"index out of range": func() {
+			var b []byte
+			_ = b[len(b)]
+		},
+		"error value": func() { panic(errors.New("not a fault")) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s: panic was not propagated", name)
+				}
+			}()
+			err := recoverFault(fn)
+			t.Fatalf("%s: recoverFault returned %v", name, err)
+		}()
+	}
+}
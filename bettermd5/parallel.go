@@ -0,0 +1,238 @@
+package bettermd5
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrIncompleteManifest is returned by Manifest.Composite when some
+	// chunks have not been hashed.
+	ErrIncompleteManifest = errors.New("bettermd5: manifest is incomplete")
+
+	// ErrManifestMismatch is returned by HashParallel when the manifest to
+	// resume was made for a different size or chunk size.
+	ErrManifestMismatch = errors.New("bettermd5: manifest does not match input")
+)
+
+// Manifest holds the checksums of the fixed-size chunks of an input. Chunk i
+// covers bytes [i*ChunkSize, min((i+1)*ChunkSize, Size)); its checksum is
+// only meaningful if Done[i] is set.
+type Manifest struct {
+	Size      int64
+	ChunkSize int64
+	Sums      [][Size]byte
+	Done      []bool
+}
+
+// NewManifest returns an empty manifest for size bytes split into chunks of
+// chunkSize bytes. It panics if chunkSize is not positive or size is
+// negative.
+func NewManifest(size, chunkSize int64) *Manifest {
+	if chunkSize <= 0 || size < 0 {
+		panic("bettermd5.NewManifest: invalid size or chunk size")
+	}
+
+	n := chunkCount(size, chunkSize)
+
+	return &Manifest{
+		Size:      size,
+		ChunkSize: chunkSize,
+		Sums:      make([][Size]byte, n),
+		Done:      make([]bool, n),
+	}
+}
+
+// chunkCount returns the number of chunkSize chunks covering size bytes. It
+// does not round up by adding chunkSize-1, which overflows for sizes near
+// the int64 limit.
+func chunkCount(size, chunkSize int64) int64 {
+	n := size / chunkSize
+	if size%chunkSize != 0 {
+		n++
+	}
+	return n
+}
+
+// Complete reports whether every chunk has been hashed.
+func (m *Manifest) Complete() bool {
+	for _, done := range m.Done {
+		if !done {
+			return false
+		}
+	}
+	return true
+}
+
+// Composite returns the MD5 checksum of the concatenated chunk checksums, as
+// used by S3 multipart ETags. It returns ErrIncompleteManifest if some chunks
+// have not been hashed.
+func (m *Manifest) Composite() (sum [Size]byte, err error) {
+	if !m.Complete() {
+		return sum, ErrIncompleteManifest
+	}
+
+	var d BetterDigest
+	d.Reset()
+	for _, s := range m.Sums {
+		d.Write(s[:])
+	}
+
+	return d.checkSum(), nil
+}
+
+// The manifest format is
+//
+//	"bmdm" || version || uint64 size || uint64 chunk size || per chunk: done byte || checksum
+//
+// with integers in big-endian.
+const (
+	manifestMagic   = "bmdm"
+	manifestVersion = 1
+	manifestHeader  = len(manifestMagic) + 1 + 16
+)
+
+// MarshalBinary returns the byte form of m, to be restored with
+// UnmarshalBinary so that an interrupted HashParallel can be resumed.
+func (m *Manifest) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, manifestHeader+len(m.Sums)*(1+Size))
+	b = append(b, manifestMagic...)
+	b = append(b, manifestVersion)
+	b = binary.BigEndian.AppendUint64(b, uint64(m.Size))
+	b = binary.BigEndian.AppendUint64(b, uint64(m.ChunkSize))
+	for i, s := range m.Sums {
+		var done byte
+		if m.Done[i] {
+			done = 1
+		}
+		b = append(b, done)
+		b = append(b, s[:]...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary sets m from the byte form returned by MarshalBinary. It
+// returns ErrInvalidState if b is not a valid manifest.
+func (m *Manifest) UnmarshalBinary(b []byte) error {
+	if len(b) < manifestHeader || string(b[:len(manifestMagic)]) != manifestMagic || b[len(manifestMagic)] != manifestVersion {
+		return ErrInvalidState
+	}
+
+	p := b[len(manifestMagic)+1:]
+	size := int64(binary.BigEndian.Uint64(p))
+	chunkSize := int64(binary.BigEndian.Uint64(p[8:]))
+	p = p[16:]
+
+	if size < 0 || chunkSize <= 0 {
+		return ErrInvalidState
+	}
+	// Compare the count before multiplying so that a forged size cannot
+	// wrap n*(1+Size) around to len(p).
+	n := chunkCount(size, chunkSize)
+	if n > int64(len(p))/(1+Size) || int64(len(p)) != n*(1+Size) {
+		return ErrInvalidState
+	}
+
+	r := NewManifest(size, chunkSize)
+	for i := range r.Sums {
+		switch p[0] {
+		case 0:
+		case 1:
+			r.Done[i] = true
+		default:
+			return ErrInvalidState
+		}
+		copy(r.Sums[i][:], p[1:1+Size])
+		p = p[1+Size:]
+	}
+
+	*m = *r
+
+	return nil
+}
+
+// HashParallel hashes size bytes of r in chunks of m.ChunkSize bytes on the
+// given number of workers and records each chunk checksum in m. Chunks
+// already marked done in m are skipped, so a manifest saved after an
+// interrupted run resumes it. m must have been created by NewManifest for the
+// same size, otherwise ErrManifestMismatch is returned.
+//
+// On error or when ctx is done, HashParallel returns after the chunks in
+// progress finish or fail; m then holds every chunk hashed so far and can be
+// saved to resume later.
+func HashParallel(ctx context.Context, r io.ReaderAt, size int64, m *Manifest, workers int) error {
+	if m.Size != size || m.ChunkSize <= 0 || int64(len(m.Sums)) != chunkCount(size, m.ChunkSize) || len(m.Done) != len(m.Sums) {
+		return ErrManifestMismatch
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan int)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range chunks {
+				off := int64(i) * m.ChunkSize
+				n := m.ChunkSize
+				if n > size-off {
+					n = size - off
+				}
+
+				sum, err := SumReaderN(io.NewSectionReader(r, off, n), n)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+
+				// Each chunk is written by exactly one worker.
+				m.Sums[i] = sum
+				m.Done[i] = true
+			}
+		}()
+	}
+
+feed:
+	for i, done := range m.Done {
+		if done {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case chunks <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if !m.Complete() {
+		return ctx.Err()
+	}
+
+	return nil
+}
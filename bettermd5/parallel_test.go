@@ -0,0 +1,172 @@
+package bettermd5
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+func testParallelData() []byte {
+	data := make([]byte, 10*1000+123)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	return data
+}
+
+func compositeOf(data []byte, chunkSize int) [Size]byte {
+	var sums []byte
+	for off := 0; off < len(data); off += chunkSize {
+		end := off + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		s := md5.Sum(data[off:end])
+		sums = append(sums, s[:]...)
+	}
+	return md5.Sum(sums)
+}
+
+func TestHashParallel(t *testing.T) {
+	data := testParallelData()
+
+	m := NewManifest(int64(len(data)), 1000)
+	if err := HashParallel(context.Background(), bytes.NewReader(data), int64(len(data)), m, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, s := range m.Sums {
+		end := (i + 1) * 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		if s != md5.Sum(data[i*1000:end]) {
+			t.Fatalf("chunk %d checksum mismatch", i)
+		}
+	}
+
+	sum, err := m.Composite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := compositeOf(data, 1000); sum != want {
+		t.Fatalf("Composite = %x want %x", sum, want)
+	}
+}
+
+// failingReaderAt fails reads at or past off.
+type failingReaderAt struct {
+	data []byte
+	off  int64
+}
+
+var errReadAt = errors.New("read failed")
+
+func (r *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > r.off {
+		return 0, errReadAt
+	}
+	return copy(p, r.data[off:]), nil
+}
+
+func TestHashParallelResume(t *testing.T) {
+	data := testParallelData()
+	size := int64(len(data))
+
+	m := NewManifest(size, 1000)
+	if err := HashParallel(context.Background(), &failingReaderAt{data, 5000}, size, m, 2); err != errReadAt {
+		t.Fatalf("HashParallel: err = %v", err)
+	}
+	if m.Complete() {
+		t.Fatal("manifest complete after a failed read")
+	}
+	if _, err := m.Composite(); err != ErrIncompleteManifest {
+		t.Fatalf("Composite: err = %v", err)
+	}
+
+	saved, _ := m.MarshalBinary()
+
+	var resumed Manifest
+	if err := resumed.UnmarshalBinary(saved); err != nil {
+		t.Fatal(err)
+	}
+	for i := range m.Done {
+		if resumed.Done[i] != m.Done[i] || resumed.Sums[i] != m.Sums[i] {
+			t.Fatalf("chunk %d changed in the round trip", i)
+		}
+	}
+
+	// Only the missing chunks may be read; the failing reader would fail any
+	// chunk from 5000 on, so use the plain data now.
+	if err := HashParallel(context.Background(), bytes.NewReader(data), size, &resumed, 2); err != nil {
+		t.Fatal(err)
+	}
+	if sum, _ := resumed.Composite(); sum != compositeOf(data, 1000) {
+		t.Fatal("resumed composite mismatch")
+	}
+
+	if err := HashParallel(context.Background(), bytes.NewReader(data), size+1, &resumed, 2); err != ErrManifestMismatch {
+		t.Fatalf("size mismatch: err = %v", err)
+	}
+
+	for name, bad := range map[string][]byte{
+		"truncated":    saved[:len(saved)-1],
+		"bad magic":    append([]byte("nope"), saved[4:]...),
+		"bad done":     append(append([]byte(nil), saved[:manifestHeader]...), append([]byte{2}, saved[manifestHeader+1:]...)...),
+		"empty header": saved[:manifestHeader-1],
+	} {
+		if err := resumed.UnmarshalBinary(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestManifestUnmarshalLarge(t *testing.T) {
+	// Sizes near the int64 limit must neither overflow the chunk count nor
+	// let the expected length wrap around to a short payload.
+	m := NewManifest(math.MaxInt64, 1<<62)
+	if len(m.Sums) != 2 {
+		t.Fatalf("NewManifest: %d chunks", len(m.Sums))
+	}
+	saved, _ := m.MarshalBinary()
+	var resumed Manifest
+	if err := resumed.UnmarshalBinary(saved); err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	if resumed.Size != math.MaxInt64 || len(resumed.Sums) != 2 {
+		t.Fatalf("round trip: size %d, %d chunks", resumed.Size, len(resumed.Sums))
+	}
+
+	forged := func(size, chunkSize int64, payload int) []byte {
+		b := append([]byte(manifestMagic), manifestVersion)
+		b = binary.BigEndian.AppendUint64(b, uint64(size))
+		b = binary.BigEndian.AppendUint64(b, uint64(chunkSize))
+		return append(b, make([]byte, payload)...)
+	}
+	for name, bad := range map[string][]byte{
+		// 0x7878787878787879 * 17 wraps to 9 modulo 2^64.
+		"wrapped length": forged(0x7878787878787879, 1, 9),
+		"huge count":     forged(math.MaxInt64, 1, 1+Size),
+		"rounding":       forged(math.MaxInt64, 2, 1+Size),
+	} {
+		if err := resumed.UnmarshalBinary(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestHashParallelCancel(t *testing.T) {
+	data := testParallelData()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m := NewManifest(int64(len(data)), 1000)
+	if err := HashParallel(ctx, bytes.NewReader(data), int64(len(data)), m, 2); err != context.Canceled {
+		t.Fatalf("HashParallel: err = %v", err)
+	}
+}
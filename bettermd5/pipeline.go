@@ -0,0 +1,59 @@
+package bettermd5
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrBoundaryMismatch is returned by ContinueState when the state does not
+// end at the offset the segment starts at.
+var ErrBoundaryMismatch = errors.New("bettermd5: state does not end at segment offset")
+
+// MD5 processes its input strictly in order, so it cannot be split into
+// independent parts that are combined afterwards. What can be distributed is
+// the work as a pipeline: a worker hashes its segment starting from the state
+// its predecessor handed over and passes its own boundary state on. The
+// functions below are the building blocks for that; the final checksum equals
+// hashing all segments in one pass.
+
+// BoundaryState returns the state after hashing the first prefixLen bytes of
+// r.
+func BoundaryState(prefixLen int64, r io.ReaderAt) ([]byte, error) {
+	return ContinueState(New().GetState(), r, 0, prefixLen)
+}
+
+// ContinueState restores state, which must end at offset off, hashes the n
+// bytes of r starting at off, and returns the boundary state after them.
+func ContinueState(state []byte, r io.ReaderAt, off, n int64) ([]byte, error) {
+	d := New()
+	if err := d.SetState(state); err != nil {
+		return nil, err
+	}
+
+	if off < 0 || uint64(off) != d.len {
+		return nil, ErrBoundaryMismatch
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	m, err := readFrom(d, io.NewSectionReader(r, off, n), *buf)
+	if err != nil {
+		return nil, err
+	}
+	if m < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return d.GetState(), nil
+}
+
+// FinalSum returns the checksum of the data hashed up to state.
+func FinalSum(state []byte) (sum [Size]byte, err error) {
+	d := New()
+	if err = d.SetState(state); err != nil {
+		return
+	}
+
+	return d.checkSum(), nil
+}
@@ -0,0 +1,45 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 29)
+	}
+	r := bytes.NewReader(data)
+
+	bounds := []int64{0, 12345, 64 * 500, 77777, int64(len(data))}
+
+	state, err := BoundaryState(bounds[1], r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(bounds)-1; i++ {
+		state, err = ContinueState(state, r, bounds[i], bounds[i+1]-bounds[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum, err := FinalSum(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != md5.Sum(data) {
+		t.Fatalf("pipeline sum = %x want %x", sum, md5.Sum(data))
+	}
+
+	state, _ = BoundaryState(100, r)
+	if _, err := ContinueState(state, r, 200, 10); err != ErrBoundaryMismatch {
+		t.Fatalf("wrong offset: err = %v", err)
+	}
+	if _, err := ContinueState(state, r, 100, int64(len(data))); err != io.ErrUnexpectedEOF {
+		t.Fatalf("past end: err = %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package bettermd5
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+// ErrEmptyBuffer is returned when a caller-supplied read buffer has no room.
+var ErrEmptyBuffer = errors.New("bettermd5: empty buffer")
+
+// ErrLimitExceeded is returned by SumReaderLimited when the stream is longer
+// than the limit.
+var ErrLimitExceeded = errors.New("bettermd5: size limit exceeded")
+
+const readBufferSize = 32 * 1024
+
+var digestPool = sync.Pool{
+	New: func() interface{} {
+		return New()
+	},
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, readBufferSize)
+		return &b
+	},
+}
+
+func getDigest() *BetterDigest {
+	d := digestPool.Get().(*BetterDigest)
+	d.Reset()
+	return d
+}
+
+func putDigest(d *BetterDigest) {
+	// Pooled digests may have hashed secrets, don't hand them to the next user.
+	d.ResetSecure()
+	digestPool.Put(d)
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	bufferPool.Put(b)
+}
+
+// Drain reads r until EOF, discarding the data, and returns its MD5 checksum
+// and the number of bytes read. The buffer and digest used are taken from a
+// pool, so draining many readers does not allocate per call.
+func Drain(r io.Reader) (sum [Size]byte, n int64, err error) {
+	d := getDigest()
+	defer putDigest(d)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	n, err = readFrom(d, r, *buf)
+	if err != nil {
+		return
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+// SumReader returns the MD5 checksum of everything read from r until EOF,
+// reading through a pooled buffer.
+func SumReader(r io.Reader) (sum [Size]byte, err error) {
+	sum, _, err = Drain(r)
+	return
+}
+
+// SumReaderContext returns the MD5 checksum of everything read from r until
+// EOF like SumReader, checking ctx before every read. Once ctx is done it
+// stops reading and returns ctx.Err().
+func SumReaderContext(ctx context.Context, r io.Reader) (sum [Size]byte, err error) {
+	sum, _, err = Drain(contextReader{ctx, r})
+	return
+}
+
+// SumReaderBuf returns the MD5 checksum of everything read from r until EOF,
+// reading through buf. It makes no allocations of its own, which lets callers
+// keep one buffer for the lifetime of a worker.
+func SumReaderBuf(r io.Reader, buf []byte) (sum [Size]byte, err error) {
+	if len(buf) == 0 {
+		return sum, ErrEmptyBuffer
+	}
+
+	d := getDigest()
+	defer putDigest(d)
+
+	if _, err = readFrom(d, r, buf); err != nil {
+		return
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+// progressUnknownInterval is the number of bytes between progress reports
+// when the total size is unknown.
+const progressUnknownInterval = 1 << 20
+
+// SumReaderProgress returns the MD5 checksum of everything read from r until
+// EOF, calling fn as hashing progresses. total is the expected number of bytes;
+// fn receives the bytes hashed so far and the percentage done, and is called
+// at most once per percentage point. If total is not positive, fn is called
+// every MiB with pct set to -1. fn is always called once more when r is
+// exhausted, unless the last call already reported the final count.
+func SumReaderProgress(r io.Reader, total int64, fn func(done int64, pct float64)) (sum [Size]byte, err error) {
+	d := getDigest()
+	defer putDigest(d)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	p := &progressWriter{
+		d:        d,
+		total:    total,
+		fn:       fn,
+		reported: -1,
+	}
+
+	if _, err = readFrom(p, r, *buf); err != nil {
+		return
+	}
+
+	if p.reported != p.done {
+		p.report()
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+type progressWriter struct {
+	d        *BetterDigest
+	total    int64
+	fn       func(done int64, pct float64)
+	done     int64
+	reported int64
+	next     int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.d.Write(b)
+	p.done += int64(len(b))
+	if p.done >= p.next {
+		p.report()
+	}
+	return len(b), nil
+}
+
+func (p *progressWriter) report() {
+	p.reported = p.done
+
+	if p.total <= 0 {
+		p.next = p.done + progressUnknownInterval
+		p.fn(p.done, -1)
+		return
+	}
+
+	pct := float64(p.done) * 100 / float64(p.total)
+
+	// Next report once another full percentage point has been hashed.
+	point := p.done*100/p.total + 1
+	p.next = (point*p.total + 99) / 100
+
+	p.fn(p.done, pct)
+}
+
+// SumReaderCapture returns the MD5 checksum of everything read from r until
+// EOF along with a copy of at most the first captureMax bytes. The whole
+// stream is hashed even after the capture is full.
+func SumReaderCapture(r io.Reader, captureMax int) (sum [Size]byte, captured []byte, err error) {
+	d := getDigest()
+	defer putDigest(d)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	c := &captureWriter{d: d, max: captureMax}
+
+	_, err = readFrom(c, r, *buf)
+	captured = c.captured
+	if err != nil {
+		return
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+type captureWriter struct {
+	d        *BetterDigest
+	max      int
+	captured []byte
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	c.d.Write(p)
+	if room := c.max - len(c.captured); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		c.captured = append(c.captured, p[:room]...)
+	}
+	return len(p), nil
+}
+
+// SumReaderN returns the MD5 checksum of exactly the next n bytes read from
+// r. It never reads past those n bytes, so r is left positioned right after
+// them. If r ends early, it returns io.ErrUnexpectedEOF.
+func SumReaderN(r io.Reader, n int64) (sum [Size]byte, err error) {
+	d := getDigest()
+	defer putDigest(d)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	m, err := readFrom(d, io.LimitReader(r, n), *buf)
+	if err != nil {
+		return
+	}
+	if m < n {
+		return sum, io.ErrUnexpectedEOF
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+// SumReaderLimited returns the MD5 checksum of everything read from r until
+// EOF and the number of bytes read. If r yields more than max bytes, it stops
+// reading right after the first byte over the limit and returns
+// ErrLimitExceeded; read errors are returned as is.
+func SumReaderLimited(r io.Reader, max int64) (sum [Size]byte, n int64, err error) {
+	d := getDigest()
+	defer putDigest(d)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if max < math.MaxInt64 {
+		r = io.LimitReader(r, max+1)
+	}
+
+	n, err = readFrom(d, r, *buf)
+	if err != nil {
+		return
+	}
+	if n > max {
+		return sum, n, ErrLimitExceeded
+	}
+
+	sum = d.checkSum()
+
+	return
+}
+
+// readFrom writes everything read from r into w, reading through buf. w is
+// expected to be a digest or a wrapper around one, so write errors are not
+// checked.
+func readFrom(w io.Writer, r io.Reader, buf []byte) (n int64, err error) {
+	for {
+		m, rerr := r.Read(buf)
+		if m > 0 {
+			w.Write(buf[:m])
+			n += int64(m)
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
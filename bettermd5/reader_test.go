@@ -0,0 +1,249 @@
+package bettermd5
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDrain(t *testing.T) {
+	data := make([]byte, 3*readBufferSize+17)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	for _, size := range []int{0, 1, 63, 64, readBufferSize, len(data)} {
+		sum, n, err := Drain(iotest.OneByteReader(bytes.NewReader(data[:size])))
+		if err != nil {
+			t.Fatalf("Drain(%d): %v", size, err)
+		}
+		if n != int64(size) {
+			t.Fatalf("Drain(%d): n = %d", size, n)
+		}
+		if sum != md5.Sum(data[:size]) {
+			t.Fatalf("Drain(%d): sum = %x want %x", size, sum, md5.Sum(data[:size]))
+		}
+	}
+
+	errRead := errors.New("read error")
+	_, n, err := Drain(io.MultiReader(bytes.NewReader(data[:10]), iotest.ErrReader(errRead)))
+	if err != errRead {
+		t.Fatalf("Drain: err = %v want %v", err, errRead)
+	}
+	if n != 10 {
+		t.Fatalf("Drain: n = %d want 10", n)
+	}
+}
+
+func TestSumReaderBuf(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	for _, size := range []int{1, 3, 64, 100, 4096} {
+		sum, err := SumReaderBuf(bytes.NewReader(data), make([]byte, size))
+		if err != nil {
+			t.Fatalf("SumReaderBuf(%d): %v", size, err)
+		}
+		if sum != md5.Sum(data) {
+			t.Fatalf("SumReaderBuf(%d): sum = %x want %x", size, sum, md5.Sum(data))
+		}
+	}
+
+	if _, err := SumReaderBuf(bytes.NewReader(data), nil); err != ErrEmptyBuffer {
+		t.Fatalf("SumReaderBuf(nil): err = %v want %v", err, ErrEmptyBuffer)
+	}
+
+	buf := make([]byte, 256)
+	allocs := testing.AllocsPerRun(10, func() {
+		SumReaderBuf(bytes.NewReader(data), buf)
+	})
+	if allocs > 1 {
+		t.Fatalf("SumReaderBuf: %v allocations per run", allocs)
+	}
+}
+
+func TestSumReaderProgress(t *testing.T) {
+	data := make([]byte, 5*readBufferSize+123)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	var calls int
+	var last int64
+	lastPct := -1.0
+	sum, err := SumReaderProgress(iotest.HalfReader(bytes.NewReader(data)), int64(len(data)), func(done int64, pct float64) {
+		calls++
+		if done < last || pct < lastPct {
+			t.Fatalf("progress went backwards: %d %v after %d %v", done, pct, last, lastPct)
+		}
+		if calls > 1 && done != int64(len(data)) && pct-lastPct < 1 {
+			t.Fatalf("progress reported too often: %v after %v", pct, lastPct)
+		}
+		last, lastPct = done, pct
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != md5.Sum(data) {
+		t.Fatalf("SumReaderProgress: sum = %x want %x", sum, md5.Sum(data))
+	}
+	if last != int64(len(data)) || lastPct != 100 {
+		t.Fatalf("final progress = %d %v", last, lastPct)
+	}
+	if calls > 101 {
+		t.Fatalf("SumReaderProgress: %d calls", calls)
+	}
+
+	big := make([]byte, 3*progressUnknownInterval+1)
+	calls = 0
+	_, err = SumReaderProgress(bytes.NewReader(big), 0, func(done int64, pct float64) {
+		calls++
+		if pct != -1 {
+			t.Fatalf("unknown total: pct = %v", pct)
+		}
+		last = done
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != int64(len(big)) {
+		t.Fatalf("unknown total: final done = %d", last)
+	}
+	if calls < 3 || calls > 5 {
+		t.Fatalf("unknown total: %d calls", calls)
+	}
+}
+
+// cancelAfter cancels a context once n bytes have been read through it.
+type cancelAfter struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.n -= n; c.n <= 0 {
+		c.cancel()
+	}
+	return n, err
+}
+
+func TestSumReaderContext(t *testing.T) {
+	data := make([]byte, 4*readBufferSize)
+
+	sum, err := SumReaderContext(context.Background(), bytes.NewReader(data))
+	if err != nil || sum != md5.Sum(data) {
+		t.Fatalf("SumReaderContext = %x, %v", sum, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &cancelAfter{r: bytes.NewReader(data), n: readBufferSize, cancel: cancel}
+	if _, err := SumReaderContext(ctx, r); err != context.Canceled {
+		t.Fatalf("cancelled: err = %v", err)
+	}
+	if r.n != 0 {
+		t.Fatalf("cancelled: read %d bytes past the cancellation", -r.n)
+	}
+}
+
+func TestSumReaderCapture(t *testing.T) {
+	data := make([]byte, 2*readBufferSize+5)
+	for i := range data {
+		data[i] = byte(i * 5)
+	}
+
+	for _, max := range []int{0, 1, 100, readBufferSize + 3, len(data), len(data) + 10} {
+		sum, captured, err := SumReaderCapture(iotest.HalfReader(bytes.NewReader(data)), max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum != md5.Sum(data) {
+			t.Fatalf("max %d: sum = %x want %x", max, sum, md5.Sum(data))
+		}
+		want := data
+		if max < len(data) {
+			want = data[:max]
+		}
+		if !bytes.Equal(captured, want) {
+			t.Fatalf("max %d: captured %d bytes", max, len(captured))
+		}
+	}
+}
+
+func TestSumReader(t *testing.T) {
+	data := make([]byte, 2*readBufferSize+5)
+	for i := range data {
+		data[i] = byte(i * 11)
+	}
+
+	sum, err := SumReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := md5.Sum(data); sum != want {
+		t.Fatalf("SumReader = %x want %x", sum, want)
+	}
+
+	errRead := errors.New("read failed")
+	if _, err := SumReader(iotest.ErrReader(errRead)); err != errRead {
+		t.Fatalf("SumReader read error = %v", err)
+	}
+}
+
+func TestSumReaderN(t *testing.T) {
+	data := make([]byte, readBufferSize+100)
+	for i := range data {
+		data[i] = byte(i * 3)
+	}
+
+	r := bytes.NewReader(data)
+	for _, n := range []int64{0, 10, readBufferSize, 50} {
+		off := len(data) - r.Len()
+		sum, err := SumReaderN(r, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := md5.Sum(data[off : off+int(n)]); sum != want {
+			t.Fatalf("SumReaderN(%d) = %x want %x", n, sum, want)
+		}
+		if left := len(data) - off - int(n); r.Len() != left {
+			t.Fatalf("SumReaderN(%d) left %d bytes, want %d", n, r.Len(), left)
+		}
+	}
+
+	if _, err := SumReaderN(r, 100); err != io.ErrUnexpectedEOF {
+		t.Fatalf("SumReaderN past end: err = %v", err)
+	}
+}
+
+func TestSumReaderLimited(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	sum, n, err := SumReaderLimited(bytes.NewReader(data), int64(len(data)))
+	if err != nil || n != int64(len(data)) || sum != md5.Sum(data) {
+		t.Fatalf("SumReaderLimited at limit = %x, %d, %v", sum, n, err)
+	}
+
+	r := bytes.NewReader(data)
+	if _, n, err = SumReaderLimited(r, 500); err != ErrLimitExceeded || n != 501 {
+		t.Fatalf("SumReaderLimited over limit = %d, %v", n, err)
+	}
+	if r.Len() != 499 {
+		t.Fatalf("SumReaderLimited read %d bytes past the limit", 499-r.Len())
+	}
+
+	errRead := errors.New("read failed")
+	if _, _, err = SumReaderLimited(iotest.ErrReader(errRead), 500); err != errRead {
+		t.Fatalf("SumReaderLimited read error = %v", err)
+	}
+}
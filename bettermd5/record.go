@@ -0,0 +1,72 @@
+package bettermd5
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrInvalidRecordLength is returned by RecordHasher.Next when the length
+// function returns a negative length.
+var ErrInvalidRecordLength = errors.New("bettermd5: invalid record length")
+
+// RecordHasher reads length-prefixed records from a stream and returns the
+// MD5 checksum of each, while also keeping a checksum of the whole stream,
+// length prefixes included.
+type RecordHasher struct {
+	r       io.Reader
+	length  func(r io.Reader) (int, error)
+	record  *BetterDigest
+	overall *BetterDigest
+	buf     []byte
+}
+
+// NewRecordHasher returns a RecordHasher reading from r. length is called to
+// read the length of the next record from the reader it is given, and should
+// return io.EOF when there are no more records. Lengths are trusted, so length
+// should reject values too large for the caller.
+func NewRecordHasher(r io.Reader, length func(r io.Reader) (int, error)) *RecordHasher {
+	h := &RecordHasher{
+		length:  length,
+		record:  New(),
+		overall: New(),
+	}
+	h.r = io.TeeReader(r, h.overall)
+	return h
+}
+
+// Next reads the next record and returns it with its MD5 checksum. The
+// returned slice is only valid until the next call. At the end of the stream
+// Next returns io.EOF; a record cut short returns io.ErrUnexpectedEOF.
+func (h *RecordHasher) Next() (record []byte, sum [Size]byte, err error) {
+	n, err := h.length(h.r)
+	if err != nil {
+		return nil, sum, err
+	}
+	if n < 0 {
+		return nil, sum, ErrInvalidRecordLength
+	}
+
+	if cap(h.buf) < n {
+		h.buf = make([]byte, n)
+	}
+	record = h.buf[:n]
+
+	if _, err = io.ReadFull(h.r, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, sum, err
+	}
+
+	h.record.Reset()
+	h.record.Write(record)
+	h.record.Sum(sum[:0])
+
+	return record, sum, nil
+}
+
+// Overall returns the MD5 checksum of everything read from the stream so far.
+func (h *RecordHasher) Overall() (sum [Size]byte) {
+	h.overall.Sum(sum[:0])
+	return
+}
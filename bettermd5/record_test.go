@@ -0,0 +1,52 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func readUint16Length(r io.Reader) (int, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(l[:])), nil
+}
+
+func TestRecordHasher(t *testing.T) {
+	records := []string{"first", "", "a somewhat longer third record", "4"}
+
+	var stream []byte
+	for _, r := range records {
+		stream = binary.BigEndian.AppendUint16(stream, uint16(len(r)))
+		stream = append(stream, r...)
+	}
+
+	h := NewRecordHasher(bytes.NewReader(stream), readUint16Length)
+	for _, want := range records {
+		record, sum, err := h.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(record) != want {
+			t.Fatalf("record = %q want %q", record, want)
+		}
+		if sum != md5.Sum([]byte(want)) {
+			t.Fatalf("record %q: sum = %x", want, sum)
+		}
+	}
+	if _, _, err := h.Next(); err != io.EOF {
+		t.Fatalf("Next at end: err = %v", err)
+	}
+	if h.Overall() != md5.Sum(stream) {
+		t.Fatalf("Overall = %x want %x", h.Overall(), md5.Sum(stream))
+	}
+
+	h = NewRecordHasher(bytes.NewReader(stream[:4]), readUint16Length)
+	if _, _, err := h.Next(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated record: err = %v", err)
+	}
+}
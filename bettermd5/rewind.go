@@ -0,0 +1,109 @@
+package bettermd5
+
+import (
+	"errors"
+)
+
+// ErrRewindBeyondEnd is returned by RewindTo for offsets past the data
+// written so far.
+var ErrRewindBeyondEnd = errors.New("bettermd5: rewind offset beyond written data")
+
+type rewindCheckpoint struct {
+	offset uint64
+	state  []byte
+}
+
+// RewindableDigest is a digest that retains checkpoints as data is written
+// so it can be rewound to an earlier offset without rehashing from the start.
+type RewindableDigest struct {
+	d           *BetterDigest
+	every       uint64
+	keep        int
+	checkpoints []rewindCheckpoint
+}
+
+// NewRewindableDigest returns a new RewindableDigest that takes a checkpoint
+// every `every` bytes and retains the most recent `keep` of them. It panics if
+// every or keep is zero.
+func NewRewindableDigest(every uint64, keep int) *RewindableDigest {
+	if every == 0 || keep <= 0 {
+		panic("bettermd5.NewRewindableDigest: every and keep must be positive")
+	}
+	return &RewindableDigest{
+		d:     New(),
+		every: every,
+		keep:  keep,
+	}
+}
+
+func (r *RewindableDigest) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	for len(p) > 0 {
+		n := r.every - r.d.len%r.every
+		if uint64(len(p)) < n {
+			r.d.Write(p)
+			break
+		}
+		r.d.Write(p[:n])
+		p = p[n:]
+		r.checkpoint()
+	}
+	return
+}
+
+func (r *RewindableDigest) checkpoint() {
+	if len(r.checkpoints) == r.keep {
+		copy(r.checkpoints, r.checkpoints[1:])
+		r.checkpoints = r.checkpoints[:r.keep-1]
+	}
+	r.checkpoints = append(r.checkpoints, rewindCheckpoint{
+		offset: r.d.len,
+		state:  r.d.GetState(),
+	})
+}
+
+// Offset returns the number of bytes hashed so far.
+func (r *RewindableDigest) Offset() uint64 {
+	return r.d.len
+}
+
+// RewindTo restores the digest to the nearest retained checkpoint at or
+// before offset and returns the number of bytes between that checkpoint and
+// offset, which the caller must write again to reach offset. Checkpoints
+// after the restored one are discarded. If no retained checkpoint is early
+// enough, the digest is rewound to the start.
+func (r *RewindableDigest) RewindTo(offset uint64) (refeed uint64, err error) {
+	if offset > r.d.len {
+		return 0, ErrRewindBeyondEnd
+	}
+
+	i := len(r.checkpoints) - 1
+	for i >= 0 && r.checkpoints[i].offset > offset {
+		i--
+	}
+
+	if i < 0 {
+		r.checkpoints = r.checkpoints[:0]
+		r.d.Reset()
+		return offset, nil
+	}
+
+	c := r.checkpoints[i]
+	if err := r.d.SetState(c.state); err != nil {
+		return 0, err
+	}
+	r.checkpoints = r.checkpoints[:i+1]
+
+	return offset - c.offset, nil
+}
+
+func (r *RewindableDigest) Reset() {
+	r.d.Reset()
+	r.checkpoints = r.checkpoints[:0]
+}
+
+func (r *RewindableDigest) Sum(in []byte) []byte { return r.d.Sum(in) }
+
+func (r *RewindableDigest) Size() int { return Size }
+
+func (r *RewindableDigest) BlockSize() int { return BlockSize }
@@ -0,0 +1,63 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+)
+
+func TestRewindableDigest(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 11)
+	}
+
+	r := NewRewindableDigest(100, 3)
+	for i := 0; i < len(data); i += 33 {
+		end := i + 33
+		if end > len(data) {
+			end = len(data)
+		}
+		r.Write(data[i:end])
+	}
+
+	want := md5.Sum(data)
+	if s := r.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("Sum = %x want %x", s, want)
+	}
+
+	// Checkpoints at 800, 900 and 1000 are retained.
+	refeed, err := r.RewindTo(850)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refeed != 50 || r.Offset() != 800 {
+		t.Fatalf("RewindTo(850): refeed = %d offset = %d", refeed, r.Offset())
+	}
+
+	r.Write(data[800:850])
+	r.Write([]byte("different suffix"))
+	want = md5.Sum(append(append([]byte{}, data[:850]...), "different suffix"...))
+	if s := r.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("Sum after rewind = %x want %x", s, want)
+	}
+
+	// Older checkpoints were evicted, so this rewinds to the start.
+	refeed, err = r.RewindTo(500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refeed != 500 || r.Offset() != 0 {
+		t.Fatalf("RewindTo(500): refeed = %d offset = %d", refeed, r.Offset())
+	}
+
+	r.Write(data[:500])
+	want = md5.Sum(data[:500])
+	if s := r.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("Sum after rewind to start = %x want %x", s, want)
+	}
+
+	if _, err := r.RewindTo(501); err != ErrRewindBeyondEnd {
+		t.Fatalf("RewindTo(501): err = %v want %v", err, ErrRewindBeyondEnd)
+	}
+}
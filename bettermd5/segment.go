@@ -0,0 +1,280 @@
+package bettermd5
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ReadWriterAt is the file a SegmentHasher writes to and reads back from.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Segment is a byte range of the file of a SegmentHasher.
+type Segment struct {
+	Offset int64
+	Length int64
+}
+
+func (s Segment) end() int64 {
+	return s.Offset + s.Length
+}
+
+// SegmentHasher computes the MD5 checksum of a file that is written in
+// ranges in any order, such as by a parallel downloader. It is an
+// io.WriterAt: writes go through to the file, the bytes that extend the
+// hashed prefix are hashed right away, and the ranges written past a gap are
+// only recorded. When a gap fills, the ranges after it are read back from
+// the file and hashed, so nothing is buffered in memory.
+//
+// Its state holds the digest of the prefix and the map of ranges written
+// after it, so hashing survives a restart as long as the file is kept.
+//
+// WriteAt may be called from several goroutines at once for ranges that do
+// not overlap, as io.WriterAt allows.
+type SegmentHasher struct {
+	f    ReadWriterAt
+	size int64
+
+	mu   sync.Mutex
+	d    *BetterDigest
+	segs []Segment
+}
+
+// NewSegmentHasher returns a SegmentHasher for a file of size bytes written
+// to f.
+func NewSegmentHasher(f ReadWriterAt, size int64) *SegmentHasher {
+	return &SegmentHasher{
+		f:    f,
+		size: size,
+		d:    New(),
+	}
+}
+
+// WriteAt writes p to the file at off and hashes it as soon as everything
+// before it has been written. It returns ErrBlockBeyondEnd for writes past
+// the size of the file and ErrBlockOverlap for writes into the hashed
+// prefix, which would no longer match its checksum; neither is written.
+// Writes may overlap ranges that are not hashed yet. An error reading back
+// the file is returned after p was written; the range stays recorded and is
+// read again on the next write.
+func (h *SegmentHasher) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > h.size {
+		return 0, ErrBlockBeyondEnd
+	}
+	if off < h.Contiguous() {
+		return 0, ErrBlockOverlap
+	}
+
+	n, err := h.f.WriteAt(p, off)
+	if err != nil {
+		return n, err
+	}
+	if n == 0 {
+		return n, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if off < int64(h.d.len) {
+		return n, ErrBlockOverlap
+	}
+
+	if off == int64(h.d.len) {
+		h.d.Write(p)
+	} else {
+		h.add(Segment{Offset: off, Length: int64(n)})
+	}
+
+	return n, h.stitch()
+}
+
+// add records seg, merging it with the ranges it overlaps or touches.
+func (h *SegmentHasher) add(seg Segment) {
+	i := sort.Search(len(h.segs), func(i int) bool { return h.segs[i].end() >= seg.Offset })
+	j := i
+	for j < len(h.segs) && h.segs[j].Offset <= seg.end() {
+		if h.segs[j].Offset < seg.Offset {
+			seg.Length += seg.Offset - h.segs[j].Offset
+			seg.Offset = h.segs[j].Offset
+		}
+		if e := h.segs[j].end(); e > seg.end() {
+			seg.Length = e - seg.Offset
+		}
+		j++
+	}
+
+	h.segs = append(h.segs[:i], append([]Segment{seg}, h.segs[j:]...)...)
+}
+
+// stitch hashes the recorded ranges the prefix has reached and drops those
+// it has passed.
+func (h *SegmentHasher) stitch() error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	for len(h.segs) > 0 && h.segs[0].Offset <= int64(h.d.len) {
+		seg := h.segs[0]
+		start := int64(h.d.len)
+		if seg.end() <= start {
+			h.segs = h.segs[1:]
+			continue
+		}
+
+		n, err := readFrom(h.d, io.NewSectionReader(h.f, start, seg.end()-start), *buf)
+		if err == nil && start+n < seg.end() {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			// Keep the rest of the range recorded from the end of the prefix.
+			h.segs[0] = Segment{Offset: start + n, Length: seg.end() - start - n}
+			return err
+		}
+
+		h.segs = h.segs[1:]
+	}
+
+	return nil
+}
+
+// Contiguous returns the length of the prefix hashed so far.
+func (h *SegmentHasher) Contiguous() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return int64(h.d.len)
+}
+
+// Segments returns the ranges written after the hashed prefix, in order.
+func (h *SegmentHasher) Segments() []Segment {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]Segment(nil), h.segs...)
+}
+
+// Gaps returns the ranges of the file that have not been written yet, in
+// order, which is what a downloader resuming from a saved state still has
+// to fetch.
+func (h *SegmentHasher) Gaps() []Segment {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var gaps []Segment
+	off := int64(h.d.len)
+	for _, seg := range h.segs {
+		gaps = append(gaps, Segment{Offset: off, Length: seg.Offset - off})
+		off = seg.end()
+	}
+	if off < h.size {
+		gaps = append(gaps, Segment{Offset: off, Length: h.size - off})
+	}
+
+	return gaps
+}
+
+// Sum returns the MD5 checksum of the file. It returns ErrGaps unless the
+// whole file has been written and hashed.
+func (h *SegmentHasher) Sum() (sum [Size]byte, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err = h.stitch(); err != nil {
+		return
+	}
+	if int64(h.d.len) != h.size {
+		return sum, ErrGaps
+	}
+
+	h.d.Sum(sum[:0])
+
+	return sum, nil
+}
+
+// The state format is
+//
+//	"bsgh" || version || uvarint size || uvarint number of ranges ||
+//	(uvarint offset || uvarint length) for each range || digest state
+const (
+	segmentMagic   = "bsgh"
+	segmentVersion = 1
+)
+
+// GetState returns the state of h, to be restored by SetState.
+func (h *SegmentHasher) GetState() []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b := make([]byte, 0, 64+len(h.segs)*8)
+	b = append(b, segmentMagic...)
+	b = append(b, segmentVersion)
+	b = binary.AppendUvarint(b, uint64(h.size))
+	b = binary.AppendUvarint(b, uint64(len(h.segs)))
+	for _, seg := range h.segs {
+		b = binary.AppendUvarint(b, uint64(seg.Offset))
+		b = binary.AppendUvarint(b, uint64(seg.Length))
+	}
+	return append(b, h.d.GetState()...)
+}
+
+// SetState restores h from state returned by GetState of a SegmentHasher
+// of a file of the same size. The file itself is not checked: it must still
+// hold the ranges written before the state was saved. SetState returns
+// ErrInvalidState and leaves h unchanged if state is not valid.
+func (h *SegmentHasher) SetState(state []byte) error {
+	if len(state) < len(segmentMagic)+1 || string(state[:len(segmentMagic)]) != segmentMagic || state[len(segmentMagic)] != segmentVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(segmentMagic)+1:]
+	next := func() (int64, bool) {
+		v, n := binary.Uvarint(p)
+		if n <= 0 || v > uint64(h.size) {
+			return 0, false
+		}
+		p = p[n:]
+		return int64(v), true
+	}
+
+	size, ok := next()
+	if !ok || size != h.size {
+		return ErrInvalidState
+	}
+	count, ok := next()
+	if !ok || count > int64(len(p))/2 {
+		return ErrInvalidState
+	}
+
+	segs := make([]Segment, 0, count)
+	for i := int64(0); i < count; i++ {
+		off, ok1 := next()
+		length, ok2 := next()
+		if !ok1 || !ok2 || length == 0 || off+length > h.size {
+			return ErrInvalidState
+		}
+		if len(segs) > 0 && off <= segs[len(segs)-1].end() {
+			return ErrInvalidState
+		}
+		segs = append(segs, Segment{Offset: off, Length: length})
+	}
+
+	d := New()
+	if err := d.SetState(p); err != nil {
+		return ErrInvalidState
+	}
+	if d.len > uint64(h.size) || (len(segs) > 0 && segs[0].Offset < int64(d.len)) {
+		return ErrInvalidState
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.d = d
+	h.segs = segs
+
+	return nil
+}
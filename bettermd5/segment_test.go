@@ -0,0 +1,206 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"errors"
+	"io"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// memFile is a ReadWriterAt in memory that can be made to fail reads.
+type memFile struct {
+	mu       sync.Mutex
+	b        []byte
+	readErr  error
+	lastRead int64
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return copy(f.b[off:], p), nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.readErr != nil {
+		return 0, f.readErr
+	}
+	f.lastRead = off
+	n := copy(p, f.b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func segmentData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+func TestSegmentHasher(t *testing.T) {
+	data := segmentData(100000)
+	want := md5.Sum(data)
+
+	var ranges []Segment
+	for off := int64(0); off < int64(len(data)); off += 7000 {
+		end := off + 7000
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		ranges = append(ranges, Segment{Offset: off, Length: end - off})
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(ranges), func(i, j int) { ranges[i], ranges[j] = ranges[j], ranges[i] })
+
+	f := &memFile{b: make([]byte, len(data))}
+	h := NewSegmentHasher(f, int64(len(data)))
+	for i, r := range ranges {
+		if _, err := h.Sum(); err != ErrGaps {
+			t.Fatalf("Sum after %d ranges: err = %v", i, err)
+		}
+
+		// Restart halfway through.
+		if i == len(ranges)/2 {
+			state := h.GetState()
+			h = NewSegmentHasher(f, int64(len(data)))
+			if err := h.SetState(state); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		p := data[r.Offset:r.end()]
+		if n, err := h.WriteAt(p, r.Offset); n != len(p) || err != nil {
+			t.Fatalf("WriteAt(%d) = %d, %v", r.Offset, n, err)
+		}
+	}
+
+	sum, err := h.Sum()
+	if err != nil || sum != want {
+		t.Fatalf("Sum = %x, %v want %x", sum, err, want)
+	}
+	if h.Gaps() != nil || h.Segments() != nil {
+		t.Fatalf("gaps %v, segments %v after all writes", h.Gaps(), h.Segments())
+	}
+}
+
+func TestSegmentHasherMaps(t *testing.T) {
+	data := segmentData(1000)
+	f := &memFile{b: make([]byte, len(data))}
+	h := NewSegmentHasher(f, int64(len(data)))
+
+	write := func(off, end int64) {
+		if _, err := h.WriteAt(data[off:end], off); err != nil {
+			t.Fatalf("WriteAt(%d, %d): %v", off, end, err)
+		}
+	}
+
+	write(500, 600)
+	write(200, 300)
+	write(300, 350)
+	write(250, 400)
+	if got, want := h.Segments(), []Segment{{200, 200}, {500, 100}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("segments = %v want %v", got, want)
+	}
+	if got, want := h.Gaps(), []Segment{{0, 200}, {400, 100}, {600, 400}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("gaps = %v want %v", got, want)
+	}
+
+	// A write from the start past the first range hashes it directly and
+	// reads back only the rest of that range.
+	write(0, 300)
+	if h.Contiguous() != 400 || f.lastRead != 300 {
+		t.Fatalf("contiguous = %d, last read at %d", h.Contiguous(), f.lastRead)
+	}
+
+	if _, err := h.WriteAt(data[100:500], 100); err != ErrBlockOverlap {
+		t.Fatalf("write into prefix: err = %v", err)
+	}
+	if _, err := h.WriteAt(data[:10], 995); err != ErrBlockBeyondEnd {
+		t.Fatalf("write past end: err = %v", err)
+	}
+
+	// A failed read back keeps the range for the next attempt.
+	errRead := errors.New("read failed")
+	f.readErr = errRead
+	if _, err := h.WriteAt(data[400:500], 400); err != errRead {
+		t.Fatalf("failed read back: err = %v", err)
+	}
+	if got, want := h.Segments(), []Segment{{500, 100}}; h.Contiguous() != 500 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("after failed read back: contiguous %d, segments %v", h.Contiguous(), got)
+	}
+	restored := NewSegmentHasher(f, int64(len(data)))
+	if err := restored.SetState(h.GetState()); err != nil {
+		t.Fatalf("state after failed read back: %v", err)
+	}
+	f.readErr = nil
+
+	write(600, 1000)
+	sum, err := h.Sum()
+	if err != nil || sum != md5.Sum(data) {
+		t.Fatalf("Sum = %x, %v", sum, err)
+	}
+}
+
+func TestSegmentHasherConcurrent(t *testing.T) {
+	data := segmentData(1 << 20)
+	f := &memFile{b: make([]byte, len(data))}
+	h := NewSegmentHasher(f, int64(len(data)))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for off := w * 4096; off < len(data); off += 8 * 4096 {
+				h.WriteAt(data[off:off+4096], int64(off))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	sum, err := h.Sum()
+	if err != nil || sum != md5.Sum(data) {
+		t.Fatalf("Sum = %x, %v", sum, err)
+	}
+}
+
+func TestSegmentHasherSetStateInvalid(t *testing.T) {
+	data := segmentData(1000)
+	f := &memFile{b: make([]byte, len(data))}
+	h := NewSegmentHasher(f, int64(len(data)))
+	h.WriteAt(data[:100], 0)
+	h.WriteAt(data[500:600], 500)
+	state := h.GetState()
+
+	other := NewSegmentHasher(f, 2000)
+	other.WriteAt(data[:100], 0)
+	other.WriteAt(data[500:600], 500)
+
+	for name, bad := range map[string][]byte{
+		"empty":       nil,
+		"magic":       append([]byte("xxxx"), state[4:]...),
+		"version":     append(append([]byte(segmentMagic), 2), state[5:]...),
+		"truncated":   state[:len(state)-1],
+		"other size":  other.GetState(),
+		"no digest":   state[:9],
+		"range count": append([]byte(segmentMagic+"\x01"), 0xe8, 0x07, 0x05, 0x01, 0x02, 0x03),
+		"empty range": append(append([]byte(segmentMagic+"\x01"), 0xe8, 0x07, 0x01, 0x80, 0x05, 0x00), New().GetState()...),
+		"overlapping": append(append([]byte(segmentMagic+"\x01"), 0xe8, 0x07, 0x02, 0x10, 0x10, 0x18, 0x10), New().GetState()...),
+	} {
+		r := NewSegmentHasher(f, int64(len(data)))
+		if err := r.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+		if r.Contiguous() != 0 || r.Segments() != nil {
+			t.Fatalf("%s: failed SetState changed the hasher", name)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package bettermd5
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Value implements driver.Valuer, storing the digest as its GetState bytes.
+func (d *BetterDigest) Value() (driver.Value, error) {
+	return d.GetState(), nil
+}
+
+// Scan implements sql.Scanner, restoring the digest from state bytes stored
+// by Value. Invalid state returns the SetState error and leaves d unchanged.
+// Scanning into a nil *BetterDigest through database/sql allocates a new
+// digest, and a NULL column leaves the pointer nil.
+func (d *BetterDigest) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return d.SetState(src)
+	case string:
+		return d.SetState([]byte(src))
+	}
+
+	return fmt.Errorf("bettermd5: cannot scan %T into BetterDigest", src)
+}
@@ -0,0 +1,58 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+var (
+	_ driver.Valuer = (*BetterDigest)(nil)
+	_ sql.Scanner   = (*BetterDigest)(nil)
+)
+
+func TestValueScan(t *testing.T) {
+	data := bytes.Repeat([]byte("sql"), 100)
+
+	d := New()
+	d.Write(data[:150])
+
+	v, err := d.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []interface{}{v, string(v.([]byte))} {
+		d2 := new(BetterDigest)
+		if err := d2.Scan(src); err != nil {
+			t.Fatalf("Scan(%T): %v", src, err)
+		}
+		d2.Write(data[150:])
+
+		if want := md5.Sum(data); !bytes.Equal(d2.Sum(nil), want[:]) {
+			t.Fatalf("Scan(%T): checksum mismatch", src)
+		}
+	}
+}
+
+func TestScanInvalid(t *testing.T) {
+	d := New()
+	d.Write([]byte("keep"))
+	want := d.Sum(nil)
+
+	if err := d.Scan([]byte("garbage")); err != ErrInvalidState {
+		t.Fatalf("Scan: err = %v", err)
+	}
+	if err := d.Scan(nil); err == nil {
+		t.Fatal("Scan(nil): expected error")
+	}
+	if err := d.Scan(int64(1)); err == nil {
+		t.Fatal("Scan(int64): expected error")
+	}
+
+	if !bytes.Equal(d.Sum(nil), want) {
+		t.Fatal("failed Scan changed the digest")
+	}
+}
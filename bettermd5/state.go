@@ -0,0 +1,182 @@
+package bettermd5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/koofr/go-cryptoutils/internal/hashstate"
+)
+
+// ErrInvalidState is returned by SetState when the state is not in any
+// recognized format.
+var ErrInvalidState = errors.New("bettermd5: invalid state")
+
+// State is the state of a BetterDigest: the four chaining words, the block
+// buffer of which the first Nx bytes are pending, and the total number of
+// bytes written.
+type State struct {
+	S   [4]uint32
+	X   [chunk]byte
+	Nx  int
+	Len uint64
+}
+
+func (s State) validate() error {
+	if s.Nx < 0 || s.Nx >= chunk || uint64(s.Nx) != s.Len%chunk {
+		return ErrInvalidState
+	}
+
+	return nil
+}
+
+// Equal reports whether s and o describe the same digest state. Bytes of X
+// past Nx are not part of the state and are ignored.
+func (s State) Equal(o State) bool {
+	return s.S == o.S &&
+		s.Nx == o.Nx &&
+		s.Len == o.Len &&
+		s.Nx >= 0 && s.Nx <= chunk &&
+		bytes.Equal(s.X[:s.Nx], o.X[:o.Nx])
+}
+
+func (s State) String() string {
+	nx := s.Nx
+	if nx < 0 || nx > chunk {
+		nx = 0
+	}
+
+	return fmt.Sprintf("bettermd5.State{s: %08x %08x %08x %08x, len: %d, pending: %x}",
+		s.S[0], s.S[1], s.S[2], s.S[3], s.Len, s.X[:nx])
+}
+
+// The compact state format is the hashstate format with the magic "bmd5"
+// and the words and length in little-endian, the byte order of MD5.
+const (
+	stateMagic      = "bmd5"
+	stateHeaderSize = len(stateMagic) + 1 + 4*4 + 8
+)
+
+var stateFormat = hashstate.Format{
+	Magic:     stateMagic,
+	Version:   1,
+	Order:     binary.LittleEndian,
+	WordSize:  4,
+	Words:     4,
+	BlockSize: chunk,
+}
+
+// MarshalBinary returns the compact byte form of s, as returned by GetState.
+func (s State) MarshalBinary() ([]byte, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	words := []uint64{uint64(s.S[0]), uint64(s.S[1]), uint64(s.S[2]), uint64(s.S[3])}
+
+	return stateFormat.Append(make([]byte, 0, stateHeaderSize+s.Nx), words, s.Len, s.X[:s.Nx]), nil
+}
+
+// UnmarshalBinary sets s from its byte form, as accepted by SetState.
+func (s *State) UnmarshalBinary(state []byte) error {
+	st, err := decodeState(state)
+
+	if err != nil {
+		return err
+	}
+
+	if err := st.validate(); err != nil {
+		return err
+	}
+
+	*s = st
+
+	return nil
+}
+
+// The crypto/md5 state format, as produced by MarshalBinary, is
+//
+//	"md5\x01" || 4 big-endian uint32 words || block buffer, zero past the pending bytes || big-endian uint64 length
+const (
+	stdlibMagic     = "md5\x01"
+	stdlibStateSize = len(stdlibMagic) + 4*4 + chunk + 8
+)
+
+// appendStdlibState appends s in the crypto/md5 format to b.
+func appendStdlibState(b []byte, s State) []byte {
+	b = append(b, stdlibMagic...)
+	for _, w := range s.S {
+		b = binary.BigEndian.AppendUint32(b, w)
+	}
+	b = append(b, s.X[:s.Nx]...)
+	b = append(b, zeros[:chunk-s.Nx]...)
+	b = binary.BigEndian.AppendUint64(b, s.Len)
+	return b
+}
+
+// decodeState detects the format of state and decodes it. GetState produces
+// the compact format and MarshalBinary the crypto/md5 one; states starting
+// with neither magic are decoded as the gob format of earlier versions.
+func decodeState(state []byte) (s State, err error) {
+	if stateFormat.HasMagic(state) {
+		return decodeCompactState(state)
+	}
+
+	if bytes.HasPrefix(state, []byte(stdlibMagic)) {
+		return decodeStdlibState(state)
+	}
+
+	if s, err = decodeGobState(state); err != nil {
+		return s, ErrInvalidState
+	}
+
+	return s, nil
+}
+
+func decodeCompactState(state []byte) (s State, err error) {
+	var words [4]uint64
+
+	length, pending, err := stateFormat.Decode(state, words[:])
+	if err != nil {
+		return s, ErrInvalidState
+	}
+
+	for i, w := range words {
+		s.S[i] = uint32(w)
+	}
+	s.Len = length
+	s.Nx = copy(s.X[:], pending)
+
+	return s, nil
+}
+
+func decodeStdlibState(state []byte) (s State, err error) {
+	if len(state) != stdlibStateSize {
+		return s, ErrInvalidState
+	}
+
+	p := state[len(stdlibMagic):]
+	for i := range s.S {
+		s.S[i] = binary.BigEndian.Uint32(p[i*4:])
+	}
+	copy(s.X[:], p[16:16+chunk])
+	s.Len = binary.BigEndian.Uint64(p[16+chunk:])
+	s.Nx = int(s.Len % chunk)
+
+	return s, nil
+}
+
+// gobState is State without its methods, so gob decodes its fields instead
+// of calling UnmarshalBinary.
+type gobState State
+
+func decodeGobState(state []byte) (State, error) {
+	dec := gob.NewDecoder(bytes.NewBuffer(state))
+
+	var s gobState
+
+	err := dec.Decode(&s)
+
+	return State(s), err
+}
@@ -0,0 +1,218 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+const legacyInput = "The quick brown fox jumps over the lazy dog, twice over: the quick brown fox"
+
+// GetState output for legacyInput from before State was exported.
+const legacyGobState = "3b7f03010111626574746572446967657374537461746501ff8000010401015301ff820001015801ff840001024e7801040001034c656e010600000019ff81010101095b345d75696e74333201ff82000106010800001aff83010101095b36345d75696e743801ff8400010601ff8000005fff800104fcfd66760ffcba984f34fcd7d93d09fcecba4d860140636b2062726f776e20666f78000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000118014c00"
+
+func TestStateLegacyGob(t *testing.T) {
+	state, _ := hex.DecodeString(legacyGobState)
+
+	c := New()
+	if err := c.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprintf("%x", c.Sum(nil)); s != "f13da5d69edf2272ab211da300f11039" {
+		t.Fatalf("legacy state: %s", s)
+	}
+
+	fresh := New()
+	io.WriteString(fresh, legacyInput)
+	if !fresh.StateEquals(state) {
+		t.Fatal("legacy state does not equal fresh state")
+	}
+}
+
+func TestStateCompact(t *testing.T) {
+	c := New()
+	io.WriteString(c, legacyInput)
+
+	state := c.GetState()
+	if want := "626d6435010f7666fd344f98ba093dd9d7864dbaec4c00000000000000636b2062726f776e20666f78"; hex.EncodeToString(state) != want {
+		t.Fatalf("compact state = %x want %s", state, want)
+	}
+
+	d := New()
+	if err := d.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprintf("%x", d.Sum(nil)); s != "f13da5d69edf2272ab211da300f11039" {
+		t.Fatalf("compact state: %s", s)
+	}
+
+	bad := map[string][]byte{
+		"truncated header": state[:stateHeaderSize-1],
+		"missing pending":  state[:len(state)-1],
+		"trailing bytes":   append(append([]byte(nil), state...), 0),
+		"unknown version":  append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+	}
+	for name, state := range bad {
+		if err := d.SetState(state); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	c := New()
+	io.WriteString(c, legacyInput[:50])
+
+	s := c.Snapshot()
+	io.WriteString(c, legacyInput[50:])
+	want := c.Sum(nil)
+
+	r := New()
+	if err := r.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(r, legacyInput[50:])
+	if got := r.Sum(nil); string(got) != string(want) {
+		t.Fatalf("restored Sum = %x want %x", got, want)
+	}
+
+	b, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u State
+	if err := u.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !u.Equal(s) {
+		t.Fatalf("round trip: %v want %v", u, s)
+	}
+
+	for _, bad := range []State{
+		{Nx: -1},
+		{Nx: chunk, Len: chunk},
+		{Nx: 3, Len: 4},
+	} {
+		if err := New().Restore(bad); err != ErrInvalidState {
+			t.Fatalf("Restore(%v): err = %v", bad, err)
+		}
+		if _, err := bad.MarshalBinary(); err != ErrInvalidState {
+			t.Fatalf("MarshalBinary(%v): err = %v", bad, err)
+		}
+	}
+}
+
+func TestStateEqual(t *testing.T) {
+	a := New()
+	io.WriteString(a, "0123456789")
+	b := New()
+	io.WriteString(b, "01234567899876543210")
+	b.Reset()
+	io.WriteString(b, "0123456789")
+
+	if !a.Snapshot().Equal(b.Snapshot()) {
+		t.Fatal("Equal: stale buffer bytes affected comparison")
+	}
+
+	io.WriteString(b, "x")
+	if a.Snapshot().Equal(b.Snapshot()) {
+		t.Fatal("Equal: different states compared equal")
+	}
+}
+
+func TestStateString(t *testing.T) {
+	c := New()
+	io.WriteString(c, "abc")
+
+	s := c.Snapshot().String()
+	for _, part := range []string{"67452301", "len: 3", "pending: 616263"} {
+		if !strings.Contains(s, part) {
+			t.Fatalf("String() = %s, missing %q", s, part)
+		}
+	}
+}
+
+func TestResumePartialBuffer(t *testing.T) {
+	data := make([]byte, 3*chunk)
+	for i := range data {
+		data[i] = byte(i*7 + 1)
+	}
+	want := Sum(data)
+
+	for n := 0; n <= 2*chunk; n++ {
+		c := New()
+		// Leave stale bytes past the pending prefix.
+		c.Write(data[:chunk-1])
+		c.Reset()
+		c.Write(data[:n])
+
+		s := c.Snapshot()
+		// Only the pending prefix of the buffer is meaningful.
+		for i := s.Nx; i < chunk; i++ {
+			s.X[i] = 0
+		}
+
+		r := New()
+		if err := r.Restore(s); err != nil {
+			t.Fatal(err)
+		}
+		r = NewFromState(r.GetState())
+		r.Write(data[n:])
+
+		if got := r.Sum(nil); string(got) != string(want[:]) {
+			t.Fatalf("resume at %d (nx %d): %x want %x", n, s.Nx, got, want)
+		}
+	}
+}
+
+func TestMarshalBinaryStdlib(t *testing.T) {
+	data := []byte(legacyInput)
+
+	for _, n := range []int{0, 10, 64, len(data)} {
+		std := md5.New()
+		std.Write(data[:n])
+		stdState, err := std.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := New()
+		d.Write(data[:n])
+		state, err := d.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(state, stdState) {
+			t.Fatalf("%d: MarshalBinary = %x want %x", n, state, stdState)
+		}
+		if appended, _ := d.AppendBinary([]byte("x")); !bytes.Equal(appended[1:], stdState) {
+			t.Fatalf("%d: AppendBinary = %x", n, appended)
+		}
+
+		restored := New()
+		if err := restored.UnmarshalBinary(stdState); err != nil {
+			t.Fatal(err)
+		}
+		restored.Write(data[n:])
+
+		std = md5.New()
+		if err := std.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			t.Fatal(err)
+		}
+		std.Write(data[n:])
+
+		want := md5.Sum(data)
+		if !bytes.Equal(restored.Sum(nil), want[:]) || !bytes.Equal(std.Sum(nil), want[:]) {
+			t.Fatalf("%d: checksum mismatch after round trip", n)
+		}
+	}
+
+	if err := New().UnmarshalBinary([]byte(stdlibMagic + "short")); err != ErrInvalidState {
+		t.Fatalf("short stdlib state: err = %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package bettermd5
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// StreamOptions configures HashStream. All fields are optional.
+type StreamOptions struct {
+	// Load returns the last saved checkpoint, or nil if there is none.
+	Load func() ([]byte, error)
+
+	// Save stores a checkpoint. It is called every Interval bytes.
+	Save func(state []byte) error
+
+	// Clear removes the saved checkpoint once the stream has been hashed.
+	Clear func() error
+
+	// Interval is the number of bytes between checkpoints. Zero disables
+	// checkpointing.
+	Interval uint64
+
+	// Progress is called after each read with the total number of bytes
+	// hashed, including those covered by a loaded checkpoint.
+	Progress func(done uint64)
+
+	// Context, if set, is checked before every read. Once it is done
+	// HashStream saves a checkpoint, if checkpointing is enabled, and
+	// returns ctx.Err(), so the next run resumes where this one stopped.
+	Context context.Context
+
+	// Report is called after each read with the progress so far. It
+	// receives the state of the digest as well if ReportState is set.
+	Report      func(Report)
+	ReportState bool
+}
+
+// Report is the progress of HashStream passed to StreamOptions.Report.
+type Report struct {
+	// Done is the total number of bytes hashed, including those covered by
+	// a loaded checkpoint.
+	Done uint64
+
+	// Rate is the number of bytes hashed per second by this call, not
+	// counting a loaded checkpoint, or zero until some time has passed.
+	Rate float64
+
+	// State is the state of the digest after Done bytes if
+	// StreamOptions.ReportState is set, and nil otherwise.
+	State []byte
+}
+
+// HashStream returns the MD5 checksum of everything read from r until EOF,
+// saving checkpoints as it goes and resuming from a saved one. If Load
+// returns a checkpoint, the digest is restored from it and r is seeked to the
+// offset it covers before hashing continues, so an interrupted run picks up
+// where it stopped. The checkpoint is cleared when r is exhausted. Errors from
+// the callbacks are returned as is, invalid checkpoints return
+// ErrInvalidState and a checkpoint past the end of r returns
+// io.ErrUnexpectedEOF.
+func HashStream(r io.ReadSeeker, opts StreamOptions) (sum [Size]byte, err error) {
+	d := getDigest()
+	defer putDigest(d)
+
+	if opts.Load != nil {
+		state, err := opts.Load()
+		if err != nil {
+			return sum, err
+		}
+		if state != nil {
+			if err := d.SetState(state); err != nil {
+				return sum, err
+			}
+		}
+	}
+
+	if d.len > 0 {
+		if d.len > uint64(1<<63-1) {
+			return sum, ErrInvalidState
+		}
+		// Seeking past the end succeeds, check that r still holds all the
+		// data the checkpoint covers first.
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return sum, err
+		}
+		if uint64(end) < d.len {
+			return sum, io.ErrUnexpectedEOF
+		}
+		if _, err := r.Seek(int64(d.len), io.SeekStart); err != nil {
+			return sum, err
+		}
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	start, resumed := time.Now(), d.len
+
+	for {
+		if opts.Context != nil {
+			if err := opts.Context.Err(); err != nil {
+				if opts.Interval > 0 && opts.Save != nil {
+					if serr := opts.Save(d.GetState()); serr != nil {
+						return sum, serr
+					}
+				}
+				return sum, err
+			}
+		}
+
+		m, rerr := r.Read(*buf)
+		if m > 0 {
+			if err = streamWrite(d, (*buf)[:m], &opts); err != nil {
+				return
+			}
+			if opts.Report != nil {
+				opts.Report(report(d, resumed, start, opts.ReportState))
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return sum, rerr
+		}
+	}
+
+	sum = d.checkSum()
+
+	if opts.Clear != nil {
+		if err = opts.Clear(); err != nil {
+			return [Size]byte{}, err
+		}
+	}
+
+	return
+}
+
+func report(d *BetterDigest, resumed uint64, start time.Time, withState bool) Report {
+	rep := Report{Done: d.len}
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		rep.Rate = float64(d.len-resumed) / elapsed
+	}
+	if withState {
+		rep.State = d.GetState()
+	}
+	return rep
+}
+
+// streamWrite hashes p into d, saving a checkpoint at every interval
+// boundary, and reports progress.
+func streamWrite(d *BetterDigest, p []byte, opts *StreamOptions) error {
+	if every := opts.Interval; every == 0 || opts.Save == nil {
+		d.Write(p)
+	} else {
+		for len(p) > 0 {
+			n := every - d.len%every
+			if uint64(len(p)) < n {
+				d.Write(p)
+				break
+			}
+			d.Write(p[:n])
+			p = p[n:]
+			if err := opts.Save(d.GetState()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.Progress != nil {
+		opts.Progress(d.len)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package bettermd5
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"testing"
+)
+
+type memCheckpoint struct {
+	state   []byte
+	saves   int
+	cleared bool
+}
+
+func (m *memCheckpoint) options(interval uint64) StreamOptions {
+	return StreamOptions{
+		Load: func() ([]byte, error) { return m.state, nil },
+		Save: func(state []byte) error {
+			m.state = state
+			m.saves++
+			return nil
+		},
+		Clear: func() error {
+			m.state = nil
+			m.cleared = true
+			return nil
+		},
+		Interval: interval,
+	}
+}
+
+// failingAfter fails reads once n bytes have been read.
+type failingAfter struct {
+	io.ReadSeeker
+	n int64
+}
+
+var errInterrupted = errors.New("interrupted")
+
+func (f *failingAfter) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, errInterrupted
+	}
+	if int64(len(p)) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.ReadSeeker.Read(p)
+	f.n -= int64(n)
+	return n, err
+}
+
+func TestHashStreamResume(t *testing.T) {
+	data := make([]byte, 3*readBufferSize+123)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+	want := md5.Sum(data)
+
+	m := &memCheckpoint{}
+
+	_, err := HashStream(&failingAfter{bytes.NewReader(data), 2*readBufferSize + 10}, m.options(1000))
+	if err != errInterrupted {
+		t.Fatalf("interrupted run: err = %v", err)
+	}
+	if m.state == nil || m.cleared {
+		t.Fatal("interrupted run left no checkpoint")
+	}
+
+	saves := m.saves
+	var progress []uint64
+	opts := m.options(1000)
+	opts.Progress = func(done uint64) { progress = append(progress, done) }
+
+	sum, err := HashStream(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != want {
+		t.Fatalf("resumed sum = %x want %x", sum, want)
+	}
+	if !m.cleared || m.state != nil {
+		t.Fatal("checkpoint not cleared")
+	}
+	if wantSaves := len(data) / 1000; m.saves != wantSaves {
+		t.Fatalf("saves = %d want %d (%d before resume)", m.saves, wantSaves, saves)
+	}
+	if len(progress) == 0 || progress[0] <= 2*readBufferSize || progress[len(progress)-1] != uint64(len(data)) {
+		t.Fatalf("progress = %v", progress)
+	}
+}
+
+func TestHashStreamErrors(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 5000)
+
+	d := New()
+	d.Write(data)
+	state := d.GetState()
+
+	load := func(state []byte) StreamOptions {
+		return StreamOptions{Load: func() ([]byte, error) { return state, nil }}
+	}
+
+	if _, err := HashStream(bytes.NewReader(data[:4000]), load(state)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("checkpoint past end: err = %v", err)
+	}
+	if _, err := HashStream(bytes.NewReader(data), load([]byte("garbage"))); err != ErrInvalidState {
+		t.Fatalf("invalid checkpoint: err = %v", err)
+	}
+
+	errSave := errors.New("save failed")
+	opts := StreamOptions{
+		Save:     func([]byte) error { return errSave },
+		Interval: 100,
+	}
+	if _, err := HashStream(bytes.NewReader(data), opts); err != errSave {
+		t.Fatalf("save error: err = %v", err)
+	}
+
+	sum, err := HashStream(bytes.NewReader(data), StreamOptions{})
+	if err != nil || sum != md5.Sum(data) {
+		t.Fatalf("no options = %x, %v", sum, err)
+	}
+}
+
+func TestHashStreamContext(t *testing.T) {
+	data := make([]byte, 4*readBufferSize+5)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+
+	m := &memCheckpoint{}
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := m.options(1 << 20)
+	opts.Context = ctx
+
+	r := &cancelAfter{r: bytes.NewReader(data), n: 2 * readBufferSize, cancel: cancel}
+	if _, err := HashStream(struct {
+		io.Reader
+		io.Seeker
+	}{r, nil}, opts); err != context.Canceled {
+		t.Fatalf("cancelled: err = %v", err)
+	}
+	if m.saves != 1 {
+		t.Fatalf("cancelled: %d saves", m.saves)
+	}
+	d := New()
+	d.Write(data[:2*readBufferSize])
+	if !bytes.Equal(m.state, d.GetState()) {
+		t.Fatal("cancelled: checkpoint is not at the cancellation")
+	}
+
+	var reports []Report
+	opts = m.options(1 << 20)
+	opts.Report = func(rep Report) { reports = append(reports, rep) }
+	opts.ReportState = true
+
+	sum, err := HashStream(bytes.NewReader(data), opts)
+	if err != nil || sum != md5.Sum(data) {
+		t.Fatalf("resumed = %x, %v", sum, err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("%d reports", len(reports))
+	}
+	for _, rep := range reports {
+		d := New()
+		d.Write(data[:rep.Done])
+		if rep.Rate < 0 || !bytes.Equal(rep.State, d.GetState()) {
+			t.Fatalf("report at %d: rate %v, state %x", rep.Done, rep.Rate, rep.State)
+		}
+	}
+	if reports[len(reports)-1].Done != uint64(len(data)) {
+		t.Fatalf("last report at %d", reports[len(reports)-1].Done)
+	}
+
+	reports = nil
+	opts = StreamOptions{Report: func(rep Report) { reports = append(reports, rep) }}
+	if _, err := HashStream(bytes.NewReader(data), opts); err != nil {
+		t.Fatal(err)
+	}
+	if reports[0].State != nil {
+		t.Fatal("state reported without ReportState")
+	}
+}
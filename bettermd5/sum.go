@@ -0,0 +1,86 @@
+package bettermd5
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// ErrDataTooLarge is returned by SumPadded when the data is longer than the
+// size it should be padded to.
+var ErrDataTooLarge = errors.New("bettermd5: data longer than padded size")
+
+// zeros is written repeatedly by SumPadded instead of allocating the padding.
+var zeros [4096]byte
+
+// SumKeyValues returns an MD5 fingerprint of kv that does not depend on map
+// iteration order. Keys are sorted byte-wise and, for each pair, the digest
+// absorbs
+//
+//	uint64 big-endian len(key) || key || uint64 big-endian len(value) || value
+//
+// The length prefixes keep pairs such as {"a": "bc"} and {"ab": "c"} apart.
+// An empty or nil map gives the checksum of no input.
+func SumKeyValues(kv map[string][]byte) [Size]byte {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	d := getDigest()
+	defer putDigest(d)
+
+	var l [8]byte
+	for _, k := range keys {
+		v := kv[k]
+		binary.BigEndian.PutUint64(l[:], uint64(len(k)))
+		d.Write(l[:])
+		d.Write([]byte(k))
+		binary.BigEndian.PutUint64(l[:], uint64(len(v)))
+		d.Write(l[:])
+		d.Write(v)
+	}
+
+	return d.checkSum()
+}
+
+// SumWithLength returns the MD5 checksum of the 8-byte big-endian length of
+// data followed by data. Committing to the length up front keeps inputs of
+// different lengths from sharing a prefix state, but this is not a MAC and
+// does not replace HMAC.
+func SumWithLength(data []byte) [Size]byte {
+	var d BetterDigest
+	d.Reset()
+
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(len(data)))
+	d.Write(l[:])
+	d.Write(data)
+
+	return d.checkSum()
+}
+
+// SumPadded returns the MD5 checksum of data followed by zero bytes up to
+// size bytes in total, as used by fixed-size record formats. The padding is
+// not allocated. It returns ErrDataTooLarge if data is longer than size.
+func SumPadded(data []byte, size int) (sum [Size]byte, err error) {
+	if len(data) > size {
+		return sum, ErrDataTooLarge
+	}
+
+	var d BetterDigest
+	d.Reset()
+	d.Write(data)
+
+	for pad := size - len(data); pad > 0; {
+		n := pad
+		if n > len(zeros) {
+			n = len(zeros)
+		}
+		d.Write(zeros[:n])
+		pad -= n
+	}
+
+	return d.checkSum(), nil
+}
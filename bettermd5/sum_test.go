@@ -0,0 +1,78 @@
+package bettermd5
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"testing"
+)
+
+func TestSumKeyValues(t *testing.T) {
+	a := map[string][]byte{"a": []byte("bc")}
+	b := map[string][]byte{"ab": []byte("c")}
+	if SumKeyValues(a) == SumKeyValues(b) {
+		t.Fatal("SumKeyValues: ambiguous framing")
+	}
+
+	kv := make(map[string][]byte)
+	for _, k := range []string{"zeta", "alpha", "mid", ""} {
+		kv[k] = []byte("value of " + k)
+	}
+	want := SumKeyValues(kv)
+	for i := 0; i < 10; i++ {
+		copied := make(map[string][]byte)
+		for k, v := range kv {
+			copied[k] = v
+		}
+		if SumKeyValues(copied) != want {
+			t.Fatal("SumKeyValues: depends on map order")
+		}
+	}
+
+	// The documented framing.
+	framed := []byte("\x00\x00\x00\x00\x00\x00\x00\x01a\x00\x00\x00\x00\x00\x00\x00\x02bc" +
+		"\x00\x00\x00\x00\x00\x00\x00\x01b\x00\x00\x00\x00\x00\x00\x00\x00")
+	if s := SumKeyValues(map[string][]byte{"b": nil, "a": []byte("bc")}); s != md5.Sum(framed) {
+		t.Fatalf("SumKeyValues = %x want %x", s, md5.Sum(framed))
+	}
+
+	if SumKeyValues(nil) != md5.Sum(nil) {
+		t.Fatal("SumKeyValues(nil) is not the checksum of no input")
+	}
+}
+
+func TestSumWithLength(t *testing.T) {
+	for _, data := range []string{"", "a", "The quick brown fox jumps over the lazy dog"} {
+		framed := make([]byte, 8, 8+len(data))
+		binary.BigEndian.PutUint64(framed, uint64(len(data)))
+		framed = append(framed, data...)
+
+		if s := SumWithLength([]byte(data)); s != md5.Sum(framed) {
+			t.Fatalf("SumWithLength(%q) = %x want %x", data, s, md5.Sum(framed))
+		}
+	}
+
+	if SumWithLength([]byte("\x00")) == SumWithLength(nil) {
+		t.Fatal("SumWithLength: length not committed")
+	}
+}
+
+func TestSumPadded(t *testing.T) {
+	data := []byte("record payload")
+
+	for _, size := range []int{len(data), len(data) + 1, 64, 4096, 3*4096 + 5} {
+		padded := make([]byte, size)
+		copy(padded, data)
+
+		sum, err := SumPadded(data, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum != md5.Sum(padded) {
+			t.Fatalf("SumPadded(%d) = %x want %x", size, sum, md5.Sum(padded))
+		}
+	}
+
+	if _, err := SumPadded(data, len(data)-1); err != ErrDataTooLarge {
+		t.Fatalf("SumPadded too small: err = %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package bettermd5
+
+import (
+	"sync"
+)
+
+// syncChunk is the largest piece of a write hashed in one critical section
+// of a SyncDigest.
+const syncChunk = 64 << 10
+
+// SyncDigest is a digest that is safe for concurrent use, e.g. by a
+// goroutine writing an upload to it while another checkpoints its state.
+//
+// Every method copies the state or hashes data under a short critical
+// section: Write hashes large writes in pieces of 64 KiB, so a concurrent
+// Snapshot, GetState or Sum waits for at most one piece, and sees the state
+// after a prefix of a concurrent Write. Encoding the state and finalizing
+// the checksum happen outside the lock.
+type SyncDigest struct {
+	mu sync.Mutex
+	d  BetterDigest
+}
+
+// NewSync returns a new SyncDigest computing the MD5 checksum.
+func NewSync() *SyncDigest {
+	s := new(SyncDigest)
+	s.d.Reset()
+	return s
+}
+
+// NewSyncFromDigest returns a new SyncDigest continuing from the state of
+// d. The block observer of d is not copied.
+func NewSyncFromDigest(d *BetterDigest) *SyncDigest {
+	s := new(SyncDigest)
+	s.d = *d.Clone()
+	return s
+}
+
+func (s *SyncDigest) Size() int { return Size }
+
+func (s *SyncDigest) BlockSize() int { return BlockSize }
+
+// Write hashes p. Writes from several goroutines are each hashed in order,
+// but pieces of concurrent writes longer than 64 KiB may interleave.
+func (s *SyncDigest) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		piece := p
+		if len(piece) > syncChunk {
+			piece = piece[:syncChunk]
+		}
+
+		s.mu.Lock()
+		s.d.Write(piece)
+		s.mu.Unlock()
+
+		p = p[len(piece):]
+	}
+	return n, nil
+}
+
+func (s *SyncDigest) Reset() {
+	s.mu.Lock()
+	s.d.Reset()
+	s.mu.Unlock()
+}
+
+// Sum appends the checksum of everything written so far to in.
+func (s *SyncDigest) Sum(in []byte) []byte {
+	d := s.Digest()
+	return d.Sum(in)
+}
+
+// Snapshot returns the current state of the digest. It only holds the lock
+// while copying the state.
+func (s *SyncDigest) Snapshot() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.d.Snapshot()
+}
+
+// Restore sets the digest to st. It returns ErrInvalidState and leaves the
+// digest unchanged if st is not a state a digest can be in.
+func (s *SyncDigest) Restore(st State) error {
+	if err := st.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.d.Restore(st)
+}
+
+// GetState returns the state of the digest like BetterDigest.GetState.
+func (s *SyncDigest) GetState() []byte {
+	state, _ := s.Snapshot().MarshalBinary()
+	return state
+}
+
+// SetState restores the digest from state in any format accepted by
+// BetterDigest.SetState. The state is decoded before taking the lock.
+func (s *SyncDigest) SetState(state []byte) error {
+	var st State
+
+	if err := st.UnmarshalBinary(state); err != nil {
+		return err
+	}
+
+	return s.Restore(st)
+}
+
+// Digest returns a BetterDigest with the current state, which the caller
+// owns and can use without locking.
+func (s *SyncDigest) Digest() *BetterDigest {
+	d := new(BetterDigest)
+	d.Restore(s.Snapshot())
+	return d
+}
+
+// Clone returns a copy of s that can be written to and summed independently.
+func (s *SyncDigest) Clone() *SyncDigest {
+	c := new(SyncDigest)
+	c.d.Restore(s.Snapshot())
+	return c
+}
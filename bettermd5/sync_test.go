@@ -0,0 +1,126 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"hash"
+	"sync"
+	"testing"
+)
+
+var _ hash.Hash = (*SyncDigest)(nil)
+
+func TestSyncDigest(t *testing.T) {
+	data := segmentData(3*syncChunk + 1000)
+	want := md5.Sum(data)
+
+	s := NewSync()
+	s.Write(data[:100])
+	s.Write(data[100:])
+	if got := s.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatalf("Sum = %x want %x", got, want)
+	}
+
+	d := New()
+	d.Write(data[:5000])
+	r := NewSyncFromDigest(d)
+	r.Write(data[5000:])
+	if got := r.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatal("NewSyncFromDigest did not continue the digest")
+	}
+
+	c := s.Clone()
+	c.Write([]byte("more"))
+	if got := s.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatal("writing to a clone changed the original")
+	}
+	if got, want := c.Sum(nil), md5.Sum(append(append([]byte(nil), data...), "more"...)); !bytes.Equal(got, want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+
+	s.Reset()
+	if got, want := s.Sum(nil), md5.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatal("Reset did not reset the digest")
+	}
+}
+
+func TestSyncDigestState(t *testing.T) {
+	data := segmentData(1000)
+	want := md5.Sum(data)
+
+	s := NewSync()
+	s.Write(data[:300])
+	state := s.GetState()
+
+	r := NewSync()
+	if err := r.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	r.Write(data[300:])
+	if got := r.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatal("SetState did not restore the digest")
+	}
+
+	if d := s.Digest(); !d.StateEquals(state) {
+		t.Fatal("Digest does not match the state")
+	}
+
+	for name, err := range map[string]error{
+		"truncated": r.SetState(state[:len(state)-1]),
+		"bad Nx":    r.Restore(State{Nx: 1}),
+	} {
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if got := r.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
+
+// TestSyncDigestConcurrent checkpoints the digest while it is written. Run
+// with -race to check the locking.
+func TestSyncDigestConcurrent(t *testing.T) {
+	data := segmentData(64 * syncChunk)
+	want := md5.Sum(data)
+	s := NewSync()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < len(data); i += 3 * syncChunk / 2 {
+			s.Write(data[i:min(i+3*syncChunk/2, len(data))])
+		}
+	}()
+
+	// Every snapshot is the state after a prefix of the data, so resuming
+	// from it with the rest gives the full checksum.
+	var states []State
+	for i := 0; i < 20; i++ {
+		states = append(states, s.Snapshot())
+	}
+	wg.Wait()
+
+	for _, st := range states {
+		d := New()
+		if err := d.Restore(st); err != nil {
+			t.Fatal(err)
+		}
+		d.Write(data[st.Len:])
+		if got := d.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Fatalf("snapshot at %d resumed to %x want %x", st.Len, got, want)
+		}
+	}
+	if got := s.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Fatal("concurrent checksum mismatch")
+	}
+}
+
+func BenchmarkSyncDigestSnapshot(b *testing.B) {
+	s := NewSync()
+	s.Write(segmentData(1000))
+	for i := 0; i < b.N; i++ {
+		s.GetState()
+	}
+}
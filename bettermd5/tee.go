@@ -0,0 +1,58 @@
+package bettermd5
+
+import (
+	"io"
+)
+
+// TeeHasher hashes everything written to it and forwards it to another
+// writer. Unlike io.MultiWriter, a failing forward writer does not stop the
+// hashing: the error is recorded and reported by ForwardErr, and the digest
+// still covers every byte written.
+type TeeHasher struct {
+	d          *BetterDigest
+	forward    io.Writer
+	forwardErr error
+	forwarded  int64
+}
+
+// NewTeeHasher returns a new TeeHasher forwarding to forward.
+func NewTeeHasher(forward io.Writer) *TeeHasher {
+	return &TeeHasher{
+		d:       New(),
+		forward: forward,
+	}
+}
+
+// Write hashes p and forwards it. It always reports len(p) bytes written and
+// never fails; forward errors are available from ForwardErr. Once the forward
+// writer has failed, no further data is sent to it, so that it never receives
+// a stream with holes.
+func (t *TeeHasher) Write(p []byte) (int, error) {
+	t.d.Write(p)
+
+	if t.forwardErr == nil {
+		n, err := t.forward.Write(p)
+		t.forwarded += int64(n)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		t.forwardErr = err
+	}
+
+	return len(p), nil
+}
+
+// ForwardErr returns the first error returned by the forward writer, if any.
+func (t *TeeHasher) ForwardErr() error {
+	return t.forwardErr
+}
+
+// Forwarded returns the number of bytes successfully forwarded.
+func (t *TeeHasher) Forwarded() int64 {
+	return t.forwarded
+}
+
+// Sum appends the MD5 checksum of everything written so far to in.
+func (t *TeeHasher) Sum(in []byte) []byte {
+	return t.d.Sum(in)
+}
@@ -0,0 +1,55 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"io"
+	"testing"
+)
+
+type failingWriter struct {
+	buf   bytes.Buffer
+	limit int
+	err   error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.limit {
+		n := w.limit - w.buf.Len()
+		w.buf.Write(p[:n])
+		return n, w.err
+	}
+	return w.buf.Write(p)
+}
+
+func TestTeeHasher(t *testing.T) {
+	errSink := errors.New("sink failed")
+	sink := &failingWriter{limit: 10, err: errSink}
+
+	h := NewTeeHasher(sink)
+	io.WriteString(h, "01234")
+	io.WriteString(h, "56789abc")
+	n, err := io.WriteString(h, "defgh")
+	if n != 5 || err != nil {
+		t.Fatalf("Write after forward error = %d, %v", n, err)
+	}
+
+	want := md5.Sum([]byte("0123456789abcdefgh"))
+	if s := h.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("Sum = %x want %x", s, want)
+	}
+	if h.ForwardErr() != errSink {
+		t.Fatalf("ForwardErr = %v want %v", h.ForwardErr(), errSink)
+	}
+	if h.Forwarded() != 10 || sink.buf.String() != "0123456789" {
+		t.Fatalf("Forwarded = %d, sink = %q", h.Forwarded(), sink.buf.String())
+	}
+
+	var out bytes.Buffer
+	h = NewTeeHasher(&out)
+	io.WriteString(h, "all good")
+	if h.ForwardErr() != nil || out.String() != "all good" {
+		t.Fatalf("ForwardErr = %v, out = %q", h.ForwardErr(), out.String())
+	}
+}
@@ -0,0 +1,173 @@
+package bettermd5
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+)
+
+// TreeHasher computes one MD5 checksum over a sequence of inputs, such as the
+// files of a directory tree in a defined order, as if they were
+// concatenated. Its state records which input it is at and how far into it,
+// so hashing can resume after a crash.
+//
+// To resume, restore the state and add the same inputs again in the same
+// order: inputs that were already hashed are skipped without being read and
+// the partially hashed one continues where it left off.
+type TreeHasher struct {
+	d      *BetterDigest
+	index  int
+	offset int64
+	next   int
+}
+
+// NewTreeHasher returns a new TreeHasher.
+func NewTreeHasher() *TreeHasher {
+	return &TreeHasher{
+		d: New(),
+	}
+}
+
+// NewTreeHasherFromState returns a TreeHasher from existing state.
+func NewTreeHasherFromState(state []byte) *TreeHasher {
+	t := NewTreeHasher()
+	t.SetState(state)
+	return t
+}
+
+// AddFile hashes the contents of the file at path as the next input.
+func (t *TreeHasher) AddFile(path string) error {
+	if t.next < t.index {
+		t.next++
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return t.AddReader(f)
+}
+
+// AddReader hashes everything read from r until EOF as the next input. r must
+// be positioned at the start of the input; when resuming into this input, the
+// bytes hashed before are skipped by seeking if r is an io.Seeker and by
+// reading them otherwise.
+//
+// If AddReader fails, the bytes hashed so far stay recorded in the state and
+// the input is not counted, so the same input can be added again.
+func (t *TreeHasher) AddReader(r io.Reader) error {
+	if t.next < t.index {
+		t.next++
+		return nil
+	}
+
+	if t.offset > 0 {
+		if err := skip(r, t.offset); err != nil {
+			return err
+		}
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := readFrom(treeWriter{t}, r, *buf); err != nil {
+		return err
+	}
+
+	t.index++
+	t.offset = 0
+	t.next++
+
+	return nil
+}
+
+type treeWriter struct {
+	t *TreeHasher
+}
+
+func (w treeWriter) Write(p []byte) (int, error) {
+	w.t.d.Write(p)
+	w.t.offset += int64(len(p))
+	return len(p), nil
+}
+
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekCurrent)
+		return err
+	}
+
+	m, err := io.CopyN(io.Discard, r, n)
+	if m < n && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// Inputs returns the number of inputs fully hashed.
+func (t *TreeHasher) Inputs() int {
+	return t.index
+}
+
+// Sum appends the MD5 checksum of all inputs hashed so far to in.
+func (t *TreeHasher) Sum(in []byte) []byte {
+	return t.d.Sum(in)
+}
+
+// The state format is
+//
+//	"bmdt" || version || uvarint inputs hashed || uvarint offset in the next input || digest state
+const (
+	treeMagic   = "bmdt"
+	treeVersion = 1
+)
+
+// GetState returns the state of the hasher, to be restored by SetState.
+func (t *TreeHasher) GetState() []byte {
+	b := make([]byte, 0, len(treeMagic)+1+2*binary.MaxVarintLen64+stateHeaderSize+chunk)
+	b = append(b, treeMagic...)
+	b = append(b, treeVersion)
+	b = binary.AppendUvarint(b, uint64(t.index))
+	b = binary.AppendUvarint(b, uint64(t.offset))
+	return append(b, t.d.GetState()...)
+}
+
+// SetState restores the hasher from state returned by GetState. Inputs must
+// then be added again from the first one. It returns ErrInvalidState and
+// leaves the hasher unchanged if state is not valid.
+func (t *TreeHasher) SetState(state []byte) error {
+	if len(state) < len(treeMagic)+1 || string(state[:len(treeMagic)]) != treeMagic || state[len(treeMagic)] != treeVersion {
+		return ErrInvalidState
+	}
+	p := state[len(treeMagic)+1:]
+
+	index, n := binary.Uvarint(p)
+	if n <= 0 || index > math.MaxInt32 {
+		return ErrInvalidState
+	}
+	p = p[n:]
+	offset, n := binary.Uvarint(p)
+	if n <= 0 || offset > math.MaxInt64 {
+		return ErrInvalidState
+	}
+
+	d := New()
+	if err := d.SetState(p[n:]); err != nil {
+		return ErrInvalidState
+	}
+	if offset > d.len {
+		return ErrInvalidState
+	}
+
+	t.d = d
+	t.index = int(index)
+	t.offset = int64(offset)
+	t.next = 0
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTreeHasher(t *testing.T) {
+	dir := t.TempDir()
+
+	var all []byte
+	var paths []string
+	for i, size := range []int{100, 0, 5000, 64} {
+		data := bytes.Repeat([]byte{byte('a' + i)}, size)
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+		all = append(all, data...)
+	}
+
+	h := NewTreeHasher()
+	for _, path := range paths {
+		if err := h.AddFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := md5.Sum(all)
+	if s := h.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("Sum = %x want %x", s, want)
+	}
+	if h.Inputs() != len(paths) {
+		t.Fatalf("Inputs = %d", h.Inputs())
+	}
+
+	// Crash in the middle of the third file.
+	h = NewTreeHasher()
+	h.AddFile(paths[0])
+	h.AddFile(paths[1])
+	third, _ := os.ReadFile(paths[2])
+	errCrash := errors.New("crash")
+	r := io.MultiReader(bytes.NewReader(third[:1234]), iotest.ErrReader(errCrash))
+	if err := h.AddReader(r); err != errCrash {
+		t.Fatalf("AddReader: err = %v", err)
+	}
+	state := h.GetState()
+
+	for _, seekable := range []bool{true, false} {
+		h = NewTreeHasherFromState(state)
+		for i, path := range paths {
+			var err error
+			if i == 2 && !seekable {
+				err = h.AddReader(iotest.HalfReader(bytes.NewReader(third)))
+			} else {
+				err = h.AddFile(path)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s := h.Sum(nil); !bytes.Equal(s, want[:]) {
+			t.Fatalf("resumed (seekable %v) Sum = %x want %x", seekable, s, want)
+		}
+	}
+
+	// Already hashed files are not opened again.
+	h = NewTreeHasherFromState(state)
+	if err := h.AddFile(filepath.Join(dir, "missing")); err != nil {
+		t.Fatal(err)
+	}
+
+	before := h.GetState()
+	for name, bad := range map[string][]byte{
+		"garbage":            []byte("garbage"),
+		"truncated":          state[:len(state)-1],
+		"unknown version":    append(append([]byte(treeMagic), 2), state[len(treeMagic)+1:]...),
+		"offset past digest": append(append([]byte(treeMagic), treeVersion, 0, 100), New().GetState()...),
+	} {
+		if err := h.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if !bytes.Equal(h.GetState(), before) {
+		t.Fatal("failed SetState changed the hasher")
+	}
+}
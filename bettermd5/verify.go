@@ -0,0 +1,56 @@
+package bettermd5
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrStateMismatch is returned by RestoreAndVerify when the data does not
+	// hash to the restored state.
+	ErrStateMismatch = errors.New("bettermd5: data does not match state")
+
+	// ErrVerifyLength is returned by RestoreAndVerify when the number of bytes
+	// to verify differs from the length recorded in the state.
+	ErrVerifyLength = errors.New("bettermd5: verify length does not match state")
+)
+
+// RestoreAndVerify restores a digest from state and checks that the first
+// verifyBytes bytes of r, typically the beginning of a partially downloaded
+// file, hash to that same state. This catches a partial file that no longer
+// matches its checkpoint before hashing is resumed on top of it.
+//
+// MD5 offers no way to relate a state to a shorter prefix, so verifyBytes
+// must equal the length recorded in the state; otherwise ErrVerifyLength is
+// returned. A mismatch returns ErrStateMismatch and a short r returns
+// io.ErrUnexpectedEOF.
+func RestoreAndVerify(state []byte, r io.Reader, verifyBytes int64) (*BetterDigest, error) {
+	d := New()
+	if err := d.SetState(state); err != nil {
+		return nil, err
+	}
+
+	if verifyBytes < 0 || uint64(verifyBytes) != d.len {
+		return nil, ErrVerifyLength
+	}
+
+	scratch := getDigest()
+	defer putDigest(scratch)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	n, err := readFrom(scratch, io.LimitReader(r, verifyBytes), *buf)
+	if err != nil {
+		return nil, err
+	}
+	if n < verifyBytes {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if !scratch.Snapshot().Equal(d.Snapshot()) {
+		return nil, ErrStateMismatch
+	}
+
+	return d, nil
+}
@@ -0,0 +1,47 @@
+package bettermd5
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"testing"
+)
+
+func TestRestoreAndVerify(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 17)
+	}
+
+	c := New()
+	c.Write(data[:7777])
+	state := c.GetState()
+
+	d, err := RestoreAndVerify(state, bytes.NewReader(data[:7777]), 7777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Write(data[7777:])
+	want := md5.Sum(data)
+	if s := d.Sum(nil); !bytes.Equal(s, want[:]) {
+		t.Fatalf("resumed Sum = %x want %x", s, want)
+	}
+
+	corrupt := append([]byte{}, data[:7777]...)
+	corrupt[100] ^= 1
+	if _, err := RestoreAndVerify(state, bytes.NewReader(corrupt), 7777); err != ErrStateMismatch {
+		t.Fatalf("corrupt prefix: err = %v", err)
+	}
+
+	if _, err := RestoreAndVerify(state, bytes.NewReader(data[:5000]), 7777); err != io.ErrUnexpectedEOF {
+		t.Fatalf("short prefix: err = %v", err)
+	}
+
+	if _, err := RestoreAndVerify(state, bytes.NewReader(data), 5000); err != ErrVerifyLength {
+		t.Fatalf("wrong length: err = %v", err)
+	}
+
+	if _, err := RestoreAndVerify([]byte("garbage"), bytes.NewReader(data), 0); err != ErrInvalidState {
+		t.Fatalf("invalid state: err = %v", err)
+	}
+}
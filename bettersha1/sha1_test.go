@@ -0,0 +1,189 @@
+package bettersha1
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding"
+	"encoding/binary"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*BetterDigest)(nil)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+func TestSum(t *testing.T) {
+	for _, n := range []int{0, 1, 55, 56, 63, 64, 65, 119, 120, 1000, 10000} {
+		data := testData(n)
+		want := sha1.Sum(data)
+
+		if got := Sum(data); got != want {
+			t.Fatalf("Sum(%d bytes) = %x want %x", n, got, want)
+		}
+
+		d := New()
+		for i := range data {
+			d.Write(data[i : i+1])
+		}
+		if got := d.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Fatalf("byte-wise Sum(%d bytes) = %x want %x", n, got, want)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(1000)
+	want := sha1.Sum(data)
+
+	for _, split := range []int{0, 1, 63, 64, 100, 999, 1000} {
+		d := New()
+		d.Write(data[:split])
+		state := d.GetState()
+
+		if len(state) != stateHeaderSize+split%chunk {
+			t.Fatalf("%d: state is %d bytes", split, len(state))
+		}
+
+		r := NewFromState(state)
+		r.Write(data[split:])
+		if got := r.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Fatalf("%d: resumed Sum = %x want %x", split, got, want)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := New()
+	d.Write(testData(100))
+	state := d.GetState()
+	want := d.Sum(nil)
+
+	for name, bad := range map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:len(state)-1],
+		"trailing bytes":  append(append([]byte(nil), state...), 0),
+		"unknown version": append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+		"wrong magic":     append([]byte("bmd5"), state[len(stateMagic):]...),
+	} {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	if !bytes.Equal(d.Sum(nil), want) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
+
+func TestMarshalBinaryStdlib(t *testing.T) {
+	data := testData(1000)
+
+	for _, n := range []int{0, 10, 64, 130, len(data)} {
+		std := sha1.New()
+		std.Write(data[:n])
+		stdState, err := std.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := New()
+		d.Write(data[:n])
+		state, err := d.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(state, stdState) {
+			t.Fatalf("%d: MarshalBinary = %x want %x", n, state, stdState)
+		}
+		if appended, _ := d.AppendBinary([]byte("x")); !bytes.Equal(appended[1:], stdState) {
+			t.Fatalf("%d: AppendBinary = %x", n, appended)
+		}
+
+		restored := New()
+		if err := restored.UnmarshalBinary(stdState); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(restored.GetState(), d.GetState()) {
+			t.Fatalf("%d: UnmarshalBinary did not restore the state", n)
+		}
+		restored.Write(data[n:])
+
+		std = sha1.New()
+		if err := std.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			t.Fatal(err)
+		}
+		std.Write(data[n:])
+
+		want := sha1.Sum(data)
+		if !bytes.Equal(restored.Sum(nil), want[:]) || !bytes.Equal(std.Sum(nil), want[:]) {
+			t.Fatalf("%d: checksum mismatch after round trip", n)
+		}
+	}
+}
+
+// TestStdlibFormat pins the crypto/sha1 format, so a change to it shows up
+// here rather than as states that no longer restore.
+func TestStdlibFormat(t *testing.T) {
+	want := []byte(stdlibMagic)
+	for _, w := range []uint32{init0, init1, init2, init3, init4} {
+		want = binary.BigEndian.AppendUint32(want, w)
+	}
+	want = append(want, "abc"...)
+	want = append(want, make([]byte, chunk-3)...)
+	want = binary.BigEndian.AppendUint64(want, 3)
+
+	std := sha1.New()
+	std.Write([]byte("abc"))
+	state, err := std.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state) != stdlibStateSize || !bytes.Equal(state, want) {
+		t.Fatalf("crypto/sha1 state = %x want %x", state, want)
+	}
+
+	d := New()
+	for name, bad := range map[string][]byte{
+		"short":    want[:len(want)-1],
+		"trailing": append(append([]byte(nil), want...), 0),
+	} {
+		if err := d.UnmarshalBinary(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func BenchmarkHash8K(b *testing.B) {
+	data := testData(8192)
+	d := New()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		d.Reset()
+		d.Write(data)
+		d.Sum(nil)
+	}
+}
+
+func TestClone(t *testing.T) {
+	data := testData(1000)
+
+	d := New()
+	d.Write(data[:300])
+	c := d.Clone()
+	d.Write(data[300:])
+	c.Write(data[300:500])
+
+	if want := Sum(data); !bytes.Equal(d.Sum(nil), want[:]) {
+		t.Fatal("original diverged after Clone")
+	}
+	if want := Sum(data[:500]); !bytes.Equal(c.Sum(nil), want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+}
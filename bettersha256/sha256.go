@@ -0,0 +1,248 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bettersha256 implements the SHA-256 hash algorithm as defined in
+// FIPS 180-4, with a digest whose state can be saved and restored.
+package bettersha256
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/internal/hashstate"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("bettersha256: invalid state")
+
+// The size of a SHA-256 checksum in bytes.
+const Size = 32
+
+// The blocksize of SHA-256 in bytes.
+const BlockSize = 64
+
+const (
+	chunk = 64
+	init0 = 0x6A09E667
+	init1 = 0xBB67AE85
+	init2 = 0x3C6EF372
+	init3 = 0xA54FF53A
+	init4 = 0x510E527F
+	init5 = 0x9B05688C
+	init6 = 0x1F83D9AB
+	init7 = 0x5BE0CD19
+)
+
+// The state format is the hashstate format with the magic "bs25" and the
+// words and length in big-endian.
+const (
+	stateMagic      = "bs25"
+	stateHeaderSize = len(stateMagic) + 1 + 8*4 + 8
+)
+
+// The crypto/sha256 state format, as produced by MarshalBinary, is
+//
+//	"sha\x03" || 8 big-endian uint32 words || block buffer, zero past the pending bytes || big-endian uint64 length
+const (
+	stdlibMagic     = "sha\x03"
+	stdlibStateSize = len(stdlibMagic) + 8*4 + chunk + 8
+)
+
+var stateFormat = hashstate.Format{
+	Magic:     stateMagic,
+	Version:   1,
+	Order:     binary.BigEndian,
+	WordSize:  4,
+	Words:     8,
+	BlockSize: chunk,
+}
+
+// BetterDigest represents the partial evaluation of a checksum.
+type BetterDigest struct {
+	h   [8]uint32
+	x   [chunk]byte
+	nx  int
+	len uint64
+}
+
+func (d *BetterDigest) Reset() {
+	d.h[0] = init0
+	d.h[1] = init1
+	d.h[2] = init2
+	d.h[3] = init3
+	d.h[4] = init4
+	d.h[5] = init5
+	d.h[6] = init6
+	d.h[7] = init7
+	d.nx = 0
+	d.len = 0
+}
+
+// New returns a new hash.Hash computing the SHA-256 checksum.
+func New() *BetterDigest {
+	d := new(BetterDigest)
+	d.Reset()
+	return d
+}
+
+// NewFromState returns a new hash.Hash computing the SHA-256 checksum from
+// existing state.
+func NewFromState(state []byte) *BetterDigest {
+	d := new(BetterDigest)
+	d.Reset()
+	d.SetState(state)
+	return d
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *BetterDigest) GetState() []byte {
+	var words [8]uint64
+	for i, h := range d.h {
+		words[i] = uint64(h)
+	}
+
+	return stateFormat.Append(make([]byte, 0, stateHeaderSize+d.nx), words[:], d.len, d.x[:d.nx])
+}
+
+// SetState restores the digest from state returned by GetState or
+// MarshalBinary. It returns ErrInvalidState and leaves the digest unchanged
+// if state is not valid.
+func (d *BetterDigest) SetState(state []byte) error {
+	if bytes.HasPrefix(state, []byte(stdlibMagic)) {
+		return d.setStdlibState(state)
+	}
+
+	var words [8]uint64
+
+	length, pending, err := stateFormat.Decode(state, words[:])
+	if err != nil {
+		return ErrInvalidState
+	}
+
+	for i, w := range words {
+		d.h[i] = uint32(w)
+	}
+	d.len = length
+	d.nx = copy(d.x[:], pending)
+
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It uses the same format
+// as crypto/sha256, so the state can be restored by either package. GetState
+// returns a more compact form of the same state.
+func (d *BetterDigest) MarshalBinary() ([]byte, error) {
+	return d.AppendBinary(make([]byte, 0, stdlibStateSize))
+}
+
+// AppendBinary implements encoding.BinaryAppender like MarshalBinary.
+func (d *BetterDigest) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, stdlibMagic...)
+	for _, h := range d.h {
+		b = binary.BigEndian.AppendUint32(b, h)
+	}
+	b = append(b, d.x[:d.nx]...)
+	b = append(b, make([]byte, chunk-d.nx)...)
+	b = binary.BigEndian.AppendUint64(b, d.len)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It accepts state
+// marshaled by crypto/sha256 as well as state returned by GetState.
+func (d *BetterDigest) UnmarshalBinary(b []byte) error {
+	return d.SetState(b)
+}
+
+func (d *BetterDigest) setStdlibState(state []byte) error {
+	if len(state) != stdlibStateSize {
+		return ErrInvalidState
+	}
+
+	p := state[len(stdlibMagic):]
+	for i := range d.h {
+		d.h[i] = binary.BigEndian.Uint32(p[i*4:])
+	}
+	p = p[len(d.h)*4:]
+	copy(d.x[:], p[:chunk])
+	d.len = binary.BigEndian.Uint64(p[chunk:])
+	d.nx = int(d.len % chunk)
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *BetterDigest) Clone() *BetterDigest {
+	c := *d
+	return &c
+}
+
+func (d *BetterDigest) Size() int { return Size }
+
+func (d *BetterDigest) BlockSize() int { return BlockSize }
+
+func (d *BetterDigest) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	d.len += uint64(nn)
+	if d.nx > 0 {
+		n := copy(d.x[d.nx:], p)
+		d.nx += n
+		if d.nx == chunk {
+			block(d, d.x[:])
+			d.nx = 0
+		}
+		p = p[n:]
+	}
+	if len(p) >= chunk {
+		n := len(p) &^ (chunk - 1)
+		block(d, p[:n])
+		p = p[n:]
+	}
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+	return
+}
+
+func (d0 *BetterDigest) Sum(in []byte) []byte {
+	// Make a copy of d0 so that caller can keep writing and summing.
+	d := *d0
+	hash := d.checkSum()
+	return append(in, hash[:]...)
+}
+
+func (d *BetterDigest) checkSum() [Size]byte {
+	len := d.len
+	// Padding.  Add a 1 bit and 0 bits until 56 bytes mod 64.
+	var tmp [64]byte
+	tmp[0] = 0x80
+	if len%64 < 56 {
+		d.Write(tmp[0 : 56-len%64])
+	} else {
+		d.Write(tmp[0 : 64+56-len%64])
+	}
+
+	// Length in bits.
+	len <<= 3
+	binary.BigEndian.PutUint64(tmp[:], len)
+	d.Write(tmp[0:8])
+
+	if d.nx != 0 {
+		panic("d.nx != 0")
+	}
+
+	var digest [Size]byte
+	for i, h := range d.h {
+		binary.BigEndian.PutUint32(digest[i*4:], h)
+	}
+
+	return digest
+}
+
+// Sum returns the SHA-256 checksum of the data.
+func Sum(data []byte) [Size]byte {
+	var d BetterDigest
+	d.Reset()
+	d.Write(data)
+	return d.checkSum()
+}
@@ -0,0 +1,189 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bettersha512 implements the SHA-512 hash algorithm as defined in
+// FIPS 180-4, with a digest whose state can be saved and restored.
+package bettersha512
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/internal/hashstate"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("bettersha512: invalid state")
+
+// The size of a SHA-512 checksum in bytes.
+const Size = 64
+
+// The blocksize of SHA-512 in bytes.
+const BlockSize = 128
+
+const (
+	chunk = 128
+	init0 = 0x6a09e667f3bcc908
+	init1 = 0xbb67ae8584caa73b
+	init2 = 0x3c6ef372fe94f82b
+	init3 = 0xa54ff53a5f1d36f1
+	init4 = 0x510e527fade682d1
+	init5 = 0x9b05688c2b3e6c1f
+	init6 = 0x1f83d9abfb41bd6b
+	init7 = 0x5be0cd19137e2179
+)
+
+// The state format is the hashstate format with the magic "bs51" and the
+// words and length in big-endian. The length is in bytes, so like
+// crypto/sha512 the digest supports inputs of up to 2^64 bytes.
+const (
+	stateMagic      = "bs51"
+	stateHeaderSize = len(stateMagic) + 1 + 8*8 + 8
+)
+
+var stateFormat = hashstate.Format{
+	Magic:     stateMagic,
+	Version:   1,
+	Order:     binary.BigEndian,
+	WordSize:  8,
+	Words:     8,
+	BlockSize: chunk,
+}
+
+// BetterDigest represents the partial evaluation of a checksum.
+type BetterDigest struct {
+	h   [8]uint64
+	x   [chunk]byte
+	nx  int
+	len uint64
+}
+
+func (d *BetterDigest) Reset() {
+	d.h[0] = init0
+	d.h[1] = init1
+	d.h[2] = init2
+	d.h[3] = init3
+	d.h[4] = init4
+	d.h[5] = init5
+	d.h[6] = init6
+	d.h[7] = init7
+	d.nx = 0
+	d.len = 0
+}
+
+// New returns a new hash.Hash computing the SHA-512 checksum.
+func New() *BetterDigest {
+	d := new(BetterDigest)
+	d.Reset()
+	return d
+}
+
+// NewFromState returns a new hash.Hash computing the SHA-512 checksum from
+// existing state.
+func NewFromState(state []byte) *BetterDigest {
+	d := new(BetterDigest)
+	d.Reset()
+	d.SetState(state)
+	return d
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *BetterDigest) GetState() []byte {
+	return stateFormat.Append(make([]byte, 0, stateHeaderSize+d.nx), d.h[:], d.len, d.x[:d.nx])
+}
+
+// SetState restores the digest from state returned by GetState. It returns
+// ErrInvalidState and leaves the digest unchanged if state is not valid.
+func (d *BetterDigest) SetState(state []byte) error {
+	var words [8]uint64
+
+	length, pending, err := stateFormat.Decode(state, words[:])
+	if err != nil {
+		return ErrInvalidState
+	}
+
+	d.h = words
+	d.len = length
+	d.nx = copy(d.x[:], pending)
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *BetterDigest) Clone() *BetterDigest {
+	c := *d
+	return &c
+}
+
+func (d *BetterDigest) Size() int { return Size }
+
+func (d *BetterDigest) BlockSize() int { return BlockSize }
+
+func (d *BetterDigest) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	d.len += uint64(nn)
+	if d.nx > 0 {
+		n := copy(d.x[d.nx:], p)
+		d.nx += n
+		if d.nx == chunk {
+			block(d, d.x[:])
+			d.nx = 0
+		}
+		p = p[n:]
+	}
+	if len(p) >= chunk {
+		n := len(p) &^ (chunk - 1)
+		block(d, p[:n])
+		p = p[n:]
+	}
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+	return
+}
+
+func (d0 *BetterDigest) Sum(in []byte) []byte {
+	// Make a copy of d0 so that caller can keep writing and summing.
+	d := *d0
+	hash := d.checkSum()
+	return append(in, hash[:]...)
+}
+
+func (d *BetterDigest) checkSum() [Size]byte {
+	len := d.len
+	// Padding.  Add a 1 bit and 0 bits until 112 bytes mod 128.
+	var tmp [128 + 16]byte
+	tmp[0] = 0x80
+	var t uint64
+	if len%128 < 112 {
+		t = 112 - len%128
+	} else {
+		t = 128 + 112 - len%128
+	}
+
+	// Length in bits. The upper 64 bits of the 128-bit length are always
+	// zero because len is a uint64.
+	len <<= 3
+	padlen := tmp[:t+16]
+	binary.BigEndian.PutUint64(padlen[t+8:], len)
+	d.Write(padlen)
+
+	if d.nx != 0 {
+		panic("d.nx != 0")
+	}
+
+	var digest [Size]byte
+	for i, h := range d.h {
+		binary.BigEndian.PutUint64(digest[i*8:], h)
+	}
+
+	return digest
+}
+
+// Sum returns the SHA-512 checksum of the data.
+func Sum(data []byte) [Size]byte {
+	var d BetterDigest
+	d.Reset()
+	d.Write(data)
+	return d.checkSum()
+}
@@ -0,0 +1,109 @@
+package bettersha512
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*BetterDigest)(nil)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+func TestSum(t *testing.T) {
+	for _, n := range []int{0, 1, 55, 56, 63, 64, 65, 111, 112, 119, 120, 127, 128, 129, 1000, 10000} {
+		data := testData(n)
+		want := sha512.Sum512(data)
+
+		if got := Sum(data); got != want {
+			t.Fatalf("Sum(%d bytes) = %x want %x", n, got, want)
+		}
+
+		d := New()
+		for i := range data {
+			d.Write(data[i : i+1])
+		}
+		if got := d.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Fatalf("byte-wise Sum(%d bytes) = %x want %x", n, got, want)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(1000)
+	want := sha512.Sum512(data)
+
+	for _, split := range []int{0, 1, 127, 128, 200, 999, 1000} {
+		d := New()
+		d.Write(data[:split])
+		state := d.GetState()
+
+		if len(state) != stateHeaderSize+split%chunk {
+			t.Fatalf("%d: state is %d bytes", split, len(state))
+		}
+
+		r := NewFromState(state)
+		r.Write(data[split:])
+		if got := r.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Fatalf("%d: resumed Sum = %x want %x", split, got, want)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	d := New()
+	d.Write(testData(100))
+	state := d.GetState()
+	want := d.Sum(nil)
+
+	for name, bad := range map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:len(state)-1],
+		"trailing bytes":  append(append([]byte(nil), state...), 0),
+		"unknown version": append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+		"wrong magic":     append([]byte("bmd5"), state[len(stateMagic):]...),
+	} {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	if !bytes.Equal(d.Sum(nil), want) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
+
+func BenchmarkHash8K(b *testing.B) {
+	data := testData(8192)
+	d := New()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		d.Reset()
+		d.Write(data)
+		d.Sum(nil)
+	}
+}
+
+func TestClone(t *testing.T) {
+	data := testData(1000)
+
+	d := New()
+	d.Write(data[:300])
+	c := d.Clone()
+	d.Write(data[300:])
+	c.Write(data[300:500])
+
+	if want := Sum(data); !bytes.Equal(d.Sum(nil), want[:]) {
+		t.Fatal("original diverged after Clone")
+	}
+	if want := Sum(data[:500]); !bytes.Equal(c.Sum(nil), want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+}
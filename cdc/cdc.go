@@ -0,0 +1,302 @@
+// Package cdc splits streams into content-defined chunks with FastCDC and
+// hashes each chunk with any resumable hash.
+//
+// Chunk boundaries depend only on the content around them, so inserting or
+// removing bytes in a stream only changes the chunks near the edit, which
+// is what deduplication needs. The chunker follows FastCDC (Xia et al.,
+// "FastCDC: a Fast and Efficient Content-Defined Chunking Approach for Data
+// Deduplication", USENIX ATC 2016): a gear rolling hash, no cut points
+// before the minimum size, and normalized chunking, which uses a stricter
+// mask before the average size and a looser one after it so chunk sizes
+// cluster around the average. Every chunk is cut at the maximum size at the
+// latest.
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"math/bits"
+)
+
+var (
+	// ErrInvalidOptions is returned by New for sizes that are out of range
+	// or not in order, or an average size that is not a power of two.
+	ErrInvalidOptions = errors.New("cdc: invalid chunk sizes")
+
+	// ErrInvalidState is returned by SetState when the state is not valid
+	// for the chunker.
+	ErrInvalidState = errors.New("cdc: invalid state")
+)
+
+const (
+	// DefaultMinSize, DefaultAvgSize and DefaultMaxSize are the chunk sizes
+	// used when Options is zero, those of the FastCDC paper.
+	DefaultMinSize = 2 << 10
+	DefaultAvgSize = 8 << 10
+	DefaultMaxSize = 64 << 10
+
+	minMinSize = 64
+	maxMaxSize = 1 << 30
+
+	// normalization is the number of mask bits added before and removed
+	// after the average size.
+	normalization = 2
+)
+
+// Options are the chunk sizes of a Chunker, in bytes. MinSize must be at
+// least 64 and below AvgSize, which must be a power of two below MaxSize,
+// which is at most 1 GiB. The zero Options is the default sizes.
+type Options struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+func (o Options) valid() bool {
+	return o.MinSize >= minMinSize && o.MinSize < o.AvgSize && o.AvgSize < o.MaxSize && o.MaxSize <= maxMaxSize &&
+		o.AvgSize&(o.AvgSize-1) == 0 && bits.TrailingZeros(uint(o.AvgSize)) > normalization
+}
+
+// Chunk is a chunk of the stream: its offset, its length and its checksum.
+type Chunk struct {
+	Offset uint64
+	Length int
+	Sum    []byte
+}
+
+// gear is the table of the rolling hash. It is part of the chunk format:
+// changing it moves every boundary.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 from a fixed seed.
+	x := uint64(0x636463)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		gear[i] = z ^ z>>31
+	}
+}
+
+// Chunker splits everything written to it into chunks and passes each one
+// to a function as soon as it is complete. Its state, including the hash of
+// the chunk being filled, can be saved at any point of the stream.
+type Chunker struct {
+	newHash func() resumable.Resumable
+	opts    Options
+	maskS   uint64
+	maskL   uint64
+	emit    func(Chunk) error
+
+	offset uint64
+	n      int
+	fp     uint64
+	h      resumable.Resumable
+}
+
+// New returns a Chunker that hashes chunks with the hash returned by h and
+// passes them to emit.
+func New(h func() resumable.Resumable, opts Options, emit func(Chunk) error) (*Chunker, error) {
+	if opts == (Options{}) {
+		opts = Options{MinSize: DefaultMinSize, AvgSize: DefaultAvgSize, MaxSize: DefaultMaxSize}
+	}
+	if !opts.valid() {
+		return nil, ErrInvalidOptions
+	}
+
+	c := &Chunker{
+		newHash: h,
+		opts:    opts,
+		emit:    emit,
+		h:       h(),
+	}
+	c.maskS, c.maskL = masks(opts.AvgSize)
+
+	return c, nil
+}
+
+// masks returns the masks used before and after the average size. They
+// take the top bits of the fingerprint, which depend on the last 64 bytes,
+// while the low bits only depend on the last few.
+func masks(avgSize int) (maskS, maskL uint64) {
+	b := bits.TrailingZeros(uint(avgSize))
+	return ^uint64(0) << (64 - b - normalization), ^uint64(0) << (64 - b + normalization)
+}
+
+// Options returns the chunk sizes of c.
+func (c *Chunker) Options() Options {
+	return c.opts
+}
+
+// Offset returns the number of bytes written so far.
+func (c *Chunker) Offset() uint64 {
+	return c.offset + uint64(c.n)
+}
+
+// Write splits p into chunks. If emit returns an error, Write stops right
+// after the chunk it was given and returns the error along with the number
+// of bytes of p up to the end of that chunk; the rest of p can be written
+// again.
+func (c *Chunker) Write(p []byte) (int, error) {
+	nn := 0
+
+	for len(p) > 0 {
+		i, cut := c.scan(p)
+		c.h.Write(p[:i])
+		c.n += i
+		nn += i
+		p = p[i:]
+
+		if cut {
+			if err := c.cut(); err != nil {
+				return nn, err
+			}
+		}
+	}
+
+	return nn, nil
+}
+
+// scan returns how many bytes of p belong to the current chunk and whether
+// the chunk ends after them, updating the fingerprint.
+func (c *Chunker) scan(p []byte) (int, bool) {
+	n := c.n
+	i := 0
+
+	// No cut point comes before the minimum size, so those bytes are not
+	// fingerprinted at all.
+	if n < c.opts.MinSize {
+		i = c.opts.MinSize - n
+		if i >= len(p) {
+			return len(p), false
+		}
+		n += i
+	}
+
+	fp := c.fp
+	for i < len(p) {
+		fp = fp<<1 + gear[p[i]]
+		i++
+		n++
+
+		mask := c.maskL
+		if n < c.opts.AvgSize {
+			mask = c.maskS
+		}
+		if fp&mask == 0 || n == c.opts.MaxSize {
+			c.fp = 0
+			return i, true
+		}
+	}
+
+	c.fp = fp
+	return i, false
+}
+
+func (c *Chunker) cut() error {
+	chunk := Chunk{
+		Offset: c.offset,
+		Length: c.n,
+		Sum:    c.h.Sum(nil),
+	}
+
+	c.offset += uint64(c.n)
+	c.n = 0
+	c.h.Reset()
+
+	return c.emit(chunk)
+}
+
+// Close passes the last chunk, holding the bytes written since the last
+// boundary, to emit. Nothing is emitted if there are none, so an empty
+// stream has no chunks. Writing after Close starts a new chunk.
+func (c *Chunker) Close() error {
+	if c.n == 0 {
+		return nil
+	}
+	c.fp = 0
+	return c.cut()
+}
+
+// The state format is
+//
+//	"bcdc" || version || min size || avg size || max size || offset ||
+//	bytes in the current chunk || uint64 fingerprint || current chunk hash state
+//
+// with the sizes, offset and byte count as uvarints and the fingerprint in
+// big-endian.
+const (
+	stateMagic   = "bcdc"
+	stateVersion = 1
+)
+
+// GetState returns the state of c, to be restored by SetState.
+func (c *Chunker) GetState() []byte {
+	b := make([]byte, 0, 64)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = binary.AppendUvarint(b, uint64(c.opts.MinSize))
+	b = binary.AppendUvarint(b, uint64(c.opts.AvgSize))
+	b = binary.AppendUvarint(b, uint64(c.opts.MaxSize))
+	b = binary.AppendUvarint(b, c.offset)
+	b = binary.AppendUvarint(b, uint64(c.n))
+	b = binary.BigEndian.AppendUint64(b, c.fp)
+	b = append(b, c.h.GetState()...)
+	return b
+}
+
+// SetState restores c from state returned by GetState, including its chunk
+// sizes. The hash and emit function stay those c was created with. It
+// returns ErrInvalidState and leaves c unchanged if state is not valid.
+func (c *Chunker) SetState(state []byte) error {
+	if len(state) < len(stateMagic)+1 || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	var v [5]uint64
+	for i := range v {
+		x, n := binary.Uvarint(p)
+		if n <= 0 {
+			return ErrInvalidState
+		}
+		v[i] = x
+		p = p[n:]
+	}
+	if len(p) < 8 {
+		return ErrInvalidState
+	}
+
+	for _, size := range v[:3] {
+		if size > maxMaxSize {
+			return ErrInvalidState
+		}
+	}
+	opts := Options{MinSize: int(v[0]), AvgSize: int(v[1]), MaxSize: int(v[2])}
+	offset, n := v[3], v[4]
+	fp := binary.BigEndian.Uint64(p)
+
+	if !opts.valid() || n >= uint64(opts.MaxSize) || offset+n < offset {
+		return ErrInvalidState
+	}
+	if n <= uint64(opts.MinSize) && fp != 0 {
+		return ErrInvalidState
+	}
+
+	h := c.newHash()
+	if err := h.SetState(p[8:]); err != nil {
+		return ErrInvalidState
+	}
+
+	c.opts = opts
+	c.maskS, c.maskL = masks(opts.AvgSize)
+	c.offset = offset
+	c.n = int(n)
+	c.fp = fp
+	c.h = h
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package cdc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"math/rand"
+	"testing"
+)
+
+func newSHA256() resumable.Resumable { return bettersha256.New() }
+
+// randomData returns n pseudo-random bytes, the same on every run.
+func randomData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+func split(t testing.TB, data []byte, opts Options, writeSize int) []Chunk {
+	var chunks []Chunk
+	c, err := New(newSHA256, opts, func(ch Chunk) error {
+		chunks = append(chunks, ch)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p := data; len(p) > 0; {
+		n := writeSize
+		if n > len(p) {
+			n = len(p)
+		}
+		c.Write(p[:n])
+		p = p[n:]
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return chunks
+}
+
+func checkChunks(t *testing.T, data []byte, chunks []Chunk, opts Options) {
+	t.Helper()
+
+	var off uint64
+	for i, ch := range chunks {
+		if ch.Offset != off {
+			t.Fatalf("chunk %d at %d want %d", i, ch.Offset, off)
+		}
+		if ch.Length > opts.MaxSize || (ch.Length <= opts.MinSize && i < len(chunks)-1) {
+			t.Fatalf("chunk %d of %d bytes", i, ch.Length)
+		}
+		if sum := sha256.Sum256(data[off : off+uint64(ch.Length)]); !bytes.Equal(ch.Sum, sum[:]) {
+			t.Fatalf("chunk %d: wrong checksum", i)
+		}
+		off += uint64(ch.Length)
+	}
+	if off != uint64(len(data)) {
+		t.Fatalf("chunks cover %d bytes of %d", off, len(data))
+	}
+}
+
+func TestChunks(t *testing.T) {
+	opts := Options{MinSize: DefaultMinSize, AvgSize: DefaultAvgSize, MaxSize: DefaultMaxSize}
+	data := randomData(1 << 20)
+
+	chunks := split(t, data, Options{}, 1<<20)
+	checkChunks(t, data, chunks, opts)
+
+	// Normalized chunking keeps the sizes close to the average.
+	if avg := len(data) / len(chunks); avg < DefaultAvgSize*3/4 || avg > DefaultAvgSize*3/2 {
+		t.Fatalf("%d chunks of %d bytes on average", len(chunks), avg)
+	}
+
+	for _, writeSize := range []int{1, 100, 4096, 100000} {
+		got := split(t, data, Options{}, writeSize)
+		if len(got) != len(chunks) {
+			t.Fatalf("writes of %d: %d chunks want %d", writeSize, len(got), len(chunks))
+		}
+		for i := range got {
+			if got[i].Length != chunks[i].Length || !bytes.Equal(got[i].Sum, chunks[i].Sum) {
+				t.Fatalf("writes of %d: chunk %d differs", writeSize, i)
+			}
+		}
+	}
+
+	// Pinned so that the boundaries, which deduplication depends on, do not
+	// change silently.
+	small := Options{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+	var lengths []int
+	for _, ch := range split(t, randomData(10000), small, 10000) {
+		lengths = append(lengths, ch.Length)
+	}
+	if want := []int{873, 1219, 1086, 1156, 747, 1654, 1093, 1155, 1017}; !equalInts(lengths, want) {
+		t.Fatalf("chunk lengths %v want %v", lengths, want)
+	}
+
+	if chunks := split(t, nil, Options{}, 1); len(chunks) != 0 {
+		t.Fatalf("%d chunks of no data", len(chunks))
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMaxSize(t *testing.T) {
+	// With the maximum close to the average many chunks are cut there.
+	opts := Options{MinSize: 64, AvgSize: 512, MaxSize: 600}
+	data := randomData(100000)
+	chunks := split(t, data, opts, len(data))
+	checkChunks(t, data, chunks, opts)
+
+	full := 0
+	for _, ch := range chunks {
+		if ch.Length == opts.MaxSize {
+			full++
+		}
+	}
+	if full < len(chunks)/4 {
+		t.Fatalf("%d of %d chunks cut at the maximum size", full, len(chunks))
+	}
+}
+
+func TestShift(t *testing.T) {
+	data := randomData(1 << 20)
+	shifted := append(randomData(100), data...)
+
+	sums := make(map[string]bool)
+	for _, ch := range split(t, data, Options{}, 1<<20) {
+		sums[string(ch.Sum)] = true
+	}
+
+	chunks := split(t, shifted, Options{}, 1<<20)
+	shared := 0
+	for _, ch := range chunks {
+		if sums[string(ch.Sum)] {
+			shared++
+		}
+	}
+	if shared < len(chunks)-2 {
+		t.Fatalf("only %d of %d chunks survived an insertion", shared, len(chunks))
+	}
+}
+
+func TestState(t *testing.T) {
+	opts := Options{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+	data := randomData(50000)
+	want := split(t, data, opts, len(data))
+
+	for _, at := range []int{0, 1, 255, 256, 257, 1023, 1024, 4095, 4096, 12345, 49999, 50000} {
+		var got []Chunk
+		emit := func(ch Chunk) error {
+			got = append(got, ch)
+			return nil
+		}
+
+		c, _ := New(newSHA256, opts, emit)
+		c.Write(data[:at])
+
+		r, _ := New(newSHA256, Options{}, emit)
+		if err := r.SetState(c.GetState()); err != nil {
+			t.Fatal(err)
+		}
+		if r.Options() != opts || r.Offset() != uint64(at) {
+			t.Fatalf("%d: restored %+v at %d", at, r.Options(), r.Offset())
+		}
+		r.Write(data[at:])
+		r.Close()
+
+		if len(got) != len(want) {
+			t.Fatalf("%d: %d chunks want %d", at, len(got), len(want))
+		}
+		for i := range got {
+			if got[i].Offset != want[i].Offset || got[i].Length != want[i].Length || !bytes.Equal(got[i].Sum, want[i].Sum) {
+				t.Fatalf("%d: chunk %d differs", at, i)
+			}
+		}
+	}
+}
+
+func TestEmitError(t *testing.T) {
+	opts := Options{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+	data := randomData(50000)
+	want := split(t, data, opts, len(data))
+
+	errStop := errors.New("stop")
+	var got []Chunk
+	fail := true
+	c, _ := New(newSHA256, opts, func(ch Chunk) error {
+		got = append(got, ch)
+		if fail {
+			fail = false
+			return errStop
+		}
+		return nil
+	})
+
+	n, err := c.Write(data)
+	if err != errStop || n != want[0].Length {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if c.Offset() != uint64(n) {
+		t.Fatalf("offset %d after failed emit", c.Offset())
+	}
+	c.Write(data[n:])
+	c.Close()
+
+	if len(got) != len(want) {
+		t.Fatalf("%d chunks want %d", len(got), len(want))
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{MinSize: 32, AvgSize: 1024, MaxSize: 4096},
+		{MinSize: 1024, AvgSize: 1024, MaxSize: 4096},
+		{MinSize: 256, AvgSize: 1000, MaxSize: 4096},
+		{MinSize: 256, AvgSize: 4096, MaxSize: 4096},
+		{MinSize: 256, AvgSize: 1024, MaxSize: maxMaxSize + 1},
+		{MinSize: 64, AvgSize: 4, MaxSize: 4096},
+	} {
+		if _, err := New(newSHA256, opts, nil); err != ErrInvalidOptions {
+			t.Fatalf("%+v: err = %v", opts, err)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	opts := Options{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+	c, _ := New(newSHA256, opts, func(Chunk) error { return nil })
+	c.Write(randomData(3000))
+	state := c.GetState()
+
+	early, _ := New(newSHA256, opts, func(Chunk) error { return nil })
+	early.Write(randomData(100))
+	earlyState := early.GetState()
+	earlyState[len("bcdc")+1+2+2+2+1+1+7] = 1
+
+	for name, bad := range map[string][]byte{
+		"empty":       nil,
+		"magic":       append([]byte("nope"), state[4:]...),
+		"version":     append([]byte("bcdc\x02"), state[5:]...),
+		"avg size":    append(append([]byte("bcdc\x01"), state[5:7]...), append([]byte{0xe8, 0x07}, state[9:]...)...),
+		"fingerprint": earlyState,
+		"truncated":   state[:20],
+		"hash state":  state[:len(state)-1],
+		"oversized":   []byte("bcdc\x01\xff\xff\xff\xff\x0f"),
+	} {
+		r, _ := New(newSHA256, Options{}, nil)
+		if err := r.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+		if r.Options().AvgSize != DefaultAvgSize || r.Offset() != 0 {
+			t.Fatalf("%s: chunker changed", name)
+		}
+	}
+}
+
+func BenchmarkChunker(b *testing.B) {
+	data := randomData(1 << 20)
+	c, _ := New(newSHA256, Options{}, func(Chunk) error { return nil })
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		c.Write(data)
+	}
+}
@@ -0,0 +1,253 @@
+// Package checksumfile reads and writes checksum files in the formats of
+// GNU coreutils, as written by md5sum and sha256sum,
+//
+//	d41d8cd98f00b204e9800998ecf8427e  empty.txt
+//
+// and BSD, as written by md5 or by the coreutils tools with --tag,
+//
+//	MD5 (empty.txt) = d41d8cd98f00b204e9800998ecf8427e
+//
+// for any hash registered with the resumable package, and verifies the
+// files they list.
+//
+// Names containing a backslash, a newline or a carriage return are escaped
+// like coreutils does: the line starts with a backslash and those
+// characters are written as \\, \n and \r.
+package checksumfile
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrSyntax is the error of a ParseError for a malformed line.
+	ErrSyntax = errors.New("checksumfile: invalid line")
+
+	// ErrUnknownHash is the error of a ParseError for a line whose hash is
+	// not registered, or a GNU-style line when Parse was given no hash.
+	ErrUnknownHash = errors.New("checksumfile: unknown hash")
+)
+
+// ParseError is returned by Parse for a line it cannot parse.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v on line %d", e.Err, e.Line)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Format is the layout of the lines of a checksum file.
+type Format int
+
+const (
+	// GNU is "<hex>  <name>", the default format of md5sum and friends.
+	GNU Format = iota
+
+	// BSD is "<TAG> (<name>) = <hex>", where the tag names the hash.
+	BSD
+)
+
+// Entry is one line of a checksum file.
+type Entry struct {
+	// Hash is the name the hash is registered under, such as "sha256".
+	Hash string
+
+	// Name is the file name as written in the checksum file, usually a
+	// slash-separated path relative to the directory of the file.
+	Name string
+
+	// Sum is the checksum of the file.
+	Sum []byte
+}
+
+// tags maps the registered names whose BSD tag is not just the name in
+// upper case to the tag coreutils uses.
+var tags = map[string]string{
+	"blake2b-512": "BLAKE2b",
+	"blake2b-256": "BLAKE2b-256",
+}
+
+// Tag returns the BSD tag of the hash registered under name, e.g. "SHA256"
+// for "sha256".
+func Tag(name string) string {
+	if tag, ok := tags[name]; ok {
+		return tag
+	}
+	return strings.ToUpper(name)
+}
+
+// hashName returns the registered name of the hash with BSD tag tag.
+func hashName(tag string) string {
+	for name, t := range tags {
+		if t == tag {
+			return name
+		}
+	}
+	return strings.ToLower(tag)
+}
+
+// Writer writes checksum files.
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+}
+
+// NewWriter returns a Writer that writes lines in format to w. Flush must
+// be called after the last entry.
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{
+		w:      bufio.NewWriter(w),
+		format: format,
+	}
+}
+
+// WriteEntry writes the line of e.
+func (w *Writer) WriteEntry(e Entry) error {
+	name, escaped := escape(e.Name)
+	if escaped {
+		w.w.WriteByte('\\')
+	}
+
+	sum := hex.EncodeToString(e.Sum)
+
+	var err error
+	if w.format == BSD {
+		_, err = fmt.Fprintf(w.w, "%s (%s) = %s\n", Tag(e.Hash), name, sum)
+	} else {
+		_, err = fmt.Fprintf(w.w, "%s  %s\n", sum, name)
+	}
+
+	return err
+}
+
+// Flush writes any buffered lines to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+func escape(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return name, false
+	}
+	return escaper.Replace(name), true
+}
+
+func unescape(name string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(name) {
+			return "", false
+		}
+		switch name[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// Parse reads the entries of a checksum file from r. Lines can be in
+// either format, even mixed. BSD-style lines name their hash; GNU-style
+// lines are taken to use the hash registered under hash, which may be
+// empty if all lines are BSD-style. Empty lines are skipped and both "\n"
+// and "\r\n" line endings are accepted, as is the "*" coreutils writes
+// before names of files hashed in binary mode.
+func Parse(r io.Reader, hash string) ([]Entry, error) {
+	var entries []Entry
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		e, err := parseLine(line, hash)
+		if err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseLine(line, hash string) (e Entry, err error) {
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+
+	var sum string
+	first, rest, _ := strings.Cut(line, " ")
+	if strings.HasPrefix(rest, "(") {
+		i := strings.LastIndex(rest, ") = ")
+		if i < 0 {
+			return e, ErrSyntax
+		}
+		e.Hash = hashName(first)
+		e.Name = rest[1:i]
+		sum = rest[i+4:]
+	} else {
+		if hash == "" {
+			return e, ErrUnknownHash
+		}
+		if len(rest) < 2 || (rest[0] != ' ' && rest[0] != '*') {
+			return e, ErrSyntax
+		}
+		e.Hash = hash
+		e.Name = rest[1:]
+		sum = first
+	}
+
+	if e.Name == "" {
+		return e, ErrSyntax
+	}
+	if escaped {
+		var ok bool
+		if e.Name, ok = unescape(e.Name); !ok {
+			return e, ErrSyntax
+		}
+	}
+
+	h, err := resumable.New(e.Hash)
+	if err != nil {
+		return e, ErrUnknownHash
+	}
+	if e.Sum, err = hex.DecodeString(sum); err != nil || len(e.Sum) != h.Size() {
+		return e, ErrSyntax
+	}
+
+	return e, nil
+}
@@ -0,0 +1,124 @@
+package checksumfile
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Lines written by md5sum, sha256sum --tag and b2sum --tag (coreutils 9.1)
+// for a file holding "hello\n", and by md5sum for a file named `a\b` holding
+// "x".
+const coreutils = `b1946ac92492d2347c6235b4d2611184  h.txt
+SHA256 (h.txt) = 5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03
+BLAKE2b (h.txt) = f60ce482e5cc1229f39d71313171a8d9f4ca3a87d066bf4b205effb528192a75f14f3271e2c1a90e1de53f275b4d4793eef2f5e31ea90d2ce29d2e481c36435f
+BLAKE2b-256 (h.txt) = 93becc6e9882211c3ec3708c95bcd69baab7bb59c7f4bc84ce637b88a534b783
+\9dd4e461268c8034f5c8564e155c67a6  a\\b
+`
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(coreutils), "md5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ hash, name string }{
+		{"md5", "h.txt"},
+		{"sha256", "h.txt"},
+		{"blake2b-512", "h.txt"},
+		{"blake2b-256", "h.txt"},
+		{"md5", `a\b`},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Hash != want[i].hash || e.Name != want[i].name {
+			t.Fatalf("entry %d = %s %q want %s %q", i, e.Hash, e.Name, want[i].hash, want[i].name)
+		}
+	}
+
+	if sum := entries[1].Sum; len(sum) != 32 || sum[0] != 0x58 {
+		t.Fatalf("sha256 checksum = %x", sum)
+	}
+
+	// Written by sha1sum -b, with a Windows line ending.
+	entries, err = Parse(strings.NewReader("f572d396fae9206628714fb2ce00f72e94f2258f *h.txt\r\n"), "sha1")
+	if err != nil || len(entries) != 1 || entries[0].Hash != "sha1" || entries[0].Name != "h.txt" {
+		t.Fatalf("binary mode line: %+v, %v", entries, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		input, hash string
+		err         error
+	}{
+		{"b1946ac92492d2347c6235b4d2611184  h.txt\n", "", ErrUnknownHash},
+		{"b1946ac92492d2347c6235b4d2611184  h.txt\n", "nope", ErrUnknownHash},
+		{"NOPE (h.txt) = b1946ac92492d2347c6235b4d2611184\n", "md5", ErrUnknownHash},
+		{"b1946ac92492d2347c6235b4d261118  h.txt\n", "md5", ErrSyntax},
+		{"b1946ac92492d2347c6235b4d2611184 h.txt\n", "md5", ErrSyntax},
+		{"b1946ac92492d2347c6235b4d2611184  \n", "md5", ErrSyntax},
+		{"z1946ac92492d2347c6235b4d2611184  h.txt\n", "md5", ErrSyntax},
+		{"MD5 (h.txt) b1946ac92492d2347c6235b4d2611184\n", "md5", ErrSyntax},
+		{"MD5 (h.txt) = b19\n", "md5", ErrSyntax},
+		{"\\b1946ac92492d2347c6235b4d2611184  a\\x\n", "md5", ErrSyntax},
+		{"\\b1946ac92492d2347c6235b4d2611184  a\\\n", "md5", ErrSyntax},
+	} {
+		input := "MD5 (empty) = d41d8cd98f00b204e9800998ecf8427e\n\n" + c.input
+		_, err := Parse(strings.NewReader(input), c.hash)
+		if !errors.Is(err, c.err) {
+			t.Fatalf("%q: err = %v want %v", c.input, err, c.err)
+		}
+		if perr, ok := err.(*ParseError); !ok || perr.Line != 3 {
+			t.Fatalf("%q: error %q is not for line 3", c.input, err)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	entries, err := Parse(strings.NewReader(coreutils), "md5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		format  Format
+		entries []Entry
+		want    string
+	}{
+		{GNU, []Entry{entries[0], entries[4]}, "b1946ac92492d2347c6235b4d2611184  h.txt\n\\9dd4e461268c8034f5c8564e155c67a6  a\\\\b\n"},
+		{BSD, entries, "MD5 (h.txt) = b1946ac92492d2347c6235b4d2611184\n" +
+			strings.Join(strings.Split(coreutils, "\n")[1:4], "\n") + "\n" +
+			"\\MD5 (a\\\\b) = 9dd4e461268c8034f5c8564e155c67a6\n"},
+	} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, c.format)
+		for _, e := range c.entries {
+			if err := w.WriteEntry(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w.Flush()
+
+		if buf.String() != c.want {
+			t.Fatalf("format %d:\n%s\nwant\n%s", c.format, buf.String(), c.want)
+		}
+
+		parsed, err := Parse(&buf, "md5")
+		if err != nil || len(parsed) != len(c.entries) {
+			t.Fatalf("format %d: parsed %d entries, %v", c.format, len(parsed), err)
+		}
+		for i, e := range parsed {
+			if e.Hash != c.entries[i].Hash || e.Name != c.entries[i].Name || !bytes.Equal(e.Sum, c.entries[i].Sum) {
+				t.Fatalf("format %d: entry %d = %+v want %+v", c.format, i, e, c.entries[i])
+			}
+		}
+	}
+
+	if Tag("sha256") != "SHA256" || Tag("blake2b-512") != "BLAKE2b" || Tag("xxh3-128") != "XXH3-128" {
+		t.Fatal("bad tags")
+	}
+}
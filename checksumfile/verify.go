@@ -0,0 +1,288 @@
+package checksumfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrMismatch is the error of a Result whose file does not match its
+	// checksum.
+	ErrMismatch = errors.New("checksumfile: checksum mismatch")
+
+	// ErrInvalidState is returned by SetState when the state is not valid
+	// for the verifier.
+	ErrInvalidState = errors.New("checksumfile: invalid state")
+)
+
+// Result is the outcome of verifying one entry.
+type Result struct {
+	Entry
+
+	// Err is nil if the file matches its checksum, ErrMismatch if it does
+	// not, or the error opening or reading the file.
+	Err error
+}
+
+// OK reports whether the file matches its checksum.
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+// Verify verifies the files listed in entries, with relative names
+// resolved against dir, and returns a result for each.
+func Verify(dir string, entries []Entry) []Result {
+	v := NewVerifier(dir, entries)
+
+	results := make([]Result, 0, len(entries))
+	for {
+		res, err := v.Next()
+		if err != nil {
+			// Without checkpoints the only error is io.EOF.
+			return results
+		}
+		results = append(results, res)
+	}
+}
+
+// Verifier verifies the files listed in a checksum file one at a time. Its
+// state can be saved between files and, with SetCheckpoint, while hashing
+// large ones, so verification can resume after a restart.
+type Verifier struct {
+	dir     string
+	entries []Entry
+	next    int
+
+	// The hash of the file being verified, if it was interrupted by a
+	// checkpoint, and the offset, size and modification time it was at.
+	h       resumable.Resumable
+	offset  int64
+	size    int64
+	modTime int64
+
+	every int64
+	fn    func(state []byte) error
+}
+
+// checkpointError carries an error returned by the checkpoint function
+// through io.Copy, to tell it apart from read errors.
+type checkpointError struct {
+	err error
+}
+
+func (e checkpointError) Error() string { return e.err.Error() }
+
+// NewVerifier returns a Verifier of entries, whose relative names are
+// resolved against dir.
+func NewVerifier(dir string, entries []Entry) *Verifier {
+	return &Verifier{
+		dir:     dir,
+		entries: entries,
+	}
+}
+
+// SetCheckpoint makes Next call fn with the state of v every `every` bytes
+// hashed within a file. An error from fn stops Next, which returns it; the
+// state of v then resumes the file after the bytes hashed so far. A zero
+// every or nil fn disables checkpoints.
+func (v *Verifier) SetCheckpoint(every int64, fn func(state []byte) error) {
+	v.every = every
+	v.fn = fn
+}
+
+// Done returns the number of entries verified so far.
+func (v *Verifier) Done() int {
+	return v.next
+}
+
+// Next verifies the next entry and returns its result. It returns io.EOF
+// after the last entry. Files that are missing, unreadable or use an
+// unknown hash are reported in the result; Next itself only fails when a
+// checkpoint does.
+func (v *Verifier) Next() (Result, error) {
+	if v.next >= len(v.entries) {
+		return Result{}, io.EOF
+	}
+
+	e := v.entries[v.next]
+
+	sum, fileErr, err := v.hashFile(e)
+	if err != nil {
+		return Result{}, err
+	}
+
+	v.next++
+	v.h = nil
+	v.offset = 0
+
+	if fileErr == nil && !bytes.Equal(sum, e.Sum) {
+		fileErr = ErrMismatch
+	}
+
+	return Result{Entry: e, Err: fileErr}, nil
+}
+
+// hashFile returns the checksum of the file of e or the error opening or
+// reading it, resuming from v.h if the file has not changed since.
+func (v *Verifier) hashFile(e Entry) (sum []byte, fileErr, err error) {
+	h, fileErr := resumable.New(e.Hash)
+	if fileErr != nil {
+		return nil, fileErr, nil
+	}
+
+	f, fileErr := os.Open(v.path(e.Name))
+	if fileErr != nil {
+		return nil, fileErr, nil
+	}
+	defer f.Close()
+
+	info, fileErr := f.Stat()
+	if fileErr != nil {
+		return nil, fileErr, nil
+	}
+	size, modTime := info.Size(), info.ModTime().UnixNano()
+
+	var offset int64
+	if v.h != nil && v.size == size && v.modTime == modTime && v.offset <= size {
+		if _, err := f.Seek(v.offset, io.SeekStart); err == nil {
+			h, offset = v.h, v.offset
+		}
+	}
+	v.h, v.offset, v.size, v.modTime = h, offset, size, modTime
+
+	var every uint64
+	if v.fn != nil && v.every > 0 {
+		every = uint64(v.every)
+	}
+
+	r := resumable.NewHashingReader(f, h, every, func(n uint64, _ []byte) error {
+		v.offset = offset + int64(n)
+		if err := v.fn(v.GetState()); err != nil {
+			return checkpointError{err}
+		}
+		return nil
+	})
+
+	_, fileErr = io.Copy(io.Discard, r)
+	v.offset = offset + int64(r.Offset())
+	if cerr, ok := fileErr.(checkpointError); ok {
+		return nil, nil, cerr.err
+	}
+	if fileErr != nil {
+		return nil, fileErr, nil
+	}
+
+	return h.Sum(nil), nil, nil
+}
+
+func (v *Verifier) path(name string) string {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(v.dir, name)
+}
+
+// The state format is
+//
+//	"bcsv" || version || uvarint entries || uvarint done || 0
+//
+// between files, and
+//
+//	"bcsv" || version || uvarint entries || uvarint done || 1 || uvarint offset || uvarint size || uint64 modification time || hash state
+//
+// within one, with the modification time in nanoseconds, big-endian.
+const (
+	stateMagic   = "bcsv"
+	stateVersion = 1
+)
+
+// GetState returns the state of v, to be restored by SetState. The state
+// does not include the entries, which have to be given to NewVerifier
+// again.
+func (v *Verifier) GetState() []byte {
+	b := make([]byte, 0, 64)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = binary.AppendUvarint(b, uint64(len(v.entries)))
+	b = binary.AppendUvarint(b, uint64(v.next))
+
+	if v.h == nil {
+		return append(b, 0)
+	}
+
+	b = append(b, 1)
+	b = binary.AppendUvarint(b, uint64(v.offset))
+	b = binary.AppendUvarint(b, uint64(v.size))
+	b = binary.BigEndian.AppendUint64(b, uint64(v.modTime))
+	b = append(b, v.h.GetState()...)
+	return b
+}
+
+// SetState restores v from state returned by GetState of a Verifier of
+// the same entries. A file that was being hashed is resumed only if its
+// size and modification time are unchanged; otherwise it is hashed again
+// from the start. SetState returns ErrInvalidState and leaves v unchanged
+// if state is not valid.
+func (v *Verifier) SetState(state []byte) error {
+	if len(state) < len(stateMagic)+1 || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	count, n := binary.Uvarint(p)
+	if n <= 0 || count != uint64(len(v.entries)) {
+		return ErrInvalidState
+	}
+	p = p[n:]
+	next, n := binary.Uvarint(p)
+	if n <= 0 || next > count {
+		return ErrInvalidState
+	}
+	p = p[n:]
+
+	if len(p) == 1 && p[0] == 0 {
+		v.next = int(next)
+		v.h = nil
+		v.offset = 0
+		return nil
+	}
+	if len(p) == 0 || p[0] != 1 || next == count {
+		return ErrInvalidState
+	}
+	p = p[1:]
+
+	offset, n := binary.Uvarint(p)
+	if n <= 0 {
+		return ErrInvalidState
+	}
+	p = p[n:]
+	size, n := binary.Uvarint(p)
+	if n <= 0 || size > math.MaxInt64 || offset > size || len(p[n:]) < 8 {
+		return ErrInvalidState
+	}
+	p = p[n:]
+	modTime := int64(binary.BigEndian.Uint64(p))
+
+	h, err := resumable.New(v.entries[next].Hash)
+	if err != nil {
+		return ErrInvalidState
+	}
+	if err := h.SetState(p[8:]); err != nil {
+		return ErrInvalidState
+	}
+
+	v.next = int(next)
+	v.h = h
+	v.offset = int64(offset)
+	v.size = int64(size)
+	v.modTime = modTime
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package checksumfile
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+// testDir writes a.bin, of n bytes, and b.bin to a new directory and
+// returns it with entries for sha256 checksums of both, of c.bin, which does
+// not exist, and of b.bin with a wrong checksum.
+func testDir(t *testing.T, n int) (string, []Entry) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.bin"), testData(n), 0o644)
+	os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(dir, "sub", "b.bin"), []byte("b"), 0o644)
+
+	a := sha256.Sum256(testData(n))
+	b := sha256.Sum256([]byte("b"))
+	wrong := sha256.Sum256([]byte("c"))
+
+	return dir, []Entry{
+		{Hash: "sha256", Name: "a.bin", Sum: a[:]},
+		{Hash: "sha256", Name: "sub/b.bin", Sum: b[:]},
+		{Hash: "sha256", Name: "c.bin", Sum: b[:]},
+		{Hash: "sha256", Name: "sub/b.bin", Sum: wrong[:]},
+	}
+}
+
+func checkResults(t *testing.T, results []Result) {
+	t.Helper()
+
+	if len(results) != 4 {
+		t.Fatalf("%d results", len(results))
+	}
+	if !results[0].OK() || !results[1].OK() {
+		t.Fatalf("valid files failed: %v, %v", results[0].Err, results[1].Err)
+	}
+	if !errors.Is(results[2].Err, os.ErrNotExist) {
+		t.Fatalf("missing file: err = %v", results[2].Err)
+	}
+	if results[3].Err != ErrMismatch || results[3].Name != "sub/b.bin" {
+		t.Fatalf("mismatch: %+v", results[3])
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, entries := testDir(t, 5000)
+	checkResults(t, Verify(dir, entries))
+
+	abs := entries[:1:1]
+	abs[0].Name = filepath.ToSlash(filepath.Join(dir, "a.bin"))
+	if res := Verify(t.TempDir(), abs); !res[0].OK() {
+		t.Fatalf("absolute name: %v", res[0].Err)
+	}
+
+	unknown := []Entry{{Hash: "nope", Name: "a.bin"}}
+	if res := Verify(dir, unknown); res[0].OK() {
+		t.Fatal("unknown hash verified")
+	}
+}
+
+func TestVerifierResume(t *testing.T) {
+	errStop := errors.New("stop")
+
+	dir, entries := testDir(t, 5000)
+
+	for _, stopAt := range []int{1, 3, 5} {
+		for _, modify := range []bool{false, true} {
+			// Interrupt verification of a.bin at a checkpoint.
+			var saved []byte
+			checkpoints := 0
+			v := NewVerifier(dir, entries)
+			v.SetCheckpoint(1000, func(state []byte) error {
+				checkpoints++
+				if checkpoints == stopAt {
+					saved = state
+					return errStop
+				}
+				return nil
+			})
+			if _, err := v.Next(); err != errStop {
+				t.Fatalf("%d: err = %v", stopAt, err)
+			}
+			if v.Done() != 0 {
+				t.Fatalf("%d: %d entries done", stopAt, v.Done())
+			}
+
+			if modify {
+				// A changed file is hashed again from the start.
+				os.WriteFile(filepath.Join(dir, "a.bin"), testData(5001), 0o644)
+			}
+
+			r := NewVerifier(dir, entries)
+			if err := r.SetState(saved); err != nil {
+				t.Fatal(err)
+			}
+
+			var results []Result
+			for {
+				res, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, res)
+
+				// States between files resume too.
+				r2 := NewVerifier(dir, entries)
+				if err := r2.SetState(r.GetState()); err != nil || r2.Done() != len(results) {
+					t.Fatalf("state after %d files: %v", len(results), err)
+				}
+			}
+
+			if modify {
+				if results[0].Err != ErrMismatch {
+					t.Fatalf("%d: modified file: err = %v", stopAt, results[0].Err)
+				}
+				os.WriteFile(filepath.Join(dir, "a.bin"), testData(5000), 0o644)
+				results[0].Err = nil
+			}
+			checkResults(t, results)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	dir, entries := testDir(t, 5000)
+
+	v := NewVerifier(dir, entries)
+	var mid []byte
+	v.SetCheckpoint(1000, func(state []byte) error {
+		mid = state
+		return errors.New("stop")
+	})
+	v.Next()
+
+	between := NewVerifier(dir, entries)
+	between.Next()
+	end := NewVerifier(dir, entries)
+	for end.Done() < len(entries) {
+		end.Next()
+	}
+
+	for name, bad := range map[string][]byte{
+		"empty":         nil,
+		"magic":         append([]byte("nope"), mid[4:]...),
+		"version":       append([]byte("bcsv\x02"), mid[5:]...),
+		"entries":       append([]byte("bcsv\x01\x03"), mid[6:]...),
+		"done":          []byte("bcsv\x01\x04\x05\x00"),
+		"flag":          []byte("bcsv\x01\x04\x01\x02"),
+		"no flag":       []byte("bcsv\x01\x04\x01"),
+		"trailing":      append(between.GetState(), 0),
+		"after last":    append(end.GetState()[:7], mid[7:]...),
+		"truncated":     mid[:len(mid)-1],
+		"offset":        append(append([]byte(nil), mid[:8]...), append([]byte{0xa0, 0x9c, 0x01}, mid[10:]...)...),
+		"hash state":    append(append([]byte(nil), mid[:len(mid)-50]...), make([]byte, 50)...),
+		"unterminated":  []byte("bcsv\x01\x80"),
+		"modtime short": mid[:13],
+	} {
+		r := NewVerifier(dir, entries)
+		r.SetState(between.GetState())
+		if err := r.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+		if r.Done() != 1 {
+			t.Fatalf("%s: verifier changed", name)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Command resumablehash hashes files with any hash of the resumable package
+// and can be stopped and restarted without hashing them again from the
+// start.
+//
+// Usage:
+//
+//	resumablehash [-a algorithm] [-interval duration] [-state-dir dir] [-tag] file...
+//
+// While a file is hashed, the state of the hash is written to a state file
+// every interval and when the command is interrupted with SIGINT or SIGTERM.
+// The next run resumes from the state file if the file still has the size
+// and modification time it had, and removes it once the file is hashed. The
+// state file of a file is <file>.<algorithm>.hashstate in the directory of
+// the file or, with -state-dir, <name>.<id>.<algorithm>.hashstate in the
+// state directory, where id is derived from the absolute path of the file
+// so that files with the same name in different directories do not share
+// a state file. The absolute path is also stored in the state file and has
+// to match for the state to be resumed.
+//
+// The checksums are printed in the format of md5sum and sha256sum, or in
+// the BSD format with -tag, so they can be checked with those tools.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/koofr/go-cryptoutils"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"github.com/koofr/go-cryptoutils/checksumfile"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes.
+const (
+	exitOK          = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+var errInterrupted = errors.New("interrupted")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+type options struct {
+	alg      string
+	interval time.Duration
+	stateDir string
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("resumablehash", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: resumablehash [-a algorithm] [-interval duration] [-state-dir dir] [-tag] file...")
+		flags.PrintDefaults()
+		fmt.Fprintf(stderr, "\nalgorithms: %s\n", strings.Join(resumable.Names(), ", "))
+	}
+
+	var opts options
+	flags.StringVar(&opts.alg, "a", "sha256", "hash `algorithm`")
+	flags.DurationVar(&opts.interval, "interval", 30*time.Second, "time between state file writes, 0 to write only when interrupted")
+	flags.StringVar(&opts.stateDir, "state-dir", "", "`directory` for state files instead of the directory of each file")
+	tag := flags.Bool("tag", false, "print checksums in the BSD format")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if _, err := resumable.New(opts.alg); err != nil {
+		fmt.Fprintf(stderr, "resumablehash: unknown algorithm %q\n", opts.alg)
+		return exitUsage
+	}
+
+	format := checksumfile.GNU
+	if *tag {
+		format = checksumfile.BSD
+	}
+	w := checksumfile.NewWriter(stdout, format)
+
+	code := exitOK
+	for _, path := range flags.Args() {
+		sum, err := hashFile(ctx, path, opts)
+		if err == errInterrupted {
+			w.Flush()
+			fmt.Fprintf(stderr, "resumablehash: %s: interrupted, state saved to %s\n", path, statePath(path, opts))
+			return exitInterrupted
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "resumablehash: %v\n", err)
+			code = exitFailed
+			continue
+		}
+		w.WriteEntry(checksumfile.Entry{Hash: opts.alg, Name: path, Sum: sum})
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "resumablehash: %v\n", err)
+		return exitFailed
+	}
+
+	return code
+}
+
+// absPath returns the cleaned absolute path of path, or the cleaned path if
+// the working directory is unknown.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+func statePath(path string, opts options) string {
+	dir, name := filepath.Split(path)
+	if opts.stateDir != "" {
+		id := bettersha256.Sum([]byte(absPath(path)))
+		dir, name = opts.stateDir, name+"."+hex.EncodeToString(id[:8])
+	}
+	return filepath.Join(dir, name+"."+opts.alg+".hashstate")
+}
+
+// hashFile returns the checksum of the file at path, resuming from and
+// writing its state file. It returns errInterrupted after saving the state
+// once ctx is done.
+func hashFile(ctx context.Context, path string, opts options) ([]byte, error) {
+	sum, err := cryptoutils.HashFileResumableOptions(path, statePath(path, opts), opts.alg, cryptoutils.FileOptions{
+		Period:  opts.interval,
+		Context: ctx,
+	})
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil, errInterrupted
+	}
+	return sum, err
+}
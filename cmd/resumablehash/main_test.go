@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.bin")
+	b := filepath.Join(dir, "b\nc.bin")
+	dataA := writeFile(t, a, 3<<20+100)
+	dataB := writeFile(t, b, 10)
+
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"-a", "md5", a, b}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+
+	sumA, sumB := md5.Sum(dataA), md5.Sum(dataB)
+	want := hex.EncodeToString(sumA[:]) + "  " + a + "\n" +
+		`\` + hex.EncodeToString(sumB[:]) + "  " + strings.ReplaceAll(b, "\n", `\n`) + "\n"
+	if stdout.String() != want {
+		t.Fatalf("output = %q want %q", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	if code := run(context.Background(), []string{"-tag", a}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	sha := sha256.Sum256(dataA)
+	if want := "SHA256 (" + a + ") = " + hex.EncodeToString(sha[:]) + "\n"; stdout.String() != want {
+		t.Fatalf("BSD output = %q want %q", stdout.String(), want)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	dir := t.TempDir()
+	stateDir := t.TempDir()
+	path := filepath.Join(dir, "big.bin")
+	data := writeFile(t, path, 2<<20+5)
+	sp := statePath(path, options{alg: "sha256", stateDir: stateDir})
+
+	// An interrupted run saves the state before reading any further.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var stdout, stderr bytes.Buffer
+	if code := run(ctx, []string{"-state-dir", stateDir, path}, &stdout, &stderr); code != exitInterrupted {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(sp); err != nil {
+		t.Fatalf("no state file: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "state saved to "+sp) {
+		t.Fatalf("stderr = %q", stderr.String())
+	}
+
+	stdout.Reset()
+	if code := run(context.Background(), []string{"-state-dir", stateDir, "-interval", "1ns", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	sum := sha256.Sum256(data)
+	if want := hex.EncodeToString(sum[:]) + "  " + path + "\n"; stdout.String() != want {
+		t.Fatalf("output = %q want %q", stdout.String(), want)
+	}
+	if _, err := os.Stat(sp); !os.IsNotExist(err) {
+		t.Fatalf("state file left behind: %v", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good")
+	writeFile(t, good, 10)
+
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), nil, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("no files: exit %d", code)
+	}
+	if code := run(context.Background(), []string{"-a", "nope", good}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("unknown algorithm: exit %d", code)
+	}
+
+	stdout.Reset()
+	if code := run(context.Background(), []string{filepath.Join(dir, "missing"), good}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("missing file: exit %d", code)
+	}
+	if !strings.HasSuffix(stdout.String(), "  "+good+"\n") {
+		t.Fatalf("the other file was not hashed: %q", stdout.String())
+	}
+
+	// A corrupt state file is ignored.
+	sp := statePath(good, options{alg: "sha256"})
+	if err := os.WriteFile(sp, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := run(context.Background(), []string{good}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("corrupt state: exit %d", code)
+	}
+}
+
+func TestStatePathSameName(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a", "x")
+	b := filepath.Join(dir, "b", "x")
+	opts := options{alg: "sha256", stateDir: t.TempDir()}
+
+	if statePath(a, opts) == statePath(b, opts) {
+		t.Fatalf("%s and %s share the state file %s", a, b, statePath(a, opts))
+	}
+	if statePath(a, opts) != statePath(filepath.Join(dir, "b", "..", "a", "x"), opts) {
+		t.Fatal("state file depends on how the path is written")
+	}
+	if got, want := statePath(a, options{alg: "sha256"}), a+".sha256.hashstate"; got != want {
+		t.Fatalf("statePath = %s want %s", got, want)
+	}
+}
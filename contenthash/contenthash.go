@@ -0,0 +1,179 @@
+// Package contenthash computes and verifies Dropbox content hashes.
+//
+// The content hash of a file is the SHA-256 checksum of the concatenated
+// SHA-256 checksums of its 4 MiB blocks, the last one possibly shorter, in
+// hex. An empty file has no blocks, so its content hash is the SHA-256 of
+// nothing.
+package contenthash
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrInvalidHash is returned by Verify for malformed content hashes.
+	ErrInvalidHash = errors.New("contenthash: invalid content hash")
+
+	// ErrInvalidState is returned by SetState when the state is not valid.
+	ErrInvalidState = errors.New("contenthash: invalid state")
+)
+
+// Size is the size of a content hash in bytes.
+const Size = bettersha256.Size
+
+// BlockSize is the size of the blocks hashed separately, in bytes.
+const BlockSize = 4 << 20
+
+// Hasher computes the content hash of the data written to it.
+type Hasher struct {
+	blocks []byte
+	d      *bettersha256.BetterDigest
+	n      int
+}
+
+// New returns a new Hasher.
+func New() *Hasher {
+	return &Hasher{d: bettersha256.New()}
+}
+
+// NewFromState returns a new Hasher restored from existing state.
+func NewFromState(state []byte) *Hasher {
+	h := New()
+	h.SetState(state)
+	return h
+}
+
+func (h *Hasher) Reset() {
+	h.blocks = nil
+	h.d.Reset()
+	h.n = 0
+}
+
+func (h *Hasher) Size() int { return Size }
+
+func (h *Hasher) BlockSize() int { return bettersha256.BlockSize }
+
+// Write adds p to the data. It never returns an error.
+func (h *Hasher) Write(p []byte) (int, error) {
+	nn := len(p)
+
+	for len(p) > 0 {
+		n := min(BlockSize-h.n, len(p))
+		h.d.Write(p[:n])
+		h.n += n
+		p = p[n:]
+
+		if h.n == BlockSize {
+			h.blocks = h.d.Sum(h.blocks)
+			h.d.Reset()
+			h.n = 0
+		}
+	}
+
+	return nn, nil
+}
+
+// Sum appends the content hash of the data written so far to in.
+func (h *Hasher) Sum(in []byte) []byte {
+	blocks := h.blocks
+	if h.n > 0 {
+		blocks = h.d.Sum(blocks[:len(blocks):len(blocks)])
+	}
+
+	sum := bettersha256.Sum(blocks)
+	return append(in, sum[:]...)
+}
+
+// String returns the content hash of the data written so far in hex, the
+// form Dropbox uses.
+func (h *Hasher) String() string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// The state format is
+//
+//	"bdbx" || version || uint64 bytes in the current block || uint64 blocks done ||
+//	checksums of done blocks || bettersha256 state of the current block
+//
+// with integers in big-endian.
+const (
+	stateMagic   = "bdbx"
+	stateVersion = 1
+	stateHeader  = len(stateMagic) + 1 + 16
+)
+
+// GetState returns the state of h, to be restored by SetState.
+func (h *Hasher) GetState() []byte {
+	b := make([]byte, 0, stateHeader+len(h.blocks)+128)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = binary.BigEndian.AppendUint64(b, uint64(h.n))
+	b = binary.BigEndian.AppendUint64(b, uint64(len(h.blocks)/Size))
+	b = append(b, h.blocks...)
+	b = append(b, h.d.GetState()...)
+	return b
+}
+
+// SetState restores h from state returned by GetState. It returns
+// ErrInvalidState and leaves h unchanged if state is not valid.
+func (h *Hasher) SetState(state []byte) error {
+	if len(state) < stateHeader || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	n := binary.BigEndian.Uint64(p)
+	count := binary.BigEndian.Uint64(p[8:])
+	p = p[16:]
+
+	if n >= BlockSize || count > uint64(len(p))/Size {
+		return ErrInvalidState
+	}
+
+	blocks := append([]byte(nil), p[:count*Size]...)
+
+	d := bettersha256.New()
+	if err := d.SetState(p[count*Size:]); err != nil {
+		return ErrInvalidState
+	}
+
+	h.blocks = blocks
+	h.d = d
+	h.n = int(n)
+
+	return nil
+}
+
+// Compute returns the content hash of everything read from r until EOF, in
+// hex.
+func Compute(r io.Reader) (string, error) {
+	h := New()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return h.String(), nil
+}
+
+// Verify reports whether everything read from r matches the content hash s
+// as returned by Dropbox, in either letter case.
+func Verify(s string, r io.Reader) (bool, error) {
+	want, err := hex.DecodeString(strings.ToLower(s))
+	if err != nil || len(want) != Size {
+		return false, ErrInvalidHash
+	}
+
+	h := New()
+	if _, err := io.Copy(h, r); err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(h.Sum(nil), want) == 1, nil
+}
@@ -0,0 +1,107 @@
+package contenthash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 17)
+	}
+	return data
+}
+
+func referenceHash(data []byte) string {
+	var sums []byte
+	for off := 0; off < len(data); off += BlockSize {
+		s := sha256.Sum256(data[off:min(off+BlockSize, len(data))])
+		sums = append(sums, s[:]...)
+	}
+	s := sha256.Sum256(sums)
+	return hex.EncodeToString(s[:])
+}
+
+var sizes = []int{0, 1, BlockSize - 1, BlockSize, BlockSize + 1, 2*BlockSize + 1000}
+
+func TestCompute(t *testing.T) {
+	if s, _ := Compute(bytes.NewReader(nil)); s != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("empty content hash = %s", s)
+	}
+
+	for _, n := range sizes {
+		data := testData(n)
+
+		s, err := Compute(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := referenceHash(data); s != want {
+			t.Fatalf("%d bytes: %s want %s", n, s, want)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(2*BlockSize + 1000)
+	want := referenceHash(data)
+
+	for _, split := range []int{0, 1, BlockSize, BlockSize + 1, len(data)} {
+		h := New()
+		h.Write(data[:split])
+
+		r := NewFromState(h.GetState())
+		r.Write(data[split:])
+		if s := r.String(); s != want {
+			t.Fatalf("%d: resumed hash %s want %s", split, s, want)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	h := New()
+	h.Write(testData(BlockSize + 10))
+	state := h.GetState()
+	want := h.String()
+
+	full := append([]byte(nil), state...)
+	binary.BigEndian.PutUint64(full[len(stateMagic)+1:], BlockSize)
+
+	for name, s := range map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:stateHeader+Size-1],
+		"full block":      full,
+		"wrong magic":     append([]byte("xxxx"), state[4:]...),
+		"unknown version": append(append([]byte(stateMagic), 2), state[5:]...),
+	} {
+		if err := h.SetState(s); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if h.String() != want {
+		t.Fatal("failed SetState changed the hasher")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	data := testData(BlockSize + 1)
+	want := referenceHash(data)
+
+	for _, s := range []string{want, strings.ToUpper(want)} {
+		if ok, err := Verify(s, bytes.NewReader(data)); !ok || err != nil {
+			t.Fatalf("Verify(%s) = %v, %v", s, ok, err)
+		}
+	}
+	if ok, _ := Verify(want, bytes.NewReader(data[1:])); ok {
+		t.Fatal("Verify accepted different data")
+	}
+	if _, err := Verify("abc", bytes.NewReader(data)); !errors.Is(err, ErrInvalidHash) {
+		t.Fatalf("malformed hash: err = %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package cryptoutils
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+)
+
+var (
+	// ErrInvalidHex is returned by DecodeHex and ParseDigest for strings
+	// that are not hex.
+	ErrInvalidHex = errors.New("cryptoutils: invalid hex")
+
+	// ErrInvalidBase64 is returned by DecodeBase64 for strings that are not
+	// base64.
+	ErrInvalidBase64 = errors.New("cryptoutils: invalid base64")
+)
+
+// EqualConstantTime reports whether a and b are equal. The time it takes
+// depends only on their lengths, not their content, so it is safe for
+// comparing MACs and other checksums an attacker may be guessing.
+func EqualConstantTime(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// EncodeHex returns b in lowercase hex.
+func EncodeHex(b []byte) string {
+	return hex.EncodeToString(b)
+}
+
+// DecodeHex decodes s, in either case, from hex.
+func DecodeHex(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidHex
+	}
+	return b, nil
+}
+
+// EncodeBase64 returns b in padded standard base64.
+func EncodeBase64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// DecodeBase64 decodes s from standard or URL-safe base64, with or without
+// padding, which covers the forms checksums are usually published in.
+// Decoding is strict: padding must be complete if present, the unused bits
+// of the last character must be zero and line breaks are not skipped, so
+// every checksum has exactly one accepted encoding per alphabet and padding.
+func DecodeBase64(s string) ([]byte, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, ErrInvalidBase64
+	}
+
+	url, padded := strings.ContainsAny(s, "-_"), strings.HasSuffix(s, "=")
+	var enc *base64.Encoding
+	switch {
+	case url && padded:
+		enc = base64.URLEncoding
+	case url:
+		enc = base64.RawURLEncoding
+	case padded:
+		enc = base64.StdEncoding
+	default:
+		enc = base64.RawStdEncoding
+	}
+
+	b, err := enc.Strict().DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidBase64
+	}
+	return b, nil
+}
+
+// Digest is the output of a hash. It formats as lowercase hex and compares
+// in constant time.
+type Digest []byte
+
+// SumDigest returns the current checksum of h. h is not changed.
+func SumDigest(h hash.Hash) Digest {
+	return h.Sum(nil)
+}
+
+// ParseDigest parses a digest from hex in either case.
+func ParseDigest(s string) (Digest, error) {
+	return DecodeHex(s)
+}
+
+// String returns d in lowercase hex.
+func (d Digest) String() string {
+	return EncodeHex(d)
+}
+
+// Base64 returns d in padded standard base64.
+func (d Digest) Base64() string {
+	return EncodeBase64(d)
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding d as lowercase
+// hex.
+func (d Digest) MarshalText() ([]byte, error) {
+	b := make([]byte, hex.EncodedLen(len(d)))
+	hex.Encode(b, d)
+	return b, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, decoding d from hex in
+// either case.
+func (d *Digest) UnmarshalText(text []byte) error {
+	b := make([]byte, hex.DecodedLen(len(text)))
+	if _, err := hex.Decode(b, text); err != nil {
+		return ErrInvalidHex
+	}
+	*d = b
+	return nil
+}
+
+// Equal reports whether d and other are equal, in constant time like
+// EqualConstantTime.
+func (d Digest) Equal(other []byte) bool {
+	return EqualConstantTime(d, other)
+}
+
+// EqualHex reports whether s is d in hex, in either case. Strings that are
+// not hex are never equal. The comparison of the decoded bytes takes
+// constant time like EqualConstantTime.
+func (d Digest) EqualHex(s string) bool {
+	b, err := DecodeHex(s)
+	return err == nil && EqualConstantTime(d, b)
+}
+
+// EqualBase64 reports whether s is d in any of the base64 forms accepted by
+// DecodeBase64, comparing in constant time like EqualHex.
+func (d Digest) EqualBase64(s string) bool {
+	b, err := DecodeBase64(s)
+	return err == nil && EqualConstantTime(d, b)
+}
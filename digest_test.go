@@ -0,0 +1,109 @@
+package cryptoutils
+
+import (
+	"encoding/json"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"testing"
+)
+
+func TestEqualConstantTime(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want bool
+	}{
+		{"", "", true},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"", "a", false},
+	} {
+		if got := EqualConstantTime([]byte(c.a), []byte(c.b)); got != c.want {
+			t.Fatalf("EqualConstantTime(%q, %q) = %v", c.a, c.b, got)
+		}
+	}
+}
+
+func TestHex(t *testing.T) {
+	if s := EncodeHex([]byte{0x01, 0xab, 0xff}); s != "01abff" {
+		t.Fatalf("EncodeHex = %s", s)
+	}
+	for _, s := range []string{"01abff", "01ABFF", "01aBfF"} {
+		if b, err := DecodeHex(s); err != nil || string(b) != "\x01\xab\xff" {
+			t.Fatalf("DecodeHex(%q) = %x, %v", s, b, err)
+		}
+	}
+	for _, s := range []string{"0", "0g", "01 ab"} {
+		if _, err := DecodeHex(s); err != ErrInvalidHex {
+			t.Fatalf("DecodeHex(%q): err = %v", s, err)
+		}
+	}
+}
+
+func TestBase64(t *testing.T) {
+	b := []byte{0xfb, 0xff, 0x01, 0x02}
+	if s := EncodeBase64(b); s != "+/8BAg==" {
+		t.Fatalf("EncodeBase64 = %s", s)
+	}
+	for _, s := range []string{"+/8BAg==", "+/8BAg", "-_8BAg==", "-_8BAg"} {
+		if got, err := DecodeBase64(s); err != nil || string(got) != string(b) {
+			t.Fatalf("DecodeBase64(%q) = %x, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{
+		"+/8BA", "+_8BAg", "+/8B=Ag", "*",
+		// Incomplete or excess padding.
+		"+/8BAg=", "+/8BAg===", "-_8BAg=",
+		// Non-zero unused bits in the last character.
+		"+/8BAh==", "+/8BAh", "-_8BAh",
+		// Line breaks.
+		"+/8B\nAg==", "+/8BAg\r\n",
+	} {
+		if _, err := DecodeBase64(s); err != ErrInvalidBase64 {
+			t.Fatalf("DecodeBase64(%q): err = %v", s, err)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	const abc = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+	h := bettersha256.New()
+	h.Write([]byte("abc"))
+	d := SumDigest(h)
+
+	if d.String() != abc {
+		t.Fatalf("String = %s", d)
+	}
+	if d.Base64() != "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=" {
+		t.Fatalf("Base64 = %s", d.Base64())
+	}
+
+	p, err := ParseDigest(abc)
+	if err != nil || !d.Equal(p) {
+		t.Fatalf("ParseDigest = %s, %v", p, err)
+	}
+	if d.Equal(p[1:]) || d.Equal(nil) {
+		t.Fatal("Equal accepted a shorter digest")
+	}
+	if !d.EqualHex(abc) || !d.EqualHex("BA7816BF8F01CFEA414140DE5DAE2223B00361A396177A9CB410FF61F20015AD") {
+		t.Fatal("EqualHex rejected the digest")
+	}
+	if d.EqualHex(abc[:62]) || d.EqualHex(abc[:63]+"x") || d.EqualHex("") {
+		t.Fatal("EqualHex accepted another string")
+	}
+	if !d.EqualBase64("ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0") || d.EqualBase64("ungWv48Bz") {
+		t.Fatal("EqualBase64 failed")
+	}
+
+	j, err := json.Marshal(struct{ Sum Digest }{d})
+	if err != nil || string(j) != `{"Sum":"`+abc+`"}` {
+		t.Fatalf("json = %s, %v", j, err)
+	}
+	var v struct{ Sum Digest }
+	if err := json.Unmarshal(j, &v); err != nil || !v.Sum.Equal(d) {
+		t.Fatalf("unmarshaled %s, %v", v.Sum, err)
+	}
+	if err := v.Sum.UnmarshalText([]byte("xyz")); err != ErrInvalidHex || !v.Sum.Equal(d) {
+		t.Fatalf("UnmarshalText invalid: err = %v, digest %s", err, v.Sum)
+	}
+}
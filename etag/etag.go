@@ -0,0 +1,214 @@
+// Package etag computes and verifies Amazon S3 multipart upload ETags.
+//
+// The ETag of a multipart upload is the MD5 checksum of the concatenated MD5
+// checksums of its parts, in hex, followed by a dash and the number of
+// parts, e.g. "d41d8cd98f00b204e9800998ecf8427e-3". Objects uploaded in a
+// single request have the plain hex MD5 of their content as ETag instead.
+package etag
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koofr/go-cryptoutils/bettermd5"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidETag is returned by Parse for malformed ETags.
+	ErrInvalidETag = errors.New("etag: invalid etag")
+
+	// ErrInvalidState is returned by SetState when the state is not valid.
+	ErrInvalidState = errors.New("etag: invalid state")
+)
+
+// ETag is a parsed S3 ETag. Parts is the number of parts of a multipart
+// upload, or zero for a plain MD5 ETag.
+type ETag struct {
+	Sum   [bettermd5.Size]byte
+	Parts int
+}
+
+// Parse parses an ETag as returned by S3, with or without surrounding
+// quotes.
+func Parse(s string) (e ETag, err error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`)
+
+	sum := s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		sum = s[:i]
+		if e.Parts, err = strconv.Atoi(s[i+1:]); err != nil || e.Parts < 1 {
+			return ETag{}, ErrInvalidETag
+		}
+	}
+
+	if len(sum) != 2*bettermd5.Size {
+		return ETag{}, ErrInvalidETag
+	}
+	if _, err := hex.Decode(e.Sum[:], []byte(sum)); err != nil {
+		return ETag{}, ErrInvalidETag
+	}
+
+	return e, nil
+}
+
+// String returns e in the form S3 uses, without quotes.
+func (e ETag) String() string {
+	if e.Parts == 0 {
+		return hex.EncodeToString(e.Sum[:])
+	}
+	return fmt.Sprintf("%x-%d", e.Sum, e.Parts)
+}
+
+// Hasher computes the multipart ETag of the data written to it, split into
+// parts of a fixed size.
+type Hasher struct {
+	partSize int64
+	parts    []byte
+	d        *bettermd5.BetterDigest
+}
+
+// NewHasher returns a Hasher for parts of partSize bytes. It panics if
+// partSize is not positive.
+func NewHasher(partSize int64) *Hasher {
+	if partSize <= 0 {
+		panic("etag.NewHasher: part size must be positive")
+	}
+
+	return &Hasher{
+		partSize: partSize,
+		d:        bettermd5.New(),
+	}
+}
+
+// Write adds p to the data. It never returns an error.
+func (h *Hasher) Write(p []byte) (int, error) {
+	nn := len(p)
+
+	for len(p) > 0 {
+		n, _ := h.d.Position()
+		room := uint64(h.partSize) - n
+		if uint64(len(p)) < room {
+			h.d.Write(p)
+			break
+		}
+		h.d.Write(p[:room])
+		p = p[room:]
+		h.parts = h.d.SumReset(h.parts)
+	}
+
+	return nn, nil
+}
+
+// ETag returns the multipart ETag of the data written so far. A trailing
+// partial part counts as the last part; no data at all counts as a single
+// empty part.
+func (h *Hasher) ETag() ETag {
+	parts := h.parts
+	if n, _ := h.d.Position(); n > 0 || len(parts) == 0 {
+		parts = h.d.Sum(parts[:len(parts):len(parts)])
+	}
+
+	return ETag{
+		Sum:   bettermd5.Sum(parts),
+		Parts: len(parts) / bettermd5.Size,
+	}
+}
+
+// The state format is
+//
+//	"betg" || version || uint64 part size || uint64 parts done || checksums of done parts || bettermd5 state of the current part
+//
+// with integers in big-endian.
+const (
+	stateMagic   = "betg"
+	stateVersion = 1
+	stateHeader  = len(stateMagic) + 1 + 16
+)
+
+// GetState returns the state of h, to be restored by SetState.
+func (h *Hasher) GetState() []byte {
+	b := make([]byte, 0, stateHeader+len(h.parts)+64)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = binary.BigEndian.AppendUint64(b, uint64(h.partSize))
+	b = binary.BigEndian.AppendUint64(b, uint64(len(h.parts)/bettermd5.Size))
+	b = append(b, h.parts...)
+	b = append(b, h.d.GetState()...)
+	return b
+}
+
+// SetState restores h from state returned by GetState, including its part
+// size. It returns ErrInvalidState and leaves h unchanged if state is not
+// valid.
+func (h *Hasher) SetState(state []byte) error {
+	if len(state) < stateHeader || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	partSize := binary.BigEndian.Uint64(p)
+	count := binary.BigEndian.Uint64(p[8:])
+	p = p[16:]
+
+	if partSize == 0 || partSize > 1<<62 || count > uint64(len(p))/bettermd5.Size {
+		return ErrInvalidState
+	}
+
+	parts := append([]byte(nil), p[:count*bettermd5.Size]...)
+
+	d := bettermd5.New()
+	if err := d.SetState(p[count*bettermd5.Size:]); err != nil {
+		return ErrInvalidState
+	}
+	if n, _ := d.Position(); n >= partSize {
+		return ErrInvalidState
+	}
+
+	h.partSize = int64(partSize)
+	h.parts = parts
+	h.d = d
+
+	return nil
+}
+
+// Compute returns the multipart ETag of everything read from r until EOF,
+// split into parts of partSize bytes.
+func Compute(r io.Reader, partSize int64) (ETag, error) {
+	h := NewHasher(partSize)
+
+	if _, err := io.Copy(h, r); err != nil {
+		return ETag{}, err
+	}
+
+	return h.ETag(), nil
+}
+
+// Verify reports whether everything read from r matches the ETag s as
+// returned by S3. Multipart ETags are checked by splitting r into parts of
+// partSize bytes, which must be the part size of the upload; plain ETags
+// are checked against the MD5 of r and partSize is ignored.
+func Verify(s string, r io.Reader, partSize int64) (bool, error) {
+	want, err := Parse(s)
+	if err != nil {
+		return false, err
+	}
+
+	if want.Parts == 0 {
+		sum, err := bettermd5.SumReader(r)
+		if err != nil {
+			return false, err
+		}
+		return sum == want.Sum, nil
+	}
+
+	got, err := Compute(r, partSize)
+	if err != nil {
+		return false, err
+	}
+
+	return got == want, nil
+}
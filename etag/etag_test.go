@@ -0,0 +1,111 @@
+package etag
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"testing"
+)
+
+func multipartETag(data []byte, partSize int) string {
+	var sums []byte
+	parts := 0
+	for off := 0; off < len(data) || parts == 0; off += partSize {
+		end := off + partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		s := md5.Sum(data[off:end])
+		sums = append(sums, s[:]...)
+		parts++
+	}
+	return fmt.Sprintf("%x-%d", md5.Sum(sums), parts)
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 17)
+	}
+	return data
+}
+
+func TestCompute(t *testing.T) {
+	for _, n := range []int{0, 1, 999, 1000, 1001, 5500} {
+		data := testData(n)
+
+		e, err := Compute(bytes.NewReader(data), 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := multipartETag(data, 1000); e.String() != want {
+			t.Fatalf("%d bytes: ETag = %s want %s", n, e, want)
+		}
+
+		ok, err := Verify(`"`+e.String()+`"`, bytes.NewReader(data), 1000)
+		if err != nil || !ok {
+			t.Fatalf("%d bytes: Verify = %v, %v", n, ok, err)
+		}
+		if ok, _ := Verify(e.String(), bytes.NewReader(data), 500); ok && n > 500 {
+			t.Fatalf("%d bytes: Verify with the wrong part size succeeded", n)
+		}
+	}
+
+	data := testData(100)
+	plain := fmt.Sprintf("%x", md5.Sum(data))
+	if ok, err := Verify(plain, bytes.NewReader(data), 1000); err != nil || !ok {
+		t.Fatalf("plain Verify = %v, %v", ok, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	e, err := Parse(`"d41d8cd98f00b204e9800998ecf8427e-12"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Parts != 12 || fmt.Sprintf("%x", e.Sum) != "d41d8cd98f00b204e9800998ecf8427e" {
+		t.Fatalf("Parse = %+v", e)
+	}
+	if e, _ := Parse("d41d8cd98f00b204e9800998ecf8427e"); e.Parts != 0 || e.String() != "d41d8cd98f00b204e9800998ecf8427e" {
+		t.Fatalf("Parse plain = %+v", e)
+	}
+
+	for _, s := range []string{"", "abc", "d41d8cd98f00b204e9800998ecf8427e-0", "d41d8cd98f00b204e9800998ecf8427e-x", "z41d8cd98f00b204e9800998ecf8427e"} {
+		if _, err := Parse(s); err != ErrInvalidETag {
+			t.Fatalf("Parse(%q): err = %v", s, err)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(5500)
+	want := multipartETag(data, 1000)
+
+	for _, split := range []int{0, 1, 1000, 2500, 5500} {
+		h := NewHasher(1000)
+		h.Write(data[:split])
+
+		r := NewHasher(1)
+		if err := r.SetState(h.GetState()); err != nil {
+			t.Fatal(err)
+		}
+		r.Write(data[split:])
+
+		if e := r.ETag(); e.String() != want {
+			t.Fatalf("%d: resumed ETag = %s want %s", split, e, want)
+		}
+	}
+
+	h := NewHasher(1000)
+	h.Write(data[:2500])
+	state := h.GetState()
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": state[:len(state)-1],
+		"magic":     append([]byte("nope"), state[4:]...),
+	} {
+		if err := h.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
@@ -47,3 +47,26 @@ func ExampleNewBetterCTR() {
 	fmt.Printf("%s\n", plaintext2)
 	// Output: some plaintext
 }
+
+func ExampleNewHashFromState() {
+	h, err := cryptoutils.NewHash("sha256")
+	if err != nil {
+		panic(err)
+	}
+
+	io.WriteString(h, "hello ")
+
+	// Store the algorithm name and state, e.g. in a database, and resume
+	// later without knowing the concrete hash type.
+	name, state := "sha256", h.GetState()
+
+	resumed, err := cryptoutils.NewHashFromState(name, state)
+	if err != nil {
+		panic(err)
+	}
+
+	io.WriteString(resumed, "world")
+
+	fmt.Printf("%x\n", resumed.Sum(nil))
+	// Output: b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9
+}
@@ -0,0 +1,276 @@
+package cryptoutils
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// fileCheckpointInterval is the number of bytes HashFileResumable hashes
+	// between writes of the state file.
+	fileCheckpointInterval = 64 << 20
+
+	fileReadSize = 1 << 20
+)
+
+var errInvalidFileState = errors.New("cryptoutils: invalid state file")
+
+// fileState is the content of the state file written by HashFileResumable.
+type fileState struct {
+	Alg     string
+	Path    string
+	Size    int64
+	ModTime int64
+	Offset  uint64
+	State   []byte
+}
+
+// The state file format is
+//
+//	"bfhs" || version || uvarint length || algorithm || uvarint length ||
+//	path || uvarint size || uint64 modification time || uvarint offset ||
+//	hash state
+//
+// with the modification time in nanoseconds, big-endian.
+const (
+	fileStateMagic   = "bfhs"
+	fileStateVersion = 1
+)
+
+// MarshalBinary returns the byte form of s that is written to the state file.
+func (s *fileState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 64+len(s.Alg)+len(s.Path)+len(s.State))
+	b = append(b, fileStateMagic...)
+	b = append(b, fileStateVersion)
+	b = binary.AppendUvarint(b, uint64(len(s.Alg)))
+	b = append(b, s.Alg...)
+	b = binary.AppendUvarint(b, uint64(len(s.Path)))
+	b = append(b, s.Path...)
+	b = binary.AppendUvarint(b, uint64(s.Size))
+	b = binary.BigEndian.AppendUint64(b, uint64(s.ModTime))
+	b = binary.AppendUvarint(b, s.Offset)
+	return append(b, s.State...), nil
+}
+
+// UnmarshalBinary sets s from the byte form returned by MarshalBinary. It
+// returns errInvalidFileState and leaves s unchanged if b is not valid,
+// including when it was written by another version of the format.
+func (s *fileState) UnmarshalBinary(b []byte) error {
+	if len(b) < len(fileStateMagic)+1 || string(b[:len(fileStateMagic)]) != fileStateMagic || b[len(fileStateMagic)] != fileStateVersion {
+		return errInvalidFileState
+	}
+
+	p := b[len(fileStateMagic)+1:]
+	uvarint := func() (uint64, bool) {
+		x, n := binary.Uvarint(p)
+		if n <= 0 || x > 1<<63-1 {
+			return 0, false
+		}
+		p = p[n:]
+		return x, true
+	}
+
+	text := func() (string, bool) {
+		n, ok := uvarint()
+		if !ok || n > uint64(len(p)) {
+			return "", false
+		}
+		s := string(p[:n])
+		p = p[n:]
+		return s, true
+	}
+
+	alg, ok1 := text()
+	path, ok2 := text()
+	size, ok3 := uvarint()
+	if !ok1 || !ok2 || !ok3 || len(p) < 8 {
+		return errInvalidFileState
+	}
+	modTime := int64(binary.BigEndian.Uint64(p))
+	p = p[8:]
+	offset, ok := uvarint()
+	if !ok || offset > size {
+		return errInvalidFileState
+	}
+
+	*s = fileState{
+		Alg:     alg,
+		Path:    path,
+		Size:    int64(size),
+		ModTime: modTime,
+		Offset:  offset,
+		State:   append([]byte(nil), p...),
+	}
+
+	return nil
+}
+
+// HashFileResumable returns the checksum of the file at path computed by the
+// resumable hash alg, as registered with RegisterHash.
+//
+// While hashing, the state of the hash and the offset it covers are written
+// to statePath every 64 MiB, atomically by writing a temporary file in the
+// same directory and renaming it. If statePath already holds a state for the
+// same algorithm and file, and the file still has the size and modification
+// time it had then, hashing resumes from that offset; otherwise the state
+// file is ignored and hashing starts over. The state file is removed once
+// the whole file has been hashed.
+func HashFileResumable(path, statePath, alg string) ([]byte, error) {
+	return HashFileResumableOptions(path, statePath, alg, FileOptions{Interval: fileCheckpointInterval})
+}
+
+// FileOptions configures HashFileResumableOptions.
+type FileOptions struct {
+	// Interval is the number of bytes hashed between writes of the state
+	// file. Zero disables them.
+	Interval uint64
+
+	// Period, if positive, also writes the state file when that much time
+	// has passed since it was last written.
+	Period time.Duration
+
+	// Context, if set, is checked before every read. Once it is done the
+	// state file is written and ctx.Err() is returned, so the next call
+	// resumes where this one stopped.
+	Context context.Context
+}
+
+// HashFileResumableOptions is like HashFileResumable with the state file
+// written as configured by opts.
+func HashFileResumableOptions(path, statePath, alg string, opts FileOptions) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := NewHash(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	current := fileState{
+		Alg:     alg,
+		Path:    absPath(path),
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+	}
+
+	offset := resumeFileState(statePath, current, h)
+	if offset > 0 {
+		if _, err := f.Seek(int64(offset), io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	last := time.Now()
+	save := func(n uint64, state []byte) error {
+		s := current
+		s.Offset = offset + n
+		s.State = state
+		last = time.Now()
+		return writeFileState(statePath, s)
+	}
+
+	r := resumable.NewHashingReader(f, h, opts.Interval, save)
+	buf := make([]byte, fileReadSize)
+	for {
+		if opts.Context != nil && opts.Context.Err() != nil {
+			if err := save(r.Offset(), h.GetState()); err != nil {
+				return nil, err
+			}
+			return nil, opts.Context.Err()
+		}
+		if opts.Period > 0 && time.Since(last) >= opts.Period {
+			if err := save(r.Offset(), h.GetState()); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := r.Read(buf); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// absPath returns the cleaned absolute path of path, or the cleaned path if
+// the working directory is unknown.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// resumeFileState restores h from the state file at statePath if it matches
+// current and returns the offset to resume from, or 0 to start over.
+func resumeFileState(statePath string, current fileState, h ResumableHash) uint64 {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return 0
+	}
+
+	var s fileState
+	if err := s.UnmarshalBinary(data); err != nil {
+		return 0
+	}
+
+	if s.Alg != current.Alg || s.Path != current.Path || s.Size != current.Size || s.ModTime != current.ModTime {
+		return 0
+	}
+
+	if err := h.SetState(s.State); err != nil {
+		h.Reset()
+		return 0
+	}
+
+	return s.Offset
+}
+
+func writeFileState(statePath string, s fileState) error {
+	data, err := s.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(statePath), filepath.Base(statePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), statePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
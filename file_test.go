@@ -0,0 +1,184 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashFileResumable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	statePath := filepath.Join(dir, "file.state")
+
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(1500000000, 0)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(data)
+
+	// A state left behind by an interrupted run over the first half.
+	h, _ := NewHash("sha256")
+	h.Write(data[:50000])
+	writeState := func(modTime time.Time, state []byte) {
+		err := writeFileState(statePath, fileState{
+			Alg:     "sha256",
+			Path:    absPath(path),
+			Size:    int64(len(data)),
+			ModTime: modTime.UnixNano(),
+			Offset:  50000,
+			State:   state,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeState(mtime, h.GetState())
+
+	sum, err := HashFileResumable(path, statePath, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sum, want[:]) {
+		t.Fatalf("resumed sum = %x want %x", sum, want)
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Fatalf("state file not removed: %v", err)
+	}
+
+	// A state for a different modification time must not be resumed. It
+	// holds a wrong hash state, so resuming from it would give a wrong sum.
+	wrong, _ := NewHash("sha256")
+	wrong.Write(make([]byte, 50000))
+	writeState(mtime.Add(time.Second), wrong.GetState())
+
+	sum, err = HashFileResumable(path, statePath, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sum, want[:]) {
+		t.Fatalf("sum after stale state = %x want %x", sum, want)
+	}
+
+	// So must a state written for a file of the same size and modification
+	// time at another path.
+	err = writeFileState(statePath, fileState{
+		Alg:     "sha256",
+		Path:    absPath(path) + ".other",
+		Size:    int64(len(data)),
+		ModTime: mtime.UnixNano(),
+		Offset:  50000,
+		State:   wrong.GetState(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum, err = HashFileResumable(path, statePath, "sha256"); err != nil || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("sum after state of another file = %x, %v", sum, err)
+	}
+
+	// Garbage in the state file is ignored too.
+	os.WriteFile(statePath, []byte("garbage"), 0o644)
+	if sum, err = HashFileResumable(path, statePath, "sha256"); err != nil || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("sum after garbage state = %x, %v", sum, err)
+	}
+
+	if _, err := HashFileResumable(path, statePath, "nope"); err == nil {
+		t.Fatal("unknown algorithm: expected error")
+	}
+}
+
+func TestHashFileResumableOptions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	statePath := filepath.Join(dir, "file.state")
+
+	data := make([]byte, 3*fileReadSize+10)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(data)
+
+	// A done context saves the state and stops before reading.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := HashFileResumableOptions(path, statePath, "sha256", FileOptions{Context: ctx}); err != context.Canceled {
+		t.Fatalf("canceled: err = %v", err)
+	}
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s fileState
+	if err := s.UnmarshalBinary(b); err != nil || s.Offset != 0 || s.Path != absPath(path) {
+		t.Fatalf("saved state %+v, %v", s, err)
+	}
+
+	// Writing the state after every read, by size and by time, resumes
+	// from that state and gives the same checksum.
+	sum, err := HashFileResumableOptions(path, statePath, "sha256", FileOptions{
+		Interval: fileReadSize,
+		Period:   time.Nanosecond,
+	})
+	if err != nil || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("sum = %x, %v", sum, err)
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Fatalf("state file not removed: %v", err)
+	}
+}
+
+func TestFileStateBinary(t *testing.T) {
+	h, _ := NewHash("sha256")
+	h.Write([]byte("hello"))
+	s := fileState{
+		Alg:     "sha256",
+		Size:    100,
+		ModTime: -1,
+		Offset:  5,
+		State:   h.GetState(),
+	}
+
+	b, _ := s.MarshalBinary()
+	var got fileState
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.Alg != s.Alg || got.Size != s.Size || got.ModTime != s.ModTime || got.Offset != s.Offset || !bytes.Equal(got.State, s.State) {
+		t.Fatalf("round trip: %+v want %+v", got, s)
+	}
+
+	beyond := s
+	beyond.Offset = 101
+	badOffset, _ := beyond.MarshalBinary()
+
+	for name, bad := range map[string][]byte{
+		"empty":           nil,
+		"bad magic":       append([]byte("nope"), b[4:]...),
+		"unknown version": append(append([]byte(fileStateMagic), fileStateVersion+1), b[5:]...),
+		"truncated":       b[:len(fileStateMagic)+1+1+len(s.Alg)+1+4],
+		"offset > size":   badOffset,
+	} {
+		got := s
+		if err := got.UnmarshalBinary(bad); err != errInvalidFileState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+		if got.Alg != s.Alg || got.Offset != s.Offset {
+			t.Fatalf("%s: state changed", name)
+		}
+	}
+}
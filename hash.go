@@ -0,0 +1,40 @@
+package cryptoutils
+
+import (
+	"github.com/koofr/go-cryptoutils/resumable"
+)
+
+// ResumableHash is a hash.Hash whose state can be saved with GetState and
+// restored with SetState. The digests in this module satisfy it.
+// It is the same type as resumable.Resumable.
+type ResumableHash = resumable.Resumable
+
+// NewHash returns a new resumable hash by name, such as "md5" or "sha256".
+// It returns an error if no hash is registered under name.
+func NewHash(name string) (ResumableHash, error) {
+	return resumable.New(name)
+}
+
+// NewHashFromState returns the resumable hash registered under name,
+// restored from state as returned by its GetState. Applications that store
+// an algorithm name next to a state blob can resume it without knowing the
+// concrete type.
+func NewHashFromState(name string, state []byte) (ResumableHash, error) {
+	h, err := resumable.New(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.SetState(state); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// RegisterHash makes a resumable hash available to NewHash and
+// NewHashFromState under name. It panics if fn is nil or name is already
+// registered.
+func RegisterHash(name string, fn func() ResumableHash) {
+	resumable.Register(name, fn)
+}
@@ -0,0 +1,24 @@
+package cryptoutils
+
+import (
+	"github.com/koofr/go-cryptoutils/betterblake2b"
+	"github.com/koofr/go-cryptoutils/betterblake3"
+	"github.com/koofr/go-cryptoutils/bettermd5"
+	"github.com/koofr/go-cryptoutils/bettersha1"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"github.com/koofr/go-cryptoutils/bettersha512"
+	"github.com/koofr/go-cryptoutils/quickxorhash"
+	"github.com/koofr/go-cryptoutils/xxhash"
+)
+
+var (
+	_ ResumableHash = (*betterblake2b.BetterDigest)(nil)
+	_ ResumableHash = (*betterblake3.BetterDigest)(nil)
+	_ ResumableHash = (*bettermd5.BetterDigest)(nil)
+	_ ResumableHash = (*bettersha1.BetterDigest)(nil)
+	_ ResumableHash = (*bettersha256.BetterDigest)(nil)
+	_ ResumableHash = (*bettersha512.BetterDigest)(nil)
+	_ ResumableHash = (*quickxorhash.Digest)(nil)
+	_ ResumableHash = (*xxhash.Digest64)(nil)
+	_ ResumableHash = (*xxhash.Digest128)(nil)
+)
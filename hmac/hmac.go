@@ -0,0 +1,336 @@
+// Package hmac implements HMAC as defined in RFC 2104 over resumable hashes,
+// so that a MAC over a long stream can be checkpointed and resumed like the
+// hash itself.
+//
+// Every digest state derived from the key is as good as the key for forging
+// MACs, so a plain Hasher state must be stored as carefully as the key.
+// Options can omit the outer digest from the state, which then only resumes
+// in a Hasher that has the key, or encrypt the state.
+package hmac
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"github.com/koofr/go-cryptoutils/internal/hashstate"
+	"github.com/koofr/go-cryptoutils/resumable"
+)
+
+var (
+	// ErrInvalidState is returned by SetState when the state is not valid
+	// for the hasher or cannot be decrypted.
+	ErrInvalidState = errors.New("hmac: invalid state")
+
+	// ErrKeyMismatch is returned by SetState when the state was saved by a
+	// Hasher with a different key.
+	ErrKeyMismatch = errors.New("hmac: state belongs to a different key")
+
+	// ErrKeyRequired is returned by SetState when the state omits the key
+	// material and the Hasher has no key to restore it from.
+	ErrKeyRequired = errors.New("hmac: state requires the key")
+
+	// ErrStateKeyRequired is returned by SetState when the state is encrypted
+	// and the Hasher has no state key.
+	ErrStateKeyRequired = errors.New("hmac: state is encrypted")
+
+	// ErrInvalidStateKey is returned by NewWithOptions when the state key is
+	// not 32 bytes long.
+	ErrInvalidStateKey = errors.New("hmac: state key must be 32 bytes")
+)
+
+// StateKeySize is the size of the key that encrypts states, in bytes.
+const StateKeySize = 32
+
+// Options control what GetState saves.
+type Options struct {
+	// OmitKey leaves the digests initialized from the key out of the state,
+	// keeping only the running inner digest and a short key check. Such
+	// state can only be restored by a Hasher created with the same key.
+	OmitKey bool
+
+	// StateKey, if set, encrypts the state with AES-256-GCM under this key.
+	// States are then only restored by Hashers with the same state key.
+	StateKey []byte
+}
+
+// The state format is
+//
+//	"bhmc" || version || flags || body
+//
+// where the body is either the uvarint-length-prefixed states of the inner
+// digest initialized from the key, the outer one and the running inner one,
+// or with flagOmitKey the key check followed by the running inner state only.
+// With flagEncrypted the body is replaced by a random nonce and the body
+// sealed with AES-256-GCM, with the header as additional data.
+const (
+	stateMagic   = "bhmc"
+	stateVersion = 1
+	stateHeader  = len(stateMagic) + 2
+
+	flagOmitKey   = 1 << 0
+	flagEncrypted = 1 << 1
+
+	keyCheckSize = 8
+)
+
+// keyCheckLabel is MACed to tell whether a state belongs to a key without
+// revealing anything about the key.
+const keyCheckLabel = "github.com/koofr/go-cryptoutils/hmac key check"
+
+// Hasher computes an HMAC over a resumable hash.
+type Hasher struct {
+	newHash func() resumable.Resumable
+	opts    Options
+	aead    cipher.AEAD
+
+	// innerInit and outerInit are the states of the inner and outer digests
+	// right after absorbing the padded key.
+	innerInit []byte
+	outerInit []byte
+	hasKey    bool
+
+	inner resumable.Resumable
+}
+
+// New returns a new Hasher computing the HMAC of the hash returned by h with
+// the given key, saving plain states.
+func New(h func() resumable.Resumable, key []byte) *Hasher {
+	m, _ := NewWithOptions(h, key, Options{})
+	return m
+}
+
+// NewWithOptions returns a new Hasher like New with the given options. It
+// returns ErrInvalidStateKey if the state key has the wrong size.
+func NewWithOptions(h func() resumable.Resumable, key []byte, opts Options) (*Hasher, error) {
+	m, err := newHasher(h, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := h()
+	outer := h()
+
+	blockSize := inner.BlockSize()
+	if len(key) > blockSize {
+		inner.Write(key)
+		key = inner.Sum(nil)
+		inner.Reset()
+	}
+
+	pad := make([]byte, blockSize)
+	copy(pad, key)
+	for i := range pad {
+		pad[i] ^= 0x36
+	}
+	inner.Write(pad)
+	for i := range pad {
+		pad[i] ^= 0x36 ^ 0x5c
+	}
+	outer.Write(pad)
+
+	m.innerInit = inner.GetState()
+	m.outerInit = outer.GetState()
+	m.hasKey = true
+	m.inner = inner
+
+	return m, nil
+}
+
+// NewFromState returns a new Hasher computing the HMAC of the hash returned
+// by h, restored from a state that includes the key material. Resuming needs
+// no key, but the Hasher then also accepts states of any key.
+func NewFromState(h func() resumable.Resumable, state []byte, opts Options) (*Hasher, error) {
+	m, err := newHasher(h, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.SetState(state); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func newHasher(h func() resumable.Resumable, opts Options) (*Hasher, error) {
+	m := &Hasher{newHash: h, opts: opts}
+
+	if opts.StateKey != nil {
+		if len(opts.StateKey) != StateKeySize {
+			return nil, ErrInvalidStateKey
+		}
+		block, err := aes.NewCipher(opts.StateKey)
+		if err != nil {
+			return nil, err
+		}
+		if m.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Hasher) restore(state []byte) resumable.Resumable {
+	h := m.newHash()
+	h.SetState(state)
+	return h
+}
+
+func (m *Hasher) Reset() {
+	m.inner.SetState(m.innerInit)
+}
+
+func (m *Hasher) Size() int { return m.inner.Size() }
+
+func (m *Hasher) BlockSize() int { return m.inner.BlockSize() }
+
+func (m *Hasher) Write(p []byte) (int, error) {
+	return m.inner.Write(p)
+}
+
+func (m *Hasher) Sum(in []byte) []byte {
+	outer := m.restore(m.outerInit)
+	outer.Write(m.inner.Sum(nil))
+	return outer.Sum(in)
+}
+
+// Clone returns a copy of m that can be written to and summed independently.
+// The copy shares the digest states m initialized from the key, so cloning a
+// Hasher right after New and writing a message to the clone MACs it without
+// hashing the padded key again, which New does on every call. For many
+// messages under one key, keep one such Hasher and clone it per message.
+func (m *Hasher) Clone() (*Hasher, error) {
+	inner := m.newHash()
+	if err := inner.SetState(m.inner.GetState()); err != nil {
+		return nil, err
+	}
+
+	c := *m
+	c.inner = inner
+	return &c, nil
+}
+
+func (m *Hasher) keyCheck() []byte {
+	inner := m.restore(m.innerInit)
+	inner.Write([]byte(keyCheckLabel))
+	outer := m.restore(m.outerInit)
+	outer.Write(inner.Sum(nil))
+	return outer.Sum(nil)[:keyCheckSize]
+}
+
+// GetState returns the state of the Hasher, to be restored by SetState, in
+// the form chosen by its options.
+func (m *Hasher) GetState() []byte {
+	var flags byte
+	var body []byte
+
+	if m.opts.OmitKey {
+		flags |= flagOmitKey
+		body = append(m.keyCheck(), m.inner.GetState()...)
+	} else {
+		body = hashstate.AppendField(body, m.innerInit)
+		body = hashstate.AppendField(body, m.outerInit)
+		body = hashstate.AppendField(body, m.inner.GetState())
+	}
+
+	if m.aead != nil {
+		flags |= flagEncrypted
+	}
+
+	b := append([]byte(stateMagic), stateVersion, flags)
+
+	if m.aead == nil {
+		return append(b, body...)
+	}
+
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("hmac.GetState: " + err.Error())
+	}
+	header := b
+	b = append(b, nonce...)
+	return m.aead.Seal(b, nonce, body, header)
+}
+
+// SetState restores the Hasher from state returned by GetState. States that
+// include the key material are accepted by a Hasher created with the same
+// key or by NewFromState; states that omit it need a Hasher with the same
+// key. It returns an error and leaves the Hasher unchanged if state cannot
+// be restored.
+func (m *Hasher) SetState(state []byte) error {
+	if len(state) < stateHeader || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	flags := state[stateHeader-1]
+	if flags&^(flagOmitKey|flagEncrypted) != 0 {
+		return ErrInvalidState
+	}
+
+	body := state[stateHeader:]
+
+	if flags&flagEncrypted != 0 {
+		if m.aead == nil {
+			return ErrStateKeyRequired
+		}
+		n := m.aead.NonceSize()
+		if len(body) < n {
+			return ErrInvalidState
+		}
+		var err error
+		if body, err = m.aead.Open(nil, body[:n], body[n:], state[:stateHeader]); err != nil {
+			return ErrInvalidState
+		}
+	}
+
+	innerInit, outerInit := m.innerInit, m.outerInit
+
+	var innerState []byte
+
+	if flags&flagOmitKey != 0 {
+		if !m.hasKey {
+			return ErrKeyRequired
+		}
+		if len(body) < keyCheckSize {
+			return ErrInvalidState
+		}
+		if subtle.ConstantTimeCompare(body[:keyCheckSize], m.keyCheck()) != 1 {
+			return ErrKeyMismatch
+		}
+		innerState = body[keyCheckSize:]
+	} else {
+		var ok bool
+		if innerInit, body, ok = hashstate.ConsumeField(body); !ok {
+			return ErrInvalidState
+		}
+		if outerInit, body, ok = hashstate.ConsumeField(body); !ok {
+			return ErrInvalidState
+		}
+		if innerState, body, ok = hashstate.ConsumeField(body); !ok || len(body) != 0 {
+			return ErrInvalidState
+		}
+	}
+
+	// Check every digest state before adopting any of them.
+	inner := m.newHash()
+	for _, s := range [][]byte{innerInit, outerInit, innerState} {
+		if inner.SetState(s) != nil {
+			return ErrInvalidState
+		}
+	}
+
+	if m.hasKey && flags&flagOmitKey == 0 &&
+		(subtle.ConstantTimeCompare(innerInit, m.innerInit) != 1 || subtle.ConstantTimeCompare(outerInit, m.outerInit) != 1) {
+		return ErrKeyMismatch
+	}
+
+	m.innerInit = bytes.Clone(innerInit)
+	m.outerInit = bytes.Clone(outerInit)
+	m.inner = inner
+
+	return nil
+}
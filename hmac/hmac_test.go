@@ -0,0 +1,251 @@
+package hmac
+
+import (
+	"bytes"
+	stdhmac "crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"github.com/koofr/go-cryptoutils/bettermd5"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"hash"
+	"testing"
+)
+
+var _ resumable.Resumable = (*Hasher)(nil)
+
+func newSHA256() resumable.Resumable { return bettersha256.New() }
+
+func newMD5() resumable.Resumable { return bettermd5.New() }
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+var testStateKey = bytes.Repeat([]byte{0x42}, StateKeySize)
+
+func TestSum(t *testing.T) {
+	data := testData(1000)
+
+	for _, key := range [][]byte{nil, []byte("key"), testData(64), testData(65), testData(200)} {
+		for _, h := range []struct {
+			ours func() resumable.Resumable
+			std  func() hash.Hash
+		}{
+			{newSHA256, sha256.New},
+			{newMD5, md5.New},
+		} {
+			std := stdhmac.New(h.std, key)
+			std.Write(data)
+			want := std.Sum(nil)
+
+			m := New(h.ours, key)
+			m.Write(data[:500])
+			m.Write(data[500:])
+			if got := m.Sum(nil); !bytes.Equal(got, want) {
+				t.Fatalf("%d byte key: Sum = %x want %x", len(key), got, want)
+			}
+
+			m.Reset()
+			m.Write(data)
+			if got := m.Sum(nil); !bytes.Equal(got, want) {
+				t.Fatalf("%d byte key: Sum after Reset = %x want %x", len(key), got, want)
+			}
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(1000)
+	key := []byte("a signing key")
+
+	std := stdhmac.New(sha256.New, key)
+	std.Write(data)
+	want := std.Sum(nil)
+
+	for _, opts := range []Options{
+		{},
+		{OmitKey: true},
+		{StateKey: testStateKey},
+		{OmitKey: true, StateKey: testStateKey},
+	} {
+		for _, split := range []int{0, 1, 64, 500, 1000} {
+			m, err := NewWithOptions(newSHA256, key, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.Write(data[:split])
+			state := m.GetState()
+
+			if opts.StateKey != nil && bytes.Contains(state, m.innerInit[5:]) {
+				t.Fatal("encrypted state contains the key material")
+			}
+
+			r, _ := NewWithOptions(newSHA256, key, opts)
+			if err := r.SetState(state); err != nil {
+				t.Fatalf("%+v, %d: %v", opts, split, err)
+			}
+			r.Write(data[split:])
+			if got := r.Sum(nil); !bytes.Equal(got, want) {
+				t.Fatalf("%+v, %d: resumed Sum = %x want %x", opts, split, got, want)
+			}
+		}
+	}
+}
+
+func TestNewFromState(t *testing.T) {
+	data := testData(300)
+	key := []byte("a signing key")
+
+	m := New(newSHA256, key)
+	m.Write(data[:100])
+
+	r, err := NewFromState(newSHA256, m.GetState(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write(data[100:])
+
+	std := stdhmac.New(sha256.New, key)
+	std.Write(data)
+	if got, want := r.Sum(nil), std.Sum(nil); !bytes.Equal(got, want) {
+		t.Fatalf("Sum = %x want %x", got, want)
+	}
+
+	omit, _ := NewWithOptions(newSHA256, key, Options{OmitKey: true})
+	if _, err := NewFromState(newSHA256, omit.GetState(), Options{}); err != ErrKeyRequired {
+		t.Fatalf("state without key: err = %v", err)
+	}
+}
+
+func TestSetStateErrors(t *testing.T) {
+	key := []byte("a signing key")
+
+	m := New(newSHA256, key)
+	m.Write(testData(100))
+	want := m.Sum(nil)
+
+	omit, _ := NewWithOptions(newSHA256, []byte("another key"), Options{OmitKey: true})
+	encrypted, _ := NewWithOptions(newSHA256, key, Options{StateKey: testStateKey})
+	tampered := encrypted.GetState()
+	tampered[len(tampered)-1] ^= 1
+	other := New(newSHA256, []byte("another key"))
+	md5State := New(newMD5, key).GetState()
+
+	for name, c := range map[string]struct {
+		state []byte
+		err   error
+	}{
+		"empty":           {nil, ErrInvalidState},
+		"unknown flags":   {append(m.GetState()[:stateHeader-1], 4), ErrInvalidState},
+		"truncated":       {m.GetState()[:stateHeader+10], ErrInvalidState},
+		"other hash":      {md5State, ErrInvalidState},
+		"other key":       {other.GetState(), ErrKeyMismatch},
+		"other key check": {omit.GetState(), ErrKeyMismatch},
+		"encrypted":       {tampered, ErrStateKeyRequired},
+		"empty body":      {md5State[:stateHeader], ErrInvalidState},
+	} {
+		if err := m.SetState(c.state); err != c.err {
+			t.Fatalf("%s: err = %v want %v", name, err, c.err)
+		}
+	}
+	if got := m.Sum(nil); !bytes.Equal(got, want) {
+		t.Fatal("failed SetState changed the hasher")
+	}
+
+	if err := encrypted.SetState(tampered); err != ErrInvalidState {
+		t.Fatalf("tampered state: err = %v", err)
+	}
+
+	if _, err := NewWithOptions(newSHA256, key, Options{StateKey: []byte("short")}); err != ErrInvalidStateKey {
+		t.Fatalf("short state key: err = %v", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	data := testData(1000)
+	key := []byte("key")
+
+	m := New(newSHA256, key)
+	m.Write(data[:300])
+	c, err := m.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Write(data[300:])
+	c.Write(data[300:500])
+
+	for _, tc := range []struct {
+		h    *Hasher
+		data []byte
+	}{{m, data}, {c, data[:500]}} {
+		std := stdhmac.New(sha256.New, key)
+		std.Write(tc.data)
+		if got, want := tc.h.Sum(nil), std.Sum(nil); !bytes.Equal(got, want) {
+			t.Fatalf("%d bytes: Sum = %x want %x", len(tc.data), got, want)
+		}
+	}
+}
+
+// countingHash counts the bytes written to all digests sharing written.
+type countingHash struct {
+	resumable.Resumable
+	written *int
+}
+
+func (h *countingHash) Write(p []byte) (int, error) {
+	*h.written += len(p)
+	return h.Resumable.Write(p)
+}
+
+func TestCloneKeyNotExpanded(t *testing.T) {
+	var written int
+	h := func() resumable.Resumable { return &countingHash{bettersha256.New(), &written} }
+	key := testData(200)
+	msg := []byte("message")
+
+	m := New(h, key)
+	written = 0
+	for i := 0; i < 3; i++ {
+		c, err := m.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Write(msg)
+
+		std := stdhmac.New(sha256.New, key)
+		std.Write(msg)
+		if got, want := c.Sum(nil), std.Sum(nil); !bytes.Equal(got, want) {
+			t.Fatalf("Sum = %x want %x", got, want)
+		}
+	}
+
+	// Only the messages and the inner sums are hashed, never the key.
+	if want := 3 * (len(msg) + sha256.Size); written != want {
+		t.Fatalf("hashed %d bytes want %d", written, want)
+	}
+}
+
+func BenchmarkMAC(b *testing.B) {
+	key := testData(32)
+	msg := testData(64)
+	b.Run("New", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := New(newSHA256, key)
+			m.Write(msg)
+			m.Sum(nil)
+		}
+	})
+	b.Run("Clone", func(b *testing.B) {
+		keyed := New(newSHA256, key)
+		for i := 0; i < b.N; i++ {
+			m, _ := keyed.Clone()
+			m.Write(msg)
+			m.Sum(nil)
+		}
+	})
+}
@@ -0,0 +1,393 @@
+// Package httphash computes checksums of remote objects with HTTP range
+// requests, saving the state of the hash after every range so that hashing
+// an object of any size can resume after a restart.
+//
+// Before a saved checkpoint is continued, the ETag and Last-Modified headers
+// and the size of the object are compared with those seen when hashing
+// started, so an object that changed in the meantime is not hashed as a mix
+// of two versions.
+package httphash
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrChanged is returned by Hash when the object is not the one a
+	// checkpoint was saved for, or changes while it is being hashed.
+	ErrChanged = errors.New("httphash: remote object changed")
+
+	// ErrRangeNotSupported is returned by Hash when resuming from a
+	// checkpoint and the server ignores the range request.
+	ErrRangeNotSupported = errors.New("httphash: server does not support range requests")
+
+	// ErrInvalidCheckpoint is returned by Hash when the hash does not accept
+	// the state of the loaded checkpoint, and by Checkpoint.UnmarshalBinary
+	// for data that is not a checkpoint.
+	ErrInvalidCheckpoint = errors.New("httphash: invalid checkpoint")
+)
+
+// StatusError is returned by Hash for responses with an unexpected status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("httphash: unexpected response status %d", e.StatusCode)
+}
+
+// DefaultRangeSize is the size of the ranges requested when
+// Options.RangeSize is zero.
+const DefaultRangeSize = 8 << 20
+
+// Checkpoint is the progress of Hash: the number of bytes hashed, the state
+// of the hash after them and the size and validators of the object.
+type Checkpoint struct {
+	Offset       int64
+	Size         int64
+	ETag         string
+	LastModified string
+	State        []byte
+}
+
+// Store persists the checkpoint of one object between runs of Hash.
+type Store interface {
+	// Load returns the saved checkpoint, or nil if there is none.
+	Load() (*Checkpoint, error)
+
+	// Save replaces the saved checkpoint.
+	Save(cp *Checkpoint) error
+
+	// Clear removes the saved checkpoint once the object has been hashed.
+	Clear() error
+}
+
+// Options configures Hash. All fields are optional.
+type Options struct {
+	// Client sends the requests. It defaults to http.DefaultClient.
+	Client *http.Client
+
+	// Header is added to every request, e.g. for authorization.
+	Header http.Header
+
+	// RangeSize is the number of bytes requested at a time, and so the
+	// most that is hashed again after a restart. It defaults to
+	// DefaultRangeSize.
+	RangeSize int64
+
+	// Store saves a checkpoint after every range. Without one, Hash cannot
+	// resume.
+	Store Store
+}
+
+// Hash returns the checksum of the object at url computed by h, which must
+// be freshly reset. The object is fetched in ranges of opts.RangeSize bytes;
+// after each one the checkpoint is saved to opts.Store, and a checkpoint
+// loaded from it at the start is continued if the object has not changed,
+// or ErrChanged is returned. The checkpoint is cleared once the whole object
+// has been hashed.
+//
+// A server that ignores range requests sends the whole object, which is
+// hashed in one go when starting from the beginning.
+//
+// A checkpoint that already covers the whole object is revalidated with one
+// more request before its sum is returned.
+//
+// If the server sends neither an ETag nor a Last-Modified header, only the
+// size of the object is checked before resuming.
+func Hash(ctx context.Context, url string, h resumable.Resumable, opts Options) ([]byte, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.RangeSize <= 0 {
+		opts.RangeSize = DefaultRangeSize
+	}
+
+	var cp *Checkpoint
+	if opts.Store != nil {
+		saved, err := opts.Store.Load()
+		if err != nil {
+			return nil, err
+		}
+		if saved != nil {
+			if err := h.SetState(saved.State); err != nil {
+				return nil, ErrInvalidCheckpoint
+			}
+			cp = saved
+		}
+	}
+
+	if cp != nil && cp.Offset == cp.Size {
+		if err := validate(ctx, url, cp, &opts); err != nil {
+			return nil, err
+		}
+	}
+
+	for cp == nil || cp.Offset < cp.Size {
+		next, err := fetch(ctx, url, h, cp, &opts)
+		if next != nil && (cp == nil || next.Offset > cp.Offset) && opts.Store != nil {
+			if serr := opts.Store.Save(next); serr != nil && err == nil {
+				err = serr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		cp = next
+	}
+
+	if opts.Store != nil {
+		if err := opts.Store.Clear(); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.Sum(nil), nil
+}
+
+// fetch requests the range of the object after cp, or the first one if cp
+// is nil, hashes it and returns the checkpoint after it. If reading the body
+// fails, the checkpoint covers the bytes hashed before the error.
+func fetch(ctx context.Context, url string, h resumable.Resumable, cp *Checkpoint, opts *Options) (*Checkpoint, error) {
+	var offset int64
+	if cp != nil {
+		offset = cp.Offset
+	}
+
+	resp, err := get(ctx, url, fmt.Sprintf("bytes=%d-%d", offset, offset+opts.RangeSize-1), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	next := &Checkpoint{
+		Offset:       offset,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	var length int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, end, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset || end < start || end >= size {
+			return nil, &StatusError{StatusCode: resp.StatusCode}
+		}
+		next.Size = size
+		length = end - start + 1
+
+	case http.StatusOK:
+		if offset > 0 {
+			return nil, ErrRangeNotSupported
+		}
+		if resp.ContentLength < 0 {
+			n, err := io.Copy(h, resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			next.Size = n
+			next.Offset = n
+			next.State = h.GetState()
+			return next, nil
+		}
+		next.Size = resp.ContentLength
+		length = next.Size
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The range starts at the end of the object, which happens for
+		// empty objects.
+		_, _, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || size != offset {
+			return nil, &StatusError{StatusCode: resp.StatusCode}
+		}
+		next.Size = size
+
+	default:
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if cp != nil && (cp.Size != next.Size || cp.ETag != next.ETag || cp.LastModified != next.LastModified) {
+		return nil, ErrChanged
+	}
+
+	n, err := io.CopyN(h, resp.Body, length)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	next.Offset += n
+	next.State = h.GetState()
+
+	return next, err
+}
+
+// validate checks that the object is still the one cp was saved for, when cp
+// covers all of it, by requesting its last byte. An empty object has no last
+// byte, so it is requested from the start like on the first run.
+func validate(ctx context.Context, url string, cp *Checkpoint, opts *Options) error {
+	first := cp.Size - 1
+	if first < 0 {
+		first = 0
+	}
+
+	resp, err := get(ctx, url, fmt.Sprintf("bytes=%d-", first), opts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var size int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, end, n, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != first || end < start || end >= n {
+			return &StatusError{StatusCode: resp.StatusCode}
+		}
+		size = n
+
+	case http.StatusOK:
+		size = resp.ContentLength
+		if size < 0 {
+			if size, err = io.Copy(io.Discard, resp.Body); err != nil {
+				return err
+			}
+		}
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		_, _, n, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok {
+			return &StatusError{StatusCode: resp.StatusCode}
+		}
+		size = n
+
+	default:
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if size != cp.Size || resp.Header.Get("ETag") != cp.ETag || resp.Header.Get("Last-Modified") != cp.LastModified {
+		return ErrChanged
+	}
+
+	return nil
+}
+
+// get sends a GET request for url with opts.Header and the given Range.
+func get(ctx context.Context, url, rng string, opts *Options) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Range", rng)
+
+	return opts.Client.Do(req)
+}
+
+// parseContentRange parses "bytes <start>-<end>/<size>" and "bytes */<size>",
+// for which it returns -1 as start and end.
+func parseContentRange(s string) (start, end, size int64, ok bool) {
+	rest, found := strings.CutPrefix(s, "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	r, sizeText, found := strings.Cut(rest, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+	size, err := strconv.ParseInt(sizeText, 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, 0, false
+	}
+	if r == "*" {
+		return -1, -1, size, true
+	}
+
+	startText, endText, found := strings.Cut(r, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+	start, err1 := strconv.ParseInt(startText, 10, 64)
+	end, err2 := strconv.ParseInt(endText, 10, 64)
+	if err1 != nil || err2 != nil || start < 0 {
+		return 0, 0, 0, false
+	}
+
+	return start, end, size, true
+}
+
+// The checkpoint format is
+//
+//	"bhtc" || version || uvarint offset || uvarint size ||
+//	uvarint length || ETag || uvarint length || Last-Modified || hash state
+const (
+	checkpointMagic   = "bhtc"
+	checkpointVersion = 1
+)
+
+// MarshalBinary returns the byte form of cp, for stores that save bytes.
+func (cp *Checkpoint) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 64+len(cp.ETag)+len(cp.LastModified)+len(cp.State))
+	b = append(b, checkpointMagic...)
+	b = append(b, checkpointVersion)
+	b = binary.AppendUvarint(b, uint64(cp.Offset))
+	b = binary.AppendUvarint(b, uint64(cp.Size))
+	b = binary.AppendUvarint(b, uint64(len(cp.ETag)))
+	b = append(b, cp.ETag...)
+	b = binary.AppendUvarint(b, uint64(len(cp.LastModified)))
+	b = append(b, cp.LastModified...)
+	return append(b, cp.State...), nil
+}
+
+// UnmarshalBinary sets cp from the byte form returned by MarshalBinary. It
+// returns ErrInvalidCheckpoint and leaves cp unchanged if b is not valid.
+func (cp *Checkpoint) UnmarshalBinary(b []byte) error {
+	if len(b) < len(checkpointMagic)+1 || string(b[:len(checkpointMagic)]) != checkpointMagic || b[len(checkpointMagic)] != checkpointVersion {
+		return ErrInvalidCheckpoint
+	}
+
+	p := b[len(checkpointMagic)+1:]
+	uvarint := func() (uint64, bool) {
+		x, n := binary.Uvarint(p)
+		if n <= 0 || x > 1<<63-1 {
+			return 0, false
+		}
+		p = p[n:]
+		return x, true
+	}
+	text := func() (string, bool) {
+		n, ok := uvarint()
+		if !ok || n > uint64(len(p)) {
+			return "", false
+		}
+		s := string(p[:n])
+		p = p[n:]
+		return s, true
+	}
+
+	offset, ok1 := uvarint()
+	size, ok2 := uvarint()
+	etag, ok3 := text()
+	lastModified, ok4 := text()
+	if !ok1 || !ok2 || !ok3 || !ok4 || offset > size {
+		return ErrInvalidCheckpoint
+	}
+
+	*cp = Checkpoint{
+		Offset:       int64(offset),
+		Size:         int64(size),
+		ETag:         etag,
+		LastModified: lastModified,
+		State:        append([]byte(nil), p...),
+	}
+
+	return nil
+}
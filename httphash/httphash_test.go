@@ -0,0 +1,273 @@
+package httphash
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+// object serves data with http.ServeContent and records the ranges asked.
+type object struct {
+	data    []byte
+	etag    string
+	ranges  []string
+	noRange bool
+}
+
+func (o *object) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.ranges = append(o.ranges, r.Header.Get("Range"))
+	if o.noRange {
+		w.Write(o.data)
+		return
+	}
+	w.Header().Set("ETag", o.etag)
+	http.ServeContent(w, r, "", time.Unix(1700000000, 0), bytes.NewReader(o.data))
+}
+
+type memStore struct {
+	cp      *Checkpoint
+	saves   int
+	failAt  int
+	cleared bool
+}
+
+var errSave = errors.New("save failed")
+
+func (s *memStore) Load() (*Checkpoint, error) { return s.cp, nil }
+
+func (s *memStore) Save(cp *Checkpoint) error {
+	s.saves++
+	if s.saves == s.failAt {
+		return errSave
+	}
+	// Go through the byte form like a store on disk would.
+	b, _ := cp.MarshalBinary()
+	s.cp = new(Checkpoint)
+	return s.cp.UnmarshalBinary(b)
+}
+
+func (s *memStore) Clear() error {
+	s.cp = nil
+	s.cleared = true
+	return nil
+}
+
+func sha256Hash() resumable.Resumable {
+	h, _ := resumable.New("sha256")
+	return h
+}
+
+func TestHash(t *testing.T) {
+	data := testData(10000)
+	want := sha256.Sum256(data)
+
+	o := &object{data: data, etag: `"v1"`}
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	store := &memStore{failAt: 3}
+	opts := Options{RangeSize: 1024, Store: store, Header: http.Header{"X-Test": {"1"}}}
+
+	if _, err := Hash(context.Background(), srv.URL, sha256Hash(), opts); err != errSave {
+		t.Fatalf("interrupted run: err = %v", err)
+	}
+	if store.cp == nil || store.cp.Offset != 2048 || store.cp.Size != int64(len(data)) || store.cp.ETag != `"v1"` || store.cp.LastModified == "" {
+		t.Fatalf("checkpoint = %+v", store.cp)
+	}
+
+	o.ranges = nil
+	sum, err := Hash(context.Background(), srv.URL, sha256Hash(), opts)
+	if err != nil || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("resumed Hash = %x, %v want %x", sum, err, want)
+	}
+	if !store.cleared || store.cp != nil {
+		t.Fatal("checkpoint not cleared")
+	}
+	if len(o.ranges) != 8 || o.ranges[0] != "bytes=2048-3071" {
+		t.Fatalf("resumed ranges = %v", o.ranges)
+	}
+
+	sum, err = Hash(context.Background(), srv.URL, sha256Hash(), Options{})
+	if err != nil || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("default options Hash = %x, %v", sum, err)
+	}
+}
+
+func TestHashChanged(t *testing.T) {
+	data := testData(5000)
+	o := &object{data: data, etag: `"v1"`}
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	store := &memStore{failAt: 2}
+	opts := Options{RangeSize: 1000, Store: store}
+	Hash(context.Background(), srv.URL, sha256Hash(), opts)
+
+	o.etag = `"v2"`
+	if _, err := Hash(context.Background(), srv.URL, sha256Hash(), opts); err != ErrChanged {
+		t.Fatalf("changed ETag: err = %v", err)
+	}
+
+	o.etag = `"v1"`
+	o.data = data[:4000]
+	if _, err := Hash(context.Background(), srv.URL, sha256Hash(), opts); err != ErrChanged {
+		t.Fatalf("changed size: err = %v", err)
+	}
+
+	o.data = data
+	store.cp.State = []byte("garbage")
+	if _, err := Hash(context.Background(), srv.URL, sha256Hash(), opts); err != ErrInvalidCheckpoint {
+		t.Fatalf("invalid state: err = %v", err)
+	}
+}
+
+func TestHashComplete(t *testing.T) {
+	data := testData(5000)
+	want := sha256.Sum256(data)
+
+	o := &object{data: data, etag: `"v1"`}
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	store := &memStore{failAt: 2}
+	opts := Options{RangeSize: 1000, Store: store}
+	Hash(context.Background(), srv.URL, sha256Hash(), opts)
+
+	// A checkpoint saved after the last range, as left by a run that
+	// stopped before clearing it.
+	h := sha256Hash()
+	h.Write(data)
+	complete := *store.cp
+	complete.Offset = complete.Size
+	complete.State = h.GetState()
+
+	for _, tc := range []struct {
+		name string
+		etag string
+		data []byte
+		err  error
+	}{
+		{"changed ETag", `"v2"`, data, ErrChanged},
+		{"changed size", `"v1"`, data[:4000], ErrChanged},
+		{"unchanged", `"v1"`, data, nil},
+	} {
+		o.etag, o.data, o.ranges = tc.etag, tc.data, nil
+		cp := complete
+		store.cp = &cp
+
+		sum, err := Hash(context.Background(), srv.URL, sha256Hash(), opts)
+		if err != tc.err {
+			t.Fatalf("%s: err = %v want %v", tc.name, err, tc.err)
+		}
+		if len(o.ranges) != 1 || o.ranges[0] != "bytes=4999-" {
+			t.Fatalf("%s: ranges = %v", tc.name, o.ranges)
+		}
+		if tc.err == nil && (!bytes.Equal(sum, want[:]) || !store.cleared) {
+			t.Fatalf("%s: Hash = %x want %x, cleared %v", tc.name, sum, want, store.cleared)
+		}
+	}
+}
+
+func TestHashNoRanges(t *testing.T) {
+	data := testData(5000)
+	want := sha256.Sum256(data)
+
+	o := &object{data: data, noRange: true}
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	store := &memStore{}
+	sum, err := Hash(context.Background(), srv.URL, sha256Hash(), Options{RangeSize: 1000, Store: store})
+	if err != nil || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("Hash = %x, %v", sum, err)
+	}
+	if len(o.ranges) != 1 {
+		t.Fatalf("%d requests", len(o.ranges))
+	}
+
+	store.cp = &Checkpoint{Offset: 1000, Size: 5000, State: sha256Hash().GetState()}
+	if _, err := Hash(context.Background(), srv.URL, sha256Hash(), Options{Store: store}); err != ErrRangeNotSupported {
+		t.Fatalf("resume without ranges: err = %v", err)
+	}
+}
+
+func TestHashEmpty(t *testing.T) {
+	srv := httptest.NewServer(&object{etag: `"empty"`})
+	defer srv.Close()
+
+	sum, err := Hash(context.Background(), srv.URL, sha256Hash(), Options{})
+	if want := sha256.Sum256(nil); err != nil || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("Hash = %x, %v", sum, err)
+	}
+}
+
+func TestHashStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := Hash(context.Background(), srv.URL, sha256Hash(), Options{})
+	var serr *StatusError
+	if !errors.As(err, &serr) || serr.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for s, want := range map[string][3]int64{
+		"bytes 0-99/1000":  {0, 99, 1000},
+		"bytes 10-10/11":   {10, 10, 11},
+		"bytes */1000":     {-1, -1, 1000},
+		"bytes 0-99/*":     {},
+		"items 0-99/1000":  {},
+		"bytes 0-99":       {},
+		"bytes -5-99/1000": {},
+		"bytes x-99/1000":  {},
+	} {
+		start, end, size, ok := parseContentRange(s)
+		if got := [3]int64{start, end, size}; ok != (want != [3]int64{}) || ok && got != want {
+			t.Fatalf("parseContentRange(%q) = %v, %v", s, got, ok)
+		}
+	}
+}
+
+func TestCheckpointBinary(t *testing.T) {
+	cp := Checkpoint{Offset: 100, Size: 1000, ETag: `"abc"`, LastModified: "Tue, 14 Nov 2023 22:13:20 GMT", State: []byte("state")}
+	b, err := cp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Checkpoint
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.Offset != cp.Offset || got.Size != cp.Size || got.ETag != cp.ETag || got.LastModified != cp.LastModified || !bytes.Equal(got.State, cp.State) {
+		t.Fatalf("round trip = %+v", got)
+	}
+
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"magic":     append([]byte("xxxx"), b[4:]...),
+		"truncated": b[:strings.Index(string(b), `"abc"`)+2],
+		"offset":    append([]byte(checkpointMagic+"\x01"), 0x10, 0x05, 0, 0),
+	} {
+		if err := got.UnmarshalBinary(bad); err != ErrInvalidCheckpoint {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Package hashstate implements the state format shared by the resumable
+// hashes in this module.
+//
+// A state is
+//
+//	magic || version || chaining words || uint64 length || pending bytes
+//
+// where the magic is four bytes naming the hash, the words and the length
+// use the byte order of the hash, and the number of pending bytes is the
+// length modulo the block size. States are therefore as small as the hash
+// allows and can be decoded without any Go-specific tooling.
+//
+// States made of several parts, such as those of HMAC or of several hashes
+// at once, store each part as a field prefixed with its length as a uvarint.
+package hashstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalid is returned by Decode for states not in the format.
+var ErrInvalid = errors.New("hashstate: invalid state")
+
+// ByteOrder is implemented by binary.LittleEndian and binary.BigEndian.
+type ByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// Format describes the state format of one hash.
+type Format struct {
+	Magic     string
+	Version   byte
+	Order     ByteOrder
+	WordSize  int
+	Words     int
+	BlockSize int
+}
+
+// HeaderSize returns the size of a state with no pending bytes.
+func (f *Format) HeaderSize() int {
+	return len(f.Magic) + 1 + f.Words*f.WordSize + 8
+}
+
+// Append appends the state made of words, length and pending to b. words
+// must hold f.Words values and pending length modulo f.BlockSize bytes.
+func (f *Format) Append(b []byte, words []uint64, length uint64, pending []byte) []byte {
+	b = append(b, f.Magic...)
+	b = append(b, f.Version)
+	for _, w := range words {
+		if f.WordSize == 4 {
+			b = f.Order.AppendUint32(b, uint32(w))
+		} else {
+			b = f.Order.AppendUint64(b, w)
+		}
+	}
+	b = f.Order.AppendUint64(b, length)
+	b = append(b, pending...)
+	return b
+}
+
+// Decode decodes state into words, which must have room for f.Words values,
+// and returns the length and the pending bytes, which alias state. It
+// returns ErrInvalid unless state is exactly in the format.
+func (f *Format) Decode(state []byte, words []uint64) (length uint64, pending []byte, err error) {
+	if len(state) < f.HeaderSize() || !bytes.HasPrefix(state, []byte(f.Magic)) || state[len(f.Magic)] != f.Version {
+		return 0, nil, ErrInvalid
+	}
+
+	p := state[len(f.Magic)+1:]
+	for i := 0; i < f.Words; i++ {
+		if f.WordSize == 4 {
+			words[i] = uint64(f.Order.Uint32(p))
+		} else {
+			words[i] = f.Order.Uint64(p)
+		}
+		p = p[f.WordSize:]
+	}
+	length = f.Order.Uint64(p)
+	pending = p[8:]
+
+	if uint64(len(pending)) != length%uint64(f.BlockSize) {
+		return 0, nil, ErrInvalid
+	}
+
+	return length, pending, nil
+}
+
+// HasMagic reports whether state starts with the magic of f.
+func (f *Format) HasMagic(state []byte) bool {
+	return bytes.HasPrefix(state, []byte(f.Magic))
+}
+
+// AppendField appends field to b, prefixed with its length as a uvarint.
+func AppendField(b []byte, field []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(field)))
+	return append(b, field...)
+}
+
+// ConsumeField splits the field appended by AppendField off the front of b
+// and returns it and the rest of b, both aliasing b. ok is false if b does
+// not start with a complete field.
+func ConsumeField(b []byte) (field []byte, rest []byte, ok bool) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || l > uint64(len(b)-n) {
+		return nil, b, false
+	}
+	b = b[n:]
+	return b[:l], b[l:], true
+}
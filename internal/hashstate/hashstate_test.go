@@ -0,0 +1,83 @@
+package hashstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, f := range []Format{
+		{Magic: "tst4", Version: 1, Order: binary.LittleEndian, WordSize: 4, Words: 4, BlockSize: 64},
+		{Magic: "tst8", Version: 3, Order: binary.BigEndian, WordSize: 8, Words: 8, BlockSize: 128},
+	} {
+		words := make([]uint64, f.Words)
+		for i := range words {
+			words[i] = uint64(i)*0x0101010101 + 1
+		}
+		pending := bytes.Repeat([]byte{0xab}, 5)
+		length := uint64(3*f.BlockSize + len(pending))
+
+		state := f.Append([]byte("x"), words, length, pending)[1:]
+		if len(state) != f.HeaderSize()+len(pending) || !f.HasMagic(state) {
+			t.Fatalf("%s: state = %x", f.Magic, state)
+		}
+
+		got := make([]uint64, f.Words)
+		l, p, err := f.Decode(state, got)
+		if err != nil {
+			t.Fatalf("%s: %v", f.Magic, err)
+		}
+		if l != length || !bytes.Equal(p, pending) {
+			t.Fatalf("%s: Decode = %d, %x", f.Magic, l, p)
+		}
+		for i := range words {
+			if f.WordSize == 4 {
+				words[i] &= 0xffffffff
+			}
+			if got[i] != words[i] {
+				t.Fatalf("%s: word %d = %x want %x", f.Magic, i, got[i], words[i])
+			}
+		}
+
+		for name, bad := range map[string][]byte{
+			"empty":     nil,
+			"truncated": state[:len(state)-1],
+			"trailing":  append(append([]byte(nil), state...), 0),
+			"version":   append(append([]byte(f.Magic), f.Version+1), state[len(f.Magic)+1:]...),
+			"magic":     append([]byte("nope"), state[len(f.Magic):]...),
+		} {
+			if _, _, err := f.Decode(bad, got); err != ErrInvalid {
+				t.Fatalf("%s %s: err = %v", f.Magic, name, err)
+			}
+		}
+	}
+}
+
+func TestField(t *testing.T) {
+	b := AppendField([]byte("x"), []byte("first"))
+	b = AppendField(b, nil)
+	b = AppendField(b, bytes.Repeat([]byte{1}, 200))
+
+	p := b[1:]
+	for _, want := range [][]byte{[]byte("first"), {}, bytes.Repeat([]byte{1}, 200)} {
+		field, rest, ok := ConsumeField(p)
+		if !ok || !bytes.Equal(field, want) {
+			t.Fatalf("ConsumeField = %x, %v want %x", field, ok, want)
+		}
+		p = rest
+	}
+	if len(p) != 0 {
+		t.Fatalf("%d bytes left", len(p))
+	}
+
+	for name, bad := range map[string][]byte{
+		"empty":       nil,
+		"short field": {5, 'a', 'b'},
+		"bad length":  {0x80},
+	} {
+		if _, rest, ok := ConsumeField(bad); ok || !bytes.Equal(rest, bad) {
+			t.Fatalf("%s: ok = %v, rest = %x", name, ok, rest)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package poly1305
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestSum(t *testing.T) {
+	// RFC 8439, section 2.5.2.
+	var key [32]byte
+	hex.Decode(key[:], []byte("85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b"))
+	msg := []byte("Cryptographic Forum Research Group")
+
+	var tag [TagSize]byte
+	Sum(&tag, msg, &key)
+	if got := hex.EncodeToString(tag[:]); got != "a8061dc1305136c6c22b8baf0c0127a9" {
+		t.Fatalf("tag = %s", got)
+	}
+	if !Verify(&tag, msg, &key) {
+		t.Fatal("Verify failed")
+	}
+
+	m := New(&key)
+	for _, b := range msg {
+		m.Write([]byte{b})
+	}
+	if !m.Verify(tag[:]) {
+		t.Fatal("bytewise MAC differs")
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kdf
+
+import (
+	"encoding/binary"
+	"github.com/koofr/go-cryptoutils/betterblake2b"
+	"sync"
+)
+
+// Argon2Version is the version of Argon2 implemented, 1.3.
+const Argon2Version = 0x13
+
+const (
+	argon2d = iota
+	argon2i
+	argon2id
+)
+
+const (
+	blockLength = 128
+	syncPoints  = 4
+)
+
+type block [blockLength]uint64
+
+// Argon2id returns a key of keyLen bytes derived from password and salt
+// with Argon2id (RFC 9106), making time passes over memory KiB with threads
+// lanes hashed in parallel. It returns ErrInvalidParams if time, threads or
+// keyLen is zero, or keyLen is below 4.
+func Argon2id(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	if time < 1 || threads < 1 || keyLen < 4 {
+		return nil, ErrInvalidParams
+	}
+	return deriveKey(argon2id, password, salt, nil, nil, time, memory, threads, keyLen), nil
+}
+
+func deriveKey(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	h0 := initHash(password, salt, secret, data, time, memory, uint32(threads), keyLen, mode)
+
+	memory = memory / (syncPoints * uint32(threads)) * (syncPoints * uint32(threads))
+	if memory < 2*syncPoints*uint32(threads) {
+		memory = 2 * syncPoints * uint32(threads)
+	}
+
+	B := initBlocks(&h0, memory, uint32(threads))
+	processBlocks(B, time, memory, uint32(threads), mode)
+	return extractKey(B, memory, uint32(threads), keyLen)
+}
+
+func initHash(password, salt, key, data []byte, time, memory, threads, keyLen uint32, mode int) [betterblake2b.Size + 8]byte {
+	var (
+		h0     [betterblake2b.Size + 8]byte
+		params [24]byte
+		tmp    [4]byte
+	)
+
+	b2 := betterblake2b.New512()
+	binary.LittleEndian.PutUint32(params[0:4], threads)
+	binary.LittleEndian.PutUint32(params[4:8], keyLen)
+	binary.LittleEndian.PutUint32(params[8:12], memory)
+	binary.LittleEndian.PutUint32(params[12:16], time)
+	binary.LittleEndian.PutUint32(params[16:20], Argon2Version)
+	binary.LittleEndian.PutUint32(params[20:24], uint32(mode))
+	b2.Write(params[:])
+	for _, p := range [][]byte{password, salt, key, data} {
+		binary.LittleEndian.PutUint32(tmp[:], uint32(len(p)))
+		b2.Write(tmp[:])
+		b2.Write(p)
+	}
+	b2.Sum(h0[:0])
+
+	return h0
+}
+
+func initBlocks(h0 *[betterblake2b.Size + 8]byte, memory, threads uint32) []block {
+	var block0 [1024]byte
+	B := make([]block, memory)
+	for lane := uint32(0); lane < threads; lane++ {
+		j := lane * (memory / threads)
+		binary.LittleEndian.PutUint32(h0[betterblake2b.Size+4:], lane)
+
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[betterblake2b.Size:], i)
+			blake2bHash(block0[:], h0[:])
+			for k := range B[j+i] {
+				B[j+i][k] = binary.LittleEndian.Uint64(block0[k*8:])
+			}
+		}
+	}
+	return B
+}
+
+func processBlocks(B []block, time, memory, threads uint32, mode int) {
+	lanes := memory / threads
+	segments := lanes / syncPoints
+
+	processSegment := func(n, slice, lane uint32, wg *sync.WaitGroup) {
+		defer wg.Done()
+
+		var addresses, in, zero block
+		dataIndependent := mode == argon2i || (mode == argon2id && n == 0 && slice < syncPoints/2)
+		if dataIndependent {
+			in[0] = uint64(n)
+			in[1] = uint64(lane)
+			in[2] = uint64(slice)
+			in[3] = uint64(memory)
+			in[4] = uint64(time)
+			in[5] = uint64(mode)
+		}
+
+		index := uint32(0)
+		if n == 0 && slice == 0 {
+			// The first two blocks of each lane come from initBlocks.
+			index = 2
+			if dataIndependent {
+				in[6]++
+				processBlock(&addresses, &in, &zero)
+				processBlock(&addresses, &addresses, &zero)
+			}
+		}
+
+		offset := lane*lanes + slice*segments + index
+		var random uint64
+		for index < segments {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += lanes // last block in lane
+			}
+			if dataIndependent {
+				if index%blockLength == 0 {
+					in[6]++
+					processBlock(&addresses, &in, &zero)
+					processBlock(&addresses, &addresses, &zero)
+				}
+				random = addresses[index%blockLength]
+			} else {
+				random = B[prev][0]
+			}
+			newOffset := indexAlpha(random, lanes, segments, threads, n, slice, lane, index)
+			processBlockXOR(&B[offset], &B[prev], &B[newOffset])
+			index, offset = index+1, offset+1
+		}
+	}
+
+	for n := uint32(0); n < time; n++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < threads; lane++ {
+				wg.Add(1)
+				go processSegment(n, slice, lane, &wg)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+func extractKey(B []block, memory, threads, keyLen uint32) []byte {
+	lanes := memory / threads
+	for lane := uint32(0); lane < threads-1; lane++ {
+		for i, v := range B[(lane*lanes)+lanes-1] {
+			B[memory-1][i] ^= v
+		}
+	}
+
+	var block [1024]byte
+	for i, v := range B[memory-1] {
+		binary.LittleEndian.PutUint64(block[i*8:], v)
+	}
+	key := make([]byte, keyLen)
+	blake2bHash(key, block[:])
+	return key
+}
+
+func indexAlpha(rand uint64, lanes, segments, threads, n, slice, lane, index uint32) uint32 {
+	refLane := uint32(rand>>32) % threads
+	if n == 0 && slice == 0 {
+		refLane = lane
+	}
+	m, s := 3*segments, ((slice+1)%syncPoints)*segments
+	if lane == refLane {
+		m += index
+	}
+	if n == 0 {
+		m, s = slice*segments, 0
+		if slice == 0 || lane == refLane {
+			m += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		m--
+	}
+	return phi(rand, uint64(m), uint64(s), refLane, lanes)
+}
+
+func phi(rand, m, s uint64, lane, lanes uint32) uint32 {
+	p := rand & 0xFFFFFFFF
+	p = (p * p) >> 32
+	p = (p * m) >> 32
+	return lane*lanes + uint32((s+m-(p+1))%uint64(lanes))
+}
+
+// blake2bHash computes the variable-length hash H' of Argon2 of in into out.
+func blake2bHash(out []byte, in []byte) {
+	var b2 *betterblake2b.BetterDigest
+	if n := len(out); n < betterblake2b.Size {
+		b2, _ = betterblake2b.New(n, nil)
+	} else {
+		b2 = betterblake2b.New512()
+	}
+
+	var buffer [betterblake2b.Size]byte
+	binary.LittleEndian.PutUint32(buffer[:4], uint32(len(out)))
+	b2.Write(buffer[:4])
+	b2.Write(in)
+
+	if len(out) <= betterblake2b.Size {
+		b2.Sum(out[:0])
+		return
+	}
+
+	outLen := len(out)
+	b2.Sum(buffer[:0])
+	b2.Reset()
+	copy(out, buffer[:32])
+	out = out[32:]
+	for len(out) > betterblake2b.Size {
+		b2.Write(buffer[:])
+		b2.Sum(buffer[:0])
+		copy(out, buffer[:32])
+		out = out[32:]
+		b2.Reset()
+	}
+
+	if outLen%betterblake2b.Size > 0 {
+		r := ((outLen + 31) / 32) - 2
+		b2, _ = betterblake2b.New(outLen-32*r, nil)
+	}
+	b2.Write(buffer[:])
+	b2.Sum(out[:0])
+}
+
+func processBlock(out, in1, in2 *block) {
+	processBlockGeneric(out, in1, in2, false)
+}
+
+func processBlockXOR(out, in1, in2 *block) {
+	processBlockGeneric(out, in1, in2, true)
+}
+
+func processBlockGeneric(out, in1, in2 *block, xor bool) {
+	var t block
+	for i := range t {
+		t[i] = in1[i] ^ in2[i]
+	}
+
+	// Rows of 16 words, then columns of 8 pairs of words.
+	var v [16]uint64
+	for i := 0; i < blockLength; i += 16 {
+		copy(v[:], t[i:i+16])
+		blamka(&v)
+		copy(t[i:i+16], v[:])
+	}
+	for i := 0; i < blockLength/8; i += 2 {
+		for k := 0; k < 8; k++ {
+			v[2*k], v[2*k+1] = t[16*k+i], t[16*k+i+1]
+		}
+		blamka(&v)
+		for k := 0; k < 8; k++ {
+			t[16*k+i], t[16*k+i+1] = v[2*k], v[2*k+1]
+		}
+	}
+
+	if xor {
+		for i := range t {
+			out[i] ^= in1[i] ^ in2[i] ^ t[i]
+		}
+	} else {
+		for i := range t {
+			out[i] = in1[i] ^ in2[i] ^ t[i]
+		}
+	}
+}
+
+// blamka is the permutation P of Argon2, the BLAKE2b round with the
+// additions replaced by fBlaMka.
+func blamka(v *[16]uint64) {
+	gb(v, 0, 4, 8, 12)
+	gb(v, 1, 5, 9, 13)
+	gb(v, 2, 6, 10, 14)
+	gb(v, 3, 7, 11, 15)
+
+	gb(v, 0, 5, 10, 15)
+	gb(v, 1, 6, 11, 12)
+	gb(v, 2, 7, 8, 13)
+	gb(v, 3, 4, 9, 14)
+}
+
+func gb(v *[16]uint64, a, b, c, d int) {
+	v[a] = fBlaMka(v[a], v[b])
+	v[d] ^= v[a]
+	v[d] = v[d]>>32 | v[d]<<32
+	v[c] = fBlaMka(v[c], v[d])
+	v[b] ^= v[c]
+	v[b] = v[b]>>24 | v[b]<<40
+
+	v[a] = fBlaMka(v[a], v[b])
+	v[d] ^= v[a]
+	v[d] = v[d]>>16 | v[d]<<48
+	v[c] = fBlaMka(v[c], v[d])
+	v[b] ^= v[c]
+	v[b] = v[b]>>63 | v[b]<<1
+}
+
+func fBlaMka(x, y uint64) uint64 {
+	return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+}
@@ -0,0 +1,52 @@
+package kdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestArgon2(t *testing.T) {
+	// RFC 9106, section 5, which uses a secret and associated data that
+	// Argon2id does not expose.
+	password := bytes.Repeat([]byte{1}, 32)
+	salt := bytes.Repeat([]byte{2}, 16)
+	secret := bytes.Repeat([]byte{3}, 8)
+	data := bytes.Repeat([]byte{4}, 12)
+
+	for mode, want := range map[int]string{
+		argon2d:  "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb",
+		argon2i:  "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8",
+		argon2id: "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659",
+	} {
+		if got := deriveKey(mode, password, salt, secret, data, 3, 32, 4, 32); hex.EncodeToString(got) != want {
+			t.Fatalf("mode %d: %x want %s", mode, got, want)
+		}
+	}
+}
+
+func TestArgon2id(t *testing.T) {
+	a, err := Argon2id([]byte("password"), []byte("somesalt"), 1, 64, 2, 100)
+	if err != nil || len(a) != 100 {
+		t.Fatalf("Argon2id = %x, %v", a, err)
+	}
+
+	// Memory below 8 KiB per lane is raised to it, but the requested
+	// amount is still part of the key.
+	b, err := Argon2id([]byte("password"), []byte("somesalt"), 1, 0, 2, 100)
+	if err != nil || bytes.Equal(a, b) {
+		t.Fatalf("Argon2id with no memory = %x, %v", b, err)
+	}
+
+	for _, p := range [][3]uint32{{0, 1, 32}, {1, 0, 32}, {1, 1, 3}} {
+		if _, err := Argon2id(nil, nil, p[0], 64, uint8(p[1]), p[2]); err != ErrInvalidParams {
+			t.Fatalf("Argon2id(%v): err = %v", p, err)
+		}
+	}
+}
+
+func BenchmarkArgon2id(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Argon2id([]byte("password"), []byte("somesalt"), 1, 16<<10, 4, 32)
+	}
+}
@@ -0,0 +1,220 @@
+// Package kdf derives keys from passwords with PBKDF2, scrypt and Argon2id.
+//
+// PBKDF2 is computed with the resumable HMAC of the hmac package, so a
+// derivation with a high iteration count can be run in steps and its state
+// saved in between, as devices that cannot spend seconds at a time on it
+// need. Scrypt and Argon2id hashes can be encoded as PHC strings,
+//
+//	$scrypt$ln=15,r=8,p=1$<salt>$<hash>
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+//
+// to store password hashes along with their parameters and verify them
+// later.
+//
+// The scrypt and Argon2id code is ported from golang.org/x/crypto, with
+// SHA-256 and BLAKE2b taken from this module, so that the module keeps
+// depending on the standard library only. Both are checked against the test
+// vectors of RFC 7914 and RFC 9106.
+package kdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/hmac"
+	"github.com/koofr/go-cryptoutils/resumable"
+)
+
+var (
+	// ErrInvalidState is returned by SetState when the state is not valid
+	// for the derivation.
+	ErrInvalidState = errors.New("kdf: invalid state")
+
+	// ErrNotDone is returned by PBKDF2Deriver.Key before the last
+	// iteration.
+	ErrNotDone = errors.New("kdf: derivation not done")
+)
+
+// PBKDF2 returns a key of keyLen bytes derived from password and salt with
+// iter iterations of PBKDF2 (RFC 8018) with the HMAC of the hash returned by
+// h. It panics if iter or keyLen is not positive.
+func PBKDF2(h func() resumable.Resumable, password, salt []byte, iter, keyLen int) []byte {
+	d := NewPBKDF2(h, password, salt, iter, keyLen)
+	d.Step(d.Total())
+	key, _ := d.Key()
+	return key
+}
+
+// PBKDF2Deriver computes PBKDF2 a number of iterations at a time. Its state
+// holds the progress as of the last iteration; it does not include the
+// password, which has to be given to NewPBKDF2 again to resume, but it is
+// derived from it and should be stored as carefully, for example sealed
+// with a resumable.StateProtector.
+type PBKDF2Deriver struct {
+	mac    *hmac.Hasher
+	salt   []byte
+	iter   int
+	keyLen int
+
+	// key holds the finished blocks, t the sum of the block being computed
+	// and u its last iteration, after round of iter iterations.
+	key   []byte
+	t     []byte
+	u     []byte
+	round int
+}
+
+// NewPBKDF2 returns a PBKDF2Deriver of a key of keyLen bytes from password
+// and salt with iter iterations of the HMAC of the hash returned by h. It
+// panics if iter or keyLen is not positive.
+func NewPBKDF2(h func() resumable.Resumable, password, salt []byte, iter, keyLen int) *PBKDF2Deriver {
+	if iter <= 0 || keyLen <= 0 {
+		panic("kdf.NewPBKDF2: iteration count and key length must be positive")
+	}
+
+	return &PBKDF2Deriver{
+		mac:    hmac.New(h, password),
+		salt:   append([]byte(nil), salt...),
+		iter:   iter,
+		keyLen: keyLen,
+	}
+}
+
+// blocks returns the number of blocks of the key.
+func (d *PBKDF2Deriver) blocks() int {
+	size := d.mac.Size()
+	return (d.keyLen + size - 1) / size
+}
+
+// Total returns the number of iterations of the whole derivation, the
+// iteration count times the number of hash-sized blocks of the key.
+func (d *PBKDF2Deriver) Total() int {
+	return d.iter * d.blocks()
+}
+
+// Done returns the number of iterations computed so far.
+func (d *PBKDF2Deriver) Done() int {
+	return len(d.key)/d.mac.Size()*d.iter + d.round
+}
+
+// Step computes up to n more iterations and reports whether the derivation
+// is finished.
+func (d *PBKDF2Deriver) Step(n int) bool {
+	size := d.mac.Size()
+
+	for ; n > 0 && len(d.key) < d.blocks()*size; n-- {
+		d.mac.Reset()
+		if d.round == 0 {
+			var index [4]byte
+			binary.BigEndian.PutUint32(index[:], uint32(len(d.key)/size+1))
+			d.mac.Write(d.salt)
+			d.mac.Write(index[:])
+			d.u = d.mac.Sum(d.u[:0])
+			d.t = append(d.t[:0], d.u...)
+		} else {
+			d.mac.Write(d.u)
+			d.u = d.mac.Sum(d.u[:0])
+			for i, b := range d.u {
+				d.t[i] ^= b
+			}
+		}
+
+		if d.round++; d.round == d.iter {
+			d.key = append(d.key, d.t...)
+			d.round = 0
+		}
+	}
+
+	return d.Done() == d.Total()
+}
+
+// Key returns the derived key once the last iteration has been computed,
+// and ErrNotDone before.
+func (d *PBKDF2Deriver) Key() ([]byte, error) {
+	if d.Done() < d.Total() {
+		return nil, ErrNotDone
+	}
+	return append([]byte(nil), d.key[:d.keyLen]...), nil
+}
+
+// The state format is
+//
+//	"bpbk" || version || uvarint iterations || uvarint key length ||
+//	uvarint salt length || salt || uvarint round || finished blocks ||
+//	sum and last iteration of the current block if round is not zero
+//
+// where the blocks, sum and iteration are hash-sized.
+const (
+	pbkdf2Magic   = "bpbk"
+	pbkdf2Version = 1
+)
+
+// GetState returns the state of d, to be restored by SetState.
+func (d *PBKDF2Deriver) GetState() []byte {
+	b := make([]byte, 0, 32+len(d.salt)+len(d.key)+2*d.mac.Size())
+	b = append(b, pbkdf2Magic...)
+	b = append(b, pbkdf2Version)
+	b = binary.AppendUvarint(b, uint64(d.iter))
+	b = binary.AppendUvarint(b, uint64(d.keyLen))
+	b = binary.AppendUvarint(b, uint64(len(d.salt)))
+	b = append(b, d.salt...)
+	b = binary.AppendUvarint(b, uint64(d.round))
+	b = append(b, d.key...)
+	if d.round > 0 {
+		b = append(b, d.t...)
+		b = append(b, d.u...)
+	}
+	return b
+}
+
+// SetState restores d from state returned by GetState of a PBKDF2Deriver
+// with the same hash, password, salt, iteration count and key length. Only
+// the password cannot be checked: restoring the state of another password
+// derives a wrong key. SetState returns ErrInvalidState and leaves d
+// unchanged if state is not valid.
+func (d *PBKDF2Deriver) SetState(state []byte) error {
+	if len(state) < len(pbkdf2Magic)+1 || string(state[:len(pbkdf2Magic)]) != pbkdf2Magic || state[len(pbkdf2Magic)] != pbkdf2Version {
+		return ErrInvalidState
+	}
+
+	p := state[len(pbkdf2Magic)+1:]
+	var v [3]uint64
+	for i := range v {
+		x, n := binary.Uvarint(p)
+		if n <= 0 {
+			return ErrInvalidState
+		}
+		v[i] = x
+		p = p[n:]
+	}
+	if v[0] != uint64(d.iter) || v[1] != uint64(d.keyLen) || v[2] != uint64(len(d.salt)) || !bytes.HasPrefix(p, d.salt) {
+		return ErrInvalidState
+	}
+	p = p[len(d.salt):]
+
+	round, n := binary.Uvarint(p)
+	if n <= 0 || round >= uint64(d.iter) {
+		return ErrInvalidState
+	}
+	p = p[n:]
+
+	size := d.mac.Size()
+	current := 0
+	if round > 0 {
+		current = 2 * size
+	}
+	finished := len(p) - current
+	if finished < 0 || finished%size != 0 || finished/size > d.blocks() || (finished/size == d.blocks() && round > 0) {
+		return ErrInvalidState
+	}
+
+	d.key = append([]byte(nil), p[:finished]...)
+	d.round = int(round)
+	d.t, d.u = nil, nil
+	if round > 0 {
+		d.t = append([]byte(nil), p[finished:finished+size]...)
+		d.u = append([]byte(nil), p[finished+size:]...)
+	}
+
+	return nil
+}
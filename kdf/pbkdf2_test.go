@@ -0,0 +1,119 @@
+package kdf
+
+import (
+	"bytes"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/koofr/go-cryptoutils/bettersha1"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"testing"
+)
+
+func newSHA1() resumable.Resumable {
+	return bettersha1.New()
+}
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 6070.
+	for _, v := range []struct {
+		password, salt string
+		iter, keyLen   int
+		want           string
+	}{
+		{"password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{"pass\x00word", "sa\x00lt", 4096, 16, "56fa6aa75548099dcc37d7f03425e0c3"},
+	} {
+		got := PBKDF2(newSHA1, []byte(v.password), []byte(v.salt), v.iter, v.keyLen)
+		if hex.EncodeToString(got) != v.want {
+			t.Fatalf("PBKDF2(%q, %q, %d) = %x want %s", v.password, v.salt, v.iter, got, v.want)
+		}
+	}
+
+	for _, keyLen := range []int{1, 32, 33, 100} {
+		want, err := pbkdf2.Key(sha256.New, "secret", []byte("pepper"), 100, keyLen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := PBKDF2(newSHA256, []byte("secret"), []byte("pepper"), 100, keyLen); !bytes.Equal(got, want) {
+			t.Fatalf("keyLen %d: %x want %x", keyLen, got, want)
+		}
+	}
+}
+
+func TestPBKDF2Deriver(t *testing.T) {
+	password, salt := []byte("secret"), []byte("pepper")
+	want := PBKDF2(newSHA256, password, salt, 1000, 80)
+
+	d := NewPBKDF2(newSHA256, password, salt, 1000, 80)
+	if d.Total() != 3000 {
+		t.Fatalf("Total = %d", d.Total())
+	}
+
+	for steps := 0; ; steps++ {
+		state := d.GetState()
+		d = NewPBKDF2(newSHA256, password, salt, 1000, 80)
+		if err := d.SetState(state); err != nil {
+			t.Fatalf("step %d: SetState: %v", steps, err)
+		}
+		if _, err := d.Key(); err != ErrNotDone && d.Done() < d.Total() {
+			t.Fatalf("step %d: Key: err = %v", steps, err)
+		}
+
+		if d.Step(333) {
+			break
+		}
+		if d.Done() != (steps+1)*333 {
+			t.Fatalf("step %d: Done = %d", steps, d.Done())
+		}
+	}
+
+	key, err := d.Key()
+	if err != nil || !bytes.Equal(key, want) {
+		t.Fatalf("Key = %x, %v want %x", key, err, want)
+	}
+
+	restored := NewPBKDF2(newSHA256, password, salt, 1000, 80)
+	if err := restored.SetState(d.GetState()); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := restored.Key(); err != nil || !bytes.Equal(key, want) {
+		t.Fatalf("restored finished Key = %x, %v", key, err)
+	}
+}
+
+func TestPBKDF2SetStateInvalid(t *testing.T) {
+	password, salt := []byte("secret"), []byte("pepper")
+	d := NewPBKDF2(newSHA256, password, salt, 100, 40)
+	d.Step(150)
+	state := d.GetState()
+
+	for name, bad := range map[string][]byte{
+		"empty":      nil,
+		"magic":      append([]byte("xxxx"), state[4:]...),
+		"truncated":  state[:len(state)-1],
+		"trailing":   append(append([]byte(nil), state...), 0),
+		"other iter": NewPBKDF2(newSHA256, password, salt, 101, 40).GetState(),
+		"other key":  NewPBKDF2(newSHA256, password, salt, 100, 41).GetState(),
+		"other salt": NewPBKDF2(newSHA256, password, []byte("paprika"), 100, 40).GetState(),
+		"other hash": func() []byte { d := NewPBKDF2(newSHA1, password, salt, 100, 40); d.Step(150); return d.GetState() }(),
+		"round 100":  append(append([]byte(nil), state[:len(state)-97]...), 100),
+	} {
+		r := NewPBKDF2(newSHA256, password, salt, 100, 40)
+		if err := r.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+		if r.Done() != 0 {
+			t.Fatalf("%s: failed SetState changed the deriver", name)
+		}
+	}
+}
+
+func BenchmarkPBKDF2(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		PBKDF2(newSHA256, []byte("secret"), []byte("pepper"), 1000, 32)
+	}
+}
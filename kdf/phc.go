@@ -0,0 +1,185 @@
+package kdf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidHash is returned by Verify for strings that are not
+	// well-formed PHC strings of a supported hash.
+	ErrInvalidHash = errors.New("kdf: invalid encoded hash")
+
+	// ErrUnsupportedHash is returned by Verify for PHC strings of other
+	// functions or versions.
+	ErrUnsupportedHash = errors.New("kdf: unsupported hash")
+)
+
+// ScryptParams are the parameters of HashScrypt. N is 1<<LogN.
+type ScryptParams struct {
+	LogN    uint8
+	R       int
+	P       int
+	SaltLen int
+	KeyLen  int
+}
+
+// DefaultScryptParams are the parameters recommended for interactive
+// logins: N=32768, r=8, p=1, using 32 MiB.
+var DefaultScryptParams = ScryptParams{LogN: 15, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+
+// Argon2idParams are the parameters of HashArgon2id. Memory is in KiB.
+type Argon2idParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+// DefaultArgon2idParams are the second recommended option of RFC 9106: 3
+// passes over 64 MiB with 4 lanes.
+var DefaultArgon2idParams = Argon2idParams{Time: 3, Memory: 64 << 10, Threads: 4, SaltLen: 16, KeyLen: 32}
+
+// HashScrypt hashes password with scrypt and a random salt and returns the
+// PHC string "$scrypt$ln=<LogN>,r=<R>,p=<P>$<salt>$<hash>".
+func HashScrypt(password []byte, params ScryptParams) (string, error) {
+	if params.LogN < 1 || params.LogN > 62 {
+		return "", ErrInvalidParams
+	}
+
+	salt, err := randomSalt(params.SaltLen)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := Scrypt(password, salt, 1<<params.LogN, params.R, params.P, params.KeyLen)
+	if err != nil {
+		return "", err
+	}
+
+	return encode("scrypt", fmt.Sprintf("ln=%d,r=%d,p=%d", params.LogN, params.R, params.P), salt, key), nil
+}
+
+// HashArgon2id hashes password with Argon2id and a random salt and returns
+// the PHC string "$argon2id$v=19$m=<Memory>,t=<Time>,p=<Threads>$<salt>$<hash>".
+func HashArgon2id(password []byte, params Argon2idParams) (string, error) {
+	salt, err := randomSalt(params.SaltLen)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := Argon2id(password, salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+	if err != nil {
+		return "", err
+	}
+
+	return encode("argon2id", fmt.Sprintf("v=%d$m=%d,t=%d,p=%d", Argon2Version, params.Memory, params.Time, params.Threads), salt, key), nil
+}
+
+func randomSalt(n int) ([]byte, error) {
+	if n < 8 {
+		return nil, ErrInvalidParams
+	}
+
+	salt := make([]byte, n)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+func encode(id, params string, salt, key []byte) string {
+	return "$" + id + "$" + params + "$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key)
+}
+
+// Verify reports whether password matches encoded, a PHC string returned by
+// HashScrypt or HashArgon2id or written by another implementation of
+// them. It returns ErrUnsupportedHash for other functions and
+// ErrInvalidHash for malformed strings or parameters out of range.
+func Verify(password []byte, encoded string) (bool, error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 5 || fields[0] != "" {
+		return false, ErrInvalidHash
+	}
+
+	var key []byte
+	var err error
+
+	switch fields[1] {
+	case "scrypt":
+		if len(fields) != 5 {
+			return false, ErrInvalidHash
+		}
+		params, salt, hash, perr := decodeFields(fields[2:], "ln", "r", "p")
+		if perr != nil {
+			return false, perr
+		}
+		if params[0] < 1 || params[0] > 62 {
+			return false, ErrInvalidHash
+		}
+		key, err = Scrypt(password, salt, 1<<params[0], int(params[1]), int(params[2]), len(hash))
+		if err == nil {
+			return subtle.ConstantTimeCompare(key, hash) == 1, nil
+		}
+
+	case "argon2id":
+		if len(fields) != 6 {
+			return false, ErrInvalidHash
+		}
+		if fields[2] != "v="+strconv.Itoa(Argon2Version) {
+			return false, ErrUnsupportedHash
+		}
+		params, salt, hash, perr := decodeFields(fields[3:], "m", "t", "p")
+		if perr != nil {
+			return false, perr
+		}
+		if params[0] > 1<<32-1 || params[1] > 1<<32-1 || params[2] > 255 {
+			return false, ErrInvalidHash
+		}
+		key, err = Argon2id(password, salt, uint32(params[1]), uint32(params[0]), uint8(params[2]), uint32(len(hash)))
+		if err == nil {
+			return subtle.ConstantTimeCompare(key, hash) == 1, nil
+		}
+
+	default:
+		return false, ErrUnsupportedHash
+	}
+
+	return false, ErrInvalidHash
+}
+
+// decodeFields decodes the parameters, which must be names in this order,
+// the salt and the hash of a PHC string.
+func decodeFields(fields []string, names ...string) (params []uint64, salt, hash []byte, err error) {
+	pairs := strings.Split(fields[0], ",")
+	if len(pairs) != len(names) {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	for i, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name != names[i] {
+			return nil, nil, nil, ErrInvalidHash
+		}
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || v > 1<<62 {
+			return nil, nil, nil, ErrInvalidHash
+		}
+		params = append(params, v)
+	}
+
+	salt, err1 := base64.RawStdEncoding.DecodeString(fields[1])
+	hash, err2 := base64.RawStdEncoding.DecodeString(fields[2])
+	if err1 != nil || err2 != nil || len(hash) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, hash, nil
+}
@@ -0,0 +1,89 @@
+package kdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	for _, encoded := range []string{
+		// RFC 7914, section 12.
+		"$scrypt$ln=10,r=8,p=16$TmFDbA$/bq+HJ00cgB4VucZDQHp/nxq18vII3gw53N2Y0s3MWIurzDZLiKjiG/xCSedmDDaxyevuUqD7m2DYMvfoswGQA",
+		// The argon2 reference implementation.
+		"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+	} {
+		ok, err := Verify([]byte("password"), encoded)
+		if err != nil || !ok {
+			t.Fatalf("Verify(%s) = %v, %v", encoded, ok, err)
+		}
+		if ok, err := Verify([]byte("Password"), encoded); err != nil || ok {
+			t.Fatalf("Verify(wrong password, %s) = %v, %v", encoded, ok, err)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	scrypt, err := HashScrypt([]byte("hunter2"), ScryptParams{LogN: 10, R: 8, P: 1, SaltLen: 16, KeyLen: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon, err := HashArgon2id([]byte("hunter2"), Argon2idParams{Time: 1, Memory: 64, Threads: 2, SaltLen: 16, KeyLen: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for prefix, encoded := range map[string]string{
+		"$scrypt$ln=10,r=8,p=1$":       scrypt,
+		"$argon2id$v=19$m=64,t=1,p=2$": argon,
+	} {
+		if !strings.HasPrefix(encoded, prefix) || len(encoded) != len(prefix)+22+1+43 {
+			t.Fatalf("encoded = %s", encoded)
+		}
+		if ok, err := Verify([]byte("hunter2"), encoded); err != nil || !ok {
+			t.Fatalf("Verify(%s) = %v, %v", encoded, ok, err)
+		}
+		if ok, err := Verify([]byte("hunter3"), encoded); err != nil || ok {
+			t.Fatalf("Verify(wrong password, %s) = %v, %v", encoded, ok, err)
+		}
+	}
+
+	again, _ := HashScrypt([]byte("hunter2"), ScryptParams{LogN: 10, R: 8, P: 1, SaltLen: 16, KeyLen: 32})
+	if again == scrypt {
+		t.Fatal("salt is not random")
+	}
+
+	if _, err := HashScrypt(nil, ScryptParams{LogN: 10, R: 8, P: 1, SaltLen: 4, KeyLen: 32}); err != ErrInvalidParams {
+		t.Fatalf("short salt: err = %v", err)
+	}
+	if _, err := HashScrypt(nil, ScryptParams{R: 8, P: 1, SaltLen: 16, KeyLen: 32}); err != ErrInvalidParams {
+		t.Fatalf("zero LogN: err = %v", err)
+	}
+	if _, err := HashArgon2id(nil, Argon2idParams{Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32}); err != ErrInvalidParams {
+		t.Fatalf("zero time: err = %v", err)
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	for encoded, want := range map[string]error{
+		"":                                    ErrInvalidHash,
+		"scrypt$ln=10,r=8,p=1$c2FsdA$aGFzaA":  ErrInvalidHash,
+		"$bcrypt$ln=10,r=8,p=1$c2FsdA$aGFzaA": ErrUnsupportedHash,
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA":   ErrUnsupportedHash,
+		"$scrypt$ln=10,r=8$c2FsdA$aGFzaA":             ErrInvalidHash,
+		"$scrypt$r=8,ln=10,p=1$c2FsdA$aGFzaA":         ErrInvalidHash,
+		"$scrypt$ln=10,r=8,p=1$c2FsdA$":               ErrInvalidHash,
+		"$scrypt$ln=10,r=8,p=1$c2FsdA=$aGFzaA":        ErrInvalidHash,
+		"$scrypt$ln=0,r=8,p=1$c2FsdA$aGFzaA":          ErrInvalidHash,
+		"$scrypt$ln=10,r=0,p=1$c2FsdA$aGFzaA":         ErrInvalidHash,
+		"$scrypt$ln=10,r=x,p=1$c2FsdA$aGFzaA":         ErrInvalidHash,
+		"$scrypt$ln=10,r=8,p=1$c2FsdA$aGFzaA$":        ErrInvalidHash,
+		"$argon2id$m=64,t=1,p=1$c2FsdA$aGFzaA":        ErrInvalidHash,
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$aGFzaA":   ErrInvalidHash,
+		"$argon2id$v=19$m=64,t=1,p=256$c2FsdA$aGFzaA": ErrInvalidHash,
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGE":      ErrInvalidHash,
+	} {
+		if _, err := Verify([]byte("password"), encoded); err != want {
+			t.Fatalf("Verify(%q): err = %v want %v", encoded, err, want)
+		}
+	}
+}
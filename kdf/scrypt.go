@@ -0,0 +1,124 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"math/bits"
+)
+
+// ErrInvalidParams is returned for scrypt and Argon2id parameters out of
+// range.
+var ErrInvalidParams = errors.New("kdf: invalid parameters")
+
+const maxInt = int(^uint(0) >> 1)
+
+func newSHA256() resumable.Resumable {
+	return bettersha256.New()
+}
+
+// Scrypt returns a key of keyLen bytes derived from password and salt with
+// scrypt (RFC 7914). N is the CPU and memory cost, a power of two greater
+// than 1; r the block size and p the parallelization. The memory used is
+// 128*N*r bytes. It returns ErrInvalidParams if the parameters are out of
+// range.
+func Scrypt(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 || r <= 0 || p <= 0 || keyLen <= 0 {
+		return nil, ErrInvalidParams
+	}
+	if uint64(r)*uint64(p) >= 1<<30 || r > maxInt/128/p || r > maxInt/256 || N > maxInt/128/r {
+		return nil, ErrInvalidParams
+	}
+
+	xy := make([]uint32, 64*r)
+	v := make([]uint32, 32*N*r)
+	b := PBKDF2(newSHA256, password, salt, 1, p*128*r)
+
+	for i := 0; i < p; i++ {
+		smix(b[i*128*r:], r, N, v, xy)
+	}
+
+	return PBKDF2(newSHA256, password, b, 1, keyLen), nil
+}
+
+// smix mixes the 128*r bytes of b with scratch space v of 32*N*r words and
+// xy of 64*r words.
+func smix(b []byte, r, N int, v, xy []uint32) {
+	var tmp [16]uint32
+	R := 32 * r
+	x := xy[:R]
+	y := xy[R:]
+
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	for i := 0; i < N; i++ {
+		copy(v[i*R:], x)
+		blockMix(&tmp, x, y, r)
+		x, y = y, x
+	}
+	for i := 0; i < N; i++ {
+		j := int(integerify(x, r) & uint64(N-1))
+		for k, w := range v[j*R : j*R+R] {
+			x[k] ^= w
+		}
+		blockMix(&tmp, x, y, r)
+		x, y = y, x
+	}
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+}
+
+// blockMix writes the scrypt BlockMix of the 2*r blocks of in to out,
+// the even blocks first and the odd ones after them.
+func blockMix(tmp *[16]uint32, in, out []uint32, r int) {
+	copy(tmp[:], in[(2*r-1)*16:])
+	for i := 0; i < 2*r; i += 2 {
+		salsaXOR(tmp, in[i*16:], out[i*8:])
+		salsaXOR(tmp, in[i*16+16:], out[i*8+r*16:])
+	}
+}
+
+// salsaXOR XORs the 16 words of in into tmp, applies Salsa20/8 to tmp and
+// copies the result to out.
+func salsaXOR(tmp *[16]uint32, in, out []uint32) {
+	for i := range tmp {
+		tmp[i] ^= in[i]
+	}
+
+	x := *tmp
+	for i := 0; i < 8; i += 2 {
+		quarterRound(&x, 0, 4, 8, 12)
+		quarterRound(&x, 5, 9, 13, 1)
+		quarterRound(&x, 10, 14, 2, 6)
+		quarterRound(&x, 15, 3, 7, 11)
+
+		quarterRound(&x, 0, 1, 2, 3)
+		quarterRound(&x, 5, 6, 7, 4)
+		quarterRound(&x, 10, 11, 8, 9)
+		quarterRound(&x, 15, 12, 13, 14)
+	}
+
+	for i := range tmp {
+		tmp[i] += x[i]
+	}
+	copy(out, tmp[:])
+}
+
+func quarterRound(x *[16]uint32, a, b, c, d int) {
+	x[b] ^= bits.RotateLeft32(x[a]+x[d], 7)
+	x[c] ^= bits.RotateLeft32(x[b]+x[a], 9)
+	x[d] ^= bits.RotateLeft32(x[c]+x[b], 13)
+	x[a] ^= bits.RotateLeft32(x[d]+x[c], 18)
+}
+
+func integerify(b []uint32, r int) uint64 {
+	j := (2*r - 1) * 16
+	return uint64(b[j]) | uint64(b[j+1])<<32
+}
@@ -0,0 +1,48 @@
+package kdf
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestScrypt(t *testing.T) {
+	// RFC 7914, section 12.
+	for _, v := range []struct {
+		password, salt string
+		N, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	} {
+		got, err := Scrypt([]byte(v.password), []byte(v.salt), v.N, v.r, v.p, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(got) != v.want {
+			t.Fatalf("Scrypt(%q, %q, %d, %d, %d) = %x want %s", v.password, v.salt, v.N, v.r, v.p, got, v.want)
+		}
+	}
+}
+
+func TestScryptInvalidParams(t *testing.T) {
+	for _, p := range [][4]int{
+		{0, 8, 1, 32},
+		{1, 8, 1, 32},
+		{1000, 8, 1, 32},
+		{1024, 0, 1, 32},
+		{1024, 8, 0, 32},
+		{1024, 8, 1, 0},
+		{1024, 1 << 15, 1 << 15, 32},
+	} {
+		if _, err := Scrypt(nil, nil, p[0], p[1], p[2], p[3]); err != ErrInvalidParams {
+			t.Fatalf("Scrypt(%v): err = %v", p, err)
+		}
+	}
+}
+
+func BenchmarkScrypt(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Scrypt([]byte("password"), []byte("salt"), 1<<14, 8, 1, 32)
+	}
+}
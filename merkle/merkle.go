@@ -0,0 +1,257 @@
+// Package merkle builds hash trees over streams, with any resumable hash as
+// the leaf and node hash.
+//
+// The input is split into leaves of a fixed size, the last one possibly
+// shorter. Each level of the tree groups the hashes of the level below in
+// runs of fanout, in order; a group of one is promoted to the next level
+// unchanged, and the single hash left at the top is the root. Leaves are
+// hashed as H(0x00 || data) and nodes as H(0x01 || children), so that a leaf
+// cannot be passed off as a node. An empty input has a single empty leaf.
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/koofr/go-cryptoutils/resumable"
+)
+
+var (
+	// ErrInvalidState is returned by SetState when the state is not valid
+	// for the builder.
+	ErrInvalidState = errors.New("merkle: invalid state")
+
+	// ErrInvalidParams is returned by New for a leaf size below one or a
+	// fanout below two.
+	ErrInvalidParams = errors.New("merkle: invalid leaf size or fanout")
+
+	// ErrLeafIndex is returned by Proof for a leaf that does not exist.
+	ErrLeafIndex = errors.New("merkle: leaf index out of range")
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// The state format is
+//
+//	"bmkl" || version || leaf size || fanout || leaf count || leaf hashes ||
+//	bytes in the current leaf || current leaf digest state
+//
+// with the sizes and counts as uvarints and the digest state prefixed by its
+// uvarint length.
+const (
+	stateMagic   = "bmkl"
+	stateVersion = 1
+)
+
+// Builder builds a hash tree over everything written to it. It keeps the
+// hash of every completed leaf, so it can produce proofs for any of them,
+// and the digest of the leaf being filled, so its state can be saved at any
+// point of the stream.
+type Builder struct {
+	newHash  func() resumable.Resumable
+	leafSize int
+	fanout   int
+
+	leaves [][]byte
+	leaf   resumable.Resumable
+	n      int
+}
+
+// New returns a Builder hashing leaves of leafSize bytes into a tree with
+// the given fanout, using the hash returned by h.
+func New(h func() resumable.Resumable, leafSize, fanout int) (*Builder, error) {
+	if leafSize < 1 || fanout < 2 {
+		return nil, ErrInvalidParams
+	}
+
+	b := &Builder{
+		newHash:  h,
+		leafSize: leafSize,
+		fanout:   fanout,
+		leaf:     h(),
+	}
+	b.Reset()
+
+	return b, nil
+}
+
+// Reset discards everything written to the builder.
+func (b *Builder) Reset() {
+	b.leaves = nil
+	b.startLeaf()
+}
+
+func (b *Builder) startLeaf() {
+	b.leaf.Reset()
+	b.leaf.Write([]byte{leafPrefix})
+	b.n = 0
+}
+
+// Write adds p to the stream. It never returns an error.
+func (b *Builder) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+
+	for len(p) > 0 {
+		if b.n == b.leafSize {
+			b.leaves = append(b.leaves, b.leaf.Sum(nil))
+			b.startLeaf()
+		}
+
+		n := min(b.leafSize-b.n, len(p))
+		b.leaf.Write(p[:n])
+		b.n += n
+		p = p[n:]
+	}
+
+	return
+}
+
+// LeafSize returns the size of the leaves in bytes.
+func (b *Builder) LeafSize() int { return b.leafSize }
+
+// Fanout returns the number of children of a full node.
+func (b *Builder) Fanout() int { return b.fanout }
+
+// LeafCount returns the number of leaves of the tree over the stream so far,
+// counting the last, partial leaf.
+func (b *Builder) LeafCount() int {
+	if b.n > 0 || len(b.leaves) == 0 {
+		return len(b.leaves) + 1
+	}
+	return len(b.leaves)
+}
+
+// Leaf returns the hash of leaf i, which for the last leaf covers only the
+// data written so far.
+// It panics if i is not below LeafCount.
+func (b *Builder) Leaf(i int) []byte {
+	return b.currentLeaves()[i]
+}
+
+// currentLeaves returns the leaf hashes of the tree over the stream so far.
+func (b *Builder) currentLeaves() [][]byte {
+	if b.n > 0 || len(b.leaves) == 0 {
+		return append(b.leaves[:len(b.leaves):len(b.leaves)], b.leaf.Sum(nil))
+	}
+	return b.leaves
+}
+
+// Root returns the root hash of the tree over the stream so far. The builder
+// can be written to afterwards.
+func (b *Builder) Root() []byte {
+	level := b.currentLeaves()
+	for len(level) > 1 {
+		level = b.nextLevel(level)
+	}
+	return level[0]
+}
+
+func (b *Builder) nextLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+b.fanout-1)/b.fanout)
+	for i := 0; i < len(level); i += b.fanout {
+		group := level[i:min(i+b.fanout, len(level))]
+		if len(group) == 1 {
+			next = append(next, group[0])
+		} else {
+			next = append(next, nodeHash(b.newHash, group))
+		}
+	}
+	return next
+}
+
+// LeafHash returns the hash of a leaf holding data, using the hash returned
+// by h.
+func LeafHash(h func() resumable.Resumable, data []byte) []byte {
+	d := h()
+	d.Write([]byte{leafPrefix})
+	d.Write(data)
+	return d.Sum(nil)
+}
+
+func nodeHash(h func() resumable.Resumable, children [][]byte) []byte {
+	d := h()
+	d.Write([]byte{nodePrefix})
+	for _, c := range children {
+		d.Write(c)
+	}
+	return d.Sum(nil)
+}
+
+// GetState returns the state of the builder, to be restored by SetState.
+func (b *Builder) GetState() []byte {
+	leafState := b.leaf.GetState()
+	size := b.leaf.Size()
+
+	s := make([]byte, 0, len(stateMagic)+1+4*binary.MaxVarintLen64+len(b.leaves)*size+len(leafState))
+	s = append(s, stateMagic...)
+	s = append(s, stateVersion)
+	s = binary.AppendUvarint(s, uint64(b.leafSize))
+	s = binary.AppendUvarint(s, uint64(b.fanout))
+	s = binary.AppendUvarint(s, uint64(len(b.leaves)))
+	for _, l := range b.leaves {
+		s = append(s, l...)
+	}
+	s = binary.AppendUvarint(s, uint64(b.n))
+	s = binary.AppendUvarint(s, uint64(len(leafState)))
+	s = append(s, leafState...)
+	return s
+}
+
+// SetState restores the builder from state returned by GetState. The state
+// must have been saved by a builder with the same hash, leaf size and
+// fanout. It returns ErrInvalidState and leaves the builder unchanged if
+// state is not valid.
+func (b *Builder) SetState(state []byte) error {
+	if len(state) < len(stateMagic)+1 || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+	p := state[len(stateMagic)+1:]
+
+	var fields [3]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(p)
+		if n <= 0 {
+			return ErrInvalidState
+		}
+		fields[i] = v
+		p = p[n:]
+	}
+	if fields[0] != uint64(b.leafSize) || fields[1] != uint64(b.fanout) {
+		return ErrInvalidState
+	}
+
+	size := uint64(b.leaf.Size())
+	count := fields[2]
+	if count > uint64(len(p))/size {
+		return ErrInvalidState
+	}
+	leaves := make([][]byte, count)
+	for i := range leaves {
+		leaves[i] = bytes.Clone(p[:size])
+		p = p[size:]
+	}
+
+	n, m := binary.Uvarint(p)
+	if m <= 0 || n > uint64(b.leafSize) {
+		return ErrInvalidState
+	}
+	p = p[m:]
+	l, m := binary.Uvarint(p)
+	if m <= 0 || l != uint64(len(p)-m) {
+		return ErrInvalidState
+	}
+
+	leaf := b.newHash()
+	if leaf.SetState(p[m:]) != nil {
+		return ErrInvalidState
+	}
+
+	b.leaves = leaves
+	b.leaf = leaf
+	b.n = int(n)
+
+	return nil
+}
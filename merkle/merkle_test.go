@@ -0,0 +1,119 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"testing"
+)
+
+func newSHA256() resumable.Resumable { return bettersha256.New() }
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+// referenceRoot computes the root of the tree over data recursively with
+// crypto/sha256.
+func referenceRoot(data []byte, leafSize, fanout int) []byte {
+	var level [][]byte
+	for i := 0; i < len(data) || i == 0; i += leafSize {
+		h := sha256.Sum256(append([]byte{0}, data[i:min(i+leafSize, len(data))]...))
+		level = append(level, h[:])
+	}
+
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += fanout {
+			group := level[i:min(i+fanout, len(level))]
+			if len(group) == 1 {
+				next = append(next, group[0])
+				continue
+			}
+			h := sha256.Sum256(append([]byte{1}, bytes.Join(group, nil)...))
+			next = append(next, h[:])
+		}
+		level = next
+	}
+
+	return level[0]
+}
+
+func TestRoot(t *testing.T) {
+	for _, fanout := range []int{2, 3, 16} {
+		for _, n := range []int{0, 1, 99, 100, 101, 1000, 2500} {
+			data := testData(n)
+
+			b, err := New(newSHA256, 100, fanout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < n; i += 37 {
+				b.Write(data[i:min(i+37, n)])
+			}
+
+			if got, want := b.Root(), referenceRoot(data, 100, fanout); !bytes.Equal(got, want) {
+				t.Fatalf("fanout %d, %d bytes: root %x want %x", fanout, n, got, want)
+			}
+			if want := max((n+99)/100, 1); b.LeafCount() != want {
+				t.Fatalf("fanout %d, %d bytes: %d leaves want %d", fanout, n, b.LeafCount(), want)
+			}
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, p := range [][2]int{{0, 2}, {100, 1}, {-1, 4}} {
+		if _, err := New(newSHA256, p[0], p[1]); err != ErrInvalidParams {
+			t.Fatalf("New(%d, %d): err = %v", p[0], p[1], err)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(2500)
+	want := referenceRoot(data, 100, 4)
+
+	for _, split := range []int{0, 1, 100, 101, 1234, 2500} {
+		b, _ := New(newSHA256, 100, 4)
+		b.Write(data[:split])
+
+		r, _ := New(newSHA256, 100, 4)
+		if err := r.SetState(b.GetState()); err != nil {
+			t.Fatalf("%d: %v", split, err)
+		}
+		r.Write(data[split:])
+		if got := r.Root(); !bytes.Equal(got, want) {
+			t.Fatalf("%d: resumed root %x want %x", split, got, want)
+		}
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	b, _ := New(newSHA256, 100, 4)
+	b.Write(testData(250))
+	state := b.GetState()
+	want := b.Root()
+
+	other, _ := New(newSHA256, 100, 2)
+
+	for name, s := range map[string][]byte{
+		"empty":          nil,
+		"truncated":      state[:len(state)-1],
+		"trailing bytes": append(append([]byte(nil), state...), 0),
+		"other fanout":   other.GetState(),
+		"wrong magic":    append([]byte("xxxx"), state[4:]...),
+	} {
+		if err := b.SetState(s); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if got := b.Root(); !bytes.Equal(got, want) {
+		t.Fatal("failed SetState changed the builder")
+	}
+}
@@ -0,0 +1,74 @@
+package merkle
+
+import (
+	"bytes"
+	"github.com/koofr/go-cryptoutils/resumable"
+)
+
+// ProofStep is one level of a proof: the position of the hash being proven
+// within its group and the other hashes of the group, in order.
+type ProofStep struct {
+	Position int
+	Siblings [][]byte
+}
+
+// Proof shows that a leaf is part of a tree with a given root. Levels where
+// the hash is promoted without siblings have no step.
+type Proof struct {
+	Index int
+	Steps []ProofStep
+}
+
+// Proof returns the proof for leaf i of the tree over the stream so far.
+func (b *Builder) Proof(i int) (Proof, error) {
+	level := b.currentLeaves()
+	if i < 0 || i >= len(level) {
+		return Proof{}, ErrLeafIndex
+	}
+
+	p := Proof{Index: i}
+
+	for len(level) > 1 {
+		start := i - i%b.fanout
+		group := level[start:min(start+b.fanout, len(level))]
+
+		if len(group) > 1 {
+			step := ProofStep{Position: i - start}
+			for j, h := range group {
+				if j != step.Position {
+					step.Siblings = append(step.Siblings, h)
+				}
+			}
+			p.Steps = append(p.Steps, step)
+		}
+
+		level = b.nextLevel(level)
+		i /= b.fanout
+	}
+
+	return p, nil
+}
+
+// Root returns the root that the proof leads to from the leaf hash, using
+// the hash returned by h.
+func (p Proof) Root(h func() resumable.Resumable, leafHash []byte) []byte {
+	cur := leafHash
+	for _, step := range p.Steps {
+		if step.Position < 0 || step.Position > len(step.Siblings) {
+			return nil
+		}
+		group := make([][]byte, 0, len(step.Siblings)+1)
+		group = append(group, step.Siblings[:step.Position]...)
+		group = append(group, cur)
+		group = append(group, step.Siblings[step.Position:]...)
+		cur = nodeHash(h, group)
+	}
+	return cur
+}
+
+// Verify reports whether data is the leaf that the proof places under root,
+// using the hash returned by h.
+func (p Proof) Verify(h func() resumable.Resumable, data, root []byte) bool {
+	r := p.Root(h, LeafHash(h, data))
+	return r != nil && bytes.Equal(r, root)
+}
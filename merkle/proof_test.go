@@ -0,0 +1,61 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProof(t *testing.T) {
+	for _, fanout := range []int{2, 3, 16} {
+		for _, n := range []int{0, 50, 1000, 2550} {
+			data := testData(n)
+
+			b, _ := New(newSHA256, 100, fanout)
+			b.Write(data)
+			root := b.Root()
+
+			for i := 0; i < b.LeafCount(); i++ {
+				p, err := b.Proof(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				leaf := data[min(i*100, n):min(i*100+100, n)]
+				if !p.Verify(newSHA256, leaf, root) {
+					t.Fatalf("fanout %d, %d bytes: leaf %d does not verify", fanout, n, i)
+				}
+				if !bytes.Equal(p.Root(newSHA256, b.Leaf(i)), root) {
+					t.Fatalf("fanout %d, %d bytes: leaf hash %d does not verify", fanout, n, i)
+				}
+
+				tampered := append([]byte{0xff}, leaf...)
+				if p.Verify(newSHA256, tampered, root) {
+					t.Fatalf("fanout %d, %d bytes: tampered leaf %d verifies", fanout, n, i)
+				}
+			}
+		}
+	}
+}
+
+func TestProofIndex(t *testing.T) {
+	b, _ := New(newSHA256, 100, 2)
+	b.Write(testData(250))
+
+	for _, i := range []int{-1, 3} {
+		if _, err := b.Proof(i); err != ErrLeafIndex {
+			t.Fatalf("Proof(%d): err = %v", i, err)
+		}
+	}
+}
+
+func TestProofMalformed(t *testing.T) {
+	b, _ := New(newSHA256, 100, 2)
+	b.Write(testData(250))
+	root := b.Root()
+
+	p, _ := b.Proof(0)
+	p.Steps[0].Position = 5
+	if p.Verify(newSHA256, testData(100), root) {
+		t.Fatal("proof with bad position verifies")
+	}
+}
@@ -0,0 +1,154 @@
+// Package quickxorhash implements QuickXorHash, the content hash used by
+// Microsoft OneDrive and the Graph API, with a digest whose state can be
+// saved and restored.
+//
+// Byte k of the input is XORed into a 160-bit register at bit offset
+// 11*k mod 160, wrapping around, and the input length is XORed in
+// little-endian into the last 8 bytes of the result. OneDrive reports the
+// checksum in base64.
+package quickxorhash
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("quickxorhash: invalid state")
+
+// The size of a QuickXorHash checksum in bytes.
+const Size = 20
+
+// The blocksize of QuickXorHash in bytes.
+const BlockSize = 64
+
+const (
+	shift = 11
+
+	// period is the number of input bytes after which the bit offsets
+	// repeat, since 11 and 160 are coprime.
+	period = 8 * Size
+)
+
+// The state format is
+//
+//	"bqxh" || version || uint64 big-endian length || 160 bytes of accumulated input
+const (
+	stateMagic   = "bqxh"
+	stateVersion = 1
+	stateSize    = len(stateMagic) + 1 + 8 + period
+)
+
+// Digest represents the partial evaluation of a checksum. Input bytes at
+// the same position modulo the period land at the same bit offset, so they
+// are only XORed together while writing and placed in the register by Sum.
+type Digest struct {
+	x   [period]byte
+	len uint64
+}
+
+// New returns a new hash.Hash computing the QuickXorHash checksum.
+func New() *Digest {
+	return new(Digest)
+}
+
+// NewFromState returns a new hash.Hash computing the QuickXorHash checksum
+// from existing state.
+func NewFromState(state []byte) *Digest {
+	d := new(Digest)
+	d.SetState(state)
+	return d
+}
+
+func (d *Digest) Reset() {
+	*d = Digest{}
+}
+
+func (d *Digest) Size() int { return Size }
+
+func (d *Digest) BlockSize() int { return BlockSize }
+
+func (d *Digest) Write(p []byte) (int, error) {
+	nn := len(p)
+	off := int(d.len % period)
+	d.len += uint64(nn)
+
+	for len(p) > 0 {
+		n := period - off
+		if n > len(p) {
+			n = len(p)
+		}
+		x := d.x[off : off+n]
+		for i, b := range p[:n] {
+			x[i] ^= b
+		}
+		p = p[n:]
+		off = 0
+	}
+
+	return nn, nil
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *Digest) GetState() []byte {
+	b := make([]byte, 0, stateSize)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = binary.BigEndian.AppendUint64(b, d.len)
+	b = append(b, d.x[:]...)
+	return b
+}
+
+// SetState restores the digest from state returned by GetState. It returns
+// ErrInvalidState and leaves the digest unchanged if state is not valid.
+func (d *Digest) SetState(state []byte) error {
+	if len(state) != stateSize || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	d.len = binary.BigEndian.Uint64(p)
+	copy(d.x[:], p[8:])
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *Digest) Clone() *Digest {
+	c := *d
+	return &c
+}
+
+func (d *Digest) Sum(in []byte) []byte {
+	hash := d.checkSum()
+	return append(in, hash[:]...)
+}
+
+func (d *Digest) checkSum() [Size]byte {
+	var h [Size]byte
+
+	for i, b := range d.x {
+		if b == 0 {
+			continue
+		}
+		bit := i * shift % period
+		v := uint16(b) << (bit % 8)
+		h[bit/8] ^= byte(v)
+		h[(bit/8+1)%Size] ^= byte(v >> 8)
+	}
+
+	var l [8]byte
+	binary.LittleEndian.PutUint64(l[:], d.len)
+	for i, b := range l {
+		h[Size-8+i] ^= b
+	}
+
+	return h
+}
+
+// Sum returns the QuickXorHash checksum of the data.
+func Sum(data []byte) [Size]byte {
+	var d Digest
+	d.Write(data)
+	return d.checkSum()
+}
@@ -0,0 +1,89 @@
+package quickxorhash
+
+import (
+	"bytes"
+	"encoding/base64"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*Digest)(nil)
+
+func testData(n, mul, add int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*mul + add)
+	}
+	return data
+}
+
+var golden = []struct {
+	in  []byte
+	out string
+}{
+	{nil, "AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+	{[]byte{0}, "AAAAAAAAAAAAAAAAAQAAAAAAAAA="},
+	{[]byte("a"), "YQAAAAAAAAAAAAAAAQAAAAAAAAA="},
+	{[]byte("hello world"), "aCgDG9jwBhDc4Q1yawMZAAAAAAA="},
+	{testData(1000, 7, 0), "1+af4JAt6vicGNPjpE3HUFtNbW0="},
+	{testData(100000, 13, 5), "kuC2u5ZL9KvS/2cURFh29KLgrl4="},
+}
+
+func TestGolden(t *testing.T) {
+	for _, g := range golden {
+		sum := Sum(g.in)
+		if s := base64.StdEncoding.EncodeToString(sum[:]); s != g.out {
+			t.Fatalf("Sum(%d bytes) = %s want %s", len(g.in), s, g.out)
+		}
+
+		d := New()
+		for i := 0; i < len(g.in); i += 37 {
+			end := i + 37
+			if end > len(g.in) {
+				end = len(g.in)
+			}
+			d.Write(g.in[i:end])
+		}
+		if s := base64.StdEncoding.EncodeToString(d.Sum(nil)); s != g.out {
+			t.Fatalf("chunked Sum(%d bytes) = %s want %s", len(g.in), s, g.out)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	data := testData(1000, 7, 0)
+	want := Sum(data)
+
+	for _, split := range []int{0, 1, 159, 160, 500, 1000} {
+		d := New()
+		d.Write(data[:split])
+
+		r := NewFromState(d.GetState())
+		r.Write(data[split:])
+		if !bytes.Equal(r.Sum(nil), want[:]) {
+			t.Fatalf("%d: resumed checksum mismatch", split)
+		}
+
+		c := d.Clone()
+		c.Write(data[split:])
+		if !bytes.Equal(c.Sum(nil), want[:]) {
+			t.Fatalf("%d: cloned checksum mismatch", split)
+		}
+	}
+
+	d := New()
+	d.Write(data)
+	state := d.GetState()
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"truncated": state[:len(state)-1],
+		"version":   append(append([]byte(stateMagic), 2), state[len(stateMagic)+1:]...),
+	} {
+		if err := d.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if !bytes.Equal(d.Sum(nil), want[:]) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
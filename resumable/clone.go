@@ -0,0 +1,36 @@
+package resumable
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrNotClonable is returned by Clone for hashes it cannot copy.
+var ErrNotClonable = errors.New("resumable: hash cannot be cloned")
+
+var resumableType = reflect.TypeOf((*Resumable)(nil)).Elem()
+
+// Clone returns an independent copy of h. Hashes with a Clone method
+// returning their own type, like the digests of the better* packages, are
+// copied directly; any other hash whose concrete type is a pointer is copied
+// by restoring a new value of that type from h.GetState().
+func Clone(h Resumable) (Resumable, error) {
+	v := reflect.ValueOf(h)
+
+	if m := v.MethodByName("Clone"); m.IsValid() {
+		if t := m.Type(); t.NumIn() == 0 && t.NumOut() == 1 && t.Out(0).Implements(resumableType) {
+			return m.Call(nil)[0].Interface().(Resumable), nil
+		}
+	}
+
+	if v.Kind() != reflect.Ptr {
+		return nil, ErrNotClonable
+	}
+
+	c := reflect.New(v.Type().Elem()).Interface().(Resumable)
+	if err := c.SetState(h.GetState()); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,43 @@
+package resumable
+
+import (
+	"bytes"
+	"github.com/koofr/go-cryptoutils/bettermd5"
+	"hash"
+	"io"
+	"testing"
+)
+
+// stateOnly hides the Clone method of the wrapped digest.
+type stateOnly struct {
+	*bettermd5.BetterDigest
+}
+
+func (s *stateOnly) SetState(state []byte) error {
+	if s.BetterDigest == nil {
+		s.BetterDigest = bettermd5.New()
+	}
+	return s.BetterDigest.SetState(state)
+}
+
+func (s *stateOnly) Clone() hash.Hash { return s }
+
+func TestClone(t *testing.T) {
+	for _, h := range []Resumable{bettermd5.New(), &stateOnly{bettermd5.New()}} {
+		io.WriteString(h, "hello ")
+
+		c, err := Clone(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(h, "there")
+		io.WriteString(c, "world")
+
+		if want := algorithms["md5"]([]byte("hello world")); !bytes.Equal(c.Sum(nil), want) {
+			t.Fatalf("%T: clone = %x want %x", h, c.Sum(nil), want)
+		}
+		if want := algorithms["md5"]([]byte("hello there")); !bytes.Equal(h.Sum(nil), want) {
+			t.Fatalf("%T: original = %x want %x", h, h.Sum(nil), want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package resumable
+
+import (
+	"io"
+)
+
+// CheckpointFunc is called by HashingReader and HashingWriter with the
+// number of bytes hashed so far and the state of the hash at that offset.
+type CheckpointFunc func(offset uint64, state []byte) error
+
+// checkpointer hashes data and calls fn each time the total crosses a
+// multiple of every.
+type checkpointer struct {
+	h     Resumable
+	every uint64
+	fn    CheckpointFunc
+	n     uint64
+}
+
+func (c *checkpointer) hash(p []byte) error {
+	if c.every == 0 || c.fn == nil {
+		c.h.Write(p)
+		c.n += uint64(len(p))
+		return nil
+	}
+
+	for len(p) > 0 {
+		m := c.every - c.n%c.every
+		if uint64(len(p)) < m {
+			c.h.Write(p)
+			c.n += uint64(len(p))
+			break
+		}
+		c.h.Write(p[:m])
+		c.n += m
+		p = p[m:]
+		if err := c.fn(c.n, c.h.GetState()); err != nil {
+			// Keep the hash in step with the data that went through.
+			c.h.Write(p)
+			c.n += uint64(len(p))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HashingReader hashes everything read through it.
+type HashingReader struct {
+	r io.Reader
+	c checkpointer
+}
+
+// NewHashingReader returns a reader that reads from r and writes everything
+// read to h, calling fn with the state of h every `every` bytes. A zero every
+// or nil fn disables the callback. An error from fn is returned by Read; the
+// bytes read are hashed regardless.
+func NewHashingReader(r io.Reader, h Resumable, every uint64, fn CheckpointFunc) *HashingReader {
+	return &HashingReader{
+		r: r,
+		c: checkpointer{h: h, every: every, fn: fn},
+	}
+}
+
+func (r *HashingReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if n > 0 {
+		if cerr := r.c.hash(p[:n]); cerr != nil {
+			return n, cerr
+		}
+	}
+	return
+}
+
+// Offset returns the number of bytes hashed so far.
+func (r *HashingReader) Offset() uint64 {
+	return r.c.n
+}
+
+// HashingWriter hashes everything written through it.
+type HashingWriter struct {
+	w io.Writer
+	c checkpointer
+}
+
+// NewHashingWriter returns a writer that writes to w and hashes every byte
+// w accepted into h, calling fn with the state of h every `every` bytes. A
+// zero every or nil fn disables the callback. An error from fn is returned
+// by Write; the bytes written are hashed regardless.
+func NewHashingWriter(w io.Writer, h Resumable, every uint64, fn CheckpointFunc) *HashingWriter {
+	return &HashingWriter{
+		w: w,
+		c: checkpointer{h: h, every: every, fn: fn},
+	}
+}
+
+func (w *HashingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	if n > 0 {
+		if cerr := w.c.hash(p[:n]); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return
+}
+
+// Offset returns the number of bytes hashed so far.
+func (w *HashingWriter) Offset() uint64 {
+	return w.c.n
+}
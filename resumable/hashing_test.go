@@ -0,0 +1,85 @@
+package resumable
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestHashingReader(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 3)
+	}
+
+	h, _ := New("sha256")
+	var offsets []uint64
+	r := NewHashingReader(bytes.NewReader(data), h, 3000, func(offset uint64, state []byte) error {
+		offsets = append(offsets, offset)
+
+		resumed, _ := New("sha256")
+		if err := resumed.SetState(state); err != nil {
+			return err
+		}
+		resumed.Write(data[offset:])
+		if !bytes.Equal(resumed.Sum(nil), algorithms["sha256"](data)) {
+			t.Fatalf("checkpoint at %d: checksum mismatch", offset)
+		}
+		return nil
+	})
+
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.Sum(nil), algorithms["sha256"](data)) || r.Offset() != uint64(len(data)) {
+		t.Fatal("reader checksum mismatch")
+	}
+	if len(offsets) != 3 || offsets[0] != 3000 || offsets[2] != 9000 {
+		t.Fatalf("offsets = %v", offsets)
+	}
+}
+
+type shortWriter struct {
+	bytes.Buffer
+	max int
+}
+
+var errShort = errors.New("short write")
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		n, _ := w.Buffer.Write(p[:w.max])
+		return n, errShort
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestHashingWriter(t *testing.T) {
+	h, _ := New("md5")
+	sw := &shortWriter{max: 10}
+	errCheckpoint := errors.New("checkpoint failed")
+	w := NewHashingWriter(sw, h, 4, func(offset uint64, state []byte) error {
+		if offset == 8 {
+			return errCheckpoint
+		}
+		return nil
+	})
+
+	if n, err := w.Write([]byte("abcdef")); n != 6 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if _, err := w.Write([]byte("ghij")); err != errCheckpoint {
+		t.Fatalf("Write: err = %v want checkpoint error", err)
+	}
+	if n, err := w.Write([]byte("0123456789")); n != 10 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if n, err := w.Write([]byte("more than ten bytes")); n != 10 || err != errShort {
+		t.Fatalf("short Write = %d, %v", n, err)
+	}
+
+	if !bytes.Equal(h.Sum(nil), algorithms["md5"](sw.Bytes())) || w.Offset() != uint64(sw.Len()) {
+		t.Fatal("writer hashed bytes that were not written")
+	}
+}
@@ -0,0 +1,148 @@
+package resumable
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koofr/go-cryptoutils/internal/hashstate"
+)
+
+// ErrInvalidState is returned by MultiHasher.SetState when the state is not
+// valid for the hasher.
+var ErrInvalidState = errors.New("resumable: invalid state")
+
+// MultiHasher feeds everything written to it to several resumable hashes and
+// saves and restores their states together.
+type MultiHasher struct {
+	names  []string
+	hashes []Resumable
+}
+
+// NewMultiHasher returns a MultiHasher computing the registered hashes
+// named by names. It returns an error if a name is unknown or repeated.
+func NewMultiHasher(names ...string) (*MultiHasher, error) {
+	m := &MultiHasher{
+		names:  append([]string(nil), names...),
+		hashes: make([]Resumable, len(names)),
+	}
+
+	for i, name := range names {
+		for _, other := range names[:i] {
+			if other == name {
+				return nil, fmt.Errorf("resumable: hash %q given twice", name)
+			}
+		}
+
+		h, err := New(name)
+		if err != nil {
+			return nil, err
+		}
+		m.hashes[i] = h
+	}
+
+	return m, nil
+}
+
+// Write writes p to every hash. It never returns an error.
+func (m *MultiHasher) Write(p []byte) (int, error) {
+	for _, h := range m.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Reset resets every hash.
+func (m *MultiHasher) Reset() {
+	for _, h := range m.hashes {
+		h.Reset()
+	}
+}
+
+// Names returns the names of the hashes in the order they were given.
+func (m *MultiHasher) Names() []string {
+	return append([]string(nil), m.names...)
+}
+
+// Hash returns the hash named name, or nil if m does not compute it.
+func (m *MultiHasher) Hash(name string) Resumable {
+	for i, n := range m.names {
+		if n == name {
+			return m.hashes[i]
+		}
+	}
+	return nil
+}
+
+// Sums returns the current checksum of every hash by name.
+func (m *MultiHasher) Sums() map[string][]byte {
+	sums := make(map[string][]byte, len(m.hashes))
+	for i, h := range m.hashes {
+		sums[m.names[i]] = h.Sum(nil)
+	}
+	return sums
+}
+
+// The state format is
+//
+//	"rmlt" || version || per hash: uvarint length || name || uvarint length || state
+//
+// with the hashes in the order they were given.
+const (
+	multiMagic   = "rmlt"
+	multiVersion = 1
+)
+
+// GetState returns the states of all hashes as one blob, to be restored by
+// SetState.
+func (m *MultiHasher) GetState() []byte {
+	state := make([]byte, 0, 256)
+	state = append(state, multiMagic...)
+	state = append(state, multiVersion)
+
+	for i, h := range m.hashes {
+		state = hashstate.AppendField(state, []byte(m.names[i]))
+		state = hashstate.AppendField(state, h.GetState())
+	}
+
+	return state
+}
+
+// SetState restores all hashes from state returned by GetState of a
+// MultiHasher computing the same hashes in the same order. Either every hash
+// is restored or, on error, none is.
+func (m *MultiHasher) SetState(state []byte) error {
+	if len(state) < len(multiMagic)+1 || string(state[:len(multiMagic)]) != multiMagic || state[len(multiMagic)] != multiVersion {
+		return ErrInvalidState
+	}
+	state = state[len(multiMagic)+1:]
+
+	hashes := make([]Resumable, len(m.hashes))
+
+	for i, name := range m.names {
+		var n, s []byte
+		var ok bool
+
+		if n, state, ok = hashstate.ConsumeField(state); !ok || string(n) != name {
+			return ErrInvalidState
+		}
+		if s, state, ok = hashstate.ConsumeField(state); !ok {
+			return ErrInvalidState
+		}
+
+		h, err := New(name)
+		if err != nil {
+			return err
+		}
+		if err := h.SetState(s); err != nil {
+			return err
+		}
+		hashes[i] = h
+	}
+
+	if len(state) != 0 {
+		return ErrInvalidState
+	}
+
+	m.hashes = hashes
+
+	return nil
+}
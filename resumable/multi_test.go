@@ -0,0 +1,83 @@
+package resumable
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMultiHasher(t *testing.T) {
+	names := []string{"md5", "sha1", "sha256"}
+
+	m, err := NewMultiHasher(names...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(m, "hello ")
+	state := m.GetState()
+
+	m2, _ := NewMultiHasher(names...)
+	if err := m2.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(m2, "world")
+
+	sums := m2.Sums()
+	for _, name := range names {
+		if want := algorithms[name]([]byte("hello world")); !bytes.Equal(sums[name], want) {
+			t.Fatalf("%s = %x want %x", name, sums[name], want)
+		}
+		if !bytes.Equal(m2.Hash(name).Sum(nil), sums[name]) {
+			t.Fatalf("Hash(%s) does not match Sums", name)
+		}
+	}
+	if m2.Hash("sha512") != nil {
+		t.Fatal("Hash(sha512) should be nil")
+	}
+
+	if _, err := NewMultiHasher("md5", "md5"); err == nil {
+		t.Fatal("repeated name: expected error")
+	}
+	if _, err := NewMultiHasher("nope"); err == nil {
+		t.Fatal("unknown name: expected error")
+	}
+}
+
+func TestMultiHasherSetStateAtomic(t *testing.T) {
+	m, _ := NewMultiHasher("md5", "sha1")
+	io.WriteString(m, "keep")
+	want := m.Sums()
+
+	other, _ := NewMultiHasher("md5", "sha256")
+	good, _ := NewMultiHasher("md5", "sha1")
+	io.WriteString(good, "different")
+	state := good.GetState()
+
+	for name, bad := range map[string][]byte{
+		"other hashes":    other.GetState(),
+		"truncated":       state[:len(state)-1],
+		"trailing bytes":  append(append([]byte(nil), state...), 0),
+		"no header":       state[len(multiMagic)+1:],
+		"unknown version": append(append([]byte(multiMagic), multiVersion+1), state[len(multiMagic)+1:]...),
+	} {
+		if err := m.SetState(bad); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	// The sha1 state has an unknown version, the md5 one must not be
+	// restored either.
+	corrupt := append([]byte(nil), state...)
+	corrupt[bytes.Index(corrupt, []byte("bsh1"))+4]++
+	if err := m.SetState(corrupt); err == nil {
+		t.Fatal("corrupt sha1 state: expected error")
+	}
+
+	got := m.Sums()
+	for name := range want {
+		if !bytes.Equal(got[name], want[name]) {
+			t.Fatalf("failed SetState changed %s", name)
+		}
+	}
+}
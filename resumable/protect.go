@@ -0,0 +1,201 @@
+package resumable
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var (
+	// ErrStateAuthentication is returned by StateProtector.Open for
+	// encrypted states that were modified, sealed with another key or
+	// context, or not encrypted at all.
+	ErrStateAuthentication = errors.New("resumable: state authentication failed")
+
+	// ErrStateChecksum is returned by StateProtector.Open for checksummed
+	// states that were corrupted.
+	ErrStateChecksum = errors.New("resumable: state checksum mismatch")
+)
+
+// The sealed state format is
+//
+//	"bpst" || version || mode || body
+//
+// where the body is nonce || AES-GCM ciphertext of the state, with the
+// header and the context as additional data, in encrypted mode, and
+// state || CRC-32C of header, context and state in checksummed mode, with
+// the CRC in big-endian.
+const (
+	sealMagic   = "bpst"
+	sealVersion = 1
+	sealHeader  = len(sealMagic) + 2
+
+	sealEncrypted   = 1
+	sealChecksummed = 2
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// StateProtector seals serialized hash states for storage the application
+// does not trust, and opens them again. In encrypted mode states are
+// encrypted and authenticated with AES-GCM, so they can be neither read nor
+// modified without the key. In checksummed mode they are stored in the
+// clear with a CRC-32C, which detects accidental corruption but not
+// deliberate tampering.
+//
+// Sealing and opening take a context, such as the name of the file being
+// hashed, which has to match: a state sealed for one file does not open
+// for another. The context is not stored in the sealed state.
+type StateProtector struct {
+	aead cipher.AEAD
+}
+
+// NewStateEncrypter returns a StateProtector that encrypts states with
+// AES-GCM under key, which must be 16, 24 or 32 bytes long.
+func NewStateEncrypter(key []byte) (*StateProtector, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StateProtector{aead: aead}, nil
+}
+
+// NewStateChecksummer returns a StateProtector that only checksums states,
+// to detect corruption.
+func NewStateChecksummer() *StateProtector {
+	return &StateProtector{}
+}
+
+// Encrypted reports whether p encrypts states.
+func (p *StateProtector) Encrypted() bool {
+	return p.aead != nil
+}
+
+// Seal returns state sealed for context.
+func (p *StateProtector) Seal(state, context []byte) []byte {
+	if p.aead == nil {
+		b := make([]byte, 0, sealHeader+len(state)+4)
+		b = append(b, sealMagic...)
+		b = append(b, sealVersion, sealChecksummed)
+		b = append(b, state...)
+		return binary.BigEndian.AppendUint32(b, checksum(b, context))
+	}
+
+	nonceSize := p.aead.NonceSize()
+	b := make([]byte, sealHeader+nonceSize, sealHeader+nonceSize+len(state)+p.aead.Overhead())
+	copy(b, sealMagic)
+	b[len(sealMagic)] = sealVersion
+	b[len(sealMagic)+1] = sealEncrypted
+
+	nonce := b[sealHeader:]
+	if _, err := rand.Read(nonce); err != nil {
+		panic("resumable: reading random nonce: " + err.Error())
+	}
+
+	return p.aead.Seal(b, nonce, state, additionalData(b[:sealHeader], context))
+}
+
+// Open returns the state sealed in sealed for context. It returns
+// ErrInvalidState if sealed is not a sealed state, ErrStateAuthentication
+// if p encrypts and sealed does not open, and ErrStateChecksum if p
+// checksums and sealed is corrupted. A checksumming StateProtector cannot
+// open encrypted states, and an encrypting one does not accept states that
+// are only checksummed.
+func (p *StateProtector) Open(sealed, context []byte) ([]byte, error) {
+	if len(sealed) < sealHeader || string(sealed[:len(sealMagic)]) != sealMagic || sealed[len(sealMagic)] != sealVersion {
+		return nil, ErrInvalidState
+	}
+	mode := sealed[len(sealMagic)+1]
+
+	if p.aead == nil {
+		if mode != sealChecksummed || len(sealed) < sealHeader+4 {
+			return nil, ErrInvalidState
+		}
+		body := sealed[:len(sealed)-4]
+		if binary.BigEndian.Uint32(sealed[len(body):]) != checksum(body, context) {
+			return nil, ErrStateChecksum
+		}
+		return append([]byte(nil), body[sealHeader:]...), nil
+	}
+
+	if mode != sealEncrypted {
+		return nil, ErrStateAuthentication
+	}
+
+	nonceSize := p.aead.NonceSize()
+	if len(sealed) < sealHeader+nonceSize+p.aead.Overhead() {
+		return nil, ErrStateAuthentication
+	}
+	nonce := sealed[sealHeader : sealHeader+nonceSize]
+
+	state, err := p.aead.Open(nil, nonce, sealed[sealHeader+nonceSize:], additionalData(sealed[:sealHeader], context))
+	if err != nil {
+		return nil, ErrStateAuthentication
+	}
+
+	return state, nil
+}
+
+// Protect returns h with GetState and SetState sealing and opening the
+// states of h for context.
+func (p *StateProtector) Protect(h Resumable, context []byte) *ProtectedHash {
+	return &ProtectedHash{
+		Resumable: h,
+		p:         p,
+		context:   append([]byte(nil), context...),
+	}
+}
+
+func additionalData(header, context []byte) []byte {
+	return append(append([]byte(nil), header...), context...)
+}
+
+func checksum(body, context []byte) uint32 {
+	crc := crc32.Update(0, castagnoli, body[:sealHeader])
+	crc = crc32.Update(crc, castagnoli, context)
+	return crc32.Update(crc, castagnoli, body[sealHeader:])
+}
+
+// ProtectedHash is a resumable hash whose states are sealed by a
+// StateProtector. It is created by StateProtector.Protect.
+type ProtectedHash struct {
+	Resumable
+
+	p       *StateProtector
+	context []byte
+}
+
+// GetState returns the state of the hash, sealed.
+func (h *ProtectedHash) GetState() []byte {
+	return h.p.Seal(h.Resumable.GetState(), h.context)
+}
+
+// SetState opens state and restores the hash from it. It returns the error
+// of StateProtector.Open if state does not open, or that of the hash if it
+// rejects the state, and leaves the hash unchanged in either case.
+func (h *ProtectedHash) SetState(state []byte) error {
+	if h.p == nil {
+		return ErrInvalidState
+	}
+
+	s, err := h.p.Open(state, h.context)
+	if err != nil {
+		return err
+	}
+
+	return h.Resumable.SetState(s)
+}
+
+// Unwrap returns the underlying hash.
+func (h *ProtectedHash) Unwrap() Resumable {
+	return h.Resumable
+}
@@ -0,0 +1,120 @@
+package resumable
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/koofr/go-cryptoutils/bettersha256"
+	"testing"
+)
+
+var stateKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestStateProtector(t *testing.T) {
+	enc, err := NewStateEncrypter(stateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := NewStateChecksummer()
+	if !enc.Encrypted() || sum.Encrypted() {
+		t.Fatal("wrong modes")
+	}
+
+	d := bettersha256.New()
+	d.Write([]byte("some data hashed before the state was saved"))
+	state := d.GetState()
+	ctx := []byte("file 1")
+
+	for _, p := range []*StateProtector{enc, sum} {
+		sealed := p.Seal(state, ctx)
+		if got, err := p.Open(sealed, ctx); err != nil || !bytes.Equal(got, state) {
+			t.Fatalf("encrypted %v: Open = %x, %v", p.Encrypted(), got, err)
+		}
+		if p.Encrypted() == bytes.Contains(sealed, state) {
+			t.Fatalf("encrypted %v: state in the clear %v", p.Encrypted(), !p.Encrypted())
+		}
+
+		wantErr := ErrStateChecksum
+		if p.Encrypted() {
+			wantErr = ErrStateAuthentication
+		}
+		for i := sealHeader; i < len(sealed); i++ {
+			bad := append([]byte(nil), sealed...)
+			bad[i] ^= 0x10
+			if _, err := p.Open(bad, ctx); err != wantErr {
+				t.Fatalf("encrypted %v: flipped byte %d: err = %v", p.Encrypted(), i, err)
+			}
+		}
+		if _, err := p.Open(sealed, []byte("file 2")); err != wantErr {
+			t.Fatalf("encrypted %v: other context: err = %v", p.Encrypted(), err)
+		}
+
+		for name, bad := range map[string][]byte{
+			"empty":   nil,
+			"magic":   append([]byte("nope"), sealed[4:]...),
+			"version": append([]byte("bpst\x02"), sealed[5:]...),
+		} {
+			if _, err := p.Open(bad, ctx); err != ErrInvalidState {
+				t.Fatalf("encrypted %v: %s: err = %v", p.Encrypted(), name, err)
+			}
+		}
+	}
+
+	// Neither mode accepts the states of the other.
+	if _, err := enc.Open(sum.Seal(state, ctx), ctx); err != ErrStateAuthentication {
+		t.Fatalf("checksummed state opened by encrypter: err = %v", err)
+	}
+	if _, err := sum.Open(enc.Seal(state, ctx), ctx); err != ErrInvalidState {
+		t.Fatalf("encrypted state opened by checksummer: err = %v", err)
+	}
+
+	other, _ := NewStateEncrypter(stateKey[:16])
+	if _, err := other.Open(enc.Seal(state, ctx), ctx); err != ErrStateAuthentication {
+		t.Fatalf("other key: err = %v", err)
+	}
+	if bytes.Equal(enc.Seal(state, ctx), enc.Seal(state, ctx)) {
+		t.Fatal("sealing twice gave the same state")
+	}
+
+	if _, err := NewStateEncrypter(stateKey[:10]); err == nil {
+		t.Fatal("short key accepted")
+	}
+}
+
+func TestProtectedHash(t *testing.T) {
+	enc, _ := NewStateEncrypter(stateKey)
+	data := []byte("hello, world")
+
+	h := enc.Protect(bettersha256.New(), []byte("ctx"))
+	h.Write(data[:5])
+	state := h.GetState()
+
+	r := enc.Protect(bettersha256.New(), []byte("ctx"))
+	if err := r.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	r.Write(data[5:])
+	want := sha256.Sum256(data)
+	if !bytes.Equal(r.Sum(nil), want[:]) {
+		t.Fatal("resumed sum differs")
+	}
+
+	// Unprotected states, and those sealed for another context, are
+	// rejected and leave the hash as it was.
+	before := r.Unwrap().GetState()
+	for _, bad := range [][]byte{
+		bettersha256.New().GetState(),
+		enc.Protect(bettersha256.New(), []byte("other")).GetState(),
+		enc.Seal([]byte("not a sha256 state"), []byte("ctx")),
+	} {
+		if err := r.SetState(bad); err == nil {
+			t.Fatalf("state %x accepted", bad)
+		}
+		if !bytes.Equal(r.Unwrap().GetState(), before) {
+			t.Fatal("hash changed")
+		}
+	}
+
+	if _, err := Clone(h); err == nil {
+		t.Fatal("protected hash cloned")
+	}
+}
@@ -0,0 +1,73 @@
+package resumable
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"github.com/koofr/go-cryptoutils/bettermd4"
+	"io"
+	"testing"
+)
+
+var algorithms = map[string]func([]byte) []byte{
+	"md4":    func(b []byte) []byte { s := bettermd4.Sum(b); return s[:] },
+	"md5":    func(b []byte) []byte { s := md5.Sum(b); return s[:] },
+	"sha1":   func(b []byte) []byte { s := sha1.Sum(b); return s[:] },
+	"sha256": func(b []byte) []byte { s := sha256.Sum256(b); return s[:] },
+	"sha512": func(b []byte) []byte { s := sha512.Sum512(b); return s[:] },
+}
+
+func TestNew(t *testing.T) {
+	for name, sum := range algorithms {
+		h, err := New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		io.WriteString(h, "hello ")
+		state := h.GetState()
+
+		h2, _ := New(name)
+		if err := h2.SetState(state); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(h2, "world")
+
+		want := sum([]byte("hello world"))
+		if s := h2.Sum(nil); !bytes.Equal(s, want) {
+			t.Fatalf("%s = %x want %x", name, s, want)
+		}
+	}
+
+	if _, err := New("nope"); err == nil {
+		t.Fatal("New(nope): expected error")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-md5", func() Resumable {
+		h, _ := New("md5")
+		return h
+	})
+
+	if _, err := New("test-md5"); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, name := range Names() {
+		found = found || name == "test-md5"
+	}
+	if !found {
+		t.Fatalf("Names() = %v", Names())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate Register did not panic")
+		}
+	}()
+	Register("md5", func() Resumable { return nil })
+}
@@ -0,0 +1,74 @@
+package resumable
+
+import (
+	"bytes"
+	"encoding"
+)
+
+// stdlibMagics maps the magic of the states marshaled by the crypto/md5,
+// crypto/sha1 and crypto/sha256 hashes to the names their counterparts
+// here are registered under.
+var stdlibMagics = []struct {
+	magic string
+	name  string
+}{
+	{"md5\x01", "md5"},
+	{"sha\x01", "sha1"},
+	{"sha\x03", "sha256"},
+}
+
+// ImportStdlibState converts state marshaled by the MarshalBinary method of
+// a crypto/md5, crypto/sha1 or crypto/sha256 hash into a State of the hash
+// registered as "md5", "sha1" or "sha256", which can be restored with
+// State.New or stored like any other state. It returns ErrInvalidState if
+// blob is not such a state.
+func ImportStdlibState(blob []byte) (State, error) {
+	for _, m := range stdlibMagics {
+		if !bytes.HasPrefix(blob, []byte(m.magic)) {
+			continue
+		}
+
+		h, err := New(m.name)
+		if err != nil {
+			return State{}, err
+		}
+		if err := h.SetState(blob); err != nil {
+			return State{}, ErrInvalidState
+		}
+
+		return GetNamedState(m.name, h), nil
+	}
+
+	return State{}, ErrInvalidState
+}
+
+// ExportStdlibState converts s, the state of an md5, sha1 or sha256 hash,
+// into the form marshaled by crypto/md5, crypto/sha1 or crypto/sha256, to be
+// restored with the UnmarshalBinary method of a hash of those packages. It
+// returns ErrInvalidState if s is not valid or its hash has no such form.
+func ExportStdlibState(s State) ([]byte, error) {
+	if !isStdlibHash(s.Hash) {
+		return nil, ErrInvalidState
+	}
+
+	h, err := s.New()
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, ErrInvalidState
+	}
+
+	return m.MarshalBinary()
+}
+
+func isStdlibHash(name string) bool {
+	for _, m := range stdlibMagics {
+		if m.name == name {
+			return true
+		}
+	}
+	return false
+}
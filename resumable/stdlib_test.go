@@ -0,0 +1,90 @@
+package resumable
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding"
+	"hash"
+	"strings"
+	"testing"
+)
+
+func TestStdlibState(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 30))
+
+	for name, newStd := range map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+	} {
+		for _, n := range []int{0, 3, 64, 100} {
+			std := newStd()
+			std.Write(data[:n])
+			blob, err := std.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := ImportStdlibState(blob)
+			if err != nil {
+				t.Fatalf("%s %d: ImportStdlibState: %v", name, n, err)
+			}
+			if s.Hash != name {
+				t.Fatalf("%s %d: hash = %q", name, n, s.Hash)
+			}
+
+			h, _ := New(name)
+			h.Write(data[:n])
+			if !bytes.Equal(s.State, h.GetState()) {
+				t.Fatalf("%s %d: state = %x want %x", name, n, s.State, h.GetState())
+			}
+
+			exported, err := ExportStdlibState(s)
+			if err != nil {
+				t.Fatalf("%s %d: ExportStdlibState: %v", name, n, err)
+			}
+			if !bytes.Equal(exported, blob) {
+				t.Fatalf("%s %d: exported = %x want %x", name, n, exported, blob)
+			}
+
+			restored := newStd()
+			if err := restored.(encoding.BinaryUnmarshaler).UnmarshalBinary(exported); err != nil {
+				t.Fatal(err)
+			}
+			restored.Write(data[n:])
+			std.Write(data[n:])
+			if !bytes.Equal(restored.Sum(nil), std.Sum(nil)) {
+				t.Fatalf("%s %d: sum after export differs", name, n)
+			}
+		}
+	}
+}
+
+func TestStdlibStateInvalid(t *testing.T) {
+	std := sha256.New()
+	blob, _ := std.(encoding.BinaryMarshaler).MarshalBinary()
+
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"sha224":    append([]byte("sha\x02"), blob[4:]...),
+		"truncated": blob[:len(blob)-1],
+		"ours":      md5State(),
+	} {
+		if _, err := ImportStdlibState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	h, _ := New("crc32")
+	for name, bad := range map[string]State{
+		"unregistered":  {Hash: "nope", State: md5State()},
+		"invalid state": {Hash: "md5", State: []byte("bmd5")},
+		"other hash":    GetNamedState("crc32", h),
+	} {
+		if _, err := ExportStdlibState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
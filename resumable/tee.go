@@ -0,0 +1,191 @@
+package resumable
+
+import (
+	"fmt"
+	"io"
+)
+
+// TeeWriter writes everything written to it to several destinations and
+// hashes it with one or more resumable hashes. Unlike io.MultiWriter, it
+// keeps a MultiHasher per destination covering exactly the bytes that
+// destination accepted, so that after a failure a replication can resume
+// every destination from what it really persisted.
+type TeeWriter struct {
+	names  []string
+	hasher *MultiHasher
+	hashed int64
+	dests  []*teeDest
+	err    *WriteError
+}
+
+type teeDest struct {
+	w       io.Writer
+	hasher  *MultiHasher
+	written int64
+}
+
+// TeeState is the state of the hashes of a TeeWriter or one of its
+// destinations: the number of bytes hashed and the MultiHasher state of the
+// hashes over them.
+type TeeState struct {
+	Written int64
+	State   []byte
+}
+
+// WriteError is returned by TeeWriter.Write when a destination fails or
+// accepts fewer bytes than given.
+type WriteError struct {
+	// Dest is the index of the destination that failed.
+	Dest int
+	// Written is the number of bytes Dest accepted in total, all of which
+	// are covered by its state.
+	Written int64
+	// Hashed is the number of bytes accepted by every destination, all of
+	// which are covered by the state of the TeeWriter.
+	Hashed int64
+	Err    error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("resumable: destination %d failed after %d bytes: %v", e.Dest, e.Written, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// NewTeeWriter returns a TeeWriter writing to dests and computing the
+// registered hashes named by names. It returns an error if a name is
+// unknown or repeated.
+func NewTeeWriter(names []string, dests ...io.Writer) (*TeeWriter, error) {
+	hasher, err := NewMultiHasher(names...)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TeeWriter{
+		names:  append([]string(nil), names...),
+		hasher: hasher,
+		dests:  make([]*teeDest, len(dests)),
+	}
+
+	for i, w := range dests {
+		h, _ := NewMultiHasher(names...)
+		t.dests[i] = &teeDest{w: w, hasher: h}
+	}
+
+	return t, nil
+}
+
+// Write writes p to every destination and hashes the bytes each one
+// accepts. If a destination fails, the hashes of the TeeWriter only cover
+// the prefix of p accepted by every destination, and Write returns its
+// length and a *WriteError for the first destination that failed. Once a
+// destination has failed, Write writes nothing and returns the same error
+// until Resume is called, so that no destination receives a stream with
+// holes.
+func (t *TeeWriter) Write(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+
+	accepted := len(p)
+	for i, d := range t.dests {
+		n, err := d.w.Write(p)
+		if n < 0 || n > len(p) {
+			n, err = 0, fmt.Errorf("resumable: destination %d returned invalid count %d", i, n)
+		}
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+
+		d.hasher.Write(p[:n])
+		d.written += int64(n)
+		if n < accepted {
+			accepted = n
+		}
+
+		if err != nil && t.err == nil {
+			t.err = &WriteError{Dest: i, Written: d.written, Err: err}
+		}
+	}
+
+	t.hasher.Write(p[:accepted])
+	t.hashed += int64(accepted)
+
+	if t.err != nil {
+		t.err.Hashed = t.hashed
+		return accepted, t.err
+	}
+
+	return accepted, nil
+}
+
+// Err returns the error of the first destination that failed, or nil.
+func (t *TeeWriter) Err() error {
+	if t.err == nil {
+		return nil
+	}
+	return t.err
+}
+
+// Hashed returns the number of bytes accepted by every destination.
+func (t *TeeWriter) Hashed() int64 {
+	return t.hashed
+}
+
+// Sums returns the checksums of the bytes accepted by every destination.
+func (t *TeeWriter) Sums() map[string][]byte {
+	return t.hasher.Sums()
+}
+
+// State returns the state of the hashes of the bytes accepted by every
+// destination.
+func (t *TeeWriter) State() TeeState {
+	return TeeState{Written: t.hashed, State: t.hasher.GetState()}
+}
+
+// DestStates returns the state of the hashes of every destination, in the
+// order the destinations were given. The state of a destination covers
+// exactly the Written bytes it accepted. After a failure, the Written count
+// of a destination may run ahead of the Written count of State, which only
+// covers the bytes every destination accepted. Resume restarts every
+// destination from the offset of the state it is given, so a destination
+// that ran ahead must be rewound to that offset first.
+func (t *TeeWriter) DestStates() []TeeState {
+	states := make([]TeeState, len(t.dests))
+	for i, d := range t.dests {
+		states[i] = TeeState{Written: d.written, State: d.hasher.GetState()}
+	}
+	return states
+}
+
+// Resume restores the TeeWriter and every destination from s, returned by
+// State or DestStates of a TeeWriter computing the same hashes, and clears
+// any failure. The caller must have positioned every destination
+// s.Written bytes into its stream. Either everything is restored or, on
+// error, nothing is.
+func (t *TeeWriter) Resume(s TeeState) error {
+	if s.Written < 0 {
+		return ErrInvalidState
+	}
+
+	hashers := make([]*MultiHasher, len(t.dests)+1)
+	for i := range hashers {
+		h, _ := NewMultiHasher(t.names...)
+		if err := h.SetState(s.State); err != nil {
+			return err
+		}
+		hashers[i] = h
+	}
+
+	t.hasher = hashers[0]
+	t.hashed = s.Written
+	for i, d := range t.dests {
+		d.hasher = hashers[i+1]
+		d.written = s.Written
+	}
+	t.err = nil
+
+	return nil
+}
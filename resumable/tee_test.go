@@ -0,0 +1,165 @@
+package resumable
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// limitedWriter accepts limit bytes and then fails.
+type limitedWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+var errFull = errors.New("full")
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if room := w.limit - w.buf.Len(); len(p) > room {
+		w.buf.Write(p[:room])
+		return room, errFull
+	}
+	return w.buf.Write(p)
+}
+
+func TestTeeWriter(t *testing.T) {
+	names := []string{"md5", "sha256"}
+	var a, b bytes.Buffer
+
+	tw, err := NewTeeWriter(names, &a, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(tw, "hello ")
+	io.WriteString(tw, "world")
+
+	if a.String() != "hello world" || b.String() != "hello world" {
+		t.Fatalf("destinations got %q and %q", a.String(), b.String())
+	}
+	if tw.Hashed() != 11 || tw.Err() != nil {
+		t.Fatalf("Hashed = %d, Err = %v", tw.Hashed(), tw.Err())
+	}
+
+	sums := tw.Sums()
+	for _, name := range names {
+		if want := algorithms[name]([]byte("hello world")); !bytes.Equal(sums[name], want) {
+			t.Fatalf("%s = %x want %x", name, sums[name], want)
+		}
+	}
+
+	state := tw.State()
+	for i, s := range tw.DestStates() {
+		if s.Written != state.Written || !bytes.Equal(s.State, state.State) {
+			t.Fatalf("destination %d state differs", i)
+		}
+	}
+
+	if _, err := NewTeeWriter([]string{"nope"}, &a); err == nil {
+		t.Fatal("unknown name: expected error")
+	}
+}
+
+func TestTeeWriterFailure(t *testing.T) {
+	names := []string{"sha256"}
+	data := []byte("0123456789abcdefghij")
+
+	var good bytes.Buffer
+	bad := &limitedWriter{limit: 14}
+	tw, _ := NewTeeWriter(names, &good, bad)
+
+	if n, err := tw.Write(data[:10]); n != 10 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+
+	n, err := tw.Write(data[10:])
+	var werr *WriteError
+	if !errors.As(err, &werr) || !errors.Is(err, errFull) {
+		t.Fatalf("err = %v", err)
+	}
+	if n != 4 || werr.Dest != 1 || werr.Written != 14 || werr.Hashed != 14 {
+		t.Fatalf("n = %d, error = %+v", n, werr)
+	}
+
+	// Nothing more is written until Resume.
+	if n, err := tw.Write(data); n != 0 || err != werr {
+		t.Fatalf("Write after failure = %d, %v", n, err)
+	}
+	if good.Len() != 20 || bad.buf.Len() != 14 {
+		t.Fatalf("destinations hold %d and %d bytes", good.Len(), bad.buf.Len())
+	}
+
+	// Each state covers exactly the bytes persisted.
+	states := tw.DestStates()
+	for i, want := range []int{20, 14} {
+		if states[i].Written != int64(want) {
+			t.Fatalf("destination %d: Written = %d want %d", i, states[i].Written, want)
+		}
+		m, _ := NewMultiHasher(names...)
+		m.SetState(states[i].State)
+		if !bytes.Equal(m.Sums()["sha256"], algorithms["sha256"](data[:want])) {
+			t.Fatalf("destination %d: state does not cover the persisted bytes", i)
+		}
+	}
+	if !bytes.Equal(tw.Sums()["sha256"], algorithms["sha256"](data[:14])) {
+		t.Fatal("TeeWriter hashed bytes not accepted by every destination")
+	}
+
+	// Resume both destinations from what all of them persisted.
+	state := tw.State()
+	good.Truncate(int(state.Written))
+	bad.limit = 100
+	if err := tw.Resume(state); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := tw.Write(data[state.Written:]); n != 6 || err != nil {
+		t.Fatalf("Write after Resume = %d, %v", n, err)
+	}
+
+	want := algorithms["sha256"](data)
+	if !bytes.Equal(tw.Sums()["sha256"], want) || good.String() != string(data) || bad.buf.String() != string(data) {
+		t.Fatal("resumed replication mismatch")
+	}
+	for i, s := range tw.DestStates() {
+		if s.Written != 20 || !bytes.Equal(s.State, tw.State().State) {
+			t.Fatalf("destination %d state after Resume differs", i)
+		}
+	}
+}
+
+func TestTeeWriterShortWrite(t *testing.T) {
+	short := writerFunc(func(p []byte) (int, error) { return len(p) / 2, nil })
+	tw, _ := NewTeeWriter([]string{"md5"}, short)
+
+	n, err := tw.Write([]byte("abcd"))
+	if n != 2 || !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+}
+
+func TestTeeWriterResumeAtomic(t *testing.T) {
+	var a bytes.Buffer
+	tw, _ := NewTeeWriter([]string{"md5"}, &a)
+	io.WriteString(tw, "keep")
+	want := tw.State()
+
+	other, _ := NewTeeWriter([]string{"sha1"}, io.Discard)
+	for name, bad := range map[string]TeeState{
+		"other hashes":     other.State(),
+		"negative written": {Written: -1, State: want.State},
+		"corrupt":          {Written: 4, State: want.State[:len(want.State)-1]},
+	} {
+		if err := tw.Resume(bad); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	if s := tw.State(); s.Written != want.Written || !bytes.Equal(s.State, want.State) {
+		t.Fatal("failed Resume changed the TeeWriter")
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,133 @@
+package resumable
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidStateText is returned when decoding a state from text or JSON
+// that is not in the documented form.
+var ErrInvalidStateText = errors.New("resumable: invalid state text")
+
+// GetStateString returns the state of h as padded standard base64, for
+// storing in text columns and JSON strings.
+func GetStateString(h Resumable) string {
+	return base64.StdEncoding.EncodeToString(h.GetState())
+}
+
+// SetStateString restores h from state returned by GetStateString. The
+// padding may be left out. It returns ErrInvalidStateText if s is not
+// base64 and the error of h.SetState if the state is invalid.
+func SetStateString(h Resumable, s string) error {
+	state, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return ErrInvalidStateText
+	}
+
+	return h.SetState(state)
+}
+
+// State is the state of a resumable hash together with the name it is
+// registered under, so that it can be restored without knowing the hash in
+// advance.
+//
+// Its JSON form is an object with the name and the state in padded
+// standard base64,
+//
+//	{"hash":"sha256","state":"YnMyNQFq..."}
+//
+// which other languages can read with their JSON and base64 decoders, e.g.
+// in Python
+//
+//	doc = json.loads(text)
+//	name, state = doc["hash"], base64.b64decode(doc["state"])
+//
+// Its text form, used by MarshalText, is the name and the base64 state
+// separated by a colon, "sha256:YnMyNQFq...".
+//
+// The states of md4, md5, sha1, sha256 and sha512 start with a four-byte
+// magic ("bmd4", "bmd5", "bsh1", "bs25", "bs51") and a version byte of 1,
+// followed by the chaining words (4 bytes each, 8 for sha512), the number of
+// bytes hashed as 8 bytes, and the bytes hashed since the last full block.
+// The words and length are little-endian for md4 and md5 and big-endian for
+// the others. Other hashes document their formats in their packages.
+type State struct {
+	Hash  string
+	State []byte
+}
+
+// GetNamedState returns the state of h, which is registered under name.
+func GetNamedState(name string, h Resumable) State {
+	return State{Hash: name, State: h.GetState()}
+}
+
+// New returns a new hash of the registered name s.Hash restored from
+// s.State.
+func (s State) New() (Resumable, error) {
+	h, err := New(s.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.SetState(s.State); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+type jsonState struct {
+	Hash  string `json:"hash"`
+	State []byte `json:"state"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonState{Hash: s.Hash, State: s.State})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Besides the object produced
+// by MarshalJSON it accepts a string in the text form. It does not check
+// that the hash is registered or the state valid; New does.
+func (s *State) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return s.UnmarshalText([]byte(text))
+	}
+
+	var js jsonState
+	if err := json.Unmarshal(data, &js); err != nil || js.Hash == "" || js.State == nil {
+		return ErrInvalidStateText
+	}
+
+	s.Hash = js.Hash
+	s.State = js.State
+
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.Hash + ":" + base64.StdEncoding.EncodeToString(s.State)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. The padding of the
+// base64 may be left out.
+func (s *State) UnmarshalText(text []byte) error {
+	name, b64, ok := strings.Cut(string(text), ":")
+	if !ok || name == "" {
+		return ErrInvalidStateText
+	}
+
+	state, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(b64, "="))
+	if err != nil {
+		return ErrInvalidStateText
+	}
+
+	s.Hash = name
+	s.State = state
+
+	return nil
+}
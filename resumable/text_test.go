@@ -0,0 +1,110 @@
+package resumable
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// md5State is the state of md5 after "abc", laid out as State documents.
+func md5State() []byte {
+	b := []byte("bmd5\x01")
+	for _, w := range []uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476} {
+		b = binary.LittleEndian.AppendUint32(b, w)
+	}
+	b = binary.LittleEndian.AppendUint64(b, 3)
+	return append(b, "abc"...)
+}
+
+func TestStateString(t *testing.T) {
+	h, _ := New("md5")
+	io.WriteString(h, "abc")
+
+	s := GetStateString(h)
+	if want := base64.StdEncoding.EncodeToString(md5State()); s != want {
+		t.Fatalf("GetStateString = %s want %s", s, want)
+	}
+
+	for _, text := range []string{s, strings.TrimRight(s, "=")} {
+		r, _ := New("md5")
+		if err := SetStateString(r, text); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(r.Sum(nil), h.Sum(nil)) {
+			t.Fatal("restored sum differs")
+		}
+	}
+
+	r, _ := New("md5")
+	if err := SetStateString(r, "not base64!"); err != ErrInvalidStateText {
+		t.Fatalf("invalid base64: err = %v", err)
+	}
+	if err := SetStateString(r, "bm9wZQ"); err == nil {
+		t.Fatal("invalid state accepted")
+	}
+}
+
+func TestStateJSON(t *testing.T) {
+	h, _ := New("md5")
+	io.WriteString(h, "abc")
+	s := GetNamedState("md5", h)
+
+	b64 := base64.StdEncoding.EncodeToString(md5State())
+
+	j, err := json.Marshal(struct{ Checkpoint State }{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Checkpoint":{"hash":"md5","state":"` + b64 + `"}}`; string(j) != want {
+		t.Fatalf("JSON = %s want %s", j, want)
+	}
+
+	text, _ := s.MarshalText()
+	if want := "md5:" + b64; string(text) != want {
+		t.Fatalf("text = %s want %s", text, want)
+	}
+
+	for _, input := range []string{
+		`{"hash":"md5","state":"` + b64 + `"}`,
+		`"md5:` + b64 + `"`,
+		`"md5:` + strings.TrimRight(b64, "=") + `"`,
+	} {
+		var r State
+		if err := json.Unmarshal([]byte(input), &r); err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		d, err := r.New()
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if !bytes.Equal(d.Sum(nil), h.Sum(nil)) {
+			t.Fatalf("%s: restored sum differs", input)
+		}
+	}
+
+	for _, input := range []string{
+		`{"hash":"md5"}`,
+		`{"state":"` + b64 + `"}`,
+		`{"hash":"md5","state":"***"}`,
+		`"md5"`,
+		`":` + b64 + `"`,
+		`"md5:***"`,
+		`42`,
+	} {
+		var r State
+		if err := json.Unmarshal([]byte(input), &r); err == nil {
+			t.Fatalf("%s accepted", input)
+		}
+	}
+
+	if _, err := (State{Hash: "nope", State: md5State()}).New(); err == nil {
+		t.Fatal("unknown hash accepted")
+	}
+	if _, err := (State{Hash: "sha1", State: md5State()}).New(); err == nil {
+		t.Fatal("state of another hash accepted")
+	}
+}
@@ -0,0 +1,208 @@
+// Package sign signs and verifies large streams with Ed25519ph (RFC 8032)
+// or RSA-PSS over a resumable digest of the stream, so that signing or
+// verifying an export that takes hours can be checkpointed and resumed like
+// the hash itself.
+//
+// Ed25519 keys sign a SHA-512 digest as Ed25519ph; their signatures verify
+// with ed25519.VerifyWithOptions and crypto.SHA512, not with plain
+// ed25519.Verify. RSA keys sign with PSS and a salt as long as the digest.
+package sign
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/koofr/go-cryptoutils/resumable"
+	"io"
+)
+
+var (
+	// ErrInvalidState is returned by SetState when the state is not valid
+	// for the hash of the writer.
+	ErrInvalidState = errors.New("sign: invalid state")
+
+	// ErrUnsupportedKey is returned for keys other than Ed25519 and RSA keys.
+	ErrUnsupportedKey = errors.New("sign: unsupported key")
+
+	// ErrUnsupportedHash is returned for hashes that cannot be used with the
+	// key: anything but "sha512" for Ed25519, or anything but "sha256" and
+	// "sha512" for RSA.
+	ErrUnsupportedHash = errors.New("sign: unsupported hash")
+
+	// ErrVerification is returned by Verify when the signature does not
+	// match.
+	ErrVerification = errors.New("sign: verification failed")
+)
+
+var hashes = map[string]crypto.Hash{
+	"sha256": crypto.SHA256,
+	"sha512": crypto.SHA512,
+}
+
+// options returns the signer options for public keys of pub's type with the
+// hash registered as name.
+func options(pub crypto.PublicKey, name string) (crypto.SignerOpts, error) {
+	h, ok := hashes[name]
+	if !ok {
+		return nil, ErrUnsupportedHash
+	}
+
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		if h != crypto.SHA512 {
+			return nil, ErrUnsupportedHash
+		}
+		return &ed25519.Options{Hash: crypto.SHA512}, nil
+	case *rsa.PublicKey:
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+// SignerWriter hashes everything written to it and signs the digest. Its
+// state is the state of the hash and holds nothing secret.
+type SignerWriter struct {
+	h      resumable.Resumable
+	signer crypto.Signer
+	opts   crypto.SignerOpts
+}
+
+// NewSignerWriter returns a SignerWriter signing with signer and the
+// registered hash named hash. signer may be an ed25519.PrivateKey, an
+// *rsa.PrivateKey or any crypto.Signer with a public key of those types,
+// such as a key held in a hardware module.
+func NewSignerWriter(signer crypto.Signer, hash string) (*SignerWriter, error) {
+	opts, err := options(signer.Public(), hash)
+	if err != nil {
+		return nil, err
+	}
+
+	h, _ := resumable.New(hash)
+	return &SignerWriter{h: h, signer: signer, opts: opts}, nil
+}
+
+// Write hashes p. It never returns an error.
+func (w *SignerWriter) Write(p []byte) (int, error) {
+	return w.h.Write(p)
+}
+
+// GetState returns the state of the digest of everything written so far.
+func (w *SignerWriter) GetState() []byte {
+	return w.h.GetState()
+}
+
+// SetState restores the digest from state returned by GetState of a
+// SignerWriter or VerifierWriter with the same hash. It returns
+// ErrInvalidState and leaves the writer unchanged if state is not valid.
+func (w *SignerWriter) SetState(state []byte) error {
+	return setState(w.h, state)
+}
+
+// Sign returns the signature of everything written so far. random is the
+// source of the PSS salt and is ignored by Ed25519; nil uses crypto/rand.
+// More data can be written and signed afterwards.
+func (w *SignerWriter) Sign(random io.Reader) ([]byte, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+
+	sig, err := w.signer.Sign(random, w.h.Sum(nil), w.opts)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	return sig, nil
+}
+
+// VerifierWriter hashes everything written to it and verifies a signature
+// of the digest.
+type VerifierWriter struct {
+	h    resumable.Resumable
+	pub  crypto.PublicKey
+	opts crypto.SignerOpts
+}
+
+// NewVerifierWriter returns a VerifierWriter verifying signatures by pub, an
+// ed25519.PublicKey or *rsa.PublicKey, made with the registered hash named
+// hash.
+func NewVerifierWriter(pub crypto.PublicKey, hash string) (*VerifierWriter, error) {
+	opts, err := options(pub, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	h, _ := resumable.New(hash)
+	return &VerifierWriter{h: h, pub: pub, opts: opts}, nil
+}
+
+// Write hashes p. It never returns an error.
+func (w *VerifierWriter) Write(p []byte) (int, error) {
+	return w.h.Write(p)
+}
+
+// GetState returns the state of the digest of everything written so far.
+func (w *VerifierWriter) GetState() []byte {
+	return w.h.GetState()
+}
+
+// SetState restores the digest from state returned by GetState of a
+// SignerWriter or VerifierWriter with the same hash. It returns
+// ErrInvalidState and leaves the writer unchanged if state is not valid.
+func (w *VerifierWriter) SetState(state []byte) error {
+	return setState(w.h, state)
+}
+
+// Verify checks that sig is a signature of everything written so far. It
+// returns ErrVerification if it is not.
+func (w *VerifierWriter) Verify(sig []byte) error {
+	digest := w.h.Sum(nil)
+
+	var err error
+	switch pub := w.pub.(type) {
+	case ed25519.PublicKey:
+		err = ed25519.VerifyWithOptions(pub, digest, sig, w.opts.(*ed25519.Options))
+	case *rsa.PublicKey:
+		err = rsa.VerifyPSS(pub, w.opts.HashFunc(), digest, sig, w.opts.(*rsa.PSSOptions))
+	}
+	if err != nil {
+		return ErrVerification
+	}
+
+	return nil
+}
+
+func setState(h resumable.Resumable, state []byte) error {
+	if err := h.SetState(state); err != nil {
+		return ErrInvalidState
+	}
+	return nil
+}
+
+// Sign returns the signature of everything read from r by signer with the
+// registered hash named hash.
+func Sign(signer crypto.Signer, hash string, r io.Reader) ([]byte, error) {
+	w, err := NewSignerWriter(signer, hash)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, err
+	}
+	return w.Sign(nil)
+}
+
+// Verify checks that sig is a signature by pub with the registered hash
+// named hash of everything read from r.
+func Verify(pub crypto.PublicKey, hash string, r io.Reader, sig []byte) error {
+	w, err := NewVerifierWriter(pub, hash)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Verify(sig)
+}
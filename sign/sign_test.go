@@ -0,0 +1,169 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"github.com/koofr/go-cryptoutils/bettermd5"
+	"testing"
+)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+func TestEd25519ph(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := testData(10000)
+
+	sig, err := Sign(priv, "sha512", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha512.Sum512(data)
+	if err := ed25519.VerifyWithOptions(pub, digest[:], sig, &ed25519.Options{Hash: crypto.SHA512}); err != nil {
+		t.Fatalf("crypto/ed25519 rejected the signature: %v", err)
+	}
+	if want, _ := priv.Sign(nil, digest[:], crypto.SHA512); !bytes.Equal(sig, want) {
+		t.Fatal("signature differs from crypto/ed25519")
+	}
+
+	if err := Verify(pub, "sha512", bytes.NewReader(data), sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(pub, "sha512", bytes.NewReader(data[1:]), sig); err != ErrVerification {
+		t.Fatalf("other data: err = %v", err)
+	}
+}
+
+func TestRSAPSS(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := testData(10000)
+
+	for _, hash := range []string{"sha256", "sha512"} {
+		sig, err := Sign(priv, hash, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Verify(&priv.PublicKey, hash, bytes.NewReader(data), sig); err != nil {
+			t.Fatalf("%s: %v", hash, err)
+		}
+
+		bad := append([]byte(nil), sig...)
+		bad[0] ^= 1
+		if err := Verify(&priv.PublicKey, hash, bytes.NewReader(data), bad); err != ErrVerification {
+			t.Fatalf("%s: corrupt signature: err = %v", hash, err)
+		}
+	}
+
+	sig, _ := Sign(priv, "sha256", bytes.NewReader(data))
+	digest := sha256.Sum256(data)
+	if err := rsa.VerifyPSS(&priv.PublicKey, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+		t.Fatalf("crypto/rsa rejected the signature: %v", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	data := testData(10000)
+
+	s, _ := NewSignerWriter(priv, "sha512")
+	s.Write(data[:3333])
+	state := s.GetState()
+
+	resumed, _ := NewSignerWriter(priv, "sha512")
+	if err := resumed.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	resumed.Write(data[3333:])
+	sig, err := resumed.Sign(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, _ := NewVerifierWriter(pub, "sha512")
+	v.Write(data[:5000])
+	vresumed, _ := NewVerifierWriter(pub, "sha512")
+	if err := vresumed.SetState(v.GetState()); err != nil {
+		t.Fatal(err)
+	}
+	vresumed.Write(data[5000:])
+	if err := vresumed.Verify(sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetStateInvalid(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	s, _ := NewSignerWriter(priv, "sha512")
+	s.Write([]byte("keep"))
+	want := s.GetState()
+
+	for name, bad := range map[string][]byte{
+		"empty":      nil,
+		"other hash": bettermd5.New().GetState(),
+		"truncated":  want[:len(want)-1],
+	} {
+		if err := s.SetState(bad); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	if !bytes.Equal(s.GetState(), want) {
+		t.Fatal("failed SetState changed the writer")
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	ec, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	for _, c := range []struct {
+		name string
+		pub  crypto.PublicKey
+		hash string
+		want error
+	}{
+		{"ed25519 sha256", pub, "sha256", ErrUnsupportedHash},
+		{"unknown hash", pub, "md5", ErrUnsupportedHash},
+		{"ecdsa", &ec.PublicKey, "sha256", ErrUnsupportedKey},
+	} {
+		if _, err := NewVerifierWriter(c.pub, c.hash); err != c.want {
+			t.Fatalf("%s: NewVerifierWriter err = %v", c.name, err)
+		}
+	}
+
+	if _, err := NewSignerWriter(priv, "sha256"); err != ErrUnsupportedHash {
+		t.Fatalf("NewSignerWriter(ed25519, sha256) err = %v", err)
+	}
+	if _, err := NewSignerWriter(ec, "sha256"); err != ErrUnsupportedKey {
+		t.Fatalf("NewSignerWriter(ecdsa) err = %v", err)
+	}
+}
+
+func BenchmarkSignEd25519ph(b *testing.B) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	data := testData(1 << 20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		Sign(priv, "sha512", bytes.NewReader(data))
+	}
+}
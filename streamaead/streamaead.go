@@ -0,0 +1,495 @@
+// Package streamaead implements authenticated encryption of streams cut into
+// chunks, in the style of the STREAM construction used by Tink and age.
+//
+// An encrypted stream is a header followed by chunks. The header is
+//
+//	"bsae" || version || algorithm || uint32 chunk size || 32-byte salt
+//
+// with the chunk size in big-endian. Every chunk is chunk size bytes of
+// plaintext sealed with AES-256-GCM or XChaCha20-Poly1305, except the last,
+// which holds fewer bytes and may be empty. The chunks are sealed with a key
+// derived from the caller's key and the header with HKDF-SHA256, so a fresh
+// salt gives every stream its own key, and with a nonce holding the chunk's
+// sequence number and a flag marking the last chunk. Chunks that are
+// reordered, dropped, duplicated or taken from another stream fail to open,
+// and so does a stream cut off after any chunk but the last.
+//
+// Both ends of a stream can save their position at a chunk boundary with
+// GetState and carry on from it later. States hold the header and the
+// sequence number of the next chunk, not the key or any plaintext.
+package streamaead
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+var (
+	// ErrInvalidKeySize is returned for keys that are not KeySize bytes
+	// long.
+	ErrInvalidKeySize = errors.New("streamaead: key must be 32 bytes")
+
+	// ErrInvalidOptions is returned by NewEncrypter for an unknown algorithm
+	// or a chunk size out of range.
+	ErrInvalidOptions = errors.New("streamaead: invalid options")
+
+	// ErrInvalidHeader is returned by NewDecrypter when the stream does not
+	// start with a valid header.
+	ErrInvalidHeader = errors.New("streamaead: invalid header")
+
+	// ErrAuthentication is returned when a chunk fails to open, because it
+	// was modified, reordered or sealed with another key.
+	ErrAuthentication = errors.New("streamaead: message authentication failed")
+
+	// ErrTruncated is returned by Decrypter.Read when the stream ends
+	// before its last chunk.
+	ErrTruncated = errors.New("streamaead: stream truncated")
+
+	// ErrInvalidState is returned when restoring from a state that is not
+	// valid.
+	ErrInvalidState = errors.New("streamaead: invalid state")
+
+	// ErrClosed is returned by Encrypter.Write after Close.
+	ErrClosed = errors.New("streamaead: write to closed encrypter")
+)
+
+// Algorithm is the AEAD used to seal the chunks.
+type Algorithm byte
+
+const (
+	// AES256GCM seals chunks with AES-256 in GCM mode.
+	AES256GCM Algorithm = 1
+
+	// XChaCha20Poly1305 seals chunks with XChaCha20-Poly1305.
+	XChaCha20Poly1305 Algorithm = 2
+)
+
+const (
+	// KeySize is the size of a key in bytes.
+	KeySize = 32
+
+	// DefaultChunkSize is the chunk size used when Options.ChunkSize is
+	// zero.
+	DefaultChunkSize = 64 << 10
+
+	// MaxChunkSize is the largest allowed chunk size.
+	MaxChunkSize = 16 << 20
+
+	// Overhead is the number of bytes each chunk adds to its plaintext.
+	Overhead = 16
+
+	headerMagic   = "bsae"
+	headerVersion = 1
+	saltSize      = 32
+
+	// HeaderSize is the size of the stream header in bytes.
+	HeaderSize = len(headerMagic) + 1 + 1 + 4 + saltSize
+)
+
+// Options configures a new encrypted stream.
+type Options struct {
+	// Algorithm is the AEAD to use, AES256GCM if zero.
+	Algorithm Algorithm
+
+	// ChunkSize is the number of plaintext bytes per chunk, DefaultChunkSize
+	// if zero.
+	ChunkSize int
+}
+
+type header struct {
+	alg       Algorithm
+	chunkSize int
+	salt      [saltSize]byte
+}
+
+func (h *header) marshal() []byte {
+	b := make([]byte, 0, HeaderSize)
+	b = append(b, headerMagic...)
+	b = append(b, headerVersion, byte(h.alg))
+	b = binary.BigEndian.AppendUint32(b, uint32(h.chunkSize))
+	b = append(b, h.salt[:]...)
+	return b
+}
+
+func (h *header) unmarshal(b []byte) bool {
+	if len(b) != HeaderSize || string(b[:len(headerMagic)]) != headerMagic || b[len(headerMagic)] != headerVersion {
+		return false
+	}
+
+	b = b[len(headerMagic)+1:]
+	alg := Algorithm(b[0])
+	chunkSize := binary.BigEndian.Uint32(b[1:])
+	if !validOptions(alg, int64(chunkSize)) {
+		return false
+	}
+
+	h.alg = alg
+	h.chunkSize = int(chunkSize)
+	copy(h.salt[:], b[5:])
+	return true
+}
+
+func validOptions(alg Algorithm, chunkSize int64) bool {
+	return (alg == AES256GCM || alg == XChaCha20Poly1305) && chunkSize > 0 && chunkSize <= MaxChunkSize
+}
+
+// chunks holds what both ends of a stream need to seal or open its chunks.
+type chunks struct {
+	h     header
+	aead  cipher.AEAD
+	nonce []byte
+	seq   uint64
+}
+
+func newChunks(key []byte, h header) (*chunks, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKeySize
+	}
+
+	hdr := h.marshal()
+	streamKey, err := hkdf.Key(sha256.New, key, h.salt[:], string(hdr[:HeaderSize-saltSize]), KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	var aead cipher.AEAD
+	switch h.alg {
+	case AES256GCM:
+		block, _ := aes.NewCipher(streamKey)
+		aead, _ = cipher.NewGCM(block)
+	case XChaCha20Poly1305:
+		aead, _ = NewXChaCha20Poly1305(streamKey)
+	}
+
+	return &chunks{
+		h:     h,
+		aead:  aead,
+		nonce: make([]byte, aead.NonceSize()),
+	}, nil
+}
+
+// chunkNonce returns the nonce of chunk seq: zeros, then seq in big-endian
+// and a byte that is one for the last chunk.
+func (c *chunks) chunkNonce(last bool) []byte {
+	n := len(c.nonce)
+	binary.BigEndian.PutUint64(c.nonce[n-9:], c.seq)
+	c.nonce[n-1] = 0
+	if last {
+		c.nonce[n-1] = 1
+	}
+	return c.nonce
+}
+
+// The state format is
+//
+//	"bsas" || version || header || uint64 sequence number
+//
+// with the sequence number in big-endian.
+const (
+	stateMagic   = "bsas"
+	stateVersion = 1
+	stateSize    = len(stateMagic) + 1 + HeaderSize + 8
+)
+
+func (c *chunks) state(seq uint64) []byte {
+	b := make([]byte, 0, stateSize)
+	b = append(b, stateMagic...)
+	b = append(b, stateVersion)
+	b = append(b, c.h.marshal()...)
+	b = binary.BigEndian.AppendUint64(b, seq)
+	return b
+}
+
+func parseState(state []byte) (h header, seq uint64, err error) {
+	if len(state) != stateSize || string(state[:len(stateMagic)]) != stateMagic || state[len(stateMagic)] != stateVersion {
+		return h, 0, ErrInvalidState
+	}
+
+	p := state[len(stateMagic)+1:]
+	if !h.unmarshal(p[:HeaderSize]) {
+		return h, 0, ErrInvalidState
+	}
+	seq = binary.BigEndian.Uint64(p[HeaderSize:])
+
+	// Both offsets of the chunk have to fit in an int64.
+	if seq > (uint64(math.MaxInt64)-uint64(HeaderSize))/uint64(h.chunkSize+Overhead) {
+		return h, 0, ErrInvalidState
+	}
+
+	return h, seq, nil
+}
+
+// Offsets returns the offsets in the plaintext and in the encrypted stream,
+// header included, of the chunk boundary state was saved at. An Encrypter
+// or Decrypter restored from state carries on from there.
+func Offsets(state []byte) (plaintext, ciphertext int64, err error) {
+	h, seq, err := parseState(state)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	plaintext = int64(seq) * int64(h.chunkSize)
+	ciphertext = int64(HeaderSize) + int64(seq)*int64(h.chunkSize+Overhead)
+
+	return plaintext, ciphertext, nil
+}
+
+// Encrypter encrypts everything written to it into an underlying writer.
+// Close must be called to write the last chunk.
+type Encrypter struct {
+	w      io.Writer
+	c      *chunks
+	buf    []byte
+	out    []byte
+	closed bool
+	err    error
+}
+
+// NewEncrypter writes the header of a new stream to w and returns an
+// Encrypter for it. key must be KeySize bytes long and may be used for any
+// number of streams.
+func NewEncrypter(w io.Writer, key []byte, opts Options) (*Encrypter, error) {
+	h := header{alg: opts.Algorithm, chunkSize: opts.ChunkSize}
+	if h.alg == 0 {
+		h.alg = AES256GCM
+	}
+	if h.chunkSize == 0 {
+		h.chunkSize = DefaultChunkSize
+	}
+	if !validOptions(h.alg, int64(h.chunkSize)) {
+		return nil, ErrInvalidOptions
+	}
+	if _, err := rand.Read(h.salt[:]); err != nil {
+		return nil, err
+	}
+
+	e, err := newEncrypter(w, key, h, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(h.marshal()); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// NewEncrypterFromState returns an Encrypter that carries on a stream from
+// state returned by Encrypter.GetState. w must be positioned at the
+// ciphertext offset returned by Offsets, and the plaintext has to be written
+// again from the plaintext offset.
+func NewEncrypterFromState(w io.Writer, key, state []byte) (*Encrypter, error) {
+	h, seq, err := parseState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncrypter(w, key, h, seq)
+}
+
+func newEncrypter(w io.Writer, key []byte, h header, seq uint64) (*Encrypter, error) {
+	c, err := newChunks(key, h)
+	if err != nil {
+		return nil, err
+	}
+	c.seq = seq
+
+	return &Encrypter{
+		w:   w,
+		c:   c,
+		buf: make([]byte, 0, h.chunkSize),
+		out: make([]byte, 0, h.chunkSize+Overhead),
+	}, nil
+}
+
+// Write encrypts p. Whole chunks are written to the underlying writer as
+// soon as they are complete; errors writing them are sticky.
+func (e *Encrypter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, ErrClosed
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	nn := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+
+		if len(e.buf) == cap(e.buf) {
+			if err := e.flush(false); err != nil {
+				return nn, err
+			}
+		}
+		nn += n
+	}
+
+	return nn, nil
+}
+
+// Close writes the last chunk holding the data not yet written. It does
+// not close the underlying writer.
+func (e *Encrypter) Close() error {
+	if e.closed {
+		return e.err
+	}
+	if e.err == nil {
+		e.flush(true)
+	}
+	e.closed = true
+	return e.err
+}
+
+func (e *Encrypter) flush(last bool) error {
+	e.out = e.c.aead.Seal(e.out[:0], e.c.chunkNonce(last), e.buf, nil)
+	if _, err := e.w.Write(e.out); err != nil {
+		e.err = err
+		return err
+	}
+
+	e.buf = e.buf[:0]
+	if !last {
+		e.c.seq++
+	}
+
+	return nil
+}
+
+// GetState returns the state of e at the start of the chunk being filled,
+// to be restored by NewEncrypterFromState. Buffered plaintext is not part of
+// the state. After Close the state is at the start of the last chunk.
+func (e *Encrypter) GetState() []byte {
+	return e.c.state(e.c.seq)
+}
+
+// Decrypter decrypts and authenticates a stream read from an underlying
+// reader.
+type Decrypter struct {
+	r        io.Reader
+	c        *chunks
+	in       []byte
+	plain    []byte
+	boundary uint64
+	done     bool
+	err      error
+}
+
+// NewDecrypter reads the header of a stream from r and returns a Decrypter
+// for it.
+func NewDecrypter(r io.Reader, key []byte) (*Decrypter, error) {
+	hdr := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidHeader
+		}
+		return nil, err
+	}
+
+	var h header
+	if !h.unmarshal(hdr) {
+		return nil, ErrInvalidHeader
+	}
+
+	return newDecrypter(r, key, h, 0)
+}
+
+// NewDecrypterFromState returns a Decrypter that carries on a stream from
+// state returned by Decrypter.GetState. r must be positioned at the
+// ciphertext offset returned by Offsets; the first byte read is the
+// plaintext at the plaintext offset.
+func NewDecrypterFromState(r io.Reader, key, state []byte) (*Decrypter, error) {
+	h, seq, err := parseState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDecrypter(r, key, h, seq)
+}
+
+func newDecrypter(r io.Reader, key []byte, h header, seq uint64) (*Decrypter, error) {
+	c, err := newChunks(key, h)
+	if err != nil {
+		return nil, err
+	}
+	c.seq = seq
+
+	return &Decrypter{
+		r:        r,
+		c:        c,
+		in:       make([]byte, h.chunkSize+Overhead),
+		boundary: seq,
+	}, nil
+}
+
+// Read reads decrypted data. Plaintext is only returned once its chunk has
+// been authenticated. Read returns io.EOF after the last chunk,
+// ErrTruncated if the stream ends before it and ErrAuthentication for a
+// chunk that fails to open; errors are sticky.
+func (d *Decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	if len(d.plain) == 0 && !d.done {
+		d.boundary = d.c.seq
+	}
+
+	return n, nil
+}
+
+// next reads and opens the next chunk. A full chunk is never the last one,
+// so a shorter one has to be.
+func (d *Decrypter) next() error {
+	n, err := io.ReadFull(d.r, d.in)
+	last := false
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return ErrTruncated
+	default:
+		return err
+	}
+
+	plain, err := d.c.aead.Open(d.in[:0], d.c.chunkNonce(last), d.in[:n], nil)
+	if err != nil {
+		// This includes a chunk cut short, which is opened as the last one.
+		return ErrAuthentication
+	}
+
+	d.boundary = d.c.seq
+	d.plain = plain
+	if last {
+		d.done = true
+	} else {
+		d.c.seq++
+	}
+
+	return nil
+}
+
+// GetState returns the state of d at the start of the chunk it is
+// returning plaintext from, or of the next chunk if all plaintext read so
+// far has been returned, to be restored by NewDecrypterFromState.
+func (d *Decrypter) GetState() []byte {
+	return d.c.state(d.boundary)
+}
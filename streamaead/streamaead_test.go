@@ -0,0 +1,296 @@
+package streamaead
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+func encrypt(t testing.TB, data []byte, opts Options) []byte {
+	var buf bytes.Buffer
+	e, err := NewEncrypter(&buf, testKey, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := data; len(p) > 0; {
+		n := len(p)%37 + 1
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := e.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(ciphertext []byte) ([]byte, error) {
+	d, err := NewDecrypter(bytes.NewReader(ciphertext), testKey)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(d)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, alg := range []Algorithm{AES256GCM, XChaCha20Poly1305} {
+		for _, n := range []int{0, 1, 99, 100, 101, 1000, 1234} {
+			data := testData(n)
+			ciphertext := encrypt(t, data, Options{Algorithm: alg, ChunkSize: 100})
+
+			if want := HeaderSize + n/100*(100+Overhead) + n%100 + Overhead; len(ciphertext) != want {
+				t.Fatalf("%d/%d: %d bytes of ciphertext want %d", alg, n, len(ciphertext), want)
+			}
+
+			got, err := decrypt(ciphertext)
+			if err != nil {
+				t.Fatalf("%d/%d: %v", alg, n, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%d/%d: decrypted data differs", alg, n)
+			}
+		}
+	}
+
+	a := encrypt(t, testData(10), Options{})
+	b := encrypt(t, testData(10), Options{})
+	if bytes.Equal(a[HeaderSize:], b[HeaderSize:]) {
+		t.Fatal("two streams of the same data encrypted alike")
+	}
+	if got, err := decrypt(a); err != nil || !bytes.Equal(got, testData(10)) {
+		t.Fatalf("default options: %v", err)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	const chunk = 100 + Overhead
+
+	for _, alg := range []Algorithm{AES256GCM, XChaCha20Poly1305} {
+		ciphertext := encrypt(t, testData(450), Options{Algorithm: alg, ChunkSize: 100})
+		body := ciphertext[HeaderSize:]
+		hdr := ciphertext[:HeaderSize]
+
+		join := func(parts ...[]byte) []byte {
+			return bytes.Join(parts, nil)
+		}
+		chunkAt := func(i int) []byte {
+			return body[i*chunk : (i+1)*chunk]
+		}
+
+		otherKey := append([]byte(nil), testKey...)
+		otherKey[0] ^= 1
+
+		for name, c := range map[string]struct {
+			ciphertext []byte
+			err        error
+		}{
+			"truncated at boundary": {ciphertext[:HeaderSize+4*chunk], ErrTruncated},
+			"header only":           {hdr, ErrTruncated},
+			"truncated in chunk":    {ciphertext[:len(ciphertext)-1], ErrAuthentication},
+			"truncated in last tag": {ciphertext[:HeaderSize+4*chunk+10], ErrAuthentication},
+			"appended":              {join(ciphertext, []byte{0}), ErrAuthentication},
+			"swapped":               {join(hdr, chunkAt(1), chunkAt(0), body[2*chunk:]), ErrAuthentication},
+			"dropped":               {join(hdr, chunkAt(0), body[2*chunk:]), ErrAuthentication},
+			"duplicated":            {join(hdr, chunkAt(0), chunkAt(0), body[chunk:]), ErrAuthentication},
+			"last chunk dropped":    {join(hdr, body[:3*chunk], body[4*chunk:]), ErrAuthentication},
+			"flipped":               {join(hdr, body[:150], []byte{body[150] ^ 1}, body[151:]), ErrAuthentication},
+			"salt":                  {join(hdr[:HeaderSize-1], []byte{hdr[HeaderSize-1] ^ 1}, body), ErrAuthentication},
+			"chunk size":            {join(hdr[:9], []byte{hdr[9] + 16}, hdr[10:], body), ErrAuthentication},
+			"magic":                 {join([]byte("nope"), ciphertext[4:]), ErrInvalidHeader},
+			"algorithm":             {join(hdr[:5], []byte{3}, ciphertext[6:]), ErrInvalidHeader},
+			"short header":          {hdr[:HeaderSize-1], ErrInvalidHeader},
+		} {
+			if _, err := decrypt(c.ciphertext); err != c.err {
+				t.Fatalf("%d/%s: err = %v want %v", alg, name, err, c.err)
+			}
+		}
+
+		d, _ := NewDecrypter(bytes.NewReader(ciphertext), otherKey)
+		if _, err := io.ReadAll(d); err != ErrAuthentication {
+			t.Fatalf("%d/other key: err = %v", alg, err)
+		}
+
+		var other bytes.Buffer
+		e, _ := NewEncrypter(&other, testKey, Options{Algorithm: alg, ChunkSize: 100})
+		e.Write(testData(450))
+		e.Close()
+		if _, err := decrypt(join(hdr, other.Bytes()[HeaderSize:])); err != ErrAuthentication {
+			t.Fatalf("%d/chunks of another stream: err = %v", alg, err)
+		}
+	}
+}
+
+func TestEncrypterResume(t *testing.T) {
+	data := testData(1000)
+
+	for _, split := range []int{0, 1, 99, 100, 350, 999, 1000} {
+		var buf bytes.Buffer
+		e, _ := NewEncrypter(&buf, testKey, Options{Algorithm: XChaCha20Poly1305, ChunkSize: 100})
+		e.Write(data[:split])
+		state := e.GetState()
+
+		plainOff, cipherOff, err := Offsets(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int64(split / 100 * 100); plainOff != want {
+			t.Fatalf("%d: plaintext offset %d want %d", split, plainOff, want)
+		}
+		if int64(buf.Len()) != cipherOff {
+			t.Fatalf("%d: ciphertext offset %d want %d", split, cipherOff, buf.Len())
+		}
+
+		buf.Truncate(int(cipherOff))
+		r, err := NewEncrypterFromState(&buf, testKey, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Write(data[plainOff:])
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := decrypt(buf.Bytes()); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%d: resumed stream does not decrypt: %v", split, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	e, _ := NewEncrypter(&buf, testKey, Options{ChunkSize: 100})
+	e.Write(data[:250])
+	e.Close()
+	if _, err := e.Write(data[:1]); err != ErrClosed {
+		t.Fatalf("write after Close: err = %v", err)
+	}
+	if _, cipherOff, _ := Offsets(e.GetState()); cipherOff != int64(HeaderSize+2*(100+Overhead)) {
+		t.Fatalf("state after Close at %d", cipherOff)
+	}
+}
+
+func TestDecrypterResume(t *testing.T) {
+	data := testData(1000)
+	ciphertext := encrypt(t, data, Options{ChunkSize: 100})
+
+	for _, split := range []int{0, 1, 99, 100, 101, 350, 999, 1000} {
+		d, _ := NewDecrypter(bytes.NewReader(ciphertext), testKey)
+		got := make([]byte, split)
+		if _, err := io.ReadFull(d, got); err != nil {
+			t.Fatal(err)
+		}
+
+		plainOff, cipherOff, err := Offsets(d.GetState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The chunk being read from is decrypted again.
+		if want := int64(split / 100 * 100); plainOff != want {
+			t.Fatalf("%d: plaintext offset %d want %d", split, plainOff, want)
+		}
+
+		r, err := NewDecrypterFromState(bytes.NewReader(ciphertext[cipherOff:]), testKey, d.GetState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%d: %v", split, err)
+		}
+		if !bytes.Equal(rest, data[plainOff:]) {
+			t.Fatalf("%d: resumed plaintext differs", split)
+		}
+	}
+
+	// The last chunk of a stream whose length is a multiple of the chunk
+	// size is empty, so reading everything ends on a boundary.
+	d, _ := NewDecrypter(bytes.NewReader(ciphertext), testKey)
+	io.ReadAll(d)
+	if plainOff, _, _ := Offsets(d.GetState()); plainOff != 1000 {
+		t.Fatalf("state after EOF at %d", plainOff)
+	}
+}
+
+func TestStateInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	e, _ := NewEncrypter(&buf, testKey, Options{ChunkSize: 100})
+	e.Write(testData(250))
+	state := e.GetState()
+
+	mutate := func(i int, b byte) []byte {
+		s := append([]byte(nil), state...)
+		s[i] = b
+		return s
+	}
+	huge := append([]byte(nil), state...)
+	binary.BigEndian.PutUint64(huge[len(huge)-8:], 1<<60)
+
+	for name, bad := range map[string][]byte{
+		"empty":      nil,
+		"truncated":  state[:len(state)-1],
+		"extended":   append(append([]byte(nil), state...), 0),
+		"magic":      append([]byte("nope"), state[4:]...),
+		"version":    mutate(4, 2),
+		"header":     mutate(5, 'x'),
+		"algorithm":  mutate(10, 9),
+		"chunk size": append(append(append([]byte(nil), state[:11]...), 0, 0, 0, 0), state[15:]...),
+		"sequence":   huge,
+	} {
+		if _, err := NewEncrypterFromState(&buf, testKey, bad); err != ErrInvalidState {
+			t.Fatalf("%s: encrypter err = %v", name, err)
+		}
+		if _, err := NewDecrypterFromState(&buf, testKey, bad); err != ErrInvalidState {
+			t.Fatalf("%s: decrypter err = %v", name, err)
+		}
+		if _, _, err := Offsets(bad); err != ErrInvalidState {
+			t.Fatalf("%s: Offsets err = %v", name, err)
+		}
+	}
+
+	if _, err := NewEncrypterFromState(&buf, testKey[1:], state); err != ErrInvalidKeySize {
+		t.Fatalf("short key: err = %v", err)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Algorithm: 3},
+		{ChunkSize: -1},
+		{ChunkSize: MaxChunkSize + 1},
+	} {
+		if _, err := NewEncrypter(io.Discard, testKey, opts); err != ErrInvalidOptions {
+			t.Fatalf("%+v: err = %v", opts, err)
+		}
+	}
+
+	if _, err := NewEncrypter(io.Discard, testKey[1:], Options{}); err != ErrInvalidKeySize {
+		t.Fatalf("short key: err = %v", err)
+	}
+}
+
+func BenchmarkEncrypter(b *testing.B) {
+	for _, alg := range []Algorithm{AES256GCM, XChaCha20Poly1305} {
+		b.Run(map[Algorithm]string{AES256GCM: "AES256GCM", XChaCha20Poly1305: "XChaCha20Poly1305"}[alg], func(b *testing.B) {
+			data := testData(1 << 20)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				e, _ := NewEncrypter(io.Discard, testKey, Options{Algorithm: alg})
+				e.Write(data)
+				e.Close()
+			}
+		})
+	}
+}
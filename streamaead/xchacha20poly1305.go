@@ -0,0 +1,169 @@
+package streamaead
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"github.com/koofr/go-cryptoutils/internal/poly1305"
+	"github.com/koofr/go-cryptoutils/streamcipher"
+	"math/bits"
+)
+
+const (
+	// XChaCha20Poly1305NonceSize is the size of an XChaCha20-Poly1305 nonce
+	// in bytes.
+	XChaCha20Poly1305NonceSize = 24
+
+	xchachaTagSize = poly1305.TagSize
+)
+
+// xchacha20poly1305 is XChaCha20-Poly1305 as described in
+// draft-irtf-cfrg-xchacha: ChaCha20-Poly1305 as in RFC 8439 with a key
+// derived by HChaCha20 from the first 16 bytes of the nonce and the last 8
+// bytes as the ChaCha20 nonce.
+type xchacha20poly1305 struct {
+	key [KeySize]byte
+}
+
+// NewXChaCha20Poly1305 returns XChaCha20-Poly1305 with the given 32-byte
+// key as a cipher.AEAD.
+func NewXChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKeySize
+	}
+
+	c := new(xchacha20poly1305)
+	copy(c.key[:], key)
+	return c, nil
+}
+
+func (c *xchacha20poly1305) NonceSize() int { return XChaCha20Poly1305NonceSize }
+
+func (c *xchacha20poly1305) Overhead() int { return xchachaTagSize }
+
+// stream returns the ChaCha20 stream for nonce, positioned at the first
+// block, and the Poly1305 key taken from block zero.
+func (c *xchacha20poly1305) stream(nonce []byte) (*streamcipher.ChaCha20, *poly1305.MAC) {
+	if len(nonce) != XChaCha20Poly1305NonceSize {
+		panic("streamaead: bad XChaCha20-Poly1305 nonce length")
+	}
+
+	var subkey [KeySize]byte
+	hChaCha20(&subkey, &c.key, nonce[:16])
+
+	var chachaNonce [streamcipher.ChaCha20NonceSize]byte
+	copy(chachaNonce[4:], nonce[16:])
+
+	s, _ := streamcipher.NewChaCha20(subkey[:], chachaNonce[:])
+
+	var polyKey [32]byte
+	s.XORKeyStream(polyKey[:], polyKey[:])
+	s.Seek(64)
+
+	return s, poly1305.New(&polyKey)
+}
+
+func (c *xchacha20poly1305) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	s, p := c.stream(nonce)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+xchachaTagSize)
+	ciphertext, tag := out[:len(plaintext)], out[len(plaintext):]
+	s.XORKeyStream(ciphertext, plaintext)
+
+	authenticate(p, additionalData, ciphertext)
+	p.Sum(tag[:0])
+
+	return ret
+}
+
+func (c *xchacha20poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < xchachaTagSize {
+		return nil, ErrAuthentication
+	}
+
+	s, p := c.stream(nonce)
+
+	tag := ciphertext[len(ciphertext)-xchachaTagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-xchachaTagSize]
+
+	authenticate(p, additionalData, ciphertext)
+	var sum [xchachaTagSize]byte
+	p.Sum(sum[:0])
+	if subtle.ConstantTimeCompare(sum[:], tag) != 1 {
+		return nil, ErrAuthentication
+	}
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	s.XORKeyStream(out, ciphertext)
+
+	return ret, nil
+}
+
+// authenticate writes the RFC 8439 MAC input for additionalData and
+// ciphertext to p.
+func authenticate(p *poly1305.MAC, additionalData, ciphertext []byte) {
+	var pad [16]byte
+	p.Write(additionalData)
+	p.Write(pad[:(16-len(additionalData)%16)%16])
+	p.Write(ciphertext)
+	p.Write(pad[:(16-len(ciphertext)%16)%16])
+
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:], uint64(len(additionalData)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ciphertext)))
+	p.Write(lengths[:])
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the
+// n new bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// hChaCha20 derives a subkey from key and a 16-byte nonce: the first and
+// last rows of the ChaCha20 state after the rounds, without the final
+// addition.
+func hChaCha20(out, key *[KeySize]byte, nonce []byte) {
+	var s [16]uint32
+	s[0], s[1], s[2], s[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		s[4+i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+	for i := 0; i < 4; i++ {
+		s[12+i] = binary.LittleEndian.Uint32(nonce[i*4:])
+	}
+
+	for i := 0; i < 10; i++ {
+		quarterRound(&s, 0, 4, 8, 12)
+		quarterRound(&s, 1, 5, 9, 13)
+		quarterRound(&s, 2, 6, 10, 14)
+		quarterRound(&s, 3, 7, 11, 15)
+		quarterRound(&s, 0, 5, 10, 15)
+		quarterRound(&s, 1, 6, 11, 12)
+		quarterRound(&s, 2, 7, 8, 13)
+		quarterRound(&s, 3, 4, 9, 14)
+	}
+
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(out[i*4:], s[i])
+		binary.LittleEndian.PutUint32(out[16+i*4:], s[12+i])
+	}
+}
+
+func quarterRound(s *[16]uint32, a, b, c, d int) {
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 12)
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 7)
+}
@@ -0,0 +1,73 @@
+package streamaead
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestHChaCha20(t *testing.T) {
+	// draft-irtf-cfrg-xchacha, section 2.2.1.
+	var key, out [KeySize]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	nonce, _ := hex.DecodeString("000000090000004a0000000031415927")
+
+	hChaCha20(&out, &key, nonce)
+	if got := hex.EncodeToString(out[:]); got != "82413b4227b27bfed30e42508a877d73a0f9e4d58a74a853c12ec41326d3ecdc" {
+		t.Fatalf("subkey = %s", got)
+	}
+}
+
+func TestXChaCha20Poly1305(t *testing.T) {
+	// draft-irtf-cfrg-xchacha, section A.3.1.
+	key := make([]byte, KeySize)
+	for i := range key {
+		key[i] = byte(0x80 + i)
+	}
+	nonce := make([]byte, XChaCha20Poly1305NonceSize)
+	for i := range nonce {
+		nonce[i] = byte(0x40 + i)
+	}
+	ad, _ := hex.DecodeString("50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	want := "bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff921f9664c97637da9768812f615c68b13b52e" +
+		"c0875924c1c7987947deafd8780acf49"
+
+	aead, err := NewXChaCha20Poly1305(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := aead.Seal([]byte("prefix"), nonce, plaintext, ad)
+	if string(sealed[:6]) != "prefix" {
+		t.Fatal("Seal did not append to dst")
+	}
+	if got := hex.EncodeToString(sealed[6:]); got != want {
+		t.Fatalf("sealed = %s", got)
+	}
+
+	opened, err := aead.Open(nil, nonce, sealed[6:], ad)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+
+	for i := 0; i < len(sealed)-6; i += 17 {
+		bad := append([]byte(nil), sealed[6:]...)
+		bad[i] ^= 1
+		if _, err := aead.Open(nil, nonce, bad, ad); err != ErrAuthentication {
+			t.Fatalf("flipped byte %d: err = %v", i, err)
+		}
+	}
+	if _, err := aead.Open(nil, nonce, sealed[6:], ad[1:]); err != ErrAuthentication {
+		t.Fatalf("other additional data: err = %v", err)
+	}
+	if _, err := aead.Open(nil, nonce, sealed[6:21], ad); err != ErrAuthentication {
+		t.Fatalf("short ciphertext: err = %v", err)
+	}
+
+	if _, err := NewXChaCha20Poly1305(key[1:]); err != ErrInvalidKeySize {
+		t.Fatalf("short key: err = %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package streamcipher
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+var (
+	// ErrInvalidKeySize is returned by NewChaCha20 for keys that are not
+	// 32 bytes long.
+	ErrInvalidKeySize = errors.New("streamcipher: ChaCha20 key must be 32 bytes")
+
+	// ErrInvalidNonceSize is returned by NewChaCha20 for nonces that are not
+	// 12 bytes long.
+	ErrInvalidNonceSize = errors.New("streamcipher: ChaCha20 nonce must be 12 bytes")
+)
+
+const (
+	// ChaCha20KeySize is the size of a ChaCha20 key in bytes.
+	ChaCha20KeySize = 32
+
+	// ChaCha20NonceSize is the size of a ChaCha20 nonce in bytes.
+	ChaCha20NonceSize = 12
+
+	chachaBlockSize = 64
+
+	// chachaLimit is the length of the keystream, which the 32-bit block
+	// counter limits to 256 GiB.
+	chachaLimit = 1 << 32 * chachaBlockSize
+)
+
+// ChaCha20 is the ChaCha20 stream cipher as defined in RFC 8439, with a
+// 96-bit nonce and a 32-bit block counter starting at zero.
+type ChaCha20 struct {
+	key   [8]uint32
+	nonce [3]uint32
+	k     keystream
+}
+
+// The ChaCha20 state format is
+//
+//	"bscc" || version || nonce || uint64 offset
+//
+// with the offset in big-endian.
+const (
+	chachaStateMagic   = "bscc"
+	chachaStateVersion = 1
+	chachaStateSize    = len(chachaStateMagic) + 1 + ChaCha20NonceSize + 8
+)
+
+// NewChaCha20 returns a ChaCha20 stream with the given key and nonce,
+// starting at offset zero. A nonce must never be used twice with the same
+// key.
+func NewChaCha20(key, nonce []byte) (*ChaCha20, error) {
+	if len(key) != ChaCha20KeySize {
+		return nil, ErrInvalidKeySize
+	}
+	if len(nonce) != ChaCha20NonceSize {
+		return nil, ErrInvalidNonceSize
+	}
+
+	x := new(ChaCha20)
+	for i := range x.key {
+		x.key[i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+	x.setNonce(nonce)
+	x.k = newKeystream(chachaBlockSize, chachaLimit, x.generate)
+
+	return x, nil
+}
+
+// NewChaCha20FromState returns a ChaCha20 stream with the given key,
+// restored from state returned by GetState.
+func NewChaCha20FromState(key, state []byte) (*ChaCha20, error) {
+	x, err := NewChaCha20(key, make([]byte, ChaCha20NonceSize))
+	if err != nil {
+		return nil, err
+	}
+	if err := x.SetState(state); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *ChaCha20) setNonce(nonce []byte) {
+	for i := range x.nonce {
+		x.nonce[i] = binary.LittleEndian.Uint32(nonce[i*4:])
+	}
+}
+
+func (x *ChaCha20) generate(index uint64, dst []byte) {
+	for i := 0; i < len(dst); i += chachaBlockSize {
+		x.block(uint32(index), dst[i:i+chachaBlockSize])
+		index++
+	}
+}
+
+func (x *ChaCha20) block(counter uint32, dst []byte) {
+	in := [16]uint32{
+		0x61707865, 0x3320646e, 0x79622d32, 0x6b206574,
+		x.key[0], x.key[1], x.key[2], x.key[3],
+		x.key[4], x.key[5], x.key[6], x.key[7],
+		counter, x.nonce[0], x.nonce[1], x.nonce[2],
+	}
+
+	s := in
+	for i := 0; i < 10; i++ {
+		quarterRound(&s, 0, 4, 8, 12)
+		quarterRound(&s, 1, 5, 9, 13)
+		quarterRound(&s, 2, 6, 10, 14)
+		quarterRound(&s, 3, 7, 11, 15)
+		quarterRound(&s, 0, 5, 10, 15)
+		quarterRound(&s, 1, 6, 11, 12)
+		quarterRound(&s, 2, 7, 8, 13)
+		quarterRound(&s, 3, 4, 9, 14)
+	}
+
+	for i := range s {
+		binary.LittleEndian.PutUint32(dst[i*4:], s[i]+in[i])
+	}
+}
+
+func quarterRound(s *[16]uint32, a, b, c, d int) {
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 12)
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 7)
+}
+
+// XORKeyStream XORs src with the keystream like Stream.XORKeyStream. It
+// panics if src would run past the 256 GiB end of the keystream.
+func (x *ChaCha20) XORKeyStream(dst, src []byte) { x.k.xor(dst, src) }
+
+// Seek moves to offset bytes from the start of the keystream. It returns
+// ErrSeekOutOfRange for offsets past its 256 GiB end.
+func (x *ChaCha20) Seek(offset uint64) error { return x.k.seek(offset) }
+
+func (x *ChaCha20) Offset() uint64 { return x.k.offset }
+
+// GetState returns the nonce and offset of the stream, to be restored by
+// SetState.
+func (x *ChaCha20) GetState() []byte {
+	b := make([]byte, 0, chachaStateSize)
+	b = append(b, chachaStateMagic...)
+	b = append(b, chachaStateVersion)
+	for _, n := range x.nonce {
+		b = binary.LittleEndian.AppendUint32(b, n)
+	}
+	b = binary.BigEndian.AppendUint64(b, x.k.offset)
+	return b
+}
+
+// SetState restores the nonce and offset of the stream from state returned
+// by GetState. It returns ErrInvalidState and leaves the stream unchanged if
+// state is not valid.
+func (x *ChaCha20) SetState(state []byte) error {
+	if len(state) != chachaStateSize || string(state[:len(chachaStateMagic)]) != chachaStateMagic || state[len(chachaStateMagic)] != chachaStateVersion {
+		return ErrInvalidState
+	}
+
+	p := state[len(chachaStateMagic)+1:]
+	offset := binary.BigEndian.Uint64(p[ChaCha20NonceSize:])
+	if offset > chachaLimit {
+		return ErrInvalidState
+	}
+
+	x.setNonce(p)
+	x.k.seek(offset)
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package streamcipher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// The key and nonce of the RFC 8439 block function test vector.
+var (
+	chachaKey   = []byte("\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f")
+	chachaNonce = []byte("\x00\x00\x00\x09\x00\x00\x00\x4a\x00\x00\x00\x00")
+)
+
+func TestChaCha20Vector(t *testing.T) {
+	x, err := NewChaCha20(chachaKey, chachaNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 8439, section 2.3.2, with block counter 1.
+	if err := x.Seek(64); err != nil {
+		t.Fatal(err)
+	}
+	block := make([]byte, 64)
+	x.XORKeyStream(block, block)
+	if got := hex.EncodeToString(block); got != "10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4ed2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e" {
+		t.Fatalf("block 1 = %s", got)
+	}
+
+	// Checked against the cryptography Python package.
+	x.Seek(0)
+	stream := make([]byte, 10000)
+	x.XORKeyStream(stream, stream)
+	if sum := sha256.Sum256(stream); hex.EncodeToString(sum[:]) != "4a62cc4ed15b439d2ba03a6d74bdda74b1949e8c154ad059610764a4487783b1" {
+		t.Fatalf("keystream checksum = %x", sum)
+	}
+}
+
+func TestChaCha20Seek(t *testing.T) {
+	x, _ := NewChaCha20(chachaKey, chachaNonce)
+	want := make([]byte, 3000)
+	x.XORKeyStream(want, want)
+
+	for _, off := range []int{0, 1, 63, 64, 65, 511, 512, 513, 2999} {
+		if err := x.Seek(uint64(off)); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(want)-off)
+		x.XORKeyStream(got, got)
+		if !bytes.Equal(got, want[off:]) {
+			t.Fatalf("keystream from %d differs", off)
+		}
+
+		x.Seek(uint64(off))
+		r, err := NewChaCha20FromState(chachaKey, x.GetState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Offset() != uint64(off) {
+			t.Fatalf("restored offset %d want %d", r.Offset(), off)
+		}
+		r.XORKeyStream(got, make([]byte, len(got)))
+		if !bytes.Equal(got, want[off:]) {
+			t.Fatalf("restored keystream from %d differs", off)
+		}
+	}
+
+	if err := x.Seek(chachaLimit + 1); err != ErrSeekOutOfRange {
+		t.Fatalf("seek past the end: err = %v", err)
+	}
+}
+
+func TestChaCha20Limit(t *testing.T) {
+	x, _ := NewChaCha20(chachaKey, chachaNonce)
+	x.Seek(chachaLimit - 10)
+
+	buf := make([]byte, 10)
+	x.XORKeyStream(buf, buf)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic past the end of the keystream")
+		}
+	}()
+	x.XORKeyStream(buf[:1], buf[:1])
+}
+
+func TestChaCha20Invalid(t *testing.T) {
+	if _, err := NewChaCha20(chachaKey[:31], chachaNonce); err != ErrInvalidKeySize {
+		t.Fatalf("short key: err = %v", err)
+	}
+	if _, err := NewChaCha20(chachaKey, chachaNonce[:8]); err != ErrInvalidNonceSize {
+		t.Fatalf("short nonce: err = %v", err)
+	}
+
+	x, _ := NewChaCha20(chachaKey, chachaNonce)
+	x.Seek(100)
+	state := x.GetState()
+
+	tooFar := append([]byte(nil), state...)
+	copy(tooFar[len(tooFar)-8:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	for name, s := range map[string][]byte{
+		"empty":       nil,
+		"truncated":   state[:len(state)-1],
+		"wrong magic": append([]byte("xxxx"), state[4:]...),
+		"past end":    tooFar,
+	} {
+		if err := x.SetState(s); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if x.Offset() != 100 {
+		t.Fatal("failed SetState changed the stream")
+	}
+}
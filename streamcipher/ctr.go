@@ -0,0 +1,108 @@
+package streamcipher
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// CTR is a block cipher in counter mode, with the counter incremented as a
+// big-endian integer over the whole block, as in crypto/cipher.NewCTR.
+type CTR struct {
+	b  cipher.Block
+	iv []byte
+	k  keystream
+}
+
+// The CTR state format is
+//
+//	"bsct" || version || IV length || IV || uint64 offset
+//
+// with the offset in big-endian.
+const (
+	ctrStateMagic   = "bsct"
+	ctrStateVersion = 1
+)
+
+// NewCTR returns a CTR stream encrypting with block, starting at offset
+// zero. The length of iv must be the block size of block.
+func NewCTR(block cipher.Block, iv []byte) *CTR {
+	if len(iv) != block.BlockSize() {
+		panic("streamcipher.NewCTR: IV length must equal block size")
+	}
+
+	x := &CTR{b: block, iv: append([]byte(nil), iv...)}
+	x.k = newKeystream(block.BlockSize(), 0, x.generate)
+	return x
+}
+
+// NewCTRFromState returns a CTR stream encrypting with block, restored from
+// state returned by GetState.
+func NewCTRFromState(block cipher.Block, state []byte) (*CTR, error) {
+	x := NewCTR(block, make([]byte, block.BlockSize()))
+	if err := x.SetState(state); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *CTR) generate(index uint64, dst []byte) {
+	bs := len(x.iv)
+
+	ctr := make([]byte, bs)
+	copy(ctr, x.iv)
+	addCounter(ctr, index)
+
+	for i := 0; i < len(dst); i += bs {
+		x.b.Encrypt(dst[i:], ctr)
+		addCounter(ctr, 1)
+	}
+}
+
+// addCounter adds n to the big-endian integer ctr, modulo its size.
+func addCounter(ctr []byte, n uint64) {
+	for i := len(ctr) - 1; i >= 0 && n != 0; i-- {
+		s := uint64(ctr[i]) + n&0xff
+		ctr[i] = byte(s)
+		n = n>>8 + s>>8
+	}
+}
+
+func (x *CTR) XORKeyStream(dst, src []byte) { x.k.xor(dst, src) }
+
+// Seek moves to offset bytes from the start of the keystream. It never
+// returns an error; the counter wraps around like the counter of
+// crypto/cipher.NewCTR.
+func (x *CTR) Seek(offset uint64) error { return x.k.seek(offset) }
+
+func (x *CTR) Offset() uint64 { return x.k.offset }
+
+// GetState returns the IV and offset of the stream, to be restored by
+// SetState.
+func (x *CTR) GetState() []byte {
+	b := make([]byte, 0, len(ctrStateMagic)+2+len(x.iv)+8)
+	b = append(b, ctrStateMagic...)
+	b = append(b, ctrStateVersion, byte(len(x.iv)))
+	b = append(b, x.iv...)
+	b = binary.BigEndian.AppendUint64(b, x.k.offset)
+	return b
+}
+
+// SetState restores the IV and offset of the stream from state returned by
+// GetState. It returns ErrInvalidState and leaves the stream unchanged if
+// state is not valid for the block cipher of x.
+func (x *CTR) SetState(state []byte) error {
+	h := len(ctrStateMagic) + 2
+	if len(state) < h || string(state[:len(ctrStateMagic)]) != ctrStateMagic || state[len(ctrStateMagic)] != ctrStateVersion {
+		return ErrInvalidState
+	}
+
+	bs := int(state[h-1])
+	if bs != len(x.iv) || len(state) != h+bs+8 {
+		return ErrInvalidState
+	}
+
+	copy(x.iv, state[h:h+bs])
+	x.k.seek(binary.BigEndian.Uint64(state[h+bs:]))
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package streamcipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+func testCTR(t *testing.T, iv []byte) {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]byte, 3000)
+	cipher.NewCTR(block, iv).XORKeyStream(want, want)
+
+	x := NewCTR(block, iv)
+	for _, off := range []int{0, 1, 15, 16, 17, 511, 512, 513, 2999} {
+		if err := x.Seek(uint64(off)); err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]byte, len(want)-off)
+		for i := 0; i < len(got); i += 100 {
+			x.XORKeyStream(got[i:min(i+100, len(got))], got[i:min(i+100, len(got))])
+		}
+		if !bytes.Equal(got, want[off:]) {
+			t.Fatalf("iv %x: keystream from %d differs", iv, off)
+		}
+
+		x.Seek(uint64(off))
+		r, err := NewCTRFromState(block, x.GetState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.XORKeyStream(got, make([]byte, len(got)))
+		if !bytes.Equal(got, want[off:]) {
+			t.Fatalf("iv %x: restored keystream from %d differs", iv, off)
+		}
+	}
+}
+
+func TestCTR(t *testing.T) {
+	testCTR(t, []byte("0123456789abcdef"))
+}
+
+func TestCTRWrap(t *testing.T) {
+	testCTR(t, bytes.Repeat([]byte{0xff}, 16))
+	testCTR(t, append(bytes.Repeat([]byte{0}, 8), bytes.Repeat([]byte{0xff}, 8)...))
+}
+
+func TestCTRSetStateInvalid(t *testing.T) {
+	block, _ := aes.NewCipher(make([]byte, 16))
+	x := NewCTR(block, make([]byte, 16))
+	x.Seek(100)
+	state := x.GetState()
+
+	for name, s := range map[string][]byte{
+		"empty":          nil,
+		"truncated":      state[:len(state)-1],
+		"trailing bytes": append(append([]byte(nil), state...), 0),
+		"wrong magic":    append([]byte("xxxx"), state[4:]...),
+		"wrong IV size":  append(append([]byte(nil), state[:5]...), append([]byte{8}, state[6:]...)...),
+	} {
+		if err := x.SetState(s); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if x.Offset() != 100 {
+		t.Fatal("failed SetState changed the stream")
+	}
+}
@@ -0,0 +1,210 @@
+// Package streamcipher implements AES-CTR and ChaCha20 streams that can seek
+// to any byte offset and save and restore their position, so encryption of
+// a stream can resume at the same offset as the hashing of it.
+//
+// The states record the IV or nonce and the offset, not the key, which has
+// to be supplied again when restoring.
+package streamcipher
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrInvalidState is returned by SetState when the state is not valid
+	// for the stream.
+	ErrInvalidState = errors.New("streamcipher: invalid state")
+
+	// ErrSeekOutOfRange is returned by Seek for offsets past the end of the
+	// keystream.
+	ErrSeekOutOfRange = errors.New("streamcipher: offset out of range")
+
+	// ErrNotSeekable is returned by Reader.Seek when the underlying reader
+	// is not an io.Seeker.
+	ErrNotSeekable = errors.New("streamcipher: reader is not seekable")
+)
+
+// Stream is a cipher.Stream that knows its offset in the keystream.
+type Stream interface {
+	// XORKeyStream XORs each byte in src with a byte from the keystream,
+	// starting at the current offset, and advances the offset.
+	XORKeyStream(dst, src []byte)
+
+	// Seek moves to offset bytes from the start of the keystream.
+	Seek(offset uint64) error
+
+	// Offset returns the current offset in the keystream.
+	Offset() uint64
+
+	GetState() []byte
+	SetState(state []byte) error
+}
+
+// keystreamBufferSize is the amount of keystream generated at once.
+const keystreamBufferSize = 512
+
+// keystream buffers the output of a block keystream generator and tracks
+// the offset in it.
+type keystream struct {
+	blockSize int
+
+	// generate fills dst, a whole number of blocks, with the keystream
+	// blocks starting at block index.
+	generate func(index uint64, dst []byte)
+
+	// limit is the length of the keystream, or zero if it is unlimited.
+	limit uint64
+
+	buf    []byte
+	used   int
+	offset uint64
+}
+
+func newKeystream(blockSize int, limit uint64, generate func(uint64, []byte)) keystream {
+	n := keystreamBufferSize - keystreamBufferSize%blockSize
+	if n == 0 {
+		n = blockSize
+	}
+
+	return keystream{
+		blockSize: blockSize,
+		generate:  generate,
+		limit:     limit,
+		buf:       make([]byte, 0, n),
+	}
+}
+
+func (k *keystream) seek(offset uint64) error {
+	if k.limit != 0 && offset > k.limit {
+		return ErrSeekOutOfRange
+	}
+
+	k.offset = offset
+	k.buf = k.buf[:0]
+	k.used = 0
+
+	return nil
+}
+
+func (k *keystream) refill() {
+	bs := uint64(k.blockSize)
+	k.buf = k.buf[:cap(k.buf)]
+	k.generate(k.offset/bs, k.buf)
+	k.used = int(k.offset % bs)
+}
+
+func (k *keystream) xor(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("streamcipher: output smaller than input")
+	}
+	if k.limit != 0 && uint64(len(src)) > k.limit-k.offset {
+		panic("streamcipher: keystream exhausted")
+	}
+
+	for len(src) > 0 {
+		if k.used == len(k.buf) {
+			k.refill()
+		}
+		n := subtle.XORBytes(dst, src, k.buf[k.used:])
+		dst = dst[n:]
+		src = src[n:]
+		k.used += n
+		k.offset += uint64(n)
+	}
+}
+
+// Writer encrypts everything written to it with a Stream and writes it to
+// an underlying writer.
+type Writer struct {
+	s   Stream
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter returns a Writer encrypting to w with s.
+func NewWriter(w io.Writer, s Stream) *Writer {
+	return &Writer{s: s, w: w}
+}
+
+// Write encrypts p and writes it to the underlying writer. If that writes
+// fewer bytes, the stream is moved back to right after the bytes written, so
+// that the offset always matches the output.
+func (w *Writer) Write(p []byte) (int, error) {
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	buf := w.buf[:len(p)]
+
+	start := w.s.Offset()
+	w.s.XORKeyStream(buf, p)
+
+	n, err := w.w.Write(buf)
+	if n < len(p) {
+		w.s.Seek(start + uint64(n))
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+	}
+
+	return n, err
+}
+
+// Offset returns the number of bytes written through w since the start of
+// the keystream.
+func (w *Writer) Offset() uint64 { return w.s.Offset() }
+
+// GetState returns the state of the stream of w.
+func (w *Writer) GetState() []byte { return w.s.GetState() }
+
+// SetState restores the stream of w. The underlying writer must be at the
+// matching position.
+func (w *Writer) SetState(state []byte) error { return w.s.SetState(state) }
+
+// Reader decrypts everything read from an underlying reader with a Stream.
+type Reader struct {
+	s Stream
+	r io.Reader
+}
+
+// NewReader returns a Reader decrypting from r with s.
+func NewReader(r io.Reader, s Stream) *Reader {
+	return &Reader{s: s, r: r}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.s.XORKeyStream(p[:n], p[:n])
+	}
+	return n, err
+}
+
+// Seek seeks the underlying reader, which must be an io.Seeker, and moves
+// the stream to the same offset. The offset in the underlying reader must
+// equal the offset in the keystream.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+
+	pos, err := s.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+
+	return pos, r.s.Seek(uint64(pos))
+}
+
+// Offset returns the number of bytes read through r since the start of the
+// keystream.
+func (r *Reader) Offset() uint64 { return r.s.Offset() }
+
+// GetState returns the state of the stream of r.
+func (r *Reader) GetState() []byte { return r.s.GetState() }
+
+// SetState restores the stream of r. The underlying reader must be at the
+// matching position.
+func (r *Reader) SetState(state []byte) error { return r.s.SetState(state) }
@@ -0,0 +1,103 @@
+package streamcipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+func TestWriterResume(t *testing.T) {
+	data := testData(5000)
+	block, _ := aes.NewCipher(make([]byte, 16))
+	iv := make([]byte, 16)
+
+	want := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(want, data)
+
+	var out bytes.Buffer
+	w := NewWriter(&out, NewCTR(block, iv))
+	w.Write(data[:1234])
+	state := w.GetState()
+
+	s, err := NewCTRFromState(block, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = NewWriter(&out, s)
+	w.Write(data[1234:])
+
+	if !bytes.Equal(out.Bytes(), want) || w.Offset() != uint64(len(data)) {
+		t.Fatal("resumed ciphertext differs")
+	}
+}
+
+type shortWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriterShortWrite(t *testing.T) {
+	data := testData(100)
+	x, _ := NewChaCha20(chachaKey, chachaNonce)
+
+	sw := &shortWriter{max: 30}
+	w := NewWriter(sw, x)
+	n, err := w.Write(data)
+	if n != 30 || err != io.ErrShortWrite {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if w.Offset() != 30 {
+		t.Fatalf("offset %d after short write", w.Offset())
+	}
+
+	sw.max = 100
+	w.Write(data[30:])
+
+	x, _ = NewChaCha20(chachaKey, chachaNonce)
+	r := NewReader(bytes.NewReader(sw.Bytes()), x)
+	got, _ := io.ReadAll(r)
+	if !bytes.Equal(got, data) {
+		t.Fatal("round trip after short write differs")
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	data := testData(3000)
+
+	var out bytes.Buffer
+	x, _ := NewChaCha20(chachaKey, chachaNonce)
+	NewWriter(&out, x).Write(data)
+
+	x, _ = NewChaCha20(chachaKey, chachaNonce)
+	r := NewReader(bytes.NewReader(out.Bytes()), x)
+	if _, err := r.Seek(1000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if !bytes.Equal(got, data[1000:]) {
+		t.Fatal("plaintext after Seek differs")
+	}
+
+	r = NewReader(io.MultiReader(&out), x)
+	if _, err := r.Seek(0, io.SeekStart); !errors.Is(err, ErrNotSeekable) {
+		t.Fatalf("Seek on plain reader: err = %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package xxhash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The size of an XXH3-128 checksum in bytes.
+const Size128 = 16
+
+const (
+	prime32_1 = 0x9E3779B1
+	prime32_2 = 0x85EBCA77
+	prime32_3 = 0xC2B2AE3D
+
+	stripeLen        = 64
+	secretSize       = 192
+	secretConsume    = 8
+	stripesPerBlock  = (secretSize - stripeLen) / secretConsume
+	bufferSize       = 256
+	bufferStripes    = bufferSize / stripeLen
+	midSizeMax       = 240
+	secretMergeStart = 11
+	secretLastStart  = 7
+	secretSizeMin    = 136
+)
+
+var defaultSecret = [secretSize]byte{
+	0xb8, 0xfe, 0x6c, 0x39, 0x23, 0xa4, 0x4b, 0xbe, 0x7c, 0x01, 0x81, 0x2c, 0xf7, 0x21, 0xad, 0x1c,
+	0xde, 0xd4, 0x6d, 0xe9, 0x83, 0x90, 0x97, 0xdb, 0x72, 0x40, 0xa4, 0xa4, 0xb7, 0xb3, 0x67, 0x1f,
+	0xcb, 0x79, 0xe6, 0x4e, 0xcc, 0xc0, 0xe5, 0x78, 0x82, 0x5a, 0xd0, 0x7d, 0xcc, 0xff, 0x72, 0x21,
+	0xb8, 0x08, 0x46, 0x74, 0xf7, 0x43, 0x24, 0x8e, 0xe0, 0x35, 0x90, 0xe6, 0x81, 0x3a, 0x26, 0x4c,
+	0x3c, 0x28, 0x52, 0xbb, 0x91, 0xc3, 0x00, 0xcb, 0x88, 0xd0, 0x65, 0x8b, 0x1b, 0x53, 0x2e, 0xa3,
+	0x71, 0x64, 0x48, 0x97, 0xa2, 0x0d, 0xf9, 0x4e, 0x38, 0x19, 0xef, 0x46, 0xa9, 0xde, 0xac, 0xd8,
+	0xa8, 0xfa, 0x76, 0x3f, 0xe3, 0x9c, 0x34, 0x3f, 0xf9, 0xdc, 0xbb, 0xc7, 0xc7, 0x0b, 0x4f, 0x1d,
+	0x8a, 0x51, 0xe0, 0x4b, 0xcd, 0xb4, 0x59, 0x31, 0xc8, 0x9f, 0x7e, 0xc9, 0xd9, 0x78, 0x73, 0x64,
+	0xea, 0xc5, 0xac, 0x83, 0x34, 0xd3, 0xeb, 0xc3, 0xc5, 0x81, 0xa0, 0xff, 0xfa, 0x13, 0x63, 0xeb,
+	0x17, 0x0d, 0xdd, 0x51, 0xb7, 0xf0, 0xda, 0x49, 0xd3, 0x16, 0x55, 0x26, 0x29, 0xd4, 0x68, 0x9e,
+	0x2b, 0x16, 0xbe, 0x58, 0x7d, 0x47, 0xa1, 0xfc, 0x8f, 0xf8, 0xb8, 0xd1, 0x7a, 0xd0, 0x31, 0xce,
+	0x45, 0xcb, 0x3a, 0x8f, 0x95, 0x16, 0x04, 0x28, 0xaf, 0xd7, 0xfb, 0xca, 0xbb, 0x4b, 0x40, 0x7e,
+}
+
+var initialAcc = [8]uint64{
+	prime32_3, prime64_1, prime64_2, prime64_3,
+	prime64_4, prime32_2, prime64_5, prime32_1,
+}
+
+// The XXH3-128 state format is
+//
+//	"bx3h" || version || seed || length || 8 accumulators || pending bytes || lookback
+//
+// with the integers as big-endian uint64. Input is consumed in 256-byte
+// units, so the number of pending bytes follows from the length. Once input
+// has been consumed and fewer than 64 bytes are pending, the final stripe
+// also covers bytes before them, and those are saved as the lookback.
+const (
+	state128Magic   = "bx3h"
+	state128Version = 1
+	state128Header  = len(state128Magic) + 1 + 8 + 8 + 8*8
+)
+
+// Digest128 represents the partial evaluation of an XXH3-128 checksum.
+type Digest128 struct {
+	seed   uint64
+	secret [secretSize]byte
+	acc    [8]uint64
+	buf    [bufferSize]byte
+	nx     int
+	len    uint64
+
+	// stripes is the number of stripes accumulated in the current block.
+	stripes int
+}
+
+// New128 returns a new hash.Hash computing the XXH3-128 checksum with seed 0.
+func New128() *Digest128 {
+	return New128WithSeed(0)
+}
+
+// New128WithSeed returns a new hash.Hash computing the XXH3-128 checksum
+// with the given seed.
+func New128WithSeed(seed uint64) *Digest128 {
+	d := new(Digest128)
+	d.setSeed(seed)
+	d.Reset()
+	return d
+}
+
+// New128FromState returns a new hash.Hash computing the XXH3-128 checksum
+// from existing state.
+func New128FromState(state []byte) *Digest128 {
+	d := New128()
+	d.SetState(state)
+	return d
+}
+
+func (d *Digest128) setSeed(seed uint64) {
+	d.seed = seed
+	d.secret = defaultSecret
+	if seed == 0 {
+		return
+	}
+	for i := 0; i < secretSize; i += 16 {
+		binary.LittleEndian.PutUint64(d.secret[i:], binary.LittleEndian.Uint64(defaultSecret[i:])+seed)
+		binary.LittleEndian.PutUint64(d.secret[i+8:], binary.LittleEndian.Uint64(defaultSecret[i+8:])-seed)
+	}
+}
+
+// Reset resets the digest to its initial state, keeping its seed.
+func (d *Digest128) Reset() {
+	d.acc = initialAcc
+	d.nx = 0
+	d.len = 0
+	d.stripes = 0
+}
+
+func (d *Digest128) Size() int { return Size128 }
+
+func (d *Digest128) BlockSize() int { return stripeLen }
+
+func (d *Digest128) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	d.len += uint64(nn)
+
+	if d.nx+len(p) <= bufferSize {
+		d.nx += copy(d.buf[d.nx:], p)
+		return
+	}
+
+	if d.nx > 0 {
+		n := copy(d.buf[d.nx:], p)
+		d.stripes = consumeStripes(&d.acc, d.buf[:], bufferStripes, d.stripes, &d.secret)
+		d.nx = 0
+		p = p[n:]
+	}
+
+	if len(p) > bufferSize {
+		i := 0
+		for ; len(p)-i > bufferSize; i += bufferSize {
+			d.stripes = consumeStripes(&d.acc, p[i:], bufferStripes, d.stripes, &d.secret)
+		}
+		// Keep the last consumed stripe, which the final stripe may overlap.
+		copy(d.buf[bufferSize-stripeLen:], p[i-stripeLen:i])
+		p = p[i:]
+	}
+
+	d.nx = copy(d.buf[:], p)
+
+	return
+}
+
+// Sum appends the checksum to in in its canonical, big-endian form.
+func (d *Digest128) Sum(in []byte) []byte {
+	hi, lo := d.Sum128()
+	in = binary.BigEndian.AppendUint64(in, hi)
+	return binary.BigEndian.AppendUint64(in, lo)
+}
+
+// Sum128 returns the high and low halves of the current checksum.
+func (d *Digest128) Sum128() (hi, lo uint64) {
+	if d.len <= midSizeMax {
+		return hash128Short(d.buf[:d.nx], d.seed, defaultSecret[:])
+	}
+
+	acc := d.acc
+	lastSecret := d.secret[secretSize-stripeLen-secretLastStart:]
+	if d.nx >= stripeLen {
+		consumeStripes(&acc, d.buf[:], (d.nx-1)/stripeLen, d.stripes, &d.secret)
+		accumulate(&acc, d.buf[d.nx-stripeLen:], lastSecret)
+	} else {
+		var last [stripeLen]byte
+		n := copy(last[:], d.buf[bufferSize-(stripeLen-d.nx):])
+		copy(last[n:], d.buf[:d.nx])
+		accumulate(&acc, last[:], lastSecret)
+	}
+
+	lo = mergeAccs(&acc, d.secret[secretMergeStart:], d.len*prime64_1)
+	hi = mergeAccs(&acc, d.secret[secretSize-64-secretMergeStart:], ^(d.len * prime64_2))
+
+	return hi, lo
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *Digest128) GetState() []byte {
+	lookback := lookbackLen(d.len, d.nx)
+
+	b := make([]byte, 0, state128Header+d.nx+lookback)
+	b = append(b, state128Magic...)
+	b = append(b, state128Version)
+	b = binary.BigEndian.AppendUint64(b, d.seed)
+	b = binary.BigEndian.AppendUint64(b, d.len)
+	for _, v := range d.acc {
+		b = binary.BigEndian.AppendUint64(b, v)
+	}
+	b = append(b, d.buf[:d.nx]...)
+	b = append(b, d.buf[bufferSize-lookback:]...)
+	return b
+}
+
+// SetState restores the digest, including its seed, from state returned by
+// GetState. It returns ErrInvalidState and leaves the digest unchanged if
+// state is not valid.
+func (d *Digest128) SetState(state []byte) error {
+	if len(state) < state128Header || string(state[:len(state128Magic)]) != state128Magic || state[len(state128Magic)] != state128Version {
+		return ErrInvalidState
+	}
+
+	p := state[len(state128Magic)+1:]
+	length := binary.BigEndian.Uint64(p[8:])
+
+	nx := int(length)
+	if length > bufferSize {
+		nx = int((length-1)%bufferSize) + 1
+	}
+	lookback := lookbackLen(length, nx)
+	if len(p) != 16+8*8+nx+lookback {
+		return ErrInvalidState
+	}
+
+	if seed := binary.BigEndian.Uint64(p); seed != d.seed {
+		d.setSeed(seed)
+	}
+	for i := range d.acc {
+		d.acc[i] = binary.BigEndian.Uint64(p[16+i*8:])
+	}
+	p = p[16+8*8:]
+	d.len = length
+	d.nx = copy(d.buf[:], p[:nx])
+	copy(d.buf[bufferSize-lookback:], p[nx:])
+	d.stripes = int((length-uint64(nx))/stripeLen) % stripesPerBlock
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *Digest128) Clone() *Digest128 {
+	c := *d
+	return &c
+}
+
+// lookbackLen returns the number of consumed bytes the final stripe covers.
+func lookbackLen(length uint64, nx int) int {
+	if length > uint64(nx) && nx < stripeLen {
+		return stripeLen - nx
+	}
+	return 0
+}
+
+// consumeStripes accumulates n stripes of p into acc, scrambling acc at the
+// end of each block, and returns the number of stripes accumulated in the
+// current block.
+func consumeStripes(acc *[8]uint64, p []byte, n, stripes int, secret *[secretSize]byte) int {
+	for i := 0; i < n; i++ {
+		accumulate(acc, p[i*stripeLen:], secret[stripes*secretConsume:])
+		stripes++
+		if stripes == stripesPerBlock {
+			scramble(acc, secret[secretSize-stripeLen:])
+			stripes = 0
+		}
+	}
+	return stripes
+}
+
+func accumulate(acc *[8]uint64, p, secret []byte) {
+	for i := 0; i < 8; i++ {
+		v := binary.LittleEndian.Uint64(p[i*8:])
+		k := v ^ binary.LittleEndian.Uint64(secret[i*8:])
+		acc[i^1] += v
+		acc[i] += uint64(uint32(k)) * (k >> 32)
+	}
+}
+
+func scramble(acc *[8]uint64, secret []byte) {
+	for i := range acc {
+		a := acc[i]
+		a ^= a >> 47
+		a ^= binary.LittleEndian.Uint64(secret[i*8:])
+		acc[i] = a * prime32_1
+	}
+}
+
+func mergeAccs(acc *[8]uint64, secret []byte, start uint64) uint64 {
+	h := start
+	for i := 0; i < 4; i++ {
+		h += mulFold64(acc[2*i]^binary.LittleEndian.Uint64(secret[16*i:]), acc[2*i+1]^binary.LittleEndian.Uint64(secret[16*i+8:]))
+	}
+	return avalanche3(h)
+}
+
+func mulFold64(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+func avalanche3(h uint64) uint64 {
+	h ^= h >> 37
+	h *= 0x165667919E3779F9
+	h ^= h >> 32
+	return h
+}
+
+func mix16(p, secret []byte, seed uint64) uint64 {
+	lo := binary.LittleEndian.Uint64(p)
+	hi := binary.LittleEndian.Uint64(p[8:])
+	return mulFold64(lo^(binary.LittleEndian.Uint64(secret)+seed), hi^(binary.LittleEndian.Uint64(secret[8:])-seed))
+}
+
+func mix32(lo, hi uint64, p1, p2, secret []byte, seed uint64) (uint64, uint64) {
+	lo += mix16(p1, secret, seed)
+	lo ^= binary.LittleEndian.Uint64(p2) + binary.LittleEndian.Uint64(p2[8:])
+	hi += mix16(p2, secret[16:], seed)
+	hi ^= binary.LittleEndian.Uint64(p1) + binary.LittleEndian.Uint64(p1[8:])
+	return lo, hi
+}
+
+// hash128Short returns the checksum of inputs of at most midSizeMax bytes,
+// which are hashed without the accumulators.
+func hash128Short(p []byte, seed uint64, secret []byte) (hi, lo uint64) {
+	n := uint64(len(p))
+
+	switch {
+	case n == 0:
+		lo = avalanche64(seed ^ binary.LittleEndian.Uint64(secret[64:]) ^ binary.LittleEndian.Uint64(secret[72:]))
+		hi = avalanche64(seed ^ binary.LittleEndian.Uint64(secret[80:]) ^ binary.LittleEndian.Uint64(secret[88:]))
+		return
+
+	case n <= 3:
+		combinedLo := uint32(p[0])<<16 | uint32(p[n>>1])<<24 | uint32(p[n-1]) | uint32(n)<<8
+		combinedHi := bits.RotateLeft32(bits.ReverseBytes32(combinedLo), 13)
+		flipLo := uint64(binary.LittleEndian.Uint32(secret)^binary.LittleEndian.Uint32(secret[4:])) + seed
+		flipHi := uint64(binary.LittleEndian.Uint32(secret[8:])^binary.LittleEndian.Uint32(secret[12:])) - seed
+		return avalanche64(uint64(combinedHi) ^ flipHi), avalanche64(uint64(combinedLo) ^ flipLo)
+
+	case n <= 8:
+		seed ^= uint64(bits.ReverseBytes32(uint32(seed))) << 32
+		in := uint64(binary.LittleEndian.Uint32(p)) + uint64(binary.LittleEndian.Uint32(p[n-4:]))<<32
+		flip := (binary.LittleEndian.Uint64(secret[16:]) ^ binary.LittleEndian.Uint64(secret[24:])) + seed
+		hi, lo = bits.Mul64(in^flip, prime64_1+n<<2)
+		hi += lo << 1
+		lo ^= hi >> 3
+		lo ^= lo >> 35
+		lo *= 0x9FB21C651E98DF25
+		lo ^= lo >> 28
+		return avalanche3(hi), lo
+
+	case n <= 16:
+		flipLo := (binary.LittleEndian.Uint64(secret[32:]) ^ binary.LittleEndian.Uint64(secret[40:])) - seed
+		flipHi := (binary.LittleEndian.Uint64(secret[48:]) ^ binary.LittleEndian.Uint64(secret[56:])) + seed
+		inLo := binary.LittleEndian.Uint64(p)
+		inHi := binary.LittleEndian.Uint64(p[n-8:])
+		mulHi, mulLo := bits.Mul64(inLo^inHi^flipLo, prime64_1)
+		mulLo += (n - 1) << 54
+		inHi ^= flipHi
+		mulHi += inHi + uint64(uint32(inHi))*(prime32_2-1)
+		mulLo ^= bits.ReverseBytes64(mulHi)
+		hi, lo = bits.Mul64(mulLo, prime64_2)
+		hi += mulHi * prime64_2
+		return avalanche3(hi), avalanche3(lo)
+	}
+
+	lo = n * prime64_1
+	if n <= 128 {
+		if n > 32 {
+			if n > 64 {
+				if n > 96 {
+					lo, hi = mix32(lo, hi, p[48:], p[n-64:], secret[96:], seed)
+				}
+				lo, hi = mix32(lo, hi, p[32:], p[n-48:], secret[64:], seed)
+			}
+			lo, hi = mix32(lo, hi, p[16:], p[n-32:], secret[32:], seed)
+		}
+		lo, hi = mix32(lo, hi, p, p[n-16:], secret, seed)
+	} else {
+		for i := 0; i < 4; i++ {
+			lo, hi = mix32(lo, hi, p[32*i:], p[32*i+16:], secret[32*i:], seed)
+		}
+		lo = avalanche3(lo)
+		hi = avalanche3(hi)
+		for i := 4; i < int(n/32); i++ {
+			lo, hi = mix32(lo, hi, p[32*i:], p[32*i+16:], secret[3+32*(i-4):], seed)
+		}
+		lo, hi = mix32(lo, hi, p[n-16:], p[n-32:], secret[secretSizeMin-17-16:], -seed)
+	}
+
+	return -avalanche3(lo*prime64_1 + hi*prime64_4 + (n-seed)*prime64_2), avalanche3(lo + hi)
+}
+
+// Sum128 returns the XXH3-128 checksum of the data with seed 0, in its
+// canonical, big-endian form.
+func Sum128(data []byte) [Size128]byte {
+	var sum [Size128]byte
+	d := New128()
+	d.Write(data)
+	d.Sum(sum[:0])
+	return sum
+}
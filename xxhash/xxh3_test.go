@@ -0,0 +1,153 @@
+package xxhash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*Digest128)(nil)
+
+// golden128 was generated with the reference xxHash library.
+var golden128 = []struct {
+	n      int
+	seed   uint64
+	digest string
+}{
+	{0, 0, "99aa06d3014798d86001c324468d497f"},
+	{1, 0, "a6cd5e9392000f6ac44bdff4074eecdb"},
+	{3, 0, "656e81c56e41fe02c3489259e968ad9e"},
+	{4, 0, "ab5c3e7474d809db81a65295de8e7dde"},
+	{8, 0, "e4b9dd0b66ff3c50ebabbd0695002ff6"},
+	{9, 0, "82ddc95bc76007671c69c3f04aaed08c"},
+	{16, 0, "ddf6c1254d70f76794eaa17b20756f46"},
+	{17, 0, "263f67af63088041735fe434ded90c3c"},
+	{128, 0, "dd9e5aa9bd51cc9cc6bd21ecc865f29f"},
+	{129, 0, "00433635cf8d872e7f4accb76587485b"},
+	{240, 0, "89e3a0a2ee355d25d10beb4e0599e4b3"},
+	{241, 0, "75f4da43f23cce5a541b19226f0052e8"},
+	{256, 0, "2f433606b2ebce2dff5a1cefade75bb9"},
+	{257, 0, "74a279c1dcf5382a84eb2acdd4c7b1a1"},
+	{1024, 0, "a3da96fbd688736171bee625238addb4"},
+	{1025, 0, "a53cd4fd16206676d9b414f4e1bbf7ad"},
+	{5000, 0, "e814573b3db786c4ed0146266d138bd8"},
+	{0, testSeed, "d142977a2cca554b4ca5176998171787"},
+	{1, testSeed, "e366b8c99a31df50062b185e4e01441a"},
+	{3, testSeed, "193b724faa89416371a5f088b9bf6b14"},
+	{4, testSeed, "3c4be8738c1ca5e5404c0cb400a43f6a"},
+	{8, testSeed, "bf56c6640e9a9197afaac201b17de522"},
+	{9, testSeed, "3a8c395380d19465f7ee6efdb9c11cf0"},
+	{16, testSeed, "4a137456ae19bca0d18214bb29f42e22"},
+	{17, testSeed, "23338edfb58ee008365e7d433a161892"},
+	{128, testSeed, "45e311da6869fa07438e5b999ee88b05"},
+	{129, testSeed, "787d1a402a69ed5af708a9ed675cd916"},
+	{240, testSeed, "0fa12ffa59febd0690fe0de03c6f6cd0"},
+	{241, testSeed, "3dee3a45c8bb9d706ec6d69819587a84"},
+	{256, testSeed, "65191fa647c90a987d6c7e30c068bc59"},
+	{257, testSeed, "8c5b9b9ac906dc30b6866e2350d23af0"},
+	{1024, testSeed, "9515602dc5e20c5cb76cb4813088fe8e"},
+	{1025, testSeed, "5e657b8cf784bff88a4648c470315844"},
+	{5000, testSeed, "2240c55900547d6df9a86cac78470579"},
+}
+
+func TestGolden128(t *testing.T) {
+	for _, g := range golden128 {
+		data := testData(g.n)
+
+		d := New128WithSeed(g.seed)
+		d.Write(data)
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.digest {
+			t.Fatalf("%d bytes, seed %x: %s want %s", g.n, g.seed, got, g.digest)
+		}
+
+		d.Reset()
+		for i := 0; i < len(data); i += 7 {
+			d.Write(data[i:min(i+7, len(data))])
+		}
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.digest {
+			t.Fatalf("piecewise %d bytes, seed %x: %s want %s", g.n, g.seed, got, g.digest)
+		}
+	}
+
+	if got := Sum128(testData(5000)); hex.EncodeToString(got[:]) != "e814573b3db786c4ed0146266d138bd8" {
+		t.Fatalf("Sum128 = %x", got)
+	}
+}
+
+func TestState128(t *testing.T) {
+	data := testData(5000)
+
+	d := New128WithSeed(testSeed)
+	d.Write(data)
+	want := d.Sum(nil)
+
+	// Splits around the buffer size, and after long writes that leave fewer
+	// than a stripe pending, which need the lookback bytes.
+	for _, split := range []int{0, 1, 240, 241, 256, 257, 300, 320, 512, 513, 1024 + 63, 4097, 5000} {
+		d := New128WithSeed(testSeed)
+		d.Write(data[:split])
+
+		r := New128FromState(d.GetState())
+		r.Write(data[split:])
+		if got := r.Sum(nil); !bytes.Equal(got, want) {
+			t.Fatalf("%d: resumed Sum = %x want %x", split, got, want)
+		}
+
+		r = New128FromState(d.GetState())
+		if got, want := r.Sum(nil), d.Sum(nil); !bytes.Equal(got, want) {
+			t.Fatalf("%d: restored Sum = %x want %x", split, got, want)
+		}
+	}
+}
+
+func TestSetStateInvalid128(t *testing.T) {
+	d := New128()
+	d.Write(testData(300))
+	state := d.GetState()
+	want := d.Sum(nil)
+
+	bad := map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:len(state)-1],
+		"trailing bytes":  append(append([]byte(nil), state...), 0),
+		"wrong magic":     append([]byte("xxxx"), state[4:]...),
+		"unknown version": append(append([]byte(state128Magic), 2), state[5:]...),
+	}
+	for name, state := range bad {
+		if err := d.SetState(state); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if !bytes.Equal(d.Sum(nil), want) {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
+
+func TestClone128(t *testing.T) {
+	data := testData(1000)
+
+	d := New128()
+	d.Write(data[:300])
+	c := d.Clone()
+	d.Write(data[300:])
+	c.Write(data[300:500])
+
+	if want := Sum128(data); !bytes.Equal(d.Sum(nil), want[:]) {
+		t.Fatal("original diverged after Clone")
+	}
+	if want := Sum128(data[:500]); !bytes.Equal(c.Sum(nil), want[:]) {
+		t.Fatal("clone checksum mismatch")
+	}
+}
+
+func BenchmarkHash128_8K(b *testing.B) {
+	data := testData(8192)
+	d := New128()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		d.Reset()
+		d.Write(data)
+		d.Sum(nil)
+	}
+}
@@ -0,0 +1,226 @@
+// Package xxhash implements the XXH64 and XXH3-128 non-cryptographic hash
+// functions, with digests whose state can be saved and restored.
+//
+// The checksums are meant for detecting accidental corruption only. Use one
+// of the cryptographic hashes when the data can be chosen by an adversary.
+package xxhash
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// ErrInvalidState is returned by SetState when the state is not valid.
+var ErrInvalidState = errors.New("xxhash: invalid state")
+
+// The size of an XXH64 checksum in bytes.
+const Size64 = 8
+
+const (
+	prime64_1 = 0x9E3779B185EBCA87
+	prime64_2 = 0xC2B2AE3D27D4EB4F
+	prime64_3 = 0x165667B19E3779F9
+	prime64_4 = 0x85EBCA77C2B2AE63
+	prime64_5 = 0x27D4EB2F165667C5
+)
+
+// The XXH64 state format is
+//
+//	"bx64" || version || seed || 4 accumulators || length || pending bytes
+//
+// with the integers as big-endian uint64.
+const (
+	state64Magic   = "bx64"
+	state64Version = 1
+	state64Header  = len(state64Magic) + 1 + 8 + 4*8 + 8
+)
+
+// Digest64 represents the partial evaluation of an XXH64 checksum.
+type Digest64 struct {
+	seed uint64
+	v    [4]uint64
+	x    [32]byte
+	nx   int
+	len  uint64
+}
+
+// New64 returns a new hash.Hash64 computing the XXH64 checksum with seed 0.
+func New64() *Digest64 {
+	return New64WithSeed(0)
+}
+
+// New64WithSeed returns a new hash.Hash64 computing the XXH64 checksum with
+// the given seed.
+func New64WithSeed(seed uint64) *Digest64 {
+	d := &Digest64{seed: seed}
+	d.Reset()
+	return d
+}
+
+// New64FromState returns a new hash.Hash64 computing the XXH64 checksum from
+// existing state.
+func New64FromState(state []byte) *Digest64 {
+	d := New64()
+	d.SetState(state)
+	return d
+}
+
+// Reset resets the digest to its initial state, keeping its seed.
+func (d *Digest64) Reset() {
+	d.v[0] = d.seed + prime64_1 + prime64_2
+	d.v[1] = d.seed + prime64_2
+	d.v[2] = d.seed
+	d.v[3] = d.seed - prime64_1
+	d.nx = 0
+	d.len = 0
+}
+
+func (d *Digest64) Size() int { return Size64 }
+
+func (d *Digest64) BlockSize() int { return 32 }
+
+func (d *Digest64) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	d.len += uint64(nn)
+
+	if d.nx+len(p) < 32 {
+		d.nx += copy(d.x[d.nx:], p)
+		return
+	}
+
+	if d.nx > 0 {
+		n := copy(d.x[d.nx:], p)
+		d.block(d.x[:])
+		d.nx = 0
+		p = p[n:]
+	}
+
+	for len(p) >= 32 {
+		d.block(p[:32])
+		p = p[32:]
+	}
+
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+
+	return
+}
+
+func (d *Digest64) block(p []byte) {
+	d.v[0] = round64(d.v[0], binary.LittleEndian.Uint64(p))
+	d.v[1] = round64(d.v[1], binary.LittleEndian.Uint64(p[8:]))
+	d.v[2] = round64(d.v[2], binary.LittleEndian.Uint64(p[16:]))
+	d.v[3] = round64(d.v[3], binary.LittleEndian.Uint64(p[24:]))
+}
+
+// Sum appends the checksum to in in its canonical, big-endian form.
+func (d *Digest64) Sum(in []byte) []byte {
+	return binary.BigEndian.AppendUint64(in, d.Sum64())
+}
+
+// Sum64 returns the current checksum.
+func (d *Digest64) Sum64() uint64 {
+	var h uint64
+
+	if d.len >= 32 {
+		h = bits.RotateLeft64(d.v[0], 1) + bits.RotateLeft64(d.v[1], 7) +
+			bits.RotateLeft64(d.v[2], 12) + bits.RotateLeft64(d.v[3], 18)
+		for _, v := range d.v {
+			h = mergeRound64(h, v)
+		}
+	} else {
+		h = d.v[2] + prime64_5
+	}
+
+	h += d.len
+
+	p := d.x[:d.nx]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= round64(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*prime64_1 + prime64_4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * prime64_1
+		h = bits.RotateLeft64(h, 23)*prime64_2 + prime64_3
+		p = p[4:]
+	}
+	for _, b := range p {
+		h ^= uint64(b) * prime64_5
+		h = bits.RotateLeft64(h, 11) * prime64_1
+	}
+
+	return avalanche64(h)
+}
+
+// GetState returns the state of the digest, to be restored by SetState.
+func (d *Digest64) GetState() []byte {
+	b := make([]byte, 0, state64Header+d.nx)
+	b = append(b, state64Magic...)
+	b = append(b, state64Version)
+	b = binary.BigEndian.AppendUint64(b, d.seed)
+	for _, v := range d.v {
+		b = binary.BigEndian.AppendUint64(b, v)
+	}
+	b = binary.BigEndian.AppendUint64(b, d.len)
+	b = append(b, d.x[:d.nx]...)
+	return b
+}
+
+// SetState restores the digest, including its seed, from state returned by
+// GetState. It returns ErrInvalidState and leaves the digest unchanged if
+// state is not valid.
+func (d *Digest64) SetState(state []byte) error {
+	if len(state) < state64Header || string(state[:len(state64Magic)]) != state64Magic || state[len(state64Magic)] != state64Version {
+		return ErrInvalidState
+	}
+
+	p := state[len(state64Magic)+1:]
+	length := binary.BigEndian.Uint64(p[40:])
+	if uint64(len(p)-48) != length%32 {
+		return ErrInvalidState
+	}
+
+	d.seed = binary.BigEndian.Uint64(p)
+	for i := range d.v {
+		d.v[i] = binary.BigEndian.Uint64(p[8+i*8:])
+	}
+	d.len = length
+	d.nx = copy(d.x[:], p[48:])
+
+	return nil
+}
+
+// Clone returns a copy of d that can be written to and summed independently.
+func (d *Digest64) Clone() *Digest64 {
+	c := *d
+	return &c
+}
+
+func round64(acc, input uint64) uint64 {
+	acc += input * prime64_2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime64_1
+}
+
+func mergeRound64(acc, v uint64) uint64 {
+	acc ^= round64(0, v)
+	return acc*prime64_1 + prime64_4
+}
+
+func avalanche64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= prime64_2
+	h ^= h >> 29
+	h *= prime64_3
+	h ^= h >> 32
+	return h
+}
+
+// Sum64 returns the XXH64 checksum of the data with seed 0.
+func Sum64(data []byte) uint64 {
+	d := New64()
+	d.Write(data)
+	return d.Sum64()
+}
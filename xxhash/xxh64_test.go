@@ -0,0 +1,156 @@
+package xxhash
+
+import (
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash64 = (*Digest64)(nil)
+
+// testSeed is 2^64 divided by the golden ratio, odd and with both halves set.
+const testSeed = 0x9E3779B97F4A7C15
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+// golden64 was generated with the reference xxHash library.
+var golden64 = []struct {
+	n      int
+	seed   uint64
+	digest string
+}{
+	{0, 0, "ef46db3751d8e999"},
+	{1, 0, "e934a84adb052768"},
+	{3, 0, "9ff70a635a6209ab"},
+	{4, 0, "ae5acdc00a55ac41"},
+	{8, 0, "87116b3365b924eb"},
+	{9, 0, "340667a92c4324ff"},
+	{16, 0, "ed1dd2fac0a31fbc"},
+	{17, 0, "758409c57cd5d0a2"},
+	{128, 0, "6bd66a757cf20d64"},
+	{129, 0, "3fbc5a0162d80206"},
+	{240, 0, "9f17f1fcbcbfb88e"},
+	{241, 0, "06f9e01b26bb1786"},
+	{256, 0, "2104991804ccea01"},
+	{257, 0, "3631eb755a154ed2"},
+	{1024, 0, "8dbee03b461b9097"},
+	{1025, 0, "98b00251c469ae8a"},
+	{5000, 0, "3434b44bd6cba68b"},
+	{0, testSeed, "c4349fc93c010000"},
+	{1, testSeed, "126bb57a12364aa5"},
+	{3, testSeed, "d169d7c1cb5e443f"},
+	{4, testSeed, "aeec91bdfd4f8a43"},
+	{8, testSeed, "cfcfd09b165b3edb"},
+	{9, testSeed, "b30637b5499761ed"},
+	{16, testSeed, "d4464228f8b0e4fe"},
+	{17, testSeed, "2918ea6dc26be77c"},
+	{128, testSeed, "d50fb36b5a3d7f7b"},
+	{129, testSeed, "a0e4aca7d8eb3cd3"},
+	{240, testSeed, "3b5c3bc7edac3a90"},
+	{241, testSeed, "ffa02445b6805e71"},
+	{256, testSeed, "8482989eacca254a"},
+	{257, testSeed, "4e27f4ac84390fbb"},
+	{1024, testSeed, "fd184dd7c57e96fa"},
+	{1025, testSeed, "c6dd20fea5e012cd"},
+	{5000, testSeed, "bbb598fbf5ebd69e"},
+}
+
+func TestGolden64(t *testing.T) {
+	for _, g := range golden64 {
+		data := testData(g.n)
+
+		d := New64WithSeed(g.seed)
+		d.Write(data)
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.digest {
+			t.Fatalf("%d bytes, seed %x: %s want %s", g.n, g.seed, got, g.digest)
+		}
+
+		d.Reset()
+		for i := range data {
+			d.Write(data[i : i+1])
+		}
+		if got := hex.EncodeToString(d.Sum(nil)); got != g.digest {
+			t.Fatalf("byte-wise %d bytes, seed %x: %s want %s", g.n, g.seed, got, g.digest)
+		}
+	}
+
+	if got := Sum64(testData(5000)); got != 0x3434b44bd6cba68b {
+		t.Fatalf("Sum64 = %x", got)
+	}
+}
+
+func TestState64(t *testing.T) {
+	data := testData(1000)
+
+	d := New64WithSeed(testSeed)
+	d.Write(data)
+	want := d.Sum64()
+
+	for _, split := range []int{0, 1, 31, 32, 33, 100, 999, 1000} {
+		d := New64WithSeed(testSeed)
+		d.Write(data[:split])
+
+		r := New64FromState(d.GetState())
+		r.Write(data[split:])
+		if got := r.Sum64(); got != want {
+			t.Fatalf("%d: resumed Sum64 = %x want %x", split, got, want)
+		}
+	}
+}
+
+func TestSetStateInvalid64(t *testing.T) {
+	d := New64()
+	d.Write(testData(100))
+	state := d.GetState()
+	want := d.Sum64()
+
+	bad := map[string][]byte{
+		"empty":           nil,
+		"truncated":       state[:len(state)-1],
+		"trailing bytes":  append(append([]byte(nil), state...), 0),
+		"wrong magic":     append([]byte("xxxx"), state[4:]...),
+		"unknown version": append(append([]byte(state64Magic), 2), state[5:]...),
+	}
+	for name, state := range bad {
+		if err := d.SetState(state); err != ErrInvalidState {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if d.Sum64() != want {
+		t.Fatal("failed SetState changed the digest")
+	}
+}
+
+func TestClone64(t *testing.T) {
+	data := testData(1000)
+
+	d := New64()
+	d.Write(data[:300])
+	c := d.Clone()
+	d.Write(data[300:])
+	c.Write(data[300:500])
+
+	if d.Sum64() != Sum64(data) {
+		t.Fatal("original diverged after Clone")
+	}
+	if c.Sum64() != Sum64(data[:500]) {
+		t.Fatal("clone checksum mismatch")
+	}
+}
+
+func BenchmarkHash64_8K(b *testing.B) {
+	data := testData(8192)
+	d := New64()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		d.Reset()
+		d.Write(data)
+		d.Sum64()
+	}
+}